@@ -0,0 +1,181 @@
+package plotthread
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Plot header and representation IDs are hashes of their JSON encoding. The encoders below write
+// that encoding with the fields in an explicitly specified order and escaping so IDs don't depend on
+// encoding/json's implementation details. The output matches what encoding/json emitted when the
+// thread launched and must never change.
+
+// Static representation fields
+var txTime []byte = []byte(`{"time":`)
+var txNonce []byte = []byte(`,"nonce":`)
+var txFrom []byte = []byte(`,"from":`)
+var txTo []byte = []byte(`,"to":`)
+var txMemo []byte = []byte(`,"memo":`)
+var txRefers []byte = []byte(`,"refers":"`)
+var txContentHash []byte = []byte(`,"content_hash":"`)
+var txMatures []byte = []byte(`,"matures":`)
+var txExpires []byte = []byte(`,"expires":`)
+var txSeries []byte = []byte(`,"series":`)
+var txEnd []byte = []byte("}")
+
+const canonicalHexDigits = "0123456789abcdef"
+
+// The pinned golang.org/x/crypto/sha3 absorbs each full block of input through a pointer to an array
+// of its largest block size. Encodings hashed with it keep this much spare capacity so that pointer
+// never runs past the end of their allocation, which the race detector's checkptr rejects
+const sha3BlockSlack = 168 - 136 // largest rate less SHA3-256's
+
+// Return the canonical encoding of a plot header used to compute its ID
+func encodePlotHeaderCanonical(header *PlotHeader) []byte {
+	buf := make([]byte, 0, len(hdrPrevious)+len(hdrHashListRoot)+len(hdrTime)+len(hdrTarget)+
+		len(hdrThreadWork)+len(hdrNonce)+len(hdrHeight)+len(hdrRepresentationCount)+len(hdrEnd)+
+		4*64+3*20+11+sha3BlockSlack)
+	buf = append(buf, hdrPrevious...)
+	buf = appendHex(buf, header.Previous[:])
+	buf = append(buf, hdrHashListRoot...)
+	buf = appendHex(buf, header.HashListRoot[:])
+	buf = append(buf, hdrTime...)
+	buf = strconv.AppendInt(buf, header.Time, 10)
+	buf = append(buf, hdrTarget...)
+	buf = appendHex(buf, header.Target[:])
+	buf = append(buf, hdrThreadWork...)
+	buf = appendHex(buf, header.ThreadWork[:])
+	buf = append(buf, hdrNonce...)
+	buf = strconv.AppendInt(buf, header.Nonce, 10)
+	buf = append(buf, hdrHeight...)
+	buf = strconv.AppendInt(buf, header.Height, 10)
+	buf = append(buf, hdrRepresentationCount...)
+	buf = strconv.AppendInt(buf, int64(header.RepresentationCount), 10)
+	return append(buf, hdrEnd...)
+}
+
+// Return the canonical encoding of a representation used to compute its ID.
+// The signature is never included
+func encodeRepresentationCanonical(tx *Representation) []byte {
+	buf := make([]byte, 0, 256+len(tx.Memo)+sha3BlockSlack)
+	return withSHA3Slack(appendRepresentationCanonical(buf, tx))
+}
+
+// Return buf with at least sha3BlockSlack bytes of spare capacity
+func withSHA3Slack(buf []byte) []byte {
+	if cap(buf)-len(buf) >= sha3BlockSlack {
+		return buf
+	}
+	grown := make([]byte, len(buf), len(buf)+sha3BlockSlack)
+	copy(grown, buf)
+	return grown
+}
+
+// Append the canonical encoding of a representation to buf
+func appendRepresentationCanonical(buf []byte, tx *Representation) []byte {
+	buf = append(buf, txTime...)
+	buf = strconv.AppendInt(buf, tx.Time, 10)
+	buf = append(buf, txNonce...)
+	buf = strconv.AppendInt(buf, int64(tx.Nonce), 10)
+	buf = append(buf, txFrom...)
+	buf = appendBase64(buf, tx.From)
+	buf = append(buf, txTo...)
+	buf = appendBase64(buf, tx.To)
+	if len(tx.Memo) != 0 {
+		buf = append(buf, txMemo...)
+		buf = appendCanonicalString(buf, tx.Memo)
+	}
+	if tx.Refers != nil {
+		buf = append(buf, txRefers...)
+		buf = appendHex(buf, tx.Refers[:])
+		buf = append(buf, '"')
+	}
+	if tx.ContentHash != nil {
+		buf = append(buf, txContentHash...)
+		buf = appendHex(buf, tx.ContentHash[:])
+		buf = append(buf, '"')
+	}
+	if tx.Matures != 0 {
+		buf = append(buf, txMatures...)
+		buf = strconv.AppendInt(buf, tx.Matures, 10)
+	}
+	if tx.Expires != 0 {
+		buf = append(buf, txExpires...)
+		buf = strconv.AppendInt(buf, tx.Expires, 10)
+	}
+	buf = append(buf, txSeries...)
+	buf = strconv.AppendInt(buf, tx.Series, 10)
+	return append(buf, txEnd...)
+}
+
+// Append the lowercase hex encoding of b
+func appendHex(buf, b []byte) []byte {
+	n := len(buf)
+	buf = append(buf, make([]byte, hex.EncodedLen(len(b)))...)
+	hex.Encode(buf[n:], b)
+	return buf
+}
+
+// Append b as a quoted standard base64 string or null if it's nil
+func appendBase64(buf, b []byte) []byte {
+	if b == nil {
+		return append(buf, "null"...)
+	}
+	buf = append(buf, '"')
+	n := len(buf)
+	buf = append(buf, make([]byte, base64.StdEncoding.EncodedLen(len(b)))...)
+	base64.StdEncoding.Encode(buf[n:], b)
+	return append(buf, '"')
+}
+
+// Append s as a quoted string. Quotes, backslashes and \n, \r and \t are escaped with a backslash.
+// Other control characters, <, >, &, U+2028 and U+2029 are escaped as \u00XX or \u20XX. Invalid UTF-8
+// is replaced with \ufffd
+func appendCanonicalString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				buf = append(buf, '\\', b)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', canonicalHexDigits[b>>4], canonicalHexDigits[b&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		if c == '\u2028' || c == '\u2029' {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', canonicalHexDigits[c&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf = append(buf, s[start:]...)
+	return append(buf, '"')
+}
@@ -0,0 +1,109 @@
+package plotthread
+
+import (
+	"encoding/json"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/sha3"
+)
+
+func TestCanonicalEncodingGenesis(t *testing.T) {
+	plot, id, err := LoadGenesisPlot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// these bytes are what the thread's IDs commit to. they must never change
+	header := `{"previous":"0000000000000000000000000000000000000000000000000000000000000000",` +
+		`"hash_list_root":"0341c97248a3a2d424671b115756b25a3e74df741087fc95cafed3d7decfb10f",` +
+		`"time":1718344737,"target":"0000000ffff00000000000000000000000000000000000000000000000000000",` +
+		`"thread_work":"0000000000000000000000000000000000000000000000000000000010001000",` +
+		`"nonce":437623675131838,"height":0,"representation_count":1}`
+	plotroot := `{"time":1718344707,"nonce":1440562862,"from":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",` +
+		`"to":"/harvest00000000000000000000000000000000000=","memo":"Unless a grain of wheat falls into the ` +
+		`earth and dies, it remains alone. But if it dies, it produces much grain and yields a harvest.",` +
+		`"series":1}`
+
+	if encoded := string(encodePlotHeaderCanonical(plot.Header)); encoded != header {
+		t.Fatalf("Genesis header encoding changed:\n%s\nexpected:\n%s", encoded, header)
+	}
+	if PlotID(sha3.Sum256([]byte(header))) != id {
+		t.Fatal("Genesis plot ID doesn't match the hash of its canonical encoding")
+	}
+	if encoded := string(encodeRepresentationCanonical(plot.Representations[0])); encoded != plotroot {
+		t.Fatalf("Genesis plotroot encoding changed:\n%s\nexpected:\n%s", encoded, plotroot)
+	}
+	txID, err := plot.Representations[0].ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if RepresentationID(sha3.Sum256([]byte(plotroot))) != txID {
+		t.Fatal("Genesis plotroot ID doesn't match the hash of its canonical encoding")
+	}
+}
+
+func TestCanonicalEncodingMatchesJSON(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey2, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refers := RepresentationID{0x01, 0x02}
+	contentHash := ContentHash{0x03, 0x04}
+
+	txs := []*Representation{
+		NewRepresentation(pubKey, pubKey2, 0, 0, 0, ""),
+		NewRepresentation(pubKey, pubKey2, 10, 20, 30, "hello"),
+		NewRepresentation(nil, pubKey2, 0, 0, 0, "no sender"),
+		NewRepresentation(pubKey, pubKey2, 0, 0, 0, "こんにちは \"quoted\" back\\slash\n\r\t<a href=x>&</a>\x01  "),
+		{Time: -1, Nonce: -2, From: pubKey, To: pubKey2, Matures: -3, Series: -4},
+		{From: ed25519.PublicKey{}, To: pubKey2, Refers: &refers, ContentHash: &contentHash, Series: 1},
+	}
+	for i, tx := range txs {
+		if err := tx.Sign(privKey); err != nil {
+			t.Fatal(err)
+		}
+		txCopy := *tx
+		txCopy.Signature = nil
+		expected, err := json.Marshal(txCopy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded := encodeRepresentationCanonical(tx)
+		if string(encoded) != string(expected) {
+			t.Fatalf("Representation %d encoded as:\n%s\nexpected:\n%s", i, encoded, expected)
+		}
+		if cap(encoded)-len(encoded) < sha3BlockSlack {
+			t.Fatalf("Representation %d encoded with %d bytes to spare", i, cap(encoded)-len(encoded))
+		}
+	}
+
+	plot, err := makeTestPlot(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plot.Header.Time, plot.Header.Nonce, plot.Header.Height = -1, -2, 1<<40
+	expected, err := json.Marshal(plot.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := encodePlotHeaderCanonical(plot.Header)
+	if string(encoded) != string(expected) {
+		t.Fatalf("Header encoded as:\n%s\nexpected:\n%s", encoded, expected)
+	}
+	if cap(encoded)-len(encoded) < sha3BlockSlack {
+		t.Fatalf("Header encoded with %d bytes to spare", cap(encoded)-len(encoded))
+	}
+
+	// newer versions of encoding/json escape these differently. the canonical encoding doesn't change
+	if encoded := string(appendCanonicalString(nil, "\b\f")); encoded != `"\u0008\u000c"` {
+		t.Fatalf("Expected control characters to be escaped as \\u00XX, found: %s", encoded)
+	}
+	if encoded := string(appendCanonicalString(nil, "invalid \xff utf8")); encoded != `"invalid \ufffd utf8"` {
+		t.Fatalf("Expected invalid utf8 to be escaped as \\ufffd, found: %s", encoded)
+	}
+}
@@ -3,9 +3,9 @@ package main
 import (
 	"bufio"
 	"encoding/base64"
-	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
@@ -40,7 +40,19 @@ func main() {
 	tlsCertPtr := flag.String("tlscert", "", "Path to a file containing a PEM-encoded X.509 certificate to use with TLS")
 	tlsKeyPtr := flag.String("tlskey", "", "Path to a file containing a PEM-encoded private key to use with TLS")
 	inLimitPtr := flag.Int("inlimit", MAX_INBOUND_PEER_CONNECTIONS, "Limit for the number of inbound peer connections.")
+	outLimitPtr := flag.Int("outlimit", MAX_OUTBOUND_PEER_CONNECTIONS, "Number of outbound peer connections to maintain")
 	banListPtr := flag.String("banlist", "", "Path to a file containing a list of banned host addresses")
+	idleWaitPtr := flag.Duration("idlewait", 0, "How long to wait for representations to confirm before scribing a plot without any (0 never waits)")
+	fairPtr := flag.Bool("fair", false, "Select representations to scribe round-robin across senders")
+	maxFilterSizePtr := flag.Int("maxfiltersize", DEFAULT_MAX_FILTER_SIZE, "Maximum size in bytes of a representation filter a peer may load")
+	slowPlotPtr := flag.Duration("slowplot", DEFAULT_SLOW_PLOT_THRESHOLD*time.Second, "Log the time spent in each phase of processing plots taking longer than this")
+	poolKeyFilePtr := flag.String("poolkeyfile", "", "Path to a file containing a private key with which to attest to work sent to scribing peers")
+	priorityAgingPtr := flag.Duration("priorityaging", 0, "How long a representation waits to move up a round when selecting fairly across senders (0 disables)")
+	requeueWindowPtr := flag.Duration("requeuewindow", 0, "How long a representation evicted from the queue keeps its place if pushed again (0 disables)")
+	staleTipPtr := flag.Float64("staletip", DEFAULT_STALE_TIP_MULTIPLE, "Multiple of the target spacing without a new plot after which to warn and resync with peers (0 disables)")
+	congestionPtr := flag.Bool("congestion", false, "Limit how many representations each sender may queue as the queue fills")
+	reorgLogPtr := flag.Int("reorglog", DEFAULT_REORG_LOG_SIZE, "Number of recent main thread reorganizations to keep for diagnostics (0 disables)")
+	requireRefersPtr := flag.Bool("requirerefers", false, "Only queue representations whose referenced representation is confirmed")
 	flag.Parse()
 
 	if len(*dataDirPtr) == 0 {
@@ -106,12 +118,7 @@ func main() {
 	// }
 
 	// load genesis plot
-	genesisPlot := new(Plot)
-	if err := json.Unmarshal([]byte(GenesisPlotJson), genesisPlot); err != nil {
-		log.Fatal(err)
-	}
-
-	genesisID, err := genesisPlot.ID()
+	genesisPlot, genesisID, err := LoadGenesisPlot()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -150,9 +157,24 @@ func main() {
 
 	// instantiate the representation queue
 	txQueue := NewRepresentationQueueMemory(ledger)
+	txQueue.SetSenderFairness(*fairPtr)
+	txQueue.SetPriorityAging(*priorityAgingPtr)
+	txQueue.SetRequeueWindow(*requeueWindowPtr)
+	if *congestionPtr {
+		txQueue.SetCongestionCurve(&DefaultCongestionCurve)
+	}
+
+	// restore any representations queued at the last shutdown
+	queueFile := filepath.Join(*dataDirPtr, "queue.json")
+	if err := loadQueueSnapshot(txQueue, ledger, queueFile); err != nil {
+		log.Printf("Failed to load representation queue snapshot, starting with an empty queue: %s\n", err)
+	}
 
 	// create and run the processor
 	processor := NewProcessor(genesisID, plotStore, txQueue, ledger)
+	processor.SetRequireRefers(*requireRefersPtr)
+	processor.SetSlowPlotThreshold(*slowPlotPtr)
+	processor.SetReorgLogSize(*reorgLogPtr)
 	processor.Run()
 
 	// process the genesis plot
@@ -174,6 +196,7 @@ func main() {
 		// create and run scribers
 		for i := 0; i < *numScribersPtr; i++ {
 			scriber := NewScriber(pubKeys, *memoPtr, plotStore, txQueue, ledger, processor, hashUpdateChan, i)
+			scriber.SetIdleWait(*idleWaitPtr)
 			scribers = append(scribers, scriber)
 			scriber.Run()
 		}
@@ -208,8 +231,27 @@ func main() {
 	peerManager := NewPeerManager(genesisID, peerStore, plotStore, ledger, processor, indexer, txQueue,
 		*dataDirPtr, myExternalIP, *peerPtr, *tlsCertPtr, *tlsKeyPtr,
 		*portPtr, *inLimitPtr, !*noAcceptPtr, !*noIrcPtr, *dnsSeedPtr, banMap)
+	peerManager.SetMaxFilterSize(*maxFilterSizePtr)
+	peerManager.SetOutboundLimit(*outLimitPtr)
+	if len(*poolKeyFilePtr) != 0 {
+		poolKey, err := loadPoolKey(*poolKeyFilePtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		peerManager.SetPoolKey(poolKey)
+	}
 	peerManager.Run()
 
+	// watch for the tip going stale
+	var watchdog *TipWatchdog
+	if *staleTipPtr > 0 {
+		watchdog = NewTipWatchdog(processor, ledger, *staleTipPtr,
+			func(tipID *PlotID, height int64, since time.Duration) {
+				peerManager.Resync()
+			})
+		watchdog.Run()
+	}
+
 	// shutdown on ctrl-c
 	c := make(chan os.Signal, 1)
 	done := make(chan struct{})
@@ -232,6 +274,9 @@ func main() {
 		}
 
 		// shut everything down now
+		if watchdog != nil {
+			watchdog.Shutdown()
+		}
 		peerManager.Shutdown()
 		if seeder != nil {
 			seeder.Shutdown()
@@ -246,6 +291,11 @@ func main() {
 		indexer.Shutdown()
 		processor.Shutdown()
 
+		// save the representation queue for the next startup
+		if err := saveQueueSnapshot(txQueue, queueFile); err != nil {
+			log.Println(err)
+		}
+
 		// close storage
 		if err := peerStore.Close(); err != nil {
 			log.Println(err)
@@ -263,6 +313,46 @@ func main() {
 	log.Println("Exiting")
 }
 
+func loadQueueSnapshot(txQueue *RepresentationQueueMemory, ledger Ledger, queueFile string) error {
+	file, err := os.Open(queueFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	tipID, tipHeight, err := ledger.GetThreadTip()
+	if err != nil {
+		return err
+	}
+	if tipID == nil {
+		// nothing has been connected yet
+		return nil
+	}
+	if err := txQueue.LoadSnapshot(file, tipHeight); err != nil {
+		return err
+	}
+	log.Printf("Loaded %d queued representations\n", txQueue.Len())
+
+	// don't load it again after a crash. it's written anew at shutdown
+	file.Close()
+	return os.Remove(queueFile)
+}
+
+func saveQueueSnapshot(txQueue *RepresentationQueueMemory, queueFile string) error {
+	file, err := os.Create(queueFile)
+	if err != nil {
+		return err
+	}
+	if err := txQueue.SaveSnapshot(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
 func loadPublicKeys(pubKeyEncoded, keyFile string) ([]ed25519.PublicKey, error) {
 	var pubKeysEncoded []string
 	var pubKeys []ed25519.PublicKey
@@ -300,6 +390,21 @@ func loadPublicKeys(pubKeyEncoded, keyFile string) ([]ed25519.PublicKey, error)
 	return pubKeys, nil
 }
 
+func loadPoolKey(keyFile string) (ed25519.PrivateKey, error) {
+	keyEncoded, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(keyEncoded)))
+	if err != nil {
+		return nil, err
+	}
+	if len(keyBytes) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("Invalid private key in '%s'", keyFile)
+	}
+	return ed25519.PrivateKey(keyBytes), nil
+}
+
 func loadBanList(banListFile string) (map[string]bool, error) {
 	file, err := os.Open(banListFile)
 	if err != nil {
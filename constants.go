@@ -34,7 +34,9 @@ const MAX_REPRESENTATIONS_PER_PLOT_EXCEEDED_AT_HEIGHT = 1852032 // pre-calculate
 
 const PLOTS_UNTIL_NEW_SERIES = 1008 // 1 week in plots
 
-const MAX_MEMO_LENGTH = 200 // bytes (ascii/utf8 only)
+const DEFAULT_REORG_LOG_SIZE = 100 // main thread reorganizations kept for diagnostics
+
+const MAX_MEMO_LENGTH = 200 // bytes (ascii/utf8 only). the default for ThreadParams.MaxMemoLength
 
 // given our JSON protocol we should respect Javascript's Number.MAX_SAFE_INTEGER value
 const MAX_NUMBER int64 = 1<<53 - 1
@@ -42,6 +44,10 @@ const MAX_NUMBER int64 = 1<<53 - 1
 // height at which we switch from bitcoin's difficulty adjustment algorithm to bitcoin cash's algorithm
 const BITCOIN_CASH_RETARGET_ALGORITHM_HEIGHT = 28861
 
+// plot height from which refers and content_hash are valid. the default for ThreadParams.ReferencesHeight.
+// it's unscheduled: a release sets it far enough past the tip for the network to upgrade first
+const REFERENCES_ACTIVATION_HEIGHT = MAX_NUMBER
+
 // the below values only affect peering behavior and do not affect ledger consensus
 
 const DEFAULT_PLOTTHREAD_PORT = 8832
@@ -56,9 +62,42 @@ const MAX_TIP_AGE = (24 * 7) * 60 * 60 //1 week to be lenient on amateur threads
 
 const MAX_PROTOCOL_MESSAGE_LENGTH = 2 * 1024 * 1024 // doesn't apply to plots
 
+const MAX_REPRESENTATIONS_PER_PUSH = 1000
+
+const DEFAULT_MAX_FILTER_SIZE = 1 << 16 // bytes
+
+const MAX_WORK_PUBLIC_KEYS = 256
+
+const DEFAULT_SLOW_PLOT_THRESHOLD = 5 // seconds
+
+const PROPAGATION_STATS_WINDOW = 144 // plots
+
+const MAX_ORPHAN_PLOTS = 100 // plots held while waiting for their parent
+
+const MAX_ORPHAN_PLOTS_PER_SOURCE = 20 // orphan plots held from any one peer
+
+const MAX_ORPHAN_HEIGHT_DISTANCE = 100 // plots. orphans further from our tip are dropped
+
+const MAX_PROPAGATION_DELAY = 2 * 60 * 60 // seconds. plots seen later were synced, not relayed
+
+const DEFAULT_STALE_TIP_MULTIPLE = 6 // of the target spacing
+
+const MAX_GRAPH_PATH_VISITS = 1 << 20 // nodes searched before giving up on a path
+
+const HASHRATE_WINDOW = 5 * 60 // seconds
+
+const MAX_DRAIN_PLOT_WORK = 1 << 24 // expected hashes. draining into a harder plot is refused
+
+const RANK_PROGRESS_INTERVAL = 10 // ranking iterations between progress logs
+
+const NEW_NODES_HISTORY = 4 * PLOTS_UNTIL_NEW_SERIES // plots whose new node counts the indexer keeps. ~4 weeks
+
 // the below values are scribing policy and also do not affect ledger consensus
 
 // if you change this it needs to be less than the maximum at the current height
 const MAX_REPRESENTATIONS_TO_INCLUDE_PER_PLOT = INITIAL_MAX_REPRESENTATIONS_PER_PLOT
 
 const MAX_REPRESENTATION_QUEUE_LENGTH = MAX_REPRESENTATIONS_TO_INCLUDE_PER_PLOT * 10
+
+// the longest chain of queued representations each spending what the previous one sent
+const MAX_REPRESENTATION_CHAIN_DEPTH = 25
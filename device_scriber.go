@@ -0,0 +1,32 @@
+package plotthread
+
+// DeviceScriber searches for a solving nonce on a device such as a GPU. Devices don't return hashes,
+// only a nonce which may solve the header. The PlotHeaderHasher double-checks it on the CPU.
+type DeviceScriber interface {
+	// Prepare is called with the serialized header whenever it changes. The nonce is encoded at
+	// buffer[nonceOffset:nonceOffset+nonceLen]. It returns the number of nonces each call to Scribe tries.
+	Prepare(buffer []byte, bufLen, nonceOffset, nonceLen int, target PlotID) int64
+
+	// Scribe tries nonces starting from startNonce and returns one whose hash may be at or below
+	// the target if found.
+	Scribe(startNonce int64) (nonce int64, found bool)
+}
+
+// NoopDeviceScriber is a DeviceScriber which never finds a solution. It's used to exercise the
+// device path without a device.
+type NoopDeviceScriber struct {
+	HashesPerAttempt int64 // nonces each call to Scribe claims to try. at least 1
+}
+
+// Prepare implements the DeviceScriber interface.
+func (d NoopDeviceScriber) Prepare(buffer []byte, bufLen, nonceOffset, nonceLen int, target PlotID) int64 {
+	if d.HashesPerAttempt < 1 {
+		return 1
+	}
+	return d.HashesPerAttempt
+}
+
+// Scribe implements the DeviceScriber interface.
+func (d NoopDeviceScriber) Scribe(startNonce int64) (int64, bool) {
+	return 0, false
+}
@@ -1,5 +1,10 @@
 package plotthread
 
+import (
+	"encoding/json"
+	"sync"
+)
+
 // GenesisPlotJson is the first plot in the thread.
 const GenesisPlotJson = `
 {
@@ -23,4 +28,37 @@ const GenesisPlotJson = `
             "series": 1
         }
     ]
-}`
\ No newline at end of file
+}`
+
+// LoadGenesisPlot decodes the embedded genesis plot and returns it along with its ID.
+// It checks the plot's declared thread work is exactly its own work since it has no parent.
+func LoadGenesisPlot() (*Plot, PlotID, error) {
+	plot := new(Plot)
+	if err := json.Unmarshal([]byte(GenesisPlotJson), plot); err != nil {
+		return nil, PlotID{}, err
+	}
+	id, err := plot.ID()
+	if err != nil {
+		return nil, PlotID{}, err
+	}
+	if err := checkGenesisThreadWork(plot.Header); err != nil {
+		return nil, PlotID{}, err
+	}
+	return plot, id, nil
+}
+
+var genesisPlotID PlotID
+var genesisPlotIDOnce sync.Once
+
+// GenesisPlotID returns the ID of the embedded genesis plot. It's computed on first use.
+// It panics if the embedded plot can't be loaded.
+func GenesisPlotID() PlotID {
+	genesisPlotIDOnce.Do(func() {
+		_, id, err := LoadGenesisPlot()
+		if err != nil {
+			panic(err)
+		}
+		genesisPlotID = id
+	})
+	return genesisPlotID
+}
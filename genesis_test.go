@@ -0,0 +1,36 @@
+package plotthread
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestGenesisPlotID(t *testing.T) {
+	// the mainnet genesis plot. this must never change
+	expected, err := hex.DecodeString("0000000befd8eada815673f1f4e7ee664c24533f11cf44fca0fc1cbbe42b4db8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := GenesisPlotID()
+	if hex.EncodeToString(id[:]) != hex.EncodeToString(expected) {
+		t.Fatalf("Expected genesis plot ID %x, found %s", expected, id)
+	}
+
+	// it matches the loaded plot's header
+	genesis, genesisID, err := LoadGenesisPlot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerID, err := genesis.Header.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if genesisID != id || headerID != id {
+		t.Fatalf("Expected genesis plot ID %s, loaded %s with header ID %s", id, genesisID, headerID)
+	}
+
+	// it's cached
+	if GenesisPlotID() != id {
+		t.Fatal("Expected the same genesis plot ID on each call")
+	}
+}
@@ -0,0 +1,96 @@
+package plotthread
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/sha3"
+)
+
+// ImbalanceCommitment is an order-independent commitment to the set of all public key imbalances.
+// It's a multiset hash (MuHash): the product modulo the prime 2^3072 - 1103717 of each public key
+// with its non-zero imbalance hashed to a 3072-bit number. Unlike a sum of hashes, finding a set
+// with a given product is as hard as the discrete logarithm problem.
+// A node importing a snapshot of imbalances can compare the commitment it computes with a trusted one.
+type ImbalanceCommitment [384]byte
+
+var imbalanceCommitmentModulus = func() *big.Int {
+	p := new(big.Int).Lsh(big.NewInt(1), 3072)
+	return p.Sub(p, big.NewInt(1103717))
+}()
+
+// ComputeImbalanceCommitment computes the commitment for the given set of imbalances.
+func ComputeImbalanceCommitment(imbalances map[[ed25519.PublicKeySize]byte]int64) ImbalanceCommitment {
+	var c ImbalanceCommitment
+	for pubKey, imbalance := range imbalances {
+		c.Update(pubKey[:], 0, imbalance)
+	}
+	return c
+}
+
+// Update updates the commitment for a change in the given public key's imbalance.
+func (c *ImbalanceCommitment) Update(pubKey ed25519.PublicKey, oldImbalance, newImbalance int64) {
+	if oldImbalance == newImbalance {
+		return
+	}
+	product := c.product()
+	if oldImbalance != 0 {
+		inverse := new(big.Int).ModInverse(imbalanceCommitmentTerm(pubKey, oldImbalance), imbalanceCommitmentModulus)
+		product.Mul(product, inverse)
+	}
+	if newImbalance != 0 {
+		product.Mul(product, imbalanceCommitmentTerm(pubKey, newImbalance))
+	}
+	product.Mod(product, imbalanceCommitmentModulus)
+
+	// the empty set is the zero value
+	*c = ImbalanceCommitment{}
+	if product.Cmp(big.NewInt(1)) != 0 {
+		b := product.Bytes()
+		copy(c[len(c)-len(b):], b)
+	}
+}
+
+// Digest returns a SHA3-256 hash of the commitment for display and comparison.
+func (c ImbalanceCommitment) Digest() [32]byte {
+	return sha3.Sum256(c[:])
+}
+
+// Return the product the commitment represents
+func (c ImbalanceCommitment) product() *big.Int {
+	if c == (ImbalanceCommitment{}) {
+		return big.NewInt(1)
+	}
+	return new(big.Int).SetBytes(c[:])
+}
+
+// Hash a public key with its imbalance to a non-zero number less than the modulus
+func imbalanceCommitmentTerm(pubKey ed25519.PublicKey, imbalance int64) *big.Int {
+	var buf [ed25519.PublicKeySize + 8]byte
+	copy(buf[:], pubKey)
+	binary.BigEndian.PutUint64(buf[ed25519.PublicKeySize:], uint64(imbalance))
+	var hash [384]byte
+	shake := sha3.NewShake256()
+	shake.Write(buf[:])
+	shake.Read(hash[:])
+	term := new(big.Int).SetBytes(hash[:])
+	term.Mod(term, imbalanceCommitmentModulus)
+	if term.Sign() == 0 {
+		term.SetInt64(1)
+	}
+	return term
+}
+
+// String implements the Stringer interface.
+func (c ImbalanceCommitment) String() string {
+	digest := c.Digest()
+	return hex.EncodeToString(digest[:])
+}
+
+// MarshalJSON marshals ImbalanceCommitment as a hex string of its digest.
+func (c ImbalanceCommitment) MarshalJSON() ([]byte, error) {
+	s := "\"" + c.String() + "\""
+	return []byte(s), nil
+}
@@ -0,0 +1,79 @@
+package plotthread
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestImbalanceCommitmentOrder(t *testing.T) {
+	var pubKeys []ed25519.PublicKey
+	for i := 0; i < 4; i++ {
+		pubKey, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	ledger := newTestLedger()
+	ledger.setImbalance(pubKeys[0], 3)
+	ledger.setImbalance(pubKeys[1], 1)
+	initial := ComputeImbalanceCommitment(ledger.imbalances)
+
+	var txs []*Representation
+	for i := 0; i < 3; i++ {
+		txs = append(txs, NewRepresentation(pubKeys[0], pubKeys[i+1], 0, 0, 0, ""))
+	}
+	txs = append(txs, NewRepresentation(pubKeys[1], pubKeys[3], 0, 0, 0, ""))
+
+	// apply the same representations in different orders
+	var commitments []ImbalanceCommitment
+	for _, order := range [][]int{{0, 1, 2, 3}, {3, 2, 1, 0}, {2, 0, 3, 1}} {
+		imbalanceCache := NewImbalanceCache(ledger)
+		for _, i := range order {
+			ok, err := imbalanceCache.Apply(txs[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Fatalf("Expected representation %d to apply", i)
+			}
+		}
+		commitment := initial
+		for pk, imbalance := range imbalanceCache.Imbalances() {
+			commitment.Update(pk[:], ledger.imbalances[pk], imbalance)
+		}
+		commitments = append(commitments, commitment)
+	}
+	for i := range commitments {
+		if commitments[i] != commitments[0] {
+			t.Fatalf("Commitment %s differs from %s", commitments[i], commitments[0])
+		}
+	}
+	if commitments[0] == initial {
+		t.Fatal("Expected commitment to change")
+	}
+
+	// it matches the commitment computed from scratch
+	final := make(map[[ed25519.PublicKeySize]byte]int64)
+	for i, imbalance := range []int64{0, 1, 1, 2} {
+		if imbalance == 0 {
+			continue
+		}
+		var pk [ed25519.PublicKeySize]byte
+		copy(pk[:], pubKeys[i])
+		final[pk] = imbalance
+	}
+	if expected := ComputeImbalanceCommitment(final); commitments[0] != expected {
+		t.Fatalf("Expected commitment %s, found %s", expected, commitments[0])
+	}
+
+	// undoing a change restores the previous commitment
+	commitment := commitments[0]
+	commitment.Update(pubKeys[3], 2, 5)
+	commitment.Update(pubKeys[3], 5, 2)
+	if commitment != commitments[0] {
+		t.Fatal("Expected update to be reversible")
+	}
+}
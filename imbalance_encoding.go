@@ -0,0 +1,65 @@
+package plotthread
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// IMBALANCES_ENCODING_BINARY requests imbalances be sent in their binary encoding.
+const IMBALANCES_ENCODING_BINARY = "binary"
+
+// EncodeImbalances encodes the public key imbalances in binary. The encoding is the number of entries
+// as a uvarint followed by each entry's raw public key and its imbalance as a varint.
+// Peers carry it base64-encoded inside JSON messages.
+func EncodeImbalances(imbalances []PublicKeyImbalance) ([]byte, error) {
+	buf := make([]byte, 0, binary.MaxVarintLen64+len(imbalances)*(ed25519.PublicKeySize+2))
+	var varint [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(varint[:], uint64(len(imbalances)))
+	buf = append(buf, varint[:n]...)
+	for _, pkb := range imbalances {
+		if len(pkb.PublicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("Invalid public key length %d", len(pkb.PublicKey))
+		}
+		buf = append(buf, pkb.PublicKey...)
+		n := binary.PutVarint(varint[:], pkb.Imbalance)
+		buf = append(buf, varint[:n]...)
+	}
+	return buf, nil
+}
+
+// DecodeImbalances decodes public key imbalances encoded with EncodeImbalances.
+func DecodeImbalances(encoded []byte) ([]PublicKeyImbalance, error) {
+	count, n := binary.Uvarint(encoded)
+	if n <= 0 {
+		return nil, fmt.Errorf("Invalid imbalance count")
+	}
+	encoded = encoded[n:]
+
+	// each entry needs at least a key and a 1 byte imbalance
+	if count > uint64(len(encoded)/(ed25519.PublicKeySize+1)) {
+		return nil, fmt.Errorf("Imbalance count %d exceeds encoded length %d", count, len(encoded))
+	}
+
+	imbalances := make([]PublicKeyImbalance, count)
+	for i := range imbalances {
+		if len(encoded) < ed25519.PublicKeySize {
+			return nil, fmt.Errorf("Truncated public key at entry %d", i)
+		}
+		pubKey := make([]byte, ed25519.PublicKeySize)
+		copy(pubKey, encoded)
+		encoded = encoded[ed25519.PublicKeySize:]
+
+		imbalance, n := binary.Varint(encoded)
+		if n <= 0 {
+			return nil, fmt.Errorf("Invalid imbalance at entry %d", i)
+		}
+		encoded = encoded[n:]
+		imbalances[i] = PublicKeyImbalance{PublicKey: ed25519.PublicKey(pubKey), Imbalance: imbalance}
+	}
+	if len(encoded) != 0 {
+		return nil, fmt.Errorf("%d unexpected trailing bytes", len(encoded))
+	}
+	return imbalances, nil
+}
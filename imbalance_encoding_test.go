@@ -0,0 +1,83 @@
+package plotthread
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestImbalancesEncoding(t *testing.T) {
+	var imbalances []PublicKeyImbalance
+	for i := 0; i < 1000; i++ {
+		pubKey, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		imbalance := int64(i * i)
+		switch i {
+		case 0:
+			imbalance = math.MinInt64
+		case 1:
+			imbalance = math.MaxInt64
+		case 2:
+			imbalance = -1
+		}
+		imbalances = append(imbalances, PublicKeyImbalance{PublicKey: pubKey, Imbalance: imbalance})
+	}
+
+	encoded, err := EncodeImbalances(imbalances)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeImbalances(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(imbalances) {
+		t.Fatalf("Expected %d imbalances, found %d", len(imbalances), len(decoded))
+	}
+	for i := range imbalances {
+		if !bytes.Equal(decoded[i].PublicKey, imbalances[i].PublicKey) ||
+			decoded[i].Imbalance != imbalances[i].Imbalance {
+			t.Fatalf("Imbalance %d doesn't match after decoding", i)
+		}
+	}
+
+	// compare the size of the JSON responses
+	jsonBytes, err := json.Marshal(ImbalancesMessage{Imbalances: imbalances})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedJSONBytes, err := json.Marshal(ImbalancesMessage{EncodedImbalances: encoded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encodedJSONBytes)*3 > len(jsonBytes)*2 {
+		t.Fatalf("Expected encoded response to be much smaller, %d bytes vs. %d",
+			len(encodedJSONBytes), len(jsonBytes))
+	}
+	t.Logf("JSON: %d bytes, encoded: %d bytes, encoded in JSON: %d bytes",
+		len(jsonBytes), len(encoded), len(encodedJSONBytes))
+
+	// invalid encodings
+	invalid := [][]byte{
+		nil,
+		encoded[:len(encoded)-1],
+		append(append([]byte{}, encoded...), 0),
+		{0xff, 0xff, 0xff, 0xff, 0x0f},
+		{1, 1, 2, 3},
+	}
+	for i, enc := range invalid {
+		if _, err := DecodeImbalances(enc); err == nil {
+			t.Fatalf("Expected invalid encoding %d to be rejected", i)
+		}
+	}
+
+	// invalid public key
+	if _, err := EncodeImbalances([]PublicKeyImbalance{{PublicKey: []byte{1}}}); err == nil {
+		t.Fatal("Expected invalid public key to be rejected")
+	}
+}
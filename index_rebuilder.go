@@ -0,0 +1,52 @@
+package plotthread
+
+import "fmt"
+
+// RebuildRepresentationIndex walks the main thread from genesis to the current tip rewriting the
+// representation and public key representation indices from the stored plots, e.g. after the
+// ledger's indices are found to be corrupt. "progress" is called with each height once it's indexed
+// and may be nil. Rewriting an index is idempotent and progress is persisted with each plot so an
+// interrupted rebuild resumes after the last plot it indexed. It's a maintenance operation and must
+// be run while the node isn't processing plots. Index entries for representations no longer on the
+// main thread aren't removed.
+func RebuildRepresentationIndex(store PlotStorage, ledger Ledger, progress func(int64)) error {
+	tipID, tipHeight, err := ledger.GetThreadTip()
+	if err != nil {
+		return err
+	}
+	if tipID == nil {
+		// nothing to index
+		return nil
+	}
+
+	// resume an unfinished rebuild
+	lastHeight, err := ledger.GetReindexHeight()
+	if err != nil {
+		return err
+	}
+
+	for height := lastHeight + 1; height <= tipHeight; height++ {
+		id, err := ledger.GetPlotIDForHeight(height)
+		if err != nil {
+			return err
+		}
+		if id == nil {
+			return fmt.Errorf("No plot found at height %d", height)
+		}
+		plot, err := store.GetPlot(*id)
+		if err == ErrPlotNotFound {
+			return fmt.Errorf("Plot %s not found at height %d", *id, height)
+		}
+		if err != nil {
+			return err
+		}
+		if err := ledger.ReindexPlot(*id, plot); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(height)
+		}
+	}
+
+	return ledger.FinishReindex()
+}
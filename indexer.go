@@ -1,10 +1,12 @@
 package plotthread
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"log"
 	"math"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -18,7 +20,16 @@ type Indexer struct {
 	processor        *Processor
 	latestPlotID 	 PlotID
 	latestHeight     int64
+	latestLock       sync.RWMutex
 	txGraph          *Graph
+	txCounts         map[RepresentationID]int // occurrences of each indexed representation on the main branch
+	txSeries         map[int64][]RepresentationID // txCounts keys by series, for pruning
+	replies          map[RepresentationID][]RepresentationID // representations on the main branch referring to each
+	repliesLock      sync.RWMutex
+	scriberRewards   map[string]int64         // plotroots received by each public key on the main branch
+	rewardsLock      sync.RWMutex
+	newNodes         map[int64]int            // public keys first linked by each recent main branch plot height
+	newNodesLock     sync.RWMutex
 	shutdownChan     chan struct{}
 	wg               sync.WaitGroup
 }
@@ -29,13 +40,24 @@ func NewIndexer(
 	processor *Processor,
 	genesisPlotID PlotID,
 ) *Indexer {
+	txGraph := NewGraph()
+	txGraph.SetRankProgress(func(iteration int, delta float64) {
+		if iteration%RANK_PROGRESS_INTERVAL == 0 {
+			log.Printf("Ranking iteration %d, delta: %g\n", iteration, delta)
+		}
+	})
 	return &Indexer{
 		plotStore:       plotStore,
 		ledger:           ledger,
 		processor:        processor,
 		latestPlotID:    genesisPlotID,
 		latestHeight:     0,
-		txGraph:          NewGraph(),
+		txGraph:          txGraph,
+		txCounts:         make(map[RepresentationID]int),
+		txSeries:         make(map[int64][]RepresentationID),
+		replies:          make(map[RepresentationID][]RepresentationID),
+		scriberRewards:   make(map[string]int64),
+		newNodes:         make(map[int64]int),
 		shutdownChan:     make(chan struct{}),
 	}
 }
@@ -83,13 +105,21 @@ func (idx *Indexer) run() {
 
 	ticker.Stop()
 
-	header, _, err := idx.plotStore.GetPlotHeader(idx.latestPlotID)
+	// cancel any storage reads still pending on shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-idx.shutdownChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	plotStore := NewPlotStorageContext(idx.plotStore)
+
+	header, _, err := plotStore.GetPlotHeader(ctx, idx.latestPlotID)
 	if err != nil {
-		log.Println(err)
-		return
-	}
-	if header == nil {
-		// don't have it
+		// including not having it
 		log.Println(err)
 		return
 	}
@@ -116,19 +146,20 @@ func (idx *Indexer) run() {
 			break
 		}
 
-		plot, err := idx.plotStore.GetPlot(*nextID)
+		plot, err := plotStore.GetPlot(ctx, *nextID)
 		if err != nil {
-			// not found
+			if err == context.Canceled {
+				log.Printf("Indexer shutting down...\n")
+				return
+			}
+			if err == ErrPlotNotFound {
+				log.Printf("No plot found with ID %v", nextID)
+				return
+			}
 			log.Println(err)
 			return
 		}
 
-		if plot == nil {
-			// not found
-			log.Printf("No plot found with ID %v", nextID)
-			return
-		}
-
 		idx.indexRepresentations(plot, *nextID, true)
 
 		height += 1
@@ -149,7 +180,13 @@ func (idx *Indexer) run() {
 		select {
 		case tip := <-tipChangeChan:			
 			log.Printf("Indexer received notice of new tip plot: %s at height: %d\n", tip.PlotID, tip.Plot.Header.Height)
-			idx.indexRepresentations(tip.Plot, tip.PlotID, tip.Connect)
+			if err := idx.onTipChange(ctx, plotStore, tip); err != nil {
+				if err == context.Canceled {
+					log.Printf("Indexer shutting down...\n")
+					return
+				}
+				log.Println(err)
+			}
 			if !tip.More {
 				idx.rankGraph()
 			}
@@ -162,29 +199,280 @@ func (idx *Indexer) run() {
 	}
 }
 
+// Index a tip change. If the main thread changed since the latest indexed plot without us hearing
+// about it the index is first brought to the new tip's parent from storage. A plot already indexed
+// is ignored as is the disconnection of a plot which isn't the latest indexed
+func (idx *Indexer) onTipChange(ctx context.Context, plotStore PlotStorageContext, tip TipChange) error {
+	latestID, _ := idx.LatestIndexed()
+	if !tip.Connect {
+		if tip.PlotID != latestID {
+			// the next connection will unwind it
+			log.Printf("Indexer ignoring disconnection of plot %s, latest indexed: %s\n", tip.PlotID, latestID)
+			return nil
+		}
+	} else {
+		if tip.PlotID == latestID {
+			// already indexed
+			return nil
+		}
+		if tip.Plot.Header.Previous != latestID {
+			if err := idx.replay(ctx, plotStore, tip.Plot.Header); err != nil {
+				// index the tip anyway
+				log.Printf("Error replaying missed plots: %s\n", err)
+				if err == context.Canceled {
+					return err
+				}
+			}
+		}
+	}
+	idx.indexRepresentations(tip.Plot, tip.PlotID, tip.Connect)
+	return nil
+}
+
+// Bring the index to the given header's parent. Indexed plots which aren't its ancestors are
+// unwound back to the common ancestor and the ancestors after it are then indexed in order
+func (idx *Indexer) replay(ctx context.Context, plotStore PlotStorageContext, header *PlotHeader) error {
+	latestID, latestHeight := idx.LatestIndexed()
+
+	// walk the new branch back to the latest indexed height
+	var ids []PlotID
+	previous, height := header.Previous, header.Height-1
+	stepBack := func() error {
+		ids = append(ids, previous)
+		prevHeader, _, err := plotStore.GetPlotHeader(ctx, previous)
+		if err == ErrPlotNotFound {
+			return fmt.Errorf("Plot %s not found", previous)
+		}
+		if err != nil {
+			return err
+		}
+		previous, height = prevHeader.Previous, height-1
+		return nil
+	}
+	for height > latestHeight {
+		if err := stepBack(); err != nil {
+			return err
+		}
+	}
+
+	// unwind indexed plots until the branches meet
+	indexedID, indexedHeight := latestID, latestHeight
+	for indexedID != previous {
+		if indexedHeight <= 0 {
+			return fmt.Errorf("Plot %s at height %d shares no ancestor with the latest indexed plot %s",
+				header.Previous, header.Height-1, latestID)
+		}
+		plot, err := plotStore.GetPlot(ctx, indexedID)
+		if err != nil {
+			return err
+		}
+		log.Printf("Indexer unwinding plot: %s at height: %d\n", indexedID, indexedHeight)
+		idx.indexRepresentations(plot, indexedID, false)
+		if indexedHeight == height {
+			if err := stepBack(); err != nil {
+				return err
+			}
+		}
+		indexedID, indexedHeight = plot.Header.Previous, indexedHeight-1
+	}
+
+	for i := len(ids) - 1; i >= 0; i-- {
+		plot, err := plotStore.GetPlot(ctx, ids[i])
+		if err != nil {
+			return err
+		}
+		log.Printf("Indexer replaying missed plot: %s at height: %d\n", ids[i], plot.Header.Height)
+		idx.indexRepresentations(plot, ids[i], true)
+	}
+	return nil
+}
+
 func pubKeyToString(ppk ed25519.PublicKey) string{
 	return base64.StdEncoding.EncodeToString(ppk[:])
 }
 
 func (idx *Indexer) rankGraph(){
+	// forget keys whose only representations were disconnected
+	if removed := idx.txGraph.Compact(); removed != 0 {
+		log.Printf("Indexer removed %d isolated nodes\n", removed)
+	}
 	log.Printf("Indexer commencing ranking at height: %d\n", idx.latestHeight)
-	idx.txGraph.Rank(1.0, 1e-6)
-	log.Printf("Ranking finished")
+	idx.txGraph.RankParallel(1.0, 1e-6, runtime.NumCPU())
+	stats := idx.txGraph.Stats()
+	log.Printf("Ranking finished, nodes: %d, edges: %d, total weight: %.f, dangling nodes: %d, max out-degree: %d\n",
+		stats.Nodes, stats.Edges, stats.TotalWeight, stats.DanglingNodes, stats.MaxOutDegree)
 }
 
 func (idx *Indexer) indexRepresentations(plot *Plot, id PlotID, increment bool) {
-	idx.latestPlotID = id
-	idx.latestHeight = plot.Header.Height
+	idx.latestLock.Lock()
+	if increment {
+		idx.latestPlotID = id
+		idx.latestHeight = plot.Header.Height
+	} else {
+		// the previous plot is now the latest
+		idx.latestPlotID = plot.Header.Previous
+		idx.latestHeight = plot.Header.Height - 1
+	}
+	idx.latestLock.Unlock()
 
+	var newNodes int
 	for i := 0; i < len(plot.Representations); i++ {
 		tx := plot.Representations[i]
 
+		txID, err := tx.ID()
+		if err != nil {
+			log.Printf("Error computing representation ID in plot %s: %s\n", id, err)
+			continue
+		}
+
+		// only the first occurrence of a representation on the main branch is linked
 		if increment {
-			idx.txGraph.Link(pubKeyToString(tx.From), pubKeyToString(tx.To), 1)
+			idx.txCounts[txID]++
+			if idx.txCounts[txID] == 1 {
+				idx.txSeries[tx.Series] = append(idx.txSeries[tx.Series], txID)
+			}
+			if idx.txCounts[txID] > 1 {
+				log.Printf("Duplicate representation %s in plot %s, not indexing\n", txID, id)
+				continue
+			}
+			newNodes += idx.txGraph.linkAt(pubKeyToString(tx.From), pubKeyToString(tx.To), 1, plot.Header.Height)
+			if tx.Refers != nil {
+				idx.addReply(*tx.Refers, txID)
+			}
+			if tx.IsPlotroot() {
+				idx.creditScriberReward(tx.To, 1)
+			}
 		} else {
-			idx.txGraph.Link(pubKeyToString(tx.From), pubKeyToString(tx.To), -1)
+			// a missing count was pruned after being linked once
+			count := idx.txCounts[txID]
+			if count > 1 {
+				idx.txCounts[txID] = count - 1
+				continue
+			}
+			delete(idx.txCounts, txID)
+			idx.txGraph.unlinkAt(pubKeyToString(tx.From), pubKeyToString(tx.To), 1, plot.Header.Height)
+			if tx.Refers != nil {
+				idx.removeReply(*tx.Refers, txID)
+			}
+			if tx.IsPlotroot() {
+				idx.creditScriberReward(tx.To, -1)
+			}
+		}
+	}
+
+	if increment {
+		idx.pruneRepresentationCounts(plot.Header.Height)
+	}
+
+	idx.newNodesLock.Lock()
+	defer idx.newNodesLock.Unlock()
+	if increment {
+		idx.newNodes[plot.Header.Height] = newNodes
+		// heights are connected in order so this keeps the most recent NEW_NODES_HISTORY
+		delete(idx.newNodes, plot.Header.Height-NEW_NODES_HISTORY)
+	} else {
+		// its keys will be counted again by whichever plot next links them
+		delete(idx.newNodes, plot.Header.Height)
+	}
+}
+
+// pruneRepresentationCounts forgets representations whose series can no longer be scribed at or
+// near the given height. Like the ledger's representation index, this assumes no reorg reaches
+// back more than a series.
+func (idx *Indexer) pruneRepresentationCounts(height int64) {
+	// checkRepresentationSeries accepts at most the previous series; keep one more for reorgs
+	minSeries := height/PLOTS_UNTIL_NEW_SERIES - 1
+	for series, txIDs := range idx.txSeries {
+		if series >= minSeries {
+			continue
+		}
+		for _, txID := range txIDs {
+			delete(idx.txCounts, txID)
 		}
+		delete(idx.txSeries, series)
+	}
+}
+
+// NewNodes returns the number of public keys which first appeared in the graph with the main branch
+// plot at the given height. It returns false if no plot at that height is indexed or it's more than
+// NEW_NODES_HISTORY plots below the latest indexed plot.
+func (idx *Indexer) NewNodes(height int64) (int, bool) {
+	idx.newNodesLock.RLock()
+	defer idx.newNodesLock.RUnlock()
+	count, ok := idx.newNodes[height]
+	return count, ok
+}
+
+func (idx *Indexer) addReply(refers, txID RepresentationID) {
+	idx.repliesLock.Lock()
+	defer idx.repliesLock.Unlock()
+	idx.replies[refers] = append(idx.replies[refers], txID)
+}
+
+func (idx *Indexer) removeReply(refers, txID RepresentationID) {
+	idx.repliesLock.Lock()
+	defer idx.repliesLock.Unlock()
+	replies := idx.replies[refers]
+	for i, id := range replies {
+		if id == txID {
+			replies = append(replies[:i], replies[i+1:]...)
+			break
+		}
+	}
+	if len(replies) == 0 {
+		delete(idx.replies, refers)
+		return
+	}
+	idx.replies[refers] = replies
+}
+
+// Replies returns the IDs of representations on the main branch which refer to the given
+// representation as of the latest indexed plot, in the order they were indexed.
+func (idx *Indexer) Replies(id RepresentationID) []RepresentationID {
+	idx.repliesLock.RLock()
+	defer idx.repliesLock.RUnlock()
+	replies := make([]RepresentationID, len(idx.replies[id]))
+	copy(replies, idx.replies[id])
+	return replies
+}
+
+func (idx *Indexer) creditScriberReward(pubKey ed25519.PublicKey, amount int64) {
+	idx.rewardsLock.Lock()
+	defer idx.rewardsLock.Unlock()
+	pk := pubKeyToString(pubKey)
+	idx.scriberRewards[pk] += amount
+	if idx.scriberRewards[pk] == 0 {
+		// keep memory bounded by current scribers
+		delete(idx.scriberRewards, pk)
+	}
+}
+
+// ScriberRewards returns the total plot rewards the public key has received on the main branch
+// as of the latest indexed plot. Immature rewards are included.
+func (idx *Indexer) ScriberRewards(pubKey ed25519.PublicKey) int64 {
+	idx.rewardsLock.RLock()
+	defer idx.rewardsLock.RUnlock()
+	return idx.scriberRewards[pubKeyToString(pubKey)]
+}
+
+// LatestIndexed returns the ID and height of the latest plot indexed.
+func (idx *Indexer) LatestIndexed() (PlotID, int64) {
+	idx.latestLock.RLock()
+	defer idx.latestLock.RUnlock()
+	return idx.latestPlotID, idx.latestHeight
+}
+
+// IsCaughtUp returns true if the latest plot indexed is the tip of the main thread.
+func (idx *Indexer) IsCaughtUp() (bool, error) {
+	tipID, _, err := idx.ledger.GetThreadTip()
+	if err != nil {
+		return false, err
 	}
+	if tipID == nil {
+		return false, nil
+	}
+	latestID, _ := idx.LatestIndexed()
+	return latestID == *tipID, nil
 }
 
 // Shutdown stops the indexer synchronously.
@@ -198,13 +486,25 @@ type node struct {
 	label    string
 	ranking     float64
 	outbound float64
+	height   int64 // of the plot which first linked it. -1 if unknown or that plot was unlinked
 }
 
 // Graph holds node and edge data.
 type Graph struct {
-	index map[string]uint32
-	nodes map[uint32]*node
-	edges map[uint32](map[uint32]float64)
+	index      map[string]uint32
+	nodes      map[uint32]*node
+	edges      map[uint32](map[uint32]float64)
+	onProgress func(iteration int, delta float64)
+	lock       sync.RWMutex
+}
+
+// GraphStats summarizes the size and shape of a Graph.
+type GraphStats struct {
+	Nodes         int     `json:"nodes"`
+	Edges         int     `json:"edges"`
+	TotalWeight   float64 `json:"total_weight"`
+	DanglingNodes int     `json:"dangling_nodes"`
+	MaxOutDegree  int     `json:"max_out_degree"`
 }
 
 // NewGraph initializes and returns a new graph.
@@ -216,26 +516,47 @@ func NewGraph() *Graph {
 	}
 }
 
+// SetRankProgress sets a function called after each ranking iteration with the iteration number,
+// starting from 1, and the total change in rankings. Ranking converges once the change falls to
+// epsilon. It's called with the graph locked so it mustn't call back into the graph.
+func (graph *Graph) SetRankProgress(onProgress func(iteration int, delta float64)) {
+	graph.lock.Lock()
+	defer graph.lock.Unlock()
+	graph.onProgress = onProgress
+}
+
 // Link creates a weighted edge between a source-target node pair.
 // If the edge already exists, the weight is incremented.
 func (graph *Graph) Link(source, target string, weight float64) {
-	if _, ok := graph.index[source]; !ok {
-		index := uint32(len(graph.index))
-		graph.index[source] = index
-		graph.nodes[index] = &node{
-			ranking:     0,
-			outbound: 0,
-			label:    source,
-		}
-	}
+	graph.linkAt(source, target, weight, -1)
+}
+
+// Link the nodes and record the height of the plot which first linked each. Returns the number of
+// nodes first linked at that height. A node whose first plot was unlinked counts as new again
+func (graph *Graph) linkAt(source, target string, weight float64, height int64) int {
+	graph.lock.Lock()
+	defer graph.lock.Unlock()
 
-	if _, ok := graph.index[target]; !ok {
-		index := uint32(len(graph.index))
-		graph.index[target] = index
-		graph.nodes[index] = &node{
-			ranking:     0,
-			outbound: 0,
-			label:    target,
+	var created int
+	for _, label := range []string{source, target} {
+		index, ok := graph.index[label]
+		if !ok {
+			index = uint32(len(graph.index))
+			graph.index[label] = index
+			graph.nodes[index] = &node{
+				ranking:     0,
+				outbound: 0,
+				label:    label,
+				height:   height,
+			}
+			if height >= 0 {
+				created++
+			}
+			continue
+		}
+		if n := graph.nodes[index]; n.height < 0 && height >= 0 {
+			n.height = height
+			created++
 		}
 	}
 
@@ -248,9 +569,59 @@ func (graph *Graph) Link(source, target string, weight float64) {
 
 	graph.nodes[sIndex].outbound += weight
 	graph.edges[sIndex][tIndex] += weight
+	return created
+}
+
+// Remove weight from an edge linked at the given height. Nodes first linked at that height are
+// forgotten as new so the next plot to link them counts them
+func (graph *Graph) unlinkAt(source, target string, weight float64, height int64) {
+	graph.Link(source, target, -weight)
+
+	graph.lock.Lock()
+	defer graph.lock.Unlock()
+	for _, label := range []string{source, target} {
+		if n := graph.nodes[graph.index[label]]; n.height == height {
+			n.height = -1
+		}
+	}
+}
+
+// NodeScale maps a node's ranking, normalized to [0, 1] across the exported subgraph,
+// to its relative size in [0, 1].
+type NodeScale func(normalized float64) float64
+
+// LinearNodeScale sizes nodes in direct proportion to their ranking.
+func LinearNodeScale(normalized float64) float64 {
+	return normalized
+}
+
+// LogNodeScale sizes nodes logarithmically so differences among low ranked nodes stay visible.
+func LogNodeScale(normalized float64) float64 {
+	return math.Log1p(9*normalized) / math.Log(10)
+}
+
+// NodeScaleByName returns the named NodeScale: "linear" (the default if empty) or "log".
+func NodeScaleByName(name string) (NodeScale, error) {
+	switch name {
+	case "", "linear":
+		return LinearNodeScale, nil
+	case "log":
+		return LogNodeScale, nil
+	}
+	return nil, fmt.Errorf("Unknown node scale: %s", name)
 }
 
-func (g *Graph) ToDOT(pubKey string) string {
+// node widths in inches for the lowest and highest ranked nodes in an export
+const minNodeWidth = 0.5
+
+const maxNodeWidth = 2.0
+
+// ToDOT returns the subgraph around the given public key in Graphviz DOT format.
+// Each node's width is sized from its ranking using the given scale.
+func (g *Graph) ToDOT(pubKey string, scale NodeScale) string {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
 	includedNodes := []uint32 {}
 
 	pkInt, ok := g.index[pubKey]	
@@ -283,9 +654,22 @@ func (g *Graph) ToDOT(pubKey string) string {
 		}
 	}
 
+	// normalize rankings across the included nodes
+	minRanking, maxRanking := math.Inf(1), math.Inf(-1)
+	for _, id := range includedNodes {
+		minRanking = math.Min(minRanking, g.nodes[id].ranking)
+		maxRanking = math.Max(maxRanking, g.nodes[id].ranking)
+	}
+
 	// Add nodes with ranks
 	for _, id := range includedNodes {		
-		builder.WriteString(fmt.Sprintf("  \"%d\" [label=\"%s\", ranking=\"%f\"];\n", id, g.nodes[id].label, g.nodes[id].ranking))		
+		normalized := 1.0
+		if maxRanking > minRanking {
+			normalized = (g.nodes[id].ranking - minRanking) / (maxRanking - minRanking)
+		}
+		width := minNodeWidth + (maxNodeWidth-minNodeWidth)*scale(normalized)
+		builder.WriteString(fmt.Sprintf("  \"%d\" [label=\"%s\", ranking=\"%f\", width=\"%.3f\"];\n",
+			id, g.nodes[id].label, g.nodes[id].ranking, width))
 	}
 
 	builder.WriteString("}\n")
@@ -293,6 +677,8 @@ func (g *Graph) ToDOT(pubKey string) string {
 }
 
 func (g *Graph) rankings(pubKeys []ed25519.PublicKey) map[string]float64 {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
 
 	rnks := make(map[string]float64)
 
@@ -313,6 +699,126 @@ func (g *Graph) rankings(pubKeys []ed25519.PublicKey) map[string]float64 {
 	return rnks
 }
 
+// ranking returns the ranking of the given public key and whether or not it's in the graph.
+func (g *Graph) ranking(pubKey string) (float64, bool) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	index, ok := g.index[pubKey]
+	if !ok {
+		return 0, false
+	}
+	return g.nodes[index].ranking, true
+}
+
+// Weight returns the weight of the edge from source to target and whether or not it exists.
+// Keys are base64-encoded public keys. An edge whose weight has returned to zero doesn't exist.
+func (g *Graph) Weight(source, target string) (float64, bool) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	sIndex, ok := g.index[source]
+	if !ok {
+		return 0, false
+	}
+	tIndex, ok := g.index[target]
+	if !ok {
+		return 0, false
+	}
+	weight := g.edges[sIndex][tIndex]
+	return weight, weight != 0
+}
+
+// ShortestPath returns the keys along the fewest edges leading from one key to another, both
+// included, and whether or not such a path exists. Edges are followed in their direction and
+// those whose weight has returned to zero are skipped. The search gives up after visiting
+// MAX_GRAPH_PATH_VISITS nodes and logs that it was truncated.
+func (g *Graph) ShortestPath(from, to string) ([]string, bool) {
+	path, ok, truncated := g.shortestPath(from, to, MAX_GRAPH_PATH_VISITS)
+	if truncated {
+		log.Printf("Path search from %s to %s truncated after %d nodes\n", from, to, MAX_GRAPH_PATH_VISITS)
+	}
+	return path, ok
+}
+
+// Breadth-first search visiting at most maxVisits nodes. Returns the path, whether or not it
+// was found and whether or not the search was truncated
+func (g *Graph) shortestPath(from, to string, maxVisits int) ([]string, bool, bool) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	fIndex, ok := g.index[from]
+	if !ok {
+		return nil, false, false
+	}
+	tIndex, ok := g.index[to]
+	if !ok {
+		return nil, false, false
+	}
+
+	// how each visited node was reached
+	previous := map[uint32]uint32{fIndex: fIndex}
+	queue := []uint32{fIndex}
+	visits := 0
+	for len(queue) != 0 {
+		index := queue[0]
+		queue = queue[1:]
+		if index == tIndex {
+			var path []string
+			for {
+				path = append([]string{g.nodes[index].label}, path...)
+				if index == fIndex {
+					return path, true, false
+				}
+				index = previous[index]
+			}
+		}
+		if visits == maxVisits {
+			return nil, false, true
+		}
+		visits++
+		for target, weight := range g.edges[index] {
+			if weight == 0 {
+				continue
+			}
+			if _, ok := previous[target]; ok {
+				continue
+			}
+			previous[target] = index
+			queue = append(queue, target)
+		}
+	}
+	return nil, false, false
+}
+
+// Stats returns the current node and edge counts, total edge weight, number of nodes
+// without outbound weight and the largest number of outbound edges from any one node.
+// Edges whose weight has returned to zero are not counted.
+func (g *Graph) Stats() GraphStats {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	stats := GraphStats{Nodes: len(g.nodes)}
+	for _, node := range g.nodes {
+		if node.outbound == 0 {
+			stats.DanglingNodes++
+		}
+	}
+	for _, edge := range g.edges {
+		outDegree := 0
+		for _, weight := range edge {
+			if weight == 0 {
+				continue
+			}
+			outDegree++
+			stats.TotalWeight += weight
+		}
+		stats.Edges += outDegree
+		if outDegree > stats.MaxOutDegree {
+			stats.MaxOutDegree = outDegree
+		}
+	}
+	return stats
+}
+
 
 // https://github.com/alixaxel/pagerank/blob/master/pagerank.go
 // Rank computes the RepresentivityRank of every node in the directed graph.
@@ -321,6 +827,8 @@ func (g *Graph) rankings(pubKeys []ed25519.PublicKey) map[string]float64 {
 //
 // This method will run as many iterations as needed, until the graph converges.
 func (graph *Graph) Rank(alpha, epsilon float64) {
+	graph.lock.Lock()
+	defer graph.lock.Unlock()
 
 	normalizedWeights := make(map[uint32](map[uint32]float64))
 
@@ -341,6 +849,7 @@ func (graph *Graph) Rank(alpha, epsilon float64) {
 		graph.nodes[key].ranking = inverse
 	}
 
+	var iteration int
 	for Δ > epsilon {
 		leak := float64(0)
 		nodes := map[uint32]float64{}
@@ -370,11 +879,179 @@ func (graph *Graph) Rank(alpha, epsilon float64) {
 		for key, value := range graph.nodes {
 			Δ += math.Abs(value.ranking - nodes[key])
 		}
+
+		iteration++
+		if graph.onProgress != nil {
+			graph.onProgress(iteration, Δ)
+		}
+	}
+}
+
+// RankParallel computes the same rankings as Rank dividing the work of each iteration across "workers"
+// goroutines. Each one sums the contributions to its share of target nodes from their inbound edges
+// so no worker writes another's rankings. Results may differ from Rank's by floating point rounding.
+func (graph *Graph) RankParallel(alpha, epsilon float64, workers int) {
+	graph.lock.Lock()
+	defer graph.lock.Unlock()
+
+	n := len(graph.nodes)
+	if n == 0 {
+		return
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	// node IDs are assigned sequentially so they can index slices.
+	// normalize all the edge weights so that their sum amounts to 1
+	// and index them by target
+	type inboundEdge struct {
+		source uint32
+		weight float64
+	}
+	inbound := make([][]inboundEdge, n)
+	dangling := make([]bool, n)
+	for source, node := range graph.nodes {
+		if node.outbound == 0 {
+			dangling[source] = true
+		}
+		if node.outbound > 0 {
+			for target, weight := range graph.edges[source] {
+				inbound[target] = append(inbound[target], inboundEdge{source, weight / node.outbound})
+			}
+		}
+	}
+
+	inverse := 1 / float64(n)
+	rankings, next := make([]float64, n), make([]float64, n)
+	for i := range rankings {
+		rankings[i] = inverse
+	}
+	deltas := make([]float64, workers)
+
+	// run f over each worker's share of node IDs in parallel
+	chunk := (n + workers - 1) / workers
+	parallel := func(f func(w, start, end int)) {
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			start, end := w*chunk, (w+1)*chunk
+			if end > n {
+				end = n
+			}
+			wg.Add(1)
+			go func(w, start, end int) {
+				defer wg.Done()
+				f(w, start, end)
+			}(w, start, end)
+		}
+		wg.Wait()
+	}
+
+	Δ := float64(1.0)
+	var iteration int
+	for Δ > epsilon {
+		leak := float64(0)
+		for source, ranking := range rankings {
+			if dangling[source] {
+				leak += ranking
+			}
+		}
+		leak *= alpha
+		base := (1-alpha)*inverse + leak*inverse
+
+		// sum contributions by target
+		parallel(func(w, start, end int) {
+			deltas[w] = 0
+			for target := start; target < end; target++ {
+				ranking := base
+				for _, edge := range inbound[target] {
+					ranking += alpha * rankings[edge.source] * edge.weight
+				}
+				next[target] = ranking
+				deltas[w] += math.Abs(ranking - rankings[target])
+			}
+		})
+
+		Δ = 0
+		for _, delta := range deltas {
+			Δ += delta
+		}
+		rankings, next = next, rankings
+
+		iteration++
+		if graph.onProgress != nil {
+			graph.onProgress(iteration, Δ)
+		}
+	}
+
+	for id, ranking := range rankings {
+		graph.nodes[uint32(id)].ranking = ranking
 	}
 }
 
+// Compact removes edges whose weight has returned to zero and then any nodes left without an edge in
+// either direction, e.g. after the plots linking them are disconnected. Nodes with only inbound edges
+// are sinks which still collect ranking and are kept. The remaining nodes are renumbered in their
+// existing order so their indices stay sequential. Their rankings are unchanged until the graph is
+// next ranked. Returns the number of nodes removed.
+func (graph *Graph) Compact() int {
+	graph.lock.Lock()
+	defer graph.lock.Unlock()
+
+	linked := make(map[uint32]bool)
+	for source, edge := range graph.edges {
+		for target, weight := range edge {
+			if weight == 0 {
+				delete(edge, target)
+				continue
+			}
+			linked[source] = true
+			linked[target] = true
+		}
+		if len(edge) == 0 {
+			delete(graph.edges, source)
+		}
+	}
+
+	removed := len(graph.nodes) - len(linked)
+	if removed == 0 {
+		return 0
+	}
+
+	remap := make(map[uint32]uint32, len(linked))
+	nodes := make(map[uint32]*node, len(linked))
+	index := make(map[string]uint32, len(linked))
+	var next uint32
+	for old := uint32(0); old < uint32(len(graph.nodes)); old++ {
+		if !linked[old] {
+			continue
+		}
+		remap[old] = next
+		nodes[next] = graph.nodes[old]
+		index[graph.nodes[old].label] = next
+		next++
+	}
+
+	edges := make(map[uint32](map[uint32]float64), len(graph.edges))
+	for source, edge := range graph.edges {
+		remapped := make(map[uint32]float64, len(edge))
+		for target, weight := range edge {
+			remapped[remap[target]] = weight
+		}
+		edges[remap[source]] = remapped
+	}
+
+	graph.nodes, graph.index, graph.edges = nodes, index, edges
+	return removed
+}
+
 // Reset clears all the current graph data.
 func (graph *Graph) Reset() {
+	graph.lock.Lock()
+	defer graph.lock.Unlock()
 	graph.edges = make(map[uint32](map[uint32]float64))
 	graph.nodes = make(map[uint32]*node)
 	graph.index = make(map[string]uint32)
@@ -0,0 +1,717 @@
+package plotthread
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestGraphStats(t *testing.T) {
+	graph := NewGraph()
+
+	// a -> b (2), a -> c (1), b -> c (1), c -> d (1) then undone
+	graph.Link("a", "b", 1)
+	graph.Link("a", "b", 1)
+	graph.Link("a", "c", 1)
+	graph.Link("b", "c", 1)
+	graph.Link("c", "d", 1)
+	graph.Link("c", "d", -1)
+
+	stats := graph.Stats()
+	if stats.Nodes != 4 {
+		t.Fatalf("Expected 4 nodes, found %d", stats.Nodes)
+	}
+	if stats.Edges != 3 {
+		t.Fatalf("Expected 3 edges, found %d", stats.Edges)
+	}
+	if stats.TotalWeight != 4 {
+		t.Fatalf("Expected total weight 4, found %f", stats.TotalWeight)
+	}
+	// c and d have no outbound weight
+	if stats.DanglingNodes != 2 {
+		t.Fatalf("Expected 2 dangling nodes, found %d", stats.DanglingNodes)
+	}
+	if stats.MaxOutDegree != 2 {
+		t.Fatalf("Expected max out-degree 2, found %d", stats.MaxOutDegree)
+	}
+
+	// an empty graph
+	graph.Reset()
+	if stats := graph.Stats(); stats != (GraphStats{}) {
+		t.Fatalf("Expected empty stats, found %+v", stats)
+	}
+}
+
+func TestIndexDuplicateRepresentation(t *testing.T) {
+	// create a sender
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create a recipient
+	pubKey2, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := NewRepresentation(pubKey, pubKey2, 0, 0, 0, "")
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same representation appears in 2 plots
+	plot1 := &Plot{Header: &PlotHeader{Height: 1}, Representations: []*Representation{tx}}
+	plot2 := &Plot{Header: &PlotHeader{Height: 2}, Representations: []*Representation{tx}}
+
+	idx := NewIndexer(nil, nil, nil, PlotID{})
+	weight := func() float64 {
+		return idx.txGraph.Stats().TotalWeight
+	}
+
+	idx.indexRepresentations(plot1, PlotID{1}, true)
+	idx.indexRepresentations(plot2, PlotID{2}, true)
+	if weight() != 1 {
+		t.Fatalf("Expected weight 1 after connecting both plots, found %f", weight())
+	}
+
+	// disconnecting the duplicate leaves the original linked
+	idx.indexRepresentations(plot2, PlotID{2}, false)
+	if weight() != 1 {
+		t.Fatalf("Expected weight 1 after disconnecting the duplicate, found %f", weight())
+	}
+
+	// a reorg moves the representation to another plot
+	idx.indexRepresentations(plot1, PlotID{1}, false)
+	if weight() != 0 {
+		t.Fatalf("Expected weight 0 after disconnecting both plots, found %f", weight())
+	}
+	plot3 := &Plot{Header: &PlotHeader{Height: 1}, Representations: []*Representation{tx}}
+	idx.indexRepresentations(plot3, PlotID{3}, true)
+	if weight() != 1 {
+		t.Fatalf("Expected weight 1 after re-scribing, found %f", weight())
+	}
+}
+
+func TestIndexPrunesRepresentationCounts(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey2, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := NewRepresentation(pubKey, pubKey2, 0, 0, 1, "")
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := NewIndexer(nil, nil, nil, PlotID{})
+	plot1 := &Plot{Header: &PlotHeader{Height: 1}, Representations: []*Representation{tx}}
+	idx.indexRepresentations(plot1, PlotID{1}, true)
+	if len(idx.txCounts) != 1 {
+		t.Fatalf("Expected 1 counted representation, found %d", len(idx.txCounts))
+	}
+
+	// still within reach of a reorg
+	plot2 := &Plot{Header: &PlotHeader{Height: 2 * PLOTS_UNTIL_NEW_SERIES}}
+	idx.indexRepresentations(plot2, PlotID{2}, true)
+	if len(idx.txCounts) != 1 {
+		t.Fatalf("Expected 1 counted representation, found %d", len(idx.txCounts))
+	}
+
+	// its series can no longer be scribed
+	plot3 := &Plot{Header: &PlotHeader{Height: 3 * PLOTS_UNTIL_NEW_SERIES}}
+	idx.indexRepresentations(plot3, PlotID{3}, true)
+	if len(idx.txCounts) != 0 || len(idx.txSeries) != 0 {
+		t.Fatalf("Expected counts to be pruned, found %d", len(idx.txCounts))
+	}
+
+	// disconnecting a pruned representation still unlinks it
+	idx.indexRepresentations(plot1, PlotID{1}, false)
+	if weight := idx.txGraph.Stats().TotalWeight; weight != 0 {
+		t.Fatalf("Expected weight 0 after disconnecting, found %f", weight)
+	}
+}
+
+func TestIndexReplies(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey2, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := NewRepresentation(pubKey, pubKey2, 0, 0, 0, "parent")
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	txID, err := tx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := NewRepresentation(pubKey, pubKey2, 0, 0, 0, "reply")
+	reply.Refers = &txID
+	if err := reply.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	replyID, err := reply.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx := NewIndexer(nil, nil, nil, PlotID{})
+	plot1 := &Plot{Header: &PlotHeader{Height: 1}, Representations: []*Representation{tx}}
+	plot2 := &Plot{Header: &PlotHeader{Height: 2}, Representations: []*Representation{reply}}
+	idx.indexRepresentations(plot1, PlotID{1}, true)
+	idx.indexRepresentations(plot2, PlotID{2}, true)
+	replies := idx.Replies(txID)
+	if len(replies) != 1 || replies[0] != replyID {
+		t.Fatalf("Expected reply %s, found %v", replyID, replies)
+	}
+
+	// disconnecting the reply removes it
+	idx.indexRepresentations(plot2, PlotID{2}, false)
+	if replies := idx.Replies(txID); len(replies) != 0 {
+		t.Fatalf("Expected no replies, found %v", replies)
+	}
+	if len(idx.replies) != 0 {
+		t.Fatalf("Expected empty reply index, found %d entries", len(idx.replies))
+	}
+}
+
+func TestGraphWeight(t *testing.T) {
+	graph := NewGraph()
+	graph.Link("a", "b", 1)
+	graph.Link("a", "b", 1)
+	graph.Link("b", "c", 1)
+
+	// present
+	if weight, ok := graph.Weight("a", "b"); !ok || weight != 2 {
+		t.Fatalf("Expected weight 2, found %f, %v", weight, ok)
+	}
+
+	// absent. edges are directed
+	if weight, ok := graph.Weight("b", "a"); ok || weight != 0 {
+		t.Fatalf("Expected no edge, found %f, %v", weight, ok)
+	}
+	if _, ok := graph.Weight("a", "c"); ok {
+		t.Fatal("Expected no edge")
+	}
+	if _, ok := graph.Weight("a", "d"); ok {
+		t.Fatal("Expected no edge to an unknown key")
+	}
+
+	// disconnected
+	graph.Link("b", "c", -1)
+	if weight, ok := graph.Weight("b", "c"); ok || weight != 0 {
+		t.Fatalf("Expected no edge after disconnect, found %f, %v", weight, ok)
+	}
+}
+
+func TestGraphShortestPath(t *testing.T) {
+	graph := NewGraph()
+	graph.Link("a", "b", 1)
+	graph.Link("b", "c", 1)
+	graph.Link("c", "d", 1)
+	graph.Link("a", "c", 1)
+	graph.Link("e", "a", 1)
+
+	// direct
+	if path, ok := graph.ShortestPath("a", "b"); !ok || !reflect.DeepEqual(path, []string{"a", "b"}) {
+		t.Fatalf("Expected a direct path, found %v, %v", path, ok)
+	}
+
+	// multi-hop, skipping through the shortcut
+	if path, ok := graph.ShortestPath("a", "d"); !ok || !reflect.DeepEqual(path, []string{"a", "c", "d"}) {
+		t.Fatalf("Expected a 2-hop path, found %v, %v", path, ok)
+	}
+	if path, ok := graph.ShortestPath("e", "d"); !ok || !reflect.DeepEqual(path, []string{"e", "a", "c", "d"}) {
+		t.Fatalf("Expected a 3-hop path, found %v, %v", path, ok)
+	}
+
+	// edges are directed
+	if path, ok := graph.ShortestPath("d", "a"); ok || path != nil {
+		t.Fatalf("Expected no path, found %v", path)
+	}
+
+	// disconnected
+	graph.Link("x", "y", 1)
+	if _, ok := graph.ShortestPath("a", "y"); ok {
+		t.Fatal("Expected no path to a disconnected key")
+	}
+	if _, ok := graph.ShortestPath("a", "z"); ok {
+		t.Fatal("Expected no path to an unknown key")
+	}
+
+	// zero-weight edges aren't followed
+	graph.Link("a", "c", -1)
+	if path, ok := graph.ShortestPath("a", "d"); !ok || !reflect.DeepEqual(path, []string{"a", "b", "c", "d"}) {
+		t.Fatalf("Expected the longer path, found %v, %v", path, ok)
+	}
+
+	// truncated
+	if _, ok, truncated := graph.shortestPath("a", "d", 2); ok || !truncated {
+		t.Fatalf("Expected a truncated search, found %v, %v", ok, truncated)
+	}
+	if _, ok, truncated := graph.shortestPath("a", "d", 3); !ok || truncated {
+		t.Fatalf("Expected the search to finish, found %v, %v", ok, truncated)
+	}
+}
+
+func TestGraphRankProgress(t *testing.T) {
+	for _, parallel := range []bool{false, true} {
+		graph := makeTestGraph(100, 3)
+		var iterations []int
+		var deltas []float64
+		graph.SetRankProgress(func(iteration int, delta float64) {
+			iterations = append(iterations, iteration)
+			deltas = append(deltas, delta)
+		})
+		if parallel {
+			graph.RankParallel(0.85, 1e-9, 4)
+		} else {
+			graph.Rank(0.85, 1e-9)
+		}
+
+		// once per iteration until it converges
+		if len(iterations) < 2 {
+			t.Fatalf("Expected several iterations, found %d", len(iterations))
+		}
+		for i, iteration := range iterations {
+			if iteration != i+1 {
+				t.Fatalf("Expected iteration %d, found %d", i+1, iteration)
+			}
+			last := i == len(iterations)-1
+			if last != (deltas[i] <= 1e-9) {
+				t.Fatalf("Iteration %d of %d had delta %g", iteration, len(iterations), deltas[i])
+			}
+		}
+	}
+
+	// nil is fine
+	graph := makeTestGraph(10, 2)
+	graph.SetRankProgress(nil)
+	graph.Rank(0.85, 1e-6)
+}
+
+func TestGraphCompact(t *testing.T) {
+	graph := NewGraph()
+	graph.Link("a", "b", 1)
+	graph.Link("b", "c", 1)
+	graph.Link("d", "a", 1)
+	graph.Link("e", "f", 1)
+	graph.RankParallel(0.85, 1e-9, 2)
+
+	// disconnect d -> a and e -> f. d, e and f are left isolated
+	graph.Link("d", "a", -1)
+	graph.Link("e", "f", -1)
+	before := graph.rankings(nil)
+
+	if removed := graph.Compact(); removed != 3 {
+		t.Fatalf("Expected 3 nodes removed, found %d", removed)
+	}
+	for _, key := range []string{"d", "e", "f"} {
+		if _, ok := graph.ranking(key); ok {
+			t.Fatalf("Expected %s to be removed", key)
+		}
+	}
+
+	// c is a sink and kept. the rest keep their rankings and edges
+	for _, key := range []string{"a", "b", "c"} {
+		ranking, ok := graph.ranking(key)
+		if !ok {
+			t.Fatalf("Expected %s to remain", key)
+		}
+		if ranking != before[key] {
+			t.Fatalf("Expected %s ranking %g, found %g", key, before[key], ranking)
+		}
+	}
+	if weight, ok := graph.Weight("a", "b"); !ok || weight != 1 {
+		t.Fatalf("Expected weight 1, found %f, %v", weight, ok)
+	}
+	if weight, ok := graph.Weight("b", "c"); !ok || weight != 1 {
+		t.Fatalf("Expected weight 1, found %f, %v", weight, ok)
+	}
+	stats := graph.Stats()
+	if stats.Nodes != 3 || stats.Edges != 2 {
+		t.Fatalf("Expected 3 nodes and 2 edges, found %+v", stats)
+	}
+
+	// indices stay sequential so the graph can still be extended and ranked
+	graph.Link("c", "g", 1)
+	graph.RankParallel(0.85, 1e-9, 2)
+	if _, ok := graph.ranking("g"); !ok {
+		t.Fatal("Expected g to be added")
+	}
+	if removed := graph.Compact(); removed != 0 {
+		t.Fatalf("Expected nothing removed, found %d", removed)
+	}
+}
+
+func TestGraphToDOTNodeSize(t *testing.T) {
+	graph := NewGraph()
+	graph.Link("A", "B", 1)
+	graph.Link("A", "C", 1)
+	graph.nodes[graph.index["A"]].ranking = 0.2
+	graph.nodes[graph.index["B"]].ranking = 0.8
+	graph.nodes[graph.index["C"]].ranking = 0.5
+
+	tests := []struct {
+		scale string
+		lines []string
+	}{
+		{"linear", []string{
+			`  "0" -> "1" [weight="1"];`,
+			`  "0" -> "2" [weight="1"];`,
+			`  "0" [label="A", ranking="0.200000", width="0.500"];`,
+			`  "1" [label="B", ranking="0.800000", width="2.000"];`,
+			`  "2" [label="C", ranking="0.500000", width="1.250"];`,
+		}},
+		{"log", []string{
+			`  "0" [label="A", ranking="0.200000", width="0.500"];`,
+			`  "1" [label="B", ranking="0.800000", width="2.000"];`,
+			`  "2" [label="C", ranking="0.500000", width="1.611"];`,
+		}},
+	}
+	for _, test := range tests {
+		scale, err := NodeScaleByName(test.scale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dot := graph.ToDOT("A", scale)
+		for _, line := range test.lines {
+			if !strings.Contains(dot, line+"\n") {
+				t.Fatalf("Expected %s export to contain:\n%s\nfound:\n%s", test.scale, line, dot)
+			}
+		}
+	}
+
+	if _, err := NodeScaleByName("cubic"); err == nil {
+		t.Fatal("Expected unknown scale to be rejected")
+	}
+}
+
+func TestIndexScriberRewards(t *testing.T) {
+	scriber, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriber2, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	makePlot := func(height int64, pubKey ed25519.PublicKey) *Plot {
+		plotroot := NewRepresentation(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)),
+			pubKey, 0, 0, height, "")
+		return &Plot{Header: &PlotHeader{Height: height}, Representations: []*Representation{plotroot}}
+	}
+
+	idx := NewIndexer(nil, nil, nil, PlotID{})
+	plot1, plot2 := makePlot(1, scriber), makePlot(2, scriber)
+	idx.indexRepresentations(plot1, PlotID{1}, true)
+	idx.indexRepresentations(plot2, PlotID{2}, true)
+	if rewards := idx.ScriberRewards(scriber); rewards != 2 {
+		t.Fatalf("Expected 2 rewards, found %d", rewards)
+	}
+
+	// a reorg replaces the second plot with one scribed by someone else
+	idx.indexRepresentations(plot2, PlotID{2}, false)
+	idx.indexRepresentations(makePlot(2, scriber2), PlotID{3}, true)
+	if rewards := idx.ScriberRewards(scriber); rewards != 1 {
+		t.Fatalf("Expected 1 reward after reorg, found %d", rewards)
+	}
+	if rewards := idx.ScriberRewards(scriber2); rewards != 1 {
+		t.Fatalf("Expected 1 reward for the new scriber, found %d", rewards)
+	}
+
+	// fully disconnected keys aren't retained
+	idx.indexRepresentations(plot1, PlotID{1}, false)
+	if rewards := idx.ScriberRewards(scriber); rewards != 0 {
+		t.Fatalf("Expected no rewards, found %d", rewards)
+	}
+	if len(idx.scriberRewards) != 1 {
+		t.Fatalf("Expected 1 scriber tracked, found %d", len(idx.scriberRewards))
+	}
+}
+
+func TestIndexNewNodes(t *testing.T) {
+	keys := make([]ed25519.PublicKey, 4)
+	for i := range keys {
+		var err error
+		if keys[i], _, err = ed25519.GenerateKey(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zeroKey := ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+
+	makePlot := func(height int64, scriber ed25519.PublicKey, txs ...*Representation) *Plot {
+		plotroot := NewRepresentation(zeroKey, scriber, 0, 0, height, "")
+		return &Plot{Header: &PlotHeader{Height: height}, Representations: append([]*Representation{plotroot}, txs...)}
+	}
+
+	checkNewNodes := func(idx *Indexer, height int64, expected int, indexed bool) {
+		count, ok := idx.NewNodes(height)
+		if ok != indexed || count != expected {
+			t.Fatalf("Expected %d new nodes at height %d, indexed: %v, found %d, %v",
+				expected, height, indexed, count, ok)
+		}
+	}
+
+	idx := NewIndexer(nil, nil, nil, PlotID{})
+	plot0 := makePlot(0, keys[0])
+	plot1 := makePlot(1, keys[0], NewRepresentation(keys[0], keys[1], 0, 0, 1, ""))
+	plot2 := makePlot(2, keys[1], NewRepresentation(keys[0], keys[2], 0, 0, 2, ""))
+	idx.indexRepresentations(plot0, PlotID{0}, true)
+	idx.indexRepresentations(plot1, PlotID{1}, true)
+	idx.indexRepresentations(plot2, PlotID{2}, true)
+
+	// the zero key and the first scriber, then one new recipient in each plot
+	checkNewNodes(idx, 0, 2, true)
+	checkNewNodes(idx, 1, 1, true)
+	checkNewNodes(idx, 2, 1, true)
+	checkNewNodes(idx, 3, 0, false)
+
+	// a reorg replaces plot 2. keys[2] is counted again only if the replacement links it
+	idx.indexRepresentations(plot2, PlotID{2}, false)
+	checkNewNodes(idx, 2, 0, false)
+	plot2b := makePlot(2, keys[3], NewRepresentation(keys[1], keys[2], 0, 0, 2, ""))
+	idx.indexRepresentations(plot2b, PlotID{3}, true)
+	checkNewNodes(idx, 2, 2, true)
+
+	// only repeat keys
+	plot3 := makePlot(3, keys[3], NewRepresentation(keys[2], keys[0], 0, 0, 3, ""))
+	idx.indexRepresentations(plot3, PlotID{4}, true)
+	checkNewNodes(idx, 3, 0, true)
+
+	// compacting the graph doesn't change what was counted
+	idx.indexRepresentations(plot3, PlotID{4}, false)
+	idx.indexRepresentations(plot2b, PlotID{3}, false)
+	idx.txGraph.Compact()
+	idx.indexRepresentations(plot2, PlotID{2}, true)
+	checkNewNodes(idx, 2, 1, true)
+	checkNewNodes(idx, 1, 1, true)
+
+	// only recent heights are kept
+	for height := int64(3); height <= NEW_NODES_HISTORY; height++ {
+		idx.indexRepresentations(makePlot(height, keys[0]), PlotID{}, true)
+	}
+	checkNewNodes(idx, 0, 0, false)
+	checkNewNodes(idx, 1, 1, true)
+	if len(idx.newNodes) != NEW_NODES_HISTORY {
+		t.Fatalf("Expected %d heights, found %d", NEW_NODES_HISTORY, len(idx.newNodes))
+	}
+
+	// disconnecting removes its height without restoring an older one
+	idx.indexRepresentations(makePlot(NEW_NODES_HISTORY, keys[0]), PlotID{}, false)
+	checkNewNodes(idx, 0, 0, false)
+	if len(idx.newNodes) != NEW_NODES_HISTORY-1 {
+		t.Fatalf("Expected %d heights, found %d", NEW_NODES_HISTORY-1, len(idx.newNodes))
+	}
+}
+
+func TestIndexerLatestIndexed(t *testing.T) {
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	makePlot := func(previous PlotID, height int64) *Plot {
+		plotroot := NewRepresentation(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)),
+			pubKey, 0, 0, height, "")
+		return &Plot{
+			Header:          &PlotHeader{Previous: previous, Height: height},
+			Representations: []*Representation{plotroot},
+		}
+	}
+
+	// the ledger is at height 2
+	ledger := newTestLedger()
+	ledger.heights[0], ledger.heights[1], ledger.heights[2] = PlotID{0}, PlotID{1}, PlotID{2}
+	idx := NewIndexer(nil, ledger, nil, PlotID{0})
+	if ok, err := idx.IsCaughtUp(); err != nil || ok {
+		t.Fatal("Expected indexer to be behind")
+	}
+
+	plot1, plot2 := makePlot(PlotID{0}, 1), makePlot(PlotID{1}, 2)
+	idx.indexRepresentations(plot1, PlotID{1}, true)
+	if id, height := idx.LatestIndexed(); id != (PlotID{1}) || height != 1 {
+		t.Fatalf("Expected latest indexed plot 1, found height %d", height)
+	}
+	idx.indexRepresentations(plot2, PlotID{2}, true)
+	if id, height := idx.LatestIndexed(); id != (PlotID{2}) || height != 2 {
+		t.Fatalf("Expected latest indexed plot 2, found height %d", height)
+	}
+	if ok, err := idx.IsCaughtUp(); err != nil || !ok {
+		t.Fatal("Expected indexer to be caught up")
+	}
+
+	// disconnecting moves it back
+	idx.indexRepresentations(plot2, PlotID{2}, false)
+	if id, height := idx.LatestIndexed(); id != (PlotID{1}) || height != 1 {
+		t.Fatalf("Expected latest indexed plot 1 after disconnection, found height %d", height)
+	}
+	if ok, err := idx.IsCaughtUp(); err != nil || ok {
+		t.Fatal("Expected indexer to be behind after disconnection")
+	}
+}
+
+func TestIndexerReplaysMissedTips(t *testing.T) {
+	scriber, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	makePlot := func(previous PlotID, height int64) *Plot {
+		plotroot := NewRepresentation(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)),
+			scriber, 0, 0, height, "")
+		return &Plot{
+			Header:          &PlotHeader{Previous: previous, Height: height},
+			Representations: []*Representation{plotroot},
+		}
+	}
+
+	// plots 1 through 4 are stored
+	store := newTestPlotStore()
+	var plots []*Plot
+	for height := int64(0); height <= 4; height++ {
+		var previous PlotID
+		if height != 0 {
+			previous = PlotID{byte(height - 1)}
+		}
+		plot := makePlot(previous, height)
+		store.plots[PlotID{byte(height)}] = plot
+		plots = append(plots, plot)
+	}
+	plotStore := NewPlotStorageContext(store)
+	ctx := context.Background()
+
+	idx := NewIndexer(store, nil, nil, PlotID{0})
+	if err := idx.onTipChange(ctx, plotStore, TipChange{PlotID: PlotID{1}, Plot: plots[1], Connect: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the notices for plots 2 and 3 were missed
+	if err := idx.onTipChange(ctx, plotStore, TipChange{PlotID: PlotID{4}, Plot: plots[4], Connect: true}); err != nil {
+		t.Fatal(err)
+	}
+	if id, height := idx.LatestIndexed(); id != (PlotID{4}) || height != 4 {
+		t.Fatalf("Expected latest indexed plot 4, found height %d", height)
+	}
+	if rewards := idx.ScriberRewards(scriber); rewards != 4 {
+		t.Fatalf("Expected 4 rewards after backfilling, found %d", rewards)
+	}
+
+	// a repeated notice is ignored
+	if err := idx.onTipChange(ctx, plotStore, TipChange{PlotID: PlotID{4}, Plot: plots[4], Connect: true}); err != nil {
+		t.Fatal(err)
+	}
+	if rewards := idx.ScriberRewards(scriber); rewards != 4 {
+		t.Fatalf("Expected 4 rewards after a repeated notice, found %d", rewards)
+	}
+
+	// disconnection still works
+	if err := idx.onTipChange(ctx, plotStore, TipChange{PlotID: PlotID{4}, Plot: plots[4]}); err != nil {
+		t.Fatal(err)
+	}
+	if id, height := idx.LatestIndexed(); id != (PlotID{3}) || height != 3 {
+		t.Fatalf("Expected latest indexed plot 3, found height %d", height)
+	}
+
+	// a missed reorg to another scriber's branch forking after plot 1
+	scriber2, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := PlotID{1}
+	var tip *Plot
+	for height := int64(2); height <= 4; height++ {
+		plotroot := NewRepresentation(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)),
+			scriber2, 0, 0, height, "")
+		tip = &Plot{
+			Header:          &PlotHeader{Previous: previous, Height: height},
+			Representations: []*Representation{plotroot},
+		}
+		previous = PlotID{0xb0, byte(height)}
+		store.plots[previous] = tip
+	}
+
+	// a disconnection we haven't indexed is ignored
+	if err := idx.onTipChange(ctx, plotStore, TipChange{PlotID: PlotID{2}, Plot: plots[2]}); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := idx.LatestIndexed(); id != (PlotID{3}) {
+		t.Fatal("Expected latest indexed plot 3 after an out of order disconnection")
+	}
+
+	if err := idx.onTipChange(ctx, plotStore, TipChange{PlotID: previous, Plot: tip, Connect: true}); err != nil {
+		t.Fatal(err)
+	}
+	if id, height := idx.LatestIndexed(); id != previous || height != 4 {
+		t.Fatalf("Expected latest indexed plot %s at height 4, found %s at height %d", previous, id, height)
+	}
+	if rewards := idx.ScriberRewards(scriber); rewards != 1 {
+		t.Fatalf("Expected 1 reward left on the old branch, found %d", rewards)
+	}
+	if rewards := idx.ScriberRewards(scriber2); rewards != 3 {
+		t.Fatalf("Expected 3 rewards on the new branch, found %d", rewards)
+	}
+}
+
+// Build a random graph with the given number of nodes and roughly "degree" edges from each
+func makeTestGraph(n, degree int) *Graph {
+	rng := rand.New(rand.NewSource(1))
+	graph := NewGraph()
+	for i := 0; i < n; i++ {
+		for j := 0; j < degree; j++ {
+			if rng.Intn(10) == 0 {
+				// leave some nodes dangling
+				break
+			}
+			graph.Link(strconv.Itoa(i), strconv.Itoa(rng.Intn(n)), float64(1+rng.Intn(3)))
+		}
+	}
+	return graph
+}
+
+func TestGraphRankParallel(t *testing.T) {
+	serial, parallel := makeTestGraph(1000, 5), makeTestGraph(1000, 5)
+	serial.Rank(0.85, 1e-9)
+	parallel.RankParallel(0.85, 1e-9, 4)
+
+	for key := range serial.index {
+		expected, _ := serial.ranking(key)
+		ranking, ok := parallel.ranking(key)
+		if !ok {
+			t.Fatalf("Node %s missing", key)
+		}
+		if math.Abs(expected-ranking) > 1e-9 {
+			t.Fatalf("Node %s ranking %g, expected %g", key, ranking, expected)
+		}
+	}
+}
+
+func BenchmarkGraphRank(b *testing.B) {
+	graph := makeTestGraph(100000, 5)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		graph.Rank(0.85, 1e-6)
+	}
+}
+
+func BenchmarkGraphRankParallel(b *testing.B) {
+	graph := makeTestGraph(100000, 5)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		graph.RankParallel(0.85, 1e-6, runtime.NumCPU())
+	}
+}
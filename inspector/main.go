@@ -19,7 +19,8 @@ import (
 // A small tool to inspect the plot thread and ledger offline
 func main() {
 	var commands = []string{
-		"height", "imbalance", "imbalance_at", "plot", "plot_at", "tx", "history", "verify",
+		"height", "imbalance", "imbalance_at", "plot", "plot_at", "tx", "history", "verify", "verify_thread",
+		"rebuild_index",
 	}
 
 	dataDirPtr := flag.String("datadir", "", "Path to a directory containing plot thread data")
@@ -32,6 +33,8 @@ func main() {
 	startIndexPtr := flag.Int("start_index", 0, "Start representation index (for use with \"history\")")
 	endHeightPtr := flag.Int("end_height", 0, "End plot height (for use with \"history\")")
 	limitPtr := flag.Int("limit", 3, "Limit (for use with \"history\")")
+	fullPtr := flag.Bool("full", false, "Verify signatures and imbalances (for use with \"verify_thread\")")
+	prunePtr := flag.Bool("prune", false, "Skip indices the client prunes (for use with \"rebuild_index\")")
 	flag.Parse()
 
 	if len(*dataDirPtr) == 0 {
@@ -69,6 +72,9 @@ func main() {
 		copy(txID[:], txIDBytes)
 	}
 
+	// rebuilding the index is the only command which writes
+	readOnly := *cmdPtr != "rebuild_index"
+
 	// instatiate plot storage (read-only)
 	plotStore, err := NewPlotStorageDisk(
 		filepath.Join(*dataDirPtr, "plots"),
@@ -80,10 +86,10 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// instantiate the ledger (read-only)
+	// instantiate the ledger (read-only unless rebuilding the index)
 	ledger, err := NewLedgerDisk(filepath.Join(*dataDirPtr, "ledger.db"),
-		true,  // read-only
-		false, // prune (no effect with read-only set)
+		readOnly,
+		*prunePtr, // prune (no effect with read-only set)
 		plotStore)
 	if err != nil {
 		log.Fatal(err)
@@ -128,12 +134,12 @@ func main() {
 			log.Fatalf("No plot found at height %d\n", *heightPtr)
 		}
 		plot, err := plotStore.GetPlot(*id)
+		if err == ErrPlotNotFound {
+			log.Fatalf("No plot with ID %s\n", *id)
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
-		if plot == nil {
-			log.Fatalf("No plot with ID %s\n", *id)
-		}
 		displayPlot(*id, plot)
 
 	case "plot":
@@ -141,12 +147,12 @@ func main() {
 			log.Fatalf("-plot_id required for \"plot\" command")
 		}
 		plot, err := plotStore.GetPlot(*plotID)
+		if err == ErrPlotNotFound {
+			log.Fatalf("No plot with id %s\n", *plotID)
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
-		if plot == nil {
-			log.Fatalf("No plot with id %s\n", *plotID)
-		}
 		displayPlot(*plotID, plot)
 
 	case "tx":
@@ -161,12 +167,12 @@ func main() {
 			log.Fatalf("Representation %s not found", *txID)
 		}
 		tx, header, err := plotStore.GetRepresentation(*id, index)
+		if err == ErrRepresentationNotFound {
+			log.Fatalf("No representation found with ID %s\n", *txID)
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
-		if tx == nil {
-			log.Fatalf("No representation found with ID %s\n", *txID)
-		}
 		displayRepresentation(*txID, header, index, tx)
 
 	case "history":
@@ -182,6 +188,30 @@ func main() {
 
 	case "verify":
 		verify(ledger, plotStore, pubKey, currentHeight)
+
+	case "verify_thread":
+		endHeight := int64(*endHeightPtr)
+		if endHeight == 0 {
+			endHeight = currentHeight
+		}
+		err := VerifyThread(plotStore, ledger, int64(*startHeightPtr), endHeight, VerifyThreadOptions{Full: *fullPtr})
+		if err != nil {
+			log.Fatalf("%s: %s\n", aurora.Bold(aurora.Red("FAILURE")), err)
+		}
+		log.Printf("%s: Verified plots %d through %d\n",
+			aurora.Bold(aurora.Green("SUCCESS")), *startHeightPtr, aurora.Bold(endHeight))
+
+	case "rebuild_index":
+		err := RebuildRepresentationIndex(plotStore, ledger, func(height int64) {
+			if height%1000 == 0 || height == currentHeight {
+				log.Printf("Indexed plot %d of %d\n", height, currentHeight)
+			}
+		})
+		if err != nil {
+			log.Fatalf("%s: %s\n", aurora.Bold(aurora.Red("FAILURE")), err)
+		}
+		log.Printf("%s: Rebuilt representation indices through height %d\n",
+			aurora.Bold(aurora.Green("SUCCESS")), aurora.Bold(currentHeight))
 	}
 
 	// close storage
@@ -263,9 +293,6 @@ func displayHistory(bIDs []PlotID, indices []int, stopHeight int64, stopIndex in
 		if err != nil {
 			panic(err)
 		}
-		if tx == nil {
-			panic("No representation found at index")
-		}
 		txID, err := tx.ID()
 		if err != nil {
 			panic(err)
@@ -283,7 +283,10 @@ func (w *Keyholder) GetImbalance(pubKey ed25519.PublicKey) (int64, int64, error)
 
 // GetImbalances returns a set of public key imbalances as well as the current plot height.
 func (w *Keyholder) GetImbalances(pubKeys []ed25519.PublicKey) ([]PublicKeyImbalance, int64, error) {
-	w.outChan <- Message{Type: "get_imbalances", Body: GetImbalancesMessage{PublicKeys: pubKeys}}
+	w.outChan <- Message{
+		Type: "get_imbalances",
+		Body: GetImbalancesMessage{PublicKeys: pubKeys, Encoding: IMBALANCES_ENCODING_BINARY},
+	}
 	result := <-w.resultChan
 	if len(result.err) != 0 {
 		return nil, 0, fmt.Errorf("%s", result.err)
@@ -292,6 +295,16 @@ func (w *Keyholder) GetImbalances(pubKeys []ed25519.PublicKey) ([]PublicKeyImbal
 	if err := json.Unmarshal(result.message, b); err != nil {
 		return nil, 0, err
 	}
+	if len(b.Error) != 0 {
+		return nil, 0, fmt.Errorf("%s", b.Error)
+	}
+	if len(b.EncodedImbalances) != 0 {
+		imbalances, err := DecodeImbalances(b.EncodedImbalances)
+		if err != nil {
+			return nil, 0, err
+		}
+		return imbalances, b.Height, nil
+	}
 	return b.Imbalances, b.Height, nil
 }
 
@@ -400,6 +413,27 @@ func (w *Keyholder) Send(from, to ed25519.PublicKey, matures, expires int64, mem
 	return ptr.RepresentationID, nil
 }
 
+// PushRepresentations pushes a batch of already signed representations out to the network.
+// It returns a result for each representation in the same order. A representation was accepted
+// if its result has no error.
+func (w *Keyholder) PushRepresentations(txs []*Representation) ([]PushRepresentationResultMessage, error) {
+	w.outChan <- Message{Type: "push_representations", Body: PushRepresentationsMessage{Representations: txs}}
+	result := <-w.resultChan
+
+	// handle result
+	if len(result.err) != 0 {
+		return nil, fmt.Errorf("%s", result.err)
+	}
+	ptsr := new(PushRepresentationsResultMessage)
+	if err := json.Unmarshal(result.message, ptsr); err != nil {
+		return nil, err
+	}
+	if len(ptsr.Error) != 0 {
+		return nil, fmt.Errorf("%s", ptsr.Error)
+	}
+	return ptsr.Results, nil
+}
+
 // GetRepresentation retrieves information about a historic representation.
 func (w *Keyholder) GetRepresentation(id RepresentationID) (*Representation, *PlotID, int64, error) {
 	w.outChan <- Message{Type: "get_representation", Body: GetRepresentationMessage{RepresentationID: id}}
@@ -540,6 +574,9 @@ func (w *Keyholder) run() {
 			case "push_representation_result":
 				w.resultChan <- keyholderResult{message: body}
 
+			case "push_representations_result":
+				w.resultChan <- keyholderResult{message: body}
+
 			case "representation":
 				w.resultChan <- keyholderResult{message: body}
 
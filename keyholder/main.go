@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -47,15 +46,8 @@ func main() {
 		*peerPtr = *peerPtr + ":" + strconv.Itoa(DEFAULT_PLOTTHREAD_PORT)
 	}
 
-	// load genesis plot
-	var genesisPlot Plot
-	if err := json.Unmarshal([]byte(GenesisPlotJson), &genesisPlot); err != nil {
-		log.Fatal(err)
-	}
-	genesisID, err := genesisPlot.ID()
-	if err != nil {
-		log.Fatal(err)
-	}
+	// the genesis plot ID identifies the thread to peers
+	genesisID := GenesisPlotID()
 
 	fmt.Println("Starting up...")
 	fmt.Printf("Genesis plot ID: %s\n", genesisID)
@@ -644,9 +636,9 @@ func sendRepresentation(keyholder *Keyholder) (RepresentationID, error) {
 		return RepresentationID{}, err
 	}
 	memo := strings.TrimSpace(text)
-	if len(memo) > MAX_MEMO_LENGTH {
+	if len(memo) > DefaultThreadParams.MaxMemoLength {
 		return RepresentationID{}, fmt.Errorf("Maximum memo length (%d) exceeded (%d)",
-			MAX_MEMO_LENGTH, len(memo))
+			DefaultThreadParams.MaxMemoLength, len(memo))
 	}
 
 	// create and send send it. by default the representation expires if not scribed within 3 plots from now
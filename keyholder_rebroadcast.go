@@ -0,0 +1,70 @@
+package plotthread
+
+import (
+	"fmt"
+	"time"
+)
+
+// RebroadcastPeer is a connection to a peer used to rebroadcast a representation. Keyholder implements it.
+type RebroadcastPeer interface {
+	// GetRepresentation retrieves information about a historic representation.
+	GetRepresentation(id RepresentationID) (*Representation, *PlotID, int64, error)
+
+	// PushRepresentations pushes a batch of already signed representations out to the network.
+	PushRepresentations(txs []*Representation) ([]PushRepresentationResultMessage, error)
+}
+
+// RebroadcastRepresentation makes sure a representation hasn't been lost from the peers' queues, e.g. after
+// a peer restarts. Each round it asks every peer if the representation is confirmed and, if none has it,
+// pushes it to each of them again. A peer already queueing it accepts the push without relaying it.
+// Rounds repeat up to "attempts" times, waiting "backoff" before the second and doubling the wait each time.
+// It returns the ID of the plot confirming the representation. An error is returned if every peer rejects it
+// or it's still unconfirmed after the last attempt.
+func RebroadcastRepresentation(peers []RebroadcastPeer, id RepresentationID, tx *Representation,
+	attempts int, backoff time.Duration) (*PlotID, error) {
+	txID, err := tx.ID()
+	if err != nil {
+		return nil, err
+	}
+	if txID != id {
+		return nil, fmt.Errorf("Representation ID %s doesn't match representation %s", id, txID)
+	}
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		// is it confirmed anywhere?
+		for _, peer := range peers {
+			_, plotID, _, err := peer.GetRepresentation(id)
+			if err != nil {
+				continue
+			}
+			if plotID != nil {
+				return plotID, nil
+			}
+		}
+
+		// push it again
+		var rejected int
+		var lastErr string
+		for _, peer := range peers {
+			results, err := peer.PushRepresentations([]*Representation{tx})
+			if err != nil {
+				// try again next round
+				continue
+			}
+			if len(results) == 1 && len(results[0].Error) != 0 {
+				rejected++
+				lastErr = results[0].Error
+			}
+		}
+		if len(peers) != 0 && rejected == len(peers) {
+			return nil, fmt.Errorf("Representation %s rejected by all peers: %s", id, lastErr)
+		}
+	}
+
+	return nil, fmt.Errorf("Representation %s not confirmed after %d attempts", id, attempts)
+}
@@ -0,0 +1,102 @@
+package plotthread
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+var _ RebroadcastPeer = &Keyholder{}
+
+// testRebroadcastPeer is a peer which queues pushed representations and confirms them on request
+type testRebroadcastPeer struct {
+	queued    map[RepresentationID]bool
+	confirmed map[RepresentationID]PlotID
+	pushes    int
+	reject    string
+}
+
+func newTestRebroadcastPeer() *testRebroadcastPeer {
+	return &testRebroadcastPeer{
+		queued:    make(map[RepresentationID]bool),
+		confirmed: make(map[RepresentationID]PlotID),
+	}
+}
+
+func (p *testRebroadcastPeer) GetRepresentation(id RepresentationID) (*Representation, *PlotID, int64, error) {
+	plotID, ok := p.confirmed[id]
+	if !ok {
+		return nil, nil, 0, nil
+	}
+	return nil, &plotID, 1, nil
+}
+
+func (p *testRebroadcastPeer) PushRepresentations(txs []*Representation) (
+	[]PushRepresentationResultMessage, error) {
+	var results []PushRepresentationResultMessage
+	for _, tx := range txs {
+		id, err := tx.ID()
+		if err != nil {
+			return nil, err
+		}
+		p.pushes++
+		if len(p.reject) != 0 {
+			results = append(results, PushRepresentationResultMessage{RepresentationID: id, Error: p.reject})
+			continue
+		}
+		p.queued[id] = true
+		results = append(results, PushRepresentationResultMessage{RepresentationID: id})
+	}
+	return results, nil
+}
+
+func TestRebroadcastRepresentation(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := NewRepresentation(pubKey, pubKey, 0, 0, 0, "")
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	id, err := tx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the peer restarted and dropped it
+	peer := newTestRebroadcastPeer()
+	if _, err := RebroadcastRepresentation([]RebroadcastPeer{peer}, id, tx, 2, time.Millisecond); err == nil {
+		t.Fatal("Expected representation not to be confirmed")
+	}
+	if !peer.queued[id] || peer.pushes != 2 {
+		t.Fatalf("Expected representation to be pushed twice, found %d", peer.pushes)
+	}
+
+	// it's confirmed by one of the peers
+	peer2 := newTestRebroadcastPeer()
+	peer2.confirmed[id] = PlotID{1}
+	plotID, err := RebroadcastRepresentation([]RebroadcastPeer{peer, peer2}, id, tx, 2, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plotID == nil || *plotID != (PlotID{1}) {
+		t.Fatal("Expected confirming plot ID")
+	}
+	if peer.pushes != 2 {
+		t.Fatal("Expected a confirmed representation not to be pushed")
+	}
+
+	// every peer rejects it
+	peer3 := newTestRebroadcastPeer()
+	peer3.reject = "Representation is expired"
+	_, err = RebroadcastRepresentation([]RebroadcastPeer{peer3}, id, tx, 3, time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Fatalf("Expected rejection, found: %v", err)
+	}
+	if peer3.pushes != 1 {
+		t.Fatalf("Expected no retries after rejection, found %d pushes", peer3.pushes)
+	}
+}
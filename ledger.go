@@ -17,6 +17,30 @@ const (
 	UNKNOWN
 )
 
+// String implements the Stringer interface.
+func (b BranchType) String() string {
+	switch b {
+	case MAIN:
+		return "main"
+	case SIDE:
+		return "side"
+	case ORPHAN:
+		return "orphan"
+	default:
+		return "unknown"
+	}
+}
+
+// IsMainBranch returns true if the given plot is currently on the main branch.
+// Representations in plots on any other branch aren't confirmed and may never be.
+func IsMainBranch(ledger Ledger, id PlotID) (bool, error) {
+	branchType, err := ledger.GetBranchType(id)
+	if err != nil {
+		return false, err
+	}
+	return branchType == MAIN, nil
+}
+
 // Ledger is an interface to a ledger built from the most-work thread of plots.
 // It manages and computes public key imbalances as well as representation and public key representation indices.
 // It also maintains an index of the plot thread by height as well as branch information.
@@ -49,15 +73,44 @@ type Ledger interface {
 	GetPublicKeyImbalances(pubKeys []ed25519.PublicKey) (
 		map[[ed25519.PublicKeySize]byte]int64, *PlotID, int64, error)
 
+	// GetPublicKeyFirstSeen returns the lowest main thread height of a plot with a representation
+	// involving the given public key. It returns false if the key isn't involved in any.
+	GetPublicKeyFirstSeen(pubKey ed25519.PublicKey) (int64, bool, error)
+
 	// GetRepresentationIndex returns the index of a processed representation.
 	GetRepresentationIndex(id RepresentationID) (*PlotID, int, error)
 
+	// GetRepresentationConfirmations returns the number of main thread plots from the one containing
+	// the given representation through the tip, inclusive. It returns false if the representation
+	// isn't in a main thread plot.
+	GetRepresentationConfirmations(id RepresentationID) (int64, bool, error)
+
 	// GetPublicKeyRepresentationIndicesRange returns representation indices involving a given public key
 	// over a range of heights. If startHeight > endHeight this iterates in reverse.
+	// Results are ordered by height then index within the plot, or the reverse, and startIndex is
+	// inclusive. The returned height and index are those of the last result so the next page starts
+	// from the index after it, or before it in reverse.
 	GetPublicKeyRepresentationIndicesRange(
 		pubKey ed25519.PublicKey, startHeight, endHeight int64, startIndex, limit int) (
 		[]PlotID, []int, int64, int, error)
 
+	// GetConfirmedRepresentationCount returns the total number of representations in plots on the main thread.
+	GetConfirmedRepresentationCount() (int64, error)
+
+	// ReindexPlot rewrites the representation and public key representation indices for the given
+	// main thread plot and records its height as the progress of an index rebuild.
+	ReindexPlot(id PlotID, plot *Plot) error
+
+	// GetReindexHeight returns the height of the last plot reindexed by an unfinished index rebuild.
+	// It returns -1 if no rebuild is in progress.
+	GetReindexHeight() (int64, error)
+
+	// FinishReindex marks an index rebuild complete.
+	FinishReindex() error
+
+	// GetImbalanceCommitment returns the order-independent commitment to all current public key imbalances.
+	GetImbalanceCommitment() (ImbalanceCommitment, error)
+
 	// Imbalance returns the total current ledger imbalance by summing the imbalance of all public keys.
 	// It's only used offline for verification purposes.
 	Imbalance() (int64, error)
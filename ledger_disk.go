@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"log"
 
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
@@ -25,7 +26,63 @@ func NewLedgerDisk(dbPath string, readOnly, prune bool, plotStore PlotStorage) (
 	if err != nil {
 		return nil, err
 	}
-	return &LedgerDisk{db: db, plotStore: plotStore, prune: prune}, nil
+	l := &LedgerDisk{db: db, plotStore: plotStore, prune: prune}
+	if !readOnly {
+		// ledgers written before first-seen heights were tracked need them backfilled
+		if err := l.backfillFirstSeen(); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Record first-seen heights for every main thread plot if they haven't been yet. Each plot is
+// written separately so a lower height is always recorded first. Recording is idempotent so an
+// interrupted backfill starts over on the next open
+func (l LedgerDisk) backfillFirstSeen() error {
+	key, err := computeFirstSeenIndexedKey()
+	if err != nil {
+		return err
+	}
+	indexed, err := l.db.Has(key, nil)
+	if err != nil || indexed {
+		return err
+	}
+
+	tipID, tipHeight, err := l.GetThreadTip()
+	if err != nil {
+		return err
+	}
+	if tipID != nil {
+		log.Printf("Backfilling public key first-seen heights through height %d\n", tipHeight)
+		for height := int64(0); height <= tipHeight; height++ {
+			id, err := l.GetPlotIDForHeight(height)
+			if err != nil {
+				return err
+			}
+			if id == nil {
+				return fmt.Errorf("Missing plot ID for height %d", height)
+			}
+			plot, err := l.plotStore.GetPlot(*id)
+			if err == ErrPlotNotFound {
+				return fmt.Errorf("Missing plot %s", *id)
+			}
+			if err != nil {
+				return err
+			}
+			batch := new(leveldb.Batch)
+			if err := l.putFirstSeen(plot, batch); err != nil {
+				return err
+			}
+			if err := l.db.Write(batch, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	wo := opt.WriteOptions{Sync: true}
+	return l.db.Put(key, []byte{0x1}, &wo)
 }
 
 // GetThreadTip returns the ID and the height of the plot at the current tip of the main thread.
@@ -190,9 +247,6 @@ func (l LedgerDisk) ConnectPlot(id PlotID, plot *Plot) ([]RepresentationID, erro
 				if err != nil {
 					return nil, err
 				}
-				if oldTx == nil {
-					return nil, fmt.Errorf("Missing plotroot from plot %s\n", *oldID)
-				}
 
 				// apply it to the recipient's imbalance
 				txToApply = oldTx
@@ -226,10 +280,20 @@ func (l LedgerDisk) ConnectPlot(id PlotID, plot *Plot) ([]RepresentationID, erro
 		batch.Put(key, []byte{0x1})
 	}
 
-	// update recorded imbalances
+	// update recorded imbalances and the imbalance commitment
+	commitment, err := l.GetImbalanceCommitment()
+	if err != nil {
+		return nil, err
+	}
 	imbalances := imbalanceCache.Imbalances()
 	for pubKeyBytes, imbalance := range imbalances {
-		key, err := computePubKeyImbalanceKey(ed25519.PublicKey(pubKeyBytes[:]))
+		pubKey := ed25519.PublicKey(pubKeyBytes[:])
+		oldImbalance, err := l.GetPublicKeyImbalance(pubKey)
+		if err != nil {
+			return nil, err
+		}
+		commitment.Update(pubKey, oldImbalance, imbalance)
+		key, err := computePubKeyImbalanceKey(pubKey)
 		if err != nil {
 			return nil, err
 		}
@@ -243,6 +307,16 @@ func (l LedgerDisk) ConnectPlot(id PlotID, plot *Plot) ([]RepresentationID, erro
 			batch.Put(key, imbalanceBytes)
 		}
 	}
+	commitmentKey, err := computeImbalanceCommitmentKey()
+	if err != nil {
+		return nil, err
+	}
+	batch.Put(commitmentKey, commitment[:])
+
+	// record public keys seen for the first time
+	if err := l.putFirstSeen(plot, batch); err != nil {
+		return nil, err
+	}
 
 	// index the plot by height
 	key, err := computePlotHeightIndexKey(plot.Header.Height)
@@ -269,6 +343,21 @@ func (l LedgerDisk) ConnectPlot(id PlotID, plot *Plot) ([]RepresentationID, erro
 	}
 	batch.Put(key, ctBytes)
 
+	// update the confirmed representation count
+	count, err := l.GetConfirmedRepresentationCount()
+	if err != nil {
+		return nil, err
+	}
+	key, err = computeConfirmedRepresentationCountKey()
+	if err != nil {
+		return nil, err
+	}
+	countBytes, err := encodeNumber(count + int64(len(plot.Representations)))
+	if err != nil {
+		return nil, err
+	}
+	batch.Put(key, countBytes)
+
 	// prune historic representation and public key representation indices now
 	if l.prune && plot.Header.Height >= 2*PLOTS_UNTIL_NEW_SERIES {
 		if err := l.pruneIndices(plot.Header.Height-2*PLOTS_UNTIL_NEW_SERIES, batch); err != nil {
@@ -343,9 +432,6 @@ func (l LedgerDisk) DisconnectPlot(id PlotID, plot *Plot) ([]RepresentationID, e
 				if err != nil {
 					return nil, err
 				}
-				if oldTx == nil {
-					return nil, fmt.Errorf("Missing plotroot from plot %s\n", *oldID)
-				}
 
 				// undo its effect on the recipient's imbalance
 				txToUndo = oldTx
@@ -375,10 +461,20 @@ func (l LedgerDisk) DisconnectPlot(id PlotID, plot *Plot) ([]RepresentationID, e
 		batch.Delete(key)
 	}
 
-	// update recorded imbalances
+	// update recorded imbalances and the imbalance commitment
+	commitment, err := l.GetImbalanceCommitment()
+	if err != nil {
+		return nil, err
+	}
 	imbalances := imbalanceCache.Imbalances()
 	for pubKeyBytes, imbalance := range imbalances {
-		key, err := computePubKeyImbalanceKey(ed25519.PublicKey(pubKeyBytes[:]))
+		pubKey := ed25519.PublicKey(pubKeyBytes[:])
+		oldImbalance, err := l.GetPublicKeyImbalance(pubKey)
+		if err != nil {
+			return nil, err
+		}
+		commitment.Update(pubKey, oldImbalance, imbalance)
+		key, err := computePubKeyImbalanceKey(pubKey)
 		if err != nil {
 			return nil, err
 		}
@@ -392,6 +488,16 @@ func (l LedgerDisk) DisconnectPlot(id PlotID, plot *Plot) ([]RepresentationID, e
 			batch.Put(key, imbalanceBytes)
 		}
 	}
+	commitmentKey, err := computeImbalanceCommitmentKey()
+	if err != nil {
+		return nil, err
+	}
+	batch.Put(commitmentKey, commitment[:])
+
+	// forget public keys first seen in this plot
+	if err := l.deleteFirstSeen(plot, batch); err != nil {
+		return nil, err
+	}
 
 	// remove this plot's index by height
 	key, err := computePlotHeightIndexKey(plot.Header.Height)
@@ -418,6 +524,21 @@ func (l LedgerDisk) DisconnectPlot(id PlotID, plot *Plot) ([]RepresentationID, e
 	}
 	batch.Put(key, ctBytes)
 
+	// update the confirmed representation count
+	count, err := l.GetConfirmedRepresentationCount()
+	if err != nil {
+		return nil, err
+	}
+	key, err = computeConfirmedRepresentationCountKey()
+	if err != nil {
+		return nil, err
+	}
+	countBytes, err := encodeNumber(count - int64(len(plot.Representations)))
+	if err != nil {
+		return nil, err
+	}
+	batch.Put(key, countBytes)
+
 	// restore historic indices now
 	if l.prune && plot.Header.Height >= 2*PLOTS_UNTIL_NEW_SERIES {
 		if err := l.restoreIndices(plot.Header.Height-2*PLOTS_UNTIL_NEW_SERIES, batch); err != nil {
@@ -447,12 +568,12 @@ func (l LedgerDisk) pruneIndices(height int64, batch *leveldb.Batch) error {
 
 	// fetch the plot
 	plot, err := l.plotStore.GetPlot(*id)
+	if err == ErrPlotNotFound {
+		return fmt.Errorf("Missing plot %s\n", *id)
+	}
 	if err != nil {
 		return err
 	}
-	if plot == nil {
-		return fmt.Errorf("Missing plot %s\n", *id)
-	}
 
 	for i, tx := range plot.Representations {
 		txID, err := tx.ID()
@@ -498,13 +619,18 @@ func (l LedgerDisk) restoreIndices(height int64, batch *leveldb.Batch) error {
 
 	// fetch the plot
 	plot, err := l.plotStore.GetPlot(*id)
+	if err == ErrPlotNotFound {
+		return fmt.Errorf("Missing plot %s\n", *id)
+	}
 	if err != nil {
 		return err
 	}
-	if plot == nil {
-		return fmt.Errorf("Missing plot %s\n", *id)
-	}
 
+	return putIndices(plot, batch)
+}
+
+// Write representation and public key representation indices for the given plot
+func putIndices(plot *Plot, batch *leveldb.Batch) error {
 	for i, tx := range plot.Representations {
 		txID, err := tx.ID()
 		if err != nil {
@@ -540,6 +666,166 @@ func (l LedgerDisk) restoreIndices(height int64, batch *leveldb.Batch) error {
 	return nil
 }
 
+// ReindexPlot rewrites the representation and public key representation indices for the given
+// main thread plot and records its height as the progress of an index rebuild. Indices pruned
+// at the plot's height aren't rewritten. First-seen heights are never pruned and are always
+// written where missing or later than the plot's height.
+func (l LedgerDisk) ReindexPlot(id PlotID, plot *Plot) error {
+	mainID, err := l.GetPlotIDForHeight(plot.Header.Height)
+	if err != nil {
+		return err
+	}
+	if mainID == nil || *mainID != id {
+		return fmt.Errorf("Plot %s is not on the main thread at height %d", id, plot.Header.Height)
+	}
+
+	batch := new(leveldb.Batch)
+	_, tipHeight, err := l.GetThreadTip()
+	if err != nil {
+		return err
+	}
+	if !l.prune || plot.Header.Height > tipHeight-2*PLOTS_UNTIL_NEW_SERIES {
+		if err := putIndices(plot, batch); err != nil {
+			return err
+		}
+	}
+
+	// backfill first-seen heights recorded before they were tracked
+	if err := l.putFirstSeen(plot, batch); err != nil {
+		return err
+	}
+
+	// record progress in the same write so an interrupted rebuild can resume
+	key, err := computeReindexHeightKey()
+	if err != nil {
+		return err
+	}
+	heightBytes, err := encodeNumber(plot.Header.Height)
+	if err != nil {
+		return err
+	}
+	batch.Put(key, heightBytes)
+
+	wo := opt.WriteOptions{Sync: true}
+	return l.db.Write(batch, &wo)
+}
+
+// Record the plot's height as the first-seen height of each public key involved in its representations
+// unless a lower height is already recorded
+func (l LedgerDisk) putFirstSeen(plot *Plot, batch *leveldb.Batch) error {
+	seen := make(map[[ed25519.PublicKeySize]byte]bool)
+	for _, tx := range plot.Representations {
+		pubKeys := []ed25519.PublicKey{tx.To}
+		if !tx.IsPlotroot() {
+			pubKeys = append(pubKeys, tx.From)
+		}
+		for _, pubKey := range pubKeys {
+			var pk [ed25519.PublicKeySize]byte
+			copy(pk[:], pubKey)
+			if seen[pk] {
+				continue
+			}
+			seen[pk] = true
+			height, ok, err := l.GetPublicKeyFirstSeen(pubKey)
+			if err != nil {
+				return err
+			}
+			if ok && height <= plot.Header.Height {
+				continue
+			}
+			key, err := computePubKeyFirstSeenKey(pubKey)
+			if err != nil {
+				return err
+			}
+			heightBytes, err := encodeNumber(plot.Header.Height)
+			if err != nil {
+				return err
+			}
+			batch.Put(key, heightBytes)
+		}
+	}
+	return nil
+}
+
+// Remove the first-seen height of each public key first seen in the plot being disconnected
+func (l LedgerDisk) deleteFirstSeen(plot *Plot, batch *leveldb.Batch) error {
+	for _, tx := range plot.Representations {
+		pubKeys := []ed25519.PublicKey{tx.To}
+		if !tx.IsPlotroot() {
+			pubKeys = append(pubKeys, tx.From)
+		}
+		for _, pubKey := range pubKeys {
+			height, ok, err := l.GetPublicKeyFirstSeen(pubKey)
+			if err != nil {
+				return err
+			}
+			if !ok || height != plot.Header.Height {
+				continue
+			}
+			key, err := computePubKeyFirstSeenKey(pubKey)
+			if err != nil {
+				return err
+			}
+			batch.Delete(key)
+		}
+	}
+	return nil
+}
+
+// GetPublicKeyFirstSeen returns the lowest main thread height of a plot with a representation
+// involving the given public key. It returns false if the key isn't involved in any.
+func (l LedgerDisk) GetPublicKeyFirstSeen(pubKey ed25519.PublicKey) (int64, bool, error) {
+	key, err := computePubKeyFirstSeenKey(pubKey)
+	if err != nil {
+		return 0, false, err
+	}
+	heightBytes, err := l.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	var height int64
+	buf := bytes.NewReader(heightBytes)
+	if err := binary.Read(buf, binary.BigEndian, &height); err != nil {
+		return 0, false, err
+	}
+	return height, true, nil
+}
+
+// GetReindexHeight returns the height of the last plot reindexed by an unfinished index rebuild.
+// It returns -1 if no rebuild is in progress.
+func (l LedgerDisk) GetReindexHeight() (int64, error) {
+	key, err := computeReindexHeightKey()
+	if err != nil {
+		return 0, err
+	}
+	heightBytes, err := l.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var height int64
+	buf := bytes.NewReader(heightBytes)
+	if err := binary.Read(buf, binary.BigEndian, &height); err != nil {
+		return 0, err
+	}
+	return height, nil
+}
+
+// FinishReindex marks an index rebuild complete.
+func (l LedgerDisk) FinishReindex() error {
+	key, err := computeReindexHeightKey()
+	if err != nil {
+		return err
+	}
+	wo := opt.WriteOptions{Sync: true}
+	return l.db.Delete(key, &wo)
+}
+
 // GetPublicKeyImbalance returns the current imbalance of a given public key.
 func (l LedgerDisk) GetPublicKeyImbalance(pubKey ed25519.PublicKey) (int64, error) {
 	// compute db key
@@ -654,8 +940,49 @@ func (l LedgerDisk) GetRepresentationIndex(id RepresentationID) (*PlotID, int, e
 	return plotID, index, nil
 }
 
+// GetRepresentationConfirmations returns the number of main thread plots from the one containing
+// the given representation through the tip, inclusive. It returns false if the representation
+// isn't in a main thread plot.
+func (l LedgerDisk) GetRepresentationConfirmations(id RepresentationID) (int64, bool, error) {
+	// compute the db key
+	key, err := computeRepresentationIndexKey(id)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// the tip and the index must agree
+	snapshot, err := l.db.GetSnapshot()
+	if err != nil {
+		return 0, false, err
+	}
+	defer snapshot.Release()
+
+	// the index only covers the main thread. it's removed when a plot is disconnected
+	indexBytes, err := snapshot.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	height, _, err := decodeRepresentationIndex(indexBytes)
+	if err != nil {
+		return 0, false, err
+	}
+
+	tipID, tipHeight, err := getThreadTip(snapshot)
+	if err != nil {
+		return 0, false, err
+	}
+	if tipID == nil || height > tipHeight {
+		return 0, false, nil
+	}
+	return tipHeight - height + 1, true, nil
+}
+
 // GetPublicKeyRepresentationIndicesRange returns representation indices involving a given public key
 // over a range of heights. If startHeight > endHeight this iterates in reverse.
+// Index keys encode the height and index big-endian so iteration follows plot index order.
 func (l LedgerDisk) GetPublicKeyRepresentationIndicesRange(
 	pubKey ed25519.PublicKey, startHeight, endHeight int64, startIndex, limit int) (
 	[]PlotID, []int, int64, int, error) {
@@ -796,6 +1123,88 @@ func (l LedgerDisk) getPublicKeyRepresentationIndicesRangeReverse(
 	return
 }
 
+// GetConfirmedRepresentationCount returns the total number of representations in plots on the main thread.
+func (l LedgerDisk) GetConfirmedRepresentationCount() (int64, error) {
+	key, err := computeConfirmedRepresentationCountKey()
+	if err != nil {
+		return 0, err
+	}
+	countBytes, err := l.db.Get(key, nil)
+	if err == nil {
+		var count int64
+		buf := bytes.NewReader(countBytes)
+		binary.Read(buf, binary.BigEndian, &count)
+		return count, nil
+	}
+	if err != leveldb.ErrNotFound {
+		return 0, err
+	}
+
+	// not yet recorded. compute it from the main thread's plot headers
+	tipID, tipHeight, err := l.GetThreadTip()
+	if err != nil {
+		return 0, err
+	}
+	if tipID == nil {
+		return 0, nil
+	}
+	var count int64
+	for height := int64(0); height <= tipHeight; height++ {
+		id, err := l.GetPlotIDForHeight(height)
+		if err != nil {
+			return 0, err
+		}
+		if id == nil {
+			return 0, fmt.Errorf("No plot found at height %d", height)
+		}
+		header, _, err := l.plotStore.GetPlotHeader(*id)
+		if err == ErrPlotNotFound {
+			return 0, fmt.Errorf("No plot header found for %s", *id)
+		}
+		if err != nil {
+			return 0, err
+		}
+		count += int64(header.RepresentationCount)
+	}
+	return count, nil
+}
+
+// GetImbalanceCommitment returns the order-independent commitment to all current public key imbalances.
+func (l LedgerDisk) GetImbalanceCommitment() (ImbalanceCommitment, error) {
+	var commitment ImbalanceCommitment
+	key, err := computeImbalanceCommitmentKey()
+	if err != nil {
+		return commitment, err
+	}
+	commitmentBytes, err := l.db.Get(key, nil)
+	if err == nil && len(commitmentBytes) == len(commitment) {
+		copy(commitment[:], commitmentBytes)
+		return commitment, nil
+	}
+	if err != nil && err != leveldb.ErrNotFound {
+		return commitment, err
+	}
+
+	// not yet recorded, or recorded by a version using the older additive commitment.
+	// compute it from all public key imbalances
+	key, err = computePubKeyImbalanceKey(nil)
+	if err != nil {
+		return commitment, err
+	}
+	iter := l.db.NewIterator(util.BytesPrefix(key), nil)
+	for iter.Next() {
+		var imbalance int64
+		buf := bytes.NewReader(iter.Value())
+		binary.Read(buf, binary.BigEndian, &imbalance)
+		commitment.Update(ed25519.PublicKey(iter.Key()[1:]), 0, imbalance)
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return commitment, err
+	}
+	return commitment, nil
+}
+
 // Imbalance returns the total current ledger imbalance by summing the imbalance of all public keys.
 // It's only used offline for verification purposes.
 func (l LedgerDisk) Imbalance() (int64, error) {
@@ -866,15 +1275,15 @@ func (l LedgerDisk) GetPublicKeyImbalanceAt(pubKey ed25519.PublicKey, height int
 		}
 
 		tx, _, err := l.plotStore.GetRepresentation(*id, index)
-		if err != nil {
-			iter.Release()
-			return 0, err
-		}
-		if tx == nil {
+		if err == ErrRepresentationNotFound {
 			iter.Release()
 			return 0, fmt.Errorf("No representation found in plot %s at index %d",
 				*id, index)
 		}
+		if err != nil {
+			iter.Release()
+			return 0, err
+		}
 
 		if bytes.Equal(pubKey, tx.To) {
 			imbalance += 1
@@ -906,6 +1315,11 @@ func (l LedgerDisk) Close() error {
 // t{txid}              -> {height}{index} (prunable up to the previous series)
 // k{pk}{height}{index} -> 1 (not strictly necessary. probably should make it optional by flag)
 // b{pk}                -> {imbalance} (we always need all of this table)
+// c                    -> {commitment} (imbalance commitment)
+// n                    -> {count} (confirmed representation count)
+// r                    -> {height} (progress of an unfinished index rebuild)
+// f{pk}                -> {height} (lowest main thread height involving the public key)
+// F                    -> 1 (first-seen heights have been recorded for all main thread plots)
 
 const threadTipPrefix = 'T'
 
@@ -919,6 +1333,16 @@ const pubKeyRepresentationIndexPrefix = 'k'
 
 const pubKeyImbalancePrefix = 'b'
 
+const imbalanceCommitmentPrefix = 'c'
+
+const confirmedRepresentationCountPrefix = 'n'
+
+const reindexHeightPrefix = 'r'
+
+const pubKeyFirstSeenPrefix = 'f'
+
+const firstSeenIndexedPrefix = 'F'
+
 func computeBranchTypeKey(id PlotID) ([]byte, error) {
 	key := new(bytes.Buffer)
 	if err := key.WriteByte(branchTypePrefix); err != nil {
@@ -1016,6 +1440,49 @@ func computePubKeyImbalanceKey(pubKey ed25519.PublicKey) ([]byte, error) {
 	return key.Bytes(), nil
 }
 
+func computeImbalanceCommitmentKey() ([]byte, error) {
+	key := new(bytes.Buffer)
+	if err := key.WriteByte(imbalanceCommitmentPrefix); err != nil {
+		return nil, err
+	}
+	return key.Bytes(), nil
+}
+
+func computeConfirmedRepresentationCountKey() ([]byte, error) {
+	key := new(bytes.Buffer)
+	if err := key.WriteByte(confirmedRepresentationCountPrefix); err != nil {
+		return nil, err
+	}
+	return key.Bytes(), nil
+}
+
+func computeReindexHeightKey() ([]byte, error) {
+	key := new(bytes.Buffer)
+	if err := key.WriteByte(reindexHeightPrefix); err != nil {
+		return nil, err
+	}
+	return key.Bytes(), nil
+}
+
+func computeFirstSeenIndexedKey() ([]byte, error) {
+	key := new(bytes.Buffer)
+	if err := key.WriteByte(firstSeenIndexedPrefix); err != nil {
+		return nil, err
+	}
+	return key.Bytes(), nil
+}
+
+func computePubKeyFirstSeenKey(pubKey ed25519.PublicKey) ([]byte, error) {
+	key := new(bytes.Buffer)
+	if err := key.WriteByte(pubKeyFirstSeenPrefix); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(key, binary.BigEndian, pubKey); err != nil {
+		return nil, err
+	}
+	return key.Bytes(), nil
+}
+
 func encodeThreadTip(id PlotID, height int64) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	if err := binary.Write(buf, binary.BigEndian, id); err != nil {
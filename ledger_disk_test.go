@@ -0,0 +1,516 @@
+package plotthread
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestLedgerDiskConfirmedRepresentationCount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plotStore := newTestPlotStore()
+	ledger, err := NewLedgerDisk(dir, false, false, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroKey := ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+
+	// build and connect a plot with just a plotroot on top of the given one
+	connect := func(previous PlotID, height int64, memo string) PlotID {
+		tx := NewRepresentation(zeroKey, pubKey, 0, 0, height, memo)
+		plot, err := NewPlot(previous, height, target, PlotID{}, []*Representation{tx})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := plot.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := plotStore.Store(id, plot, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ledger.ConnectPlot(id, plot); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	checkCount := func(expected int64) {
+		count, err := ledger.GetConfirmedRepresentationCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expected {
+			t.Fatalf("Expected %d confirmed representations, found %d", expected, count)
+		}
+	}
+
+	checkCount(0)
+	id0 := connect(PlotID{}, 0, "genesis")
+	id1 := connect(id0, 1, "a1")
+	id2 := connect(id1, 2, "a2")
+	checkCount(3)
+
+	// reorg to a longer branch from plot 1
+	plot2, err := plotStore.GetPlot(id2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ledger.DisconnectPlot(id2, plot2); err != nil {
+		t.Fatal(err)
+	}
+	checkCount(2)
+	id2b := connect(id1, 2, "b2")
+	connect(id2b, 3, "b3")
+	checkCount(4)
+}
+
+func TestLedgerDiskRepresentationConfirmations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plotStore := newTestPlotStore()
+	ledger, err := NewLedgerDisk(dir, false, false, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroKey := ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+
+	// build and connect a plot with just a plotroot on top of the given one
+	connect := func(previous PlotID, height int64, memo string) (PlotID, *Plot, RepresentationID) {
+		tx := NewRepresentation(zeroKey, pubKey, 0, 0, height, memo)
+		txID, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		plot, err := NewPlot(previous, height, target, PlotID{}, []*Representation{tx})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := plot.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := plotStore.Store(id, plot, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ledger.ConnectPlot(id, plot); err != nil {
+			t.Fatal(err)
+		}
+		return id, plot, txID
+	}
+
+	checkConfirmations := func(txID RepresentationID, expected int64) {
+		confirmations, confirmed, err := ledger.GetRepresentationConfirmations(txID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if confirmed != (expected > 0) || confirmations != expected {
+			t.Fatalf("Expected %d confirmations, found %d, confirmed: %v", expected, confirmations, confirmed)
+		}
+	}
+
+	id0, _, tx0 := connect(PlotID{}, 0, "genesis")
+	checkConfirmations(tx0, 1)
+	id1, _, tx1 := connect(id0, 1, "a1")
+	id2, plot2, tx2 := connect(id1, 2, "a2")
+	checkConfirmations(tx0, 3)
+	checkConfirmations(tx1, 2)
+	checkConfirmations(tx2, 1)
+
+	// reorg to a longer branch from plot 1. the representation in plot 2 is only on a side branch now
+	if _, err := ledger.DisconnectPlot(id2, plot2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ledger.SetBranchType(id2, SIDE); err != nil {
+		t.Fatal(err)
+	}
+	checkConfirmations(tx2, 0)
+	checkConfirmations(tx1, 1)
+	id2b, _, tx2b := connect(id1, 2, "b2")
+	connect(id2b, 3, "b3")
+	checkConfirmations(tx2, 0)
+	checkConfirmations(tx2b, 2)
+	checkConfirmations(tx0, 4)
+}
+
+func TestLedgerDiskPublicKeyFirstSeen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plotStore := newTestPlotStore()
+	ledger, err := NewLedgerDisk(dir, false, false, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { ledger.Close() }()
+
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroKey := ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+
+	// build and connect a plot paying pubKey on top of the given one, optionally with
+	// pubKey sending to the recipient
+	connect := func(previous PlotID, height int64, memo string, send bool) (PlotID, *Plot) {
+		txs := []*Representation{NewRepresentation(zeroKey, pubKey, 0, 0, height, memo)}
+		if send {
+			txs = append(txs, NewRepresentation(pubKey, recipient, 0, 0, height, memo))
+		}
+		plot, err := NewPlot(previous, height, target, PlotID{}, txs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := plot.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := plotStore.Store(id, plot, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ledger.ConnectPlot(id, plot); err != nil {
+			t.Fatal(err)
+		}
+		return id, plot
+	}
+
+	checkFirstSeen := func(pubKey ed25519.PublicKey, expected int64, expectedSeen bool) {
+		height, seen, err := ledger.GetPublicKeyFirstSeen(pubKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen != expectedSeen || height != expected {
+			t.Fatalf("Expected first seen at %d (%v), found %d (%v)", expected, expectedSeen, height, seen)
+		}
+	}
+
+	id0, _ := connect(PlotID{}, 0, "genesis", false)
+	id1, _ := connect(id0, 1, "a1", false)
+	id2, plot2 := connect(id1, 2, "a2", true)
+	id3, plot3 := connect(id2, 3, "a3", true)
+	checkFirstSeen(pubKey, 0, true)
+	checkFirstSeen(recipient, 2, true)
+	checkFirstSeen(zeroKey, 0, false)
+
+	// reorg to a branch from plot 1 where the recipient first appears later
+	if _, err := ledger.DisconnectPlot(id3, plot3); err != nil {
+		t.Fatal(err)
+	}
+	checkFirstSeen(recipient, 2, true)
+	if _, err := ledger.DisconnectPlot(id2, plot2); err != nil {
+		t.Fatal(err)
+	}
+	checkFirstSeen(recipient, 0, false)
+	id2b, _ := connect(id1, 2, "b2", false)
+	connect(id2b, 3, "b3", true)
+	checkFirstSeen(recipient, 3, true)
+	checkFirstSeen(pubKey, 0, true)
+
+	// a ledger written before first-seen heights were tracked is backfilled when opened
+	batch := new(leveldb.Batch)
+	iter := ledger.db.NewIterator(util.BytesPrefix([]byte{pubKeyFirstSeenPrefix}), nil)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	batch.Delete([]byte{firstSeenIndexedPrefix})
+	if err := ledger.db.Write(batch, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkFirstSeen(pubKey, 0, false)
+	if err := ledger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ledger, err = NewLedgerDisk(dir, false, false, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFirstSeen(recipient, 3, true)
+	checkFirstSeen(pubKey, 0, true)
+}
+
+func TestLedgerDiskPublicKeyRepresentationOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plotStore := newTestPlotStore()
+	ledger, err := NewLedgerDisk(dir, false, false, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroKey := ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+
+	// each plot pays pubKey and involves it in several representations interleaved with
+	// ones which don't
+	type position struct {
+		height int64
+		index  int
+	}
+	var expected []position
+	var previous PlotID
+	for height := int64(0); height < 4; height++ {
+		txs := []*Representation{NewRepresentation(zeroKey, pubKey, 0, 0, height, "")}
+		expected = append(expected, position{height, 0})
+		if height > 0 {
+			keys := make([]ed25519.PublicKey, 3)
+			for i := range keys {
+				if keys[i], _, err = ed25519.GenerateKey(nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			txs = append(txs,
+				NewRepresentation(pubKey, keys[0], 0, 0, height, ""),
+				NewRepresentation(keys[0], keys[1], 0, 0, height, ""),
+				NewRepresentation(keys[1], pubKey, 0, 0, height, ""),
+				NewRepresentation(pubKey, keys[2], 0, 0, height, ""))
+			expected = append(expected, position{height, 1}, position{height, 3}, position{height, 4})
+		}
+		plot, err := NewPlot(previous, height, target, PlotID{}, txs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := plot.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := plotStore.Store(id, plot, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ledger.ConnectPlot(id, plot); err != nil {
+			t.Fatal(err)
+		}
+		previous = id
+	}
+
+	// page through resuming from the stop cursor
+	collect := func(reverse bool) []position {
+		var all []position
+		startHeight, endHeight, startIndex := int64(0), int64(3), 0
+		if reverse {
+			startHeight, endHeight, startIndex = 3, 0, MAX_REPRESENTATIONS_PER_PLOT-1
+		}
+		for {
+			ids, indices, stopHeight, stopIndex, err := ledger.GetPublicKeyRepresentationIndicesRange(
+				pubKey, startHeight, endHeight, startIndex, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, index := range indices {
+				header, _, err := plotStore.GetPlotHeader(ids[i])
+				if err != nil {
+					t.Fatal(err)
+				}
+				all = append(all, position{header.Height, index})
+			}
+			if len(indices) < 3 {
+				return all
+			}
+			startHeight, startIndex = stopHeight, stopIndex+1
+			if reverse {
+				startIndex = stopIndex - 1
+			}
+		}
+	}
+
+	// plot index order, the same on every call
+	for i := 0; i < 2; i++ {
+		if found := collect(false); !reflect.DeepEqual(found, expected) {
+			t.Fatalf("Expected %v, found %v", expected, found)
+		}
+	}
+	var reversed []position
+	for i := len(expected) - 1; i >= 0; i-- {
+		reversed = append(reversed, expected[i])
+	}
+	if found := collect(true); !reflect.DeepEqual(found, reversed) {
+		t.Fatalf("Expected %v, found %v", reversed, found)
+	}
+}
+
+func TestRebuildRepresentationIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plotStore := newTestPlotStore()
+	ledger, err := NewLedgerDisk(dir, false, false, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroKey := ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+
+	// build the thread indexing it incrementally as each plot is connected
+	var previous PlotID
+	for height := int64(0); height < 5; height++ {
+		txs := []*Representation{NewRepresentation(zeroKey, pubKey, 0, 0, height, "")}
+		if height >= 2 {
+			// spend a matured plotroot
+			txs = append(txs, NewRepresentation(pubKey, recipient, 0, 0, height, ""))
+		}
+		plot, err := NewPlot(previous, height, target, PlotID{}, txs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := plot.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := plotStore.Store(id, plot, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ledger.ConnectPlot(id, plot); err != nil {
+			t.Fatal(err)
+		}
+		previous = id
+	}
+
+	// dump the representation and public key representation indices
+	dumpIndices := func() map[string]string {
+		indices := make(map[string]string)
+		for _, prefix := range []byte{representationIndexPrefix, pubKeyRepresentationIndexPrefix} {
+			iter := ledger.db.NewIterator(util.BytesPrefix([]byte{prefix}), nil)
+			for iter.Next() {
+				indices[string(iter.Key())] = string(iter.Value())
+			}
+			iter.Release()
+			if err := iter.Error(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return indices
+	}
+	expected := dumpIndices()
+	if len(expected) == 0 {
+		t.Fatal("Expected indices")
+	}
+
+	// lose the indices
+	for key := range expected {
+		if err := ledger.db.Delete([]byte(key), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// start a rebuild which is interrupted after the first 2 plots
+	for height := int64(0); height < 2; height++ {
+		id, err := ledger.GetPlotIDForHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plot, err := plotStore.GetPlot(*id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ledger.ReindexPlot(*id, plot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// resume it
+	var heights []int64
+	if err := RebuildRepresentationIndex(plotStore, ledger, func(height int64) {
+		heights = append(heights, height)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) != 3 || heights[0] != 2 || heights[2] != 4 {
+		t.Fatalf("Expected the rebuild to resume at height 2, reported: %v", heights)
+	}
+	if !reflect.DeepEqual(dumpIndices(), expected) {
+		t.Fatal("Rebuilt indices don't match those built incrementally")
+	}
+
+	// it's idempotent
+	height, err := ledger.GetReindexHeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != -1 {
+		t.Fatalf("Expected the rebuild to be finished, found height %d", height)
+	}
+	if err := RebuildRepresentationIndex(plotStore, ledger, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dumpIndices(), expected) {
+		t.Fatal("Indices changed when rebuilt again")
+	}
+}
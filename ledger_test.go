@@ -0,0 +1,48 @@
+package plotthread
+
+import "testing"
+
+func TestIsMainBranch(t *testing.T) {
+	ledger := newTestLedger()
+	mainID, sideID, orphanID, unknownID := PlotID{1}, PlotID{2}, PlotID{3}, PlotID{4}
+	ledger.branches[mainID] = MAIN
+	ledger.branches[sideID] = SIDE
+	ledger.branches[orphanID] = ORPHAN
+
+	tests := []struct {
+		id     PlotID
+		branch string
+		main   bool
+	}{
+		{mainID, "main", true},
+		{sideID, "side", false},
+		{orphanID, "orphan", false},
+		{unknownID, "unknown", false},
+	}
+	for _, test := range tests {
+		branchType, err := ledger.GetBranchType(test.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if branchType.String() != test.branch {
+			t.Fatalf("Expected branch %s, found %s", test.branch, branchType)
+		}
+		main, err := IsMainBranch(ledger, test.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if main != test.main {
+			t.Fatalf("Expected main %t for %s branch", test.main, test.branch)
+		}
+	}
+
+	// a reorg moves the plot to a side branch
+	ledger.branches[mainID] = SIDE
+	main, err := IsMainBranch(ledger, mainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if main {
+		t.Fatal("Expected plot to no longer be on the main branch")
+	}
+}
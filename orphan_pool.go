@@ -0,0 +1,123 @@
+package plotthread
+
+import (
+	"container/list"
+	"sort"
+)
+
+// OrphanPool holds plots whose parent hasn't been processed yet so they can be connected once it is.
+// Plots are keyed by their Previous plot ID. It's bounded, evicts the oldest plot when full and
+// limits how many plots each source may hold. It isn't safe for concurrent use.
+type OrphanPool struct {
+	max          int
+	maxPerSource int
+	plots        map[PlotID]*Orphan
+	children     map[PlotID]map[PlotID]struct{} // orphan IDs keyed by Previous
+	sources      map[string]int                 // orphan counts keyed by Source
+	order        *list.List                     // orphans in order of arrival
+	seq          uint64
+}
+
+// Orphan is a plot waiting in the pool for its parent.
+type Orphan struct {
+	ID      PlotID
+	Plot    *Plot
+	Source  string // who sent it
+	seq     uint64 // order of arrival
+	element *list.Element
+}
+
+// NewOrphanPool returns a new OrphanPool holding at most max plots and at most maxPerSource
+// plots from any one source.
+func NewOrphanPool(max, maxPerSource int) *OrphanPool {
+	if max < 1 {
+		max = 1
+	}
+	if maxPerSource < 1 {
+		maxPerSource = 1
+	}
+	return &OrphanPool{
+		max:          max,
+		maxPerSource: maxPerSource,
+		plots:        make(map[PlotID]*Orphan),
+		children:     make(map[PlotID]map[PlotID]struct{}),
+		sources:      make(map[string]int),
+		order:        list.New(),
+	}
+}
+
+// Add adds a plot to wait for its parent. It returns false if the plot is already in the pool
+// or its source already holds the maximum number of plots.
+func (o *OrphanPool) Add(id PlotID, plot *Plot, source string) bool {
+	if _, ok := o.plots[id]; ok {
+		return false
+	}
+	if o.sources[source] >= o.maxPerSource {
+		return false
+	}
+	if len(o.plots) >= o.max {
+		o.evictOldest()
+	}
+	o.seq++
+	orphan := &Orphan{ID: id, Plot: plot, Source: source, seq: o.seq}
+	orphan.element = o.order.PushBack(orphan)
+	o.plots[id] = orphan
+	o.sources[source]++
+	children, ok := o.children[plot.Header.Previous]
+	if !ok {
+		children = make(map[PlotID]struct{})
+		o.children[plot.Header.Previous] = children
+	}
+	children[id] = struct{}{}
+	return true
+}
+
+// Take removes and returns the plots waiting for the given parent in order of arrival.
+func (o *OrphanPool) Take(previous PlotID) []*Orphan {
+	children := o.children[previous]
+	orphans := make([]*Orphan, 0, len(children))
+	for id := range children {
+		orphans = append(orphans, o.plots[id])
+		o.remove(id)
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].seq < orphans[j].seq
+	})
+	return orphans
+}
+
+// Contains returns true if the plot is in the pool.
+func (o *OrphanPool) Contains(id PlotID) bool {
+	_, ok := o.plots[id]
+	return ok
+}
+
+// Len returns the number of plots in the pool.
+func (o *OrphanPool) Len() int {
+	return len(o.plots)
+}
+
+// Remove the plot which arrived first
+func (o *OrphanPool) evictOldest() {
+	if e := o.order.Front(); e != nil {
+		o.remove(e.Value.(*Orphan).ID)
+	}
+}
+
+func (o *OrphanPool) remove(id PlotID) {
+	orphan, ok := o.plots[id]
+	if !ok {
+		return
+	}
+	delete(o.plots, id)
+	o.order.Remove(orphan.element)
+	o.sources[orphan.Source]--
+	if o.sources[orphan.Source] == 0 {
+		delete(o.sources, orphan.Source)
+	}
+	previous := orphan.Plot.Header.Previous
+	delete(o.children[previous], id)
+	if len(o.children[previous]) == 0 {
+		delete(o.children, previous)
+	}
+}
@@ -0,0 +1,58 @@
+package plotthread
+
+import "testing"
+
+func TestOrphanPool(t *testing.T) {
+	pool := NewOrphanPool(3, 4)
+	parent, other := PlotID{1}, PlotID{2}
+	add := func(id PlotID, previous PlotID) bool {
+		return pool.Add(id, &Plot{Header: &PlotHeader{Previous: previous}}, "test")
+	}
+
+	if !add(PlotID{10}, parent) || !add(PlotID{11}, other) || !add(PlotID{12}, parent) {
+		t.Fatal("Expected orphans to be added")
+	}
+	if add(PlotID{12}, parent) {
+		t.Fatal("Expected a duplicate orphan to be ignored")
+	}
+
+	// the oldest is evicted when full
+	if !add(PlotID{13}, parent) {
+		t.Fatal("Expected orphan to be added")
+	}
+	if pool.Len() != 3 || pool.Contains(PlotID{10}) {
+		t.Fatalf("Expected the oldest orphan to be evicted, %d orphan(s)", pool.Len())
+	}
+
+	// children are taken in order of arrival
+	orphans := pool.Take(parent)
+	if len(orphans) != 2 || orphans[0].ID != (PlotID{12}) || orphans[1].ID != (PlotID{13}) {
+		t.Fatalf("Unexpected orphans: %v", orphans)
+	}
+	if len(pool.Take(parent)) != 0 || pool.Len() != 1 || !pool.Contains(PlotID{11}) {
+		t.Fatal("Expected only the other orphan to remain")
+	}
+}
+
+func TestOrphanPoolPerSource(t *testing.T) {
+	pool := NewOrphanPool(10, 2)
+	add := func(id PlotID, source string) bool {
+		return pool.Add(id, &Plot{Header: &PlotHeader{Previous: PlotID{1}}}, source)
+	}
+
+	if !add(PlotID{10}, "a") || !add(PlotID{11}, "a") {
+		t.Fatal("Expected orphans to be added")
+	}
+	if add(PlotID{12}, "a") {
+		t.Fatal("Expected a third orphan from the same source to be refused")
+	}
+	if !add(PlotID{13}, "b") {
+		t.Fatal("Expected an orphan from another source to be added")
+	}
+
+	// taking its orphans frees the source's allowance
+	pool.Take(PlotID{1})
+	if !add(PlotID{12}, "a") {
+		t.Fatal("Expected orphan to be added once the source's orphans were taken")
+	}
+}
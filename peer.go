@@ -3,11 +3,13 @@ package plotthread
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"runtime/debug"
 	"sync"
 	"time"
 	"unicode/utf8"
@@ -17,6 +19,24 @@ import (
 	"golang.org/x/crypto/ed25519"
 )
 
+// HeightOutOfRangeError is returned when a plot is requested at a negative height or above the tip.
+// TipHeight is only set for the latter.
+type HeightOutOfRangeError struct {
+	Height    int64
+	TipHeight int64
+}
+
+// Error implements the error interface.
+func (e HeightOutOfRangeError) Error() string {
+	if e.Height < 0 {
+		return fmt.Sprintf("Height out of range: %d is negative", e.Height)
+	}
+	return fmt.Sprintf("Height out of range: %d is above the tip height %d", e.Height, e.TipHeight)
+}
+
+// ErrNotSynced is returned when a plot is requested by height before the node has a thread tip.
+var ErrNotSynced = errors.New("Not yet synced")
+
 // Peer is a peer client in the network. They all speak WebSocket protocol to each other.
 // Peers could be fully validating and scribing nodes or simply keyholders.
 type Peer struct {
@@ -37,10 +57,15 @@ type Peer struct {
 	lastPeerAddressesReceivedTime time.Time
 	filterLock                    sync.RWMutex
 	filter                        *cuckoo.Filter
+	maxFilterSize                 int
+	poolKey                       ed25519.PrivateKey
+	peerCount                     func() int
+	startTime                     time.Time
 	addrChan                      chan<- string
 	workID                        int32
 	workPlot                     *Plot
-	medianTimestamp               int64
+	workMinTime                   int64
+	resyncChan                    chan struct{}
 	pubKeys                       []ed25519.PublicKey
 	memo                          string
 	readLimitLock                 sync.RWMutex
@@ -72,7 +97,9 @@ func NewPeer(conn *websocket.Conn, genesisID PlotID, peerStore PeerStorage,
 		localInflightQueue:  NewPlotQueue(),
 		globalInflightQueue: plotQueue,
 		ignorePlots:        make(map[PlotID]bool),
+		maxFilterSize:       DEFAULT_MAX_FILTER_SIZE,
 		addrChan:            addrChan,
+		resyncChan:          make(chan struct{}, 1),
 	}
 	peer.updateReadLimit()
 	return peer
@@ -133,6 +160,15 @@ func (p *Peer) OnClose(closeHandler func()) {
 	p.closeHandler = closeHandler
 }
 
+// Resync asks the peer to find our common ancestor again so we download any plots we're missing.
+// It doesn't block and does nothing if a resync is already pending.
+func (p *Peer) Resync() {
+	select {
+	case p.resyncChan <- struct{}{}:
+	default:
+	}
+}
+
 // Shutdown is called to shutdown the underlying WebSocket synchronously.
 func (p *Peer) Shutdown() {
 	var addr string
@@ -168,6 +204,9 @@ const (
 	// Time allowed between processing new plots before we consider a plotthread sync stalled
 	syncWait = 2 * time.Minute
 
+	// Time allowed for a message handler to complete before we disconnect the peer
+	handlerWait = 2 * time.Minute
+
 	// Maximum plots per inv_plot message
 	maxPlotsPerInv = 500
 
@@ -236,6 +275,12 @@ func (p *Peer) run() {
 		p.processor.RegisterForNewRepresentations(newTxChan)
 		defer p.processor.UnregisterForNewRepresentations(newTxChan)
 
+		// track the tip height so we don't relay representations which have since expired
+		_, tipHeight, err := p.ledger.GetThreadTip()
+		if err != nil {
+			log.Printf("Error: %s\n", err)
+		}
+
 		// send the peer pings
 		tickerPing := time.NewTicker(pingPeriod)
 		defer tickerPing.Stop()
@@ -276,6 +321,12 @@ func (p *Peer) run() {
 				// update read limit if necessary
 				p.updateReadLimit()
 
+				if tip.Connect {
+					tipHeight = tip.Plot.Header.Height
+				} else {
+					tipHeight = tip.Plot.Header.Height - 1
+				}
+
 				if tip.Connect && tip.More == false {
 					// only build off newly connected tip plots.
 					// create and send out new work if necessary
@@ -287,43 +338,21 @@ func (p *Peer) run() {
 					break
 				}
 
-				if tip.Connect {
-					// new tip announced, notify the peer
-					inv := Message{
-						Type: "inv_plot",
-						Body: InvPlotMessage{
-							PlotIDs: []PlotID{tip.PlotID},
-						},
-					}
-					// send it
-					p.conn.SetWriteDeadline(time.Now().Add(writeWait))
-					if err := p.conn.WriteJSON(inv); err != nil {
-						log.Printf("Write error: %s, to: %s\n", err, p.conn.RemoteAddr())
-						p.conn.Close()
-					}
-				}
-
-				// potentially create a filter_plot
-				fb, err := p.createFilterPlot(tip.PlotID, tip.Plot)
+				// announce the change
+				m, err := p.createTipAnnouncement(tip)
 				if err != nil {
 					log.Printf("Error: %s, to: %s\n", err, p.conn.RemoteAddr())
 					continue
 				}
-				if fb == nil {
+				if m == nil {
 					continue
 				}
-
-				// send it
-				m := Message{
-					Type: "filter_plot",
-					Body: fb,
-				}
-				if !tip.Connect {
-					m.Type = "filter_plot_undo"
+				if fb, ok := m.Body.(*FilterPlotMessage); ok {
+					log.Printf("Sending %s with %d representation(s), to: %s\n",
+						m.Type, len(fb.Representations), p.conn.RemoteAddr())
 				}
 
-				log.Printf("Sending %s with %d representation(s), to: %s\n",
-					m.Type, len(fb.Representations), p.conn.RemoteAddr())
+				// send it
 				p.conn.SetWriteDeadline(time.Now().Add(writeWait))
 				if err := p.conn.WriteJSON(m); err != nil {
 					log.Printf("Write error: %s, to: %s\n", err, p.conn.RemoteAddr())
@@ -336,12 +365,7 @@ func (p *Peer) run() {
 					break
 				}
 
-				interested := func() bool {
-					p.filterLock.RLock()
-					defer p.filterLock.RUnlock()
-					return p.filterLookup(newTx.Representation)
-				}()
-				if !interested {
+				if !p.shouldRelay(newTx.Representation, tipHeight) {
 					continue
 				}
 
@@ -374,6 +398,13 @@ func (p *Peer) run() {
 					p.conn.Close()
 				}
 
+			case <-p.resyncChan:
+				// ask the peer for anything we're missing since its tip
+				if err := p.sendFindCommonAncestor(nil, true, outChan); err != nil {
+					log.Printf("Write error: %s, to: %s\n", err, p.conn.RemoteAddr())
+					p.conn.Close()
+				}
+
 			case gw := <-getWorkChan:
 				p.onGetWork(gw)
 
@@ -497,285 +528,406 @@ func (p *Peer) run() {
 				return
 			}
 
-			switch m.Type {
-			case "inv_plot":
-				var inv InvPlotMessage
-				if err := json.Unmarshal(body, &inv); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				for i, id := range inv.PlotIDs {
-					if err := p.onInvPlot(id, i, len(inv.PlotIDs), outChan); err != nil {
-						log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-						break
-					}
-				}
+			// run the handler recovering from any panic. a handler which exceeds its deadline has
+			// the connection closed underneath it
+			var newPlot, disconnect bool
+			if err := runMessageHandler(m.Type, handlerWait, func() { p.conn.Close() }, func() {
+				newPlot, disconnect = p.handleMessage(m.Type, body, ibd, outChan, getWorkChan, submitWorkChan)
+			}); err != nil {
+				log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+				return
+			}
+			if newPlot {
+				lastNewPlotTime = time.Now()
+			}
+			if disconnect {
+				return
+			}
 
-			case "get_plot":
-				var gb GetPlotMessage
-				if err := json.Unmarshal(body, &gb); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if err := p.onGetPlot(gb.PlotID, outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
+		case websocket.CloseMessage:
+			log.Printf("Received close message from: %s\n", p.conn.RemoteAddr())
+			break
+		}
+	}
+}
 
-			case "get_plot_by_height":
-				var gbbh GetPlotByHeightMessage
-				if err := json.Unmarshal(body, &gbbh); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if err := p.onGetPlotByHeight(gbbh.Height, outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
+// Handle a message from the peer. newPlot is true if it was a plot we hadn't seen and disconnect
+// is true if the peer should be disconnected
+func (p *Peer) handleMessage(msgType string, body json.RawMessage, ibd bool, outChan chan<- Message,
+	getWorkChan chan<- GetWorkMessage, submitWorkChan chan<- SubmitWorkMessage) (newPlot, disconnect bool) {
+	switch msgType {
+	case "inv_plot":
+		var inv InvPlotMessage
+		if err := json.Unmarshal(body, &inv); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		for i, id := range inv.PlotIDs {
+			if err := p.onInvPlot(id, i, len(inv.PlotIDs), outChan); err != nil {
+				log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+				break
+			}
+		}
 
-			case "plot":
-				var b PlotMessage
-				if err := json.Unmarshal(body, &b); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if b.Plot == nil {
-					log.Printf("Error: received nil plot, from: %s\n", p.conn.RemoteAddr())
-					return
-				}
-				if b.Plot.Header == nil {
-					log.Printf("Error: received nil plot header, from: %s\n", p.conn.RemoteAddr())
-					return
-				}
-				ok, err := p.onPlot(b.Plot, ibd, outChan)
-				if err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
-				if ok {
-					lastNewPlotTime = time.Now()
-				}
+	case "get_plot":
+		var gb GetPlotMessage
+		if err := json.Unmarshal(body, &gb); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onGetPlot(gb.PlotID, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "find_common_ancestor":
-				var fca FindCommonAncestorMessage
-				if err := json.Unmarshal(body, &fca); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				num := len(fca.PlotIDs)
-				for i, id := range fca.PlotIDs {
-					ok, err := p.onFindCommonAncestor(id, i, num, outChan)
-					if err != nil {
-						log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-						break
-					}
-					if ok {
-						// don't need to process more
-						break
-					}
-				}
+	case "get_plot_by_height":
+		var gbbh GetPlotByHeightMessage
+		if err := json.Unmarshal(body, &gbbh); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onGetPlotByHeight(gbbh.Height, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "get_plot_header":
-				var gbh GetPlotHeaderMessage
-				if err := json.Unmarshal(body, &gbh); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if err := p.onGetPlotHeader(gbh.PlotID, outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
+	case "plot":
+		var b PlotMessage
+		if err := json.Unmarshal(body, &b); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if b.Plot == nil {
+			log.Printf("Error: received nil plot, from: %s\n", p.conn.RemoteAddr())
+			return false, true
+		}
+		if b.Plot.Header == nil {
+			log.Printf("Error: received nil plot header, from: %s\n", p.conn.RemoteAddr())
+			return false, true
+		}
+		ok, err := p.onPlot(b.Plot, ibd, outChan)
+		if err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
+		newPlot = ok
 
-			case "get_plot_header_by_height":
-				var gbhbh GetPlotHeaderByHeightMessage
-				if err := json.Unmarshal(body, &gbhbh); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if err := p.onGetPlotHeaderByHeight(gbhbh.Height, outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
+	case "find_common_ancestor":
+		var fca FindCommonAncestorMessage
+		if err := json.Unmarshal(body, &fca); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		num := len(fca.PlotIDs)
+		for i, id := range fca.PlotIDs {
+			ok, err := p.onFindCommonAncestor(id, i, num, outChan)
+			if err != nil {
+				log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+				break
+			}
+			if ok {
+				// don't need to process more
+				break
+			}
+		}
 
-			case "get_graph":
-				var gn GetGraphMessage
-				if err := json.Unmarshal(body, &gn); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if err := p.onGetGraph(gn.PublicKey, outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}	
+	case "get_plot_header":
+		var gbh GetPlotHeaderMessage
+		if err := json.Unmarshal(body, &gbh); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onGetPlotHeader(gbh.PlotID, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "get_ranking":
-				var gr GetRankingMessage
-				if err := json.Unmarshal(body, &gr); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if err := p.onGetRanking(gr.PublicKey, outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}	
-				
-			case "get_rankings":
-				var gr GetRankingsMessage
-				if err := json.Unmarshal(body, &gr); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if err := p.onGetRankings(gr.PublicKeys, outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
+	case "get_plot_header_by_height":
+		var gbhbh GetPlotHeaderByHeightMessage
+		if err := json.Unmarshal(body, &gbhbh); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onGetPlotHeaderByHeight(gbhbh.Height, gbhbh.TipID, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "get_imbalance":
-				var gb GetImbalanceMessage
-				if err := json.Unmarshal(body, &gb); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if err := p.onGetImbalance(gb.PublicKey, outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
+	case "get_graph":
+		var gn GetGraphMessage
+		if err := json.Unmarshal(body, &gn); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onGetGraph(gn.PublicKey, gn.Scale, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}	
 
-			case "get_imbalances":
-				var gb GetImbalancesMessage
-				if err := json.Unmarshal(body, &gb); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if err := p.onGetImbalances(gb.PublicKeys, outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
+	case "get_graph_stats":
+		if err := p.onGetGraphStats(outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "get_public_key_representations":
-				var gpkt GetPublicKeyRepresentationsMessage
-				if err := json.Unmarshal(body, &gpkt); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if err := p.onGetPublicKeyRepresentations(gpkt.PublicKey,
-					gpkt.StartHeight, gpkt.EndHeight, gpkt.StartIndex, gpkt.Limit, outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
+	case "get_ranking":
+		var gr GetRankingMessage
+		if err := json.Unmarshal(body, &gr); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onGetRanking(gr.PublicKey, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}	
+		
+	case "get_scriber_rewards":
+		var gsr GetScriberRewardsMessage
+		if err := json.Unmarshal(body, &gsr); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onGetScriberRewards(gsr.PublicKey, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "get_representation":
-				var gt GetRepresentationMessage
-				if err := json.Unmarshal(body, &gt); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if err := p.onGetRepresentation(gt.RepresentationID, outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
+	case "get_rankings":
+		var gr GetRankingsMessage
+		if err := json.Unmarshal(body, &gr); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onGetRankings(gr.PublicKeys, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "get_tip_header":
-				if err := p.onGetTipHeader(outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
+	case "get_imbalance":
+		var gb GetImbalanceMessage
+		if err := json.Unmarshal(body, &gb); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onGetImbalance(gb.PublicKey, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "push_representation":
-				var pt PushRepresentationMessage
-				if err := json.Unmarshal(body, &pt); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if pt.Representation == nil {
-					log.Printf("Error: received nil representation, from: %s\n", p.conn.RemoteAddr())
-					return
-				}
-				if err := p.onPushRepresentation(pt.Representation, outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
+	case "get_public_key_first_seen":
+		var gf GetPublicKeyFirstSeenMessage
+		if err := json.Unmarshal(body, &gf); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onGetPublicKeyFirstSeen(gf.PublicKey, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "push_representation_result":
-				var ptr PushRepresentationResultMessage
-				if err := json.Unmarshal(body, &ptr); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if len(ptr.Error) != 0 {
-					log.Printf("Error: %s, from: %s\n", ptr.Error, p.conn.RemoteAddr())
-				}
+	case "get_imbalances":
+		var gb GetImbalancesMessage
+		if err := json.Unmarshal(body, &gb); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onGetImbalances(gb.PublicKeys, gb.Encoding, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "filter_load":
-				var fl FilterLoadMessage
-				if err := json.Unmarshal(body, &fl); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if err := p.onFilterLoad(fl.Type, fl.Filter, outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
+	case "get_public_key_representations":
+		var gpkt GetPublicKeyRepresentationsMessage
+		if err := json.Unmarshal(body, &gpkt); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onGetPublicKeyRepresentations(gpkt.PublicKey,
+			gpkt.StartHeight, gpkt.EndHeight, gpkt.StartIndex, gpkt.Limit, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "filter_add":
-				var fa FilterAddMessage
-				if err := json.Unmarshal(body, &fa); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if err := p.onFilterAdd(fa.PublicKeys, outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
+	case "get_public_key_history":
+		var gpkh GetPublicKeyHistoryMessage
+		if err := json.Unmarshal(body, &gpkh); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onGetPublicKeyHistory(gpkh.PublicKey, gpkh.Cursor, gpkh.Limit, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "get_filter_representation_queue":
-				p.onGetFilterRepresentationQueue(outChan)
+	case "get_representation":
+		var gt GetRepresentationMessage
+		if err := json.Unmarshal(body, &gt); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onGetRepresentation(gt.RepresentationID, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "get_peer_addresses":
-				if err := p.onGetPeerAddresses(outChan); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					break
-				}
+	case "get_tip_header":
+		if err := p.onGetTipHeader(outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "peer_addresses":
-				var pa PeerAddressesMessage
-				if err := json.Unmarshal(body, &pa); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				p.onPeerAddresses(pa.Addresses)
+	case "get_confirmed_representation_count":
+		if err := p.onGetConfirmedRepresentationCount(outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			case "get_work":
-				var gw GetWorkMessage
-				if err := json.Unmarshal(body, &gw); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				log.Printf("Received get_work message, from: %s\n", p.conn.RemoteAddr())
-				getWorkChan <- gw
+	case "get_queue_policy":
+		p.onGetQueuePolicy(outChan)
 
-			case "submit_work":
-				var sw SubmitWorkMessage
-				if err := json.Unmarshal(body, &sw); err != nil {
-					log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
-					return
-				}
-				if sw.Header == nil {
-					log.Printf("Error: received nil header, from: %s\n", p.conn.RemoteAddr())
-					return
-				}
-				log.Printf("Received submit_work message, from: %s\n", p.conn.RemoteAddr())
-				submitWorkChan <- sw
+	case "get_reorgs":
+		p.onGetReorgs(outChan)
+
+	case "get_status":
+		if err := p.onGetStatus(outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
+
+	case "push_representation":
+		var pt PushRepresentationMessage
+		if err := json.Unmarshal(body, &pt); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if pt.Representation == nil {
+			log.Printf("Error: received nil representation, from: %s\n", p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onPushRepresentation(pt.Representation, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
+
+	case "push_representation_result":
+		var ptr PushRepresentationResultMessage
+		if err := json.Unmarshal(body, &ptr); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if len(ptr.Error) != 0 {
+			log.Printf("Error: %s, from: %s\n", ptr.Error, p.conn.RemoteAddr())
+		}
+
+	case "push_representations":
+		var pts PushRepresentationsMessage
+		if err := json.Unmarshal(body, &pts); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onPushRepresentations(pts.Representations, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
 
-			default:
-				log.Printf("Unknown message: %s, from: %s\n", m.Type, p.conn.RemoteAddr())
+	case "push_representations_result":
+		var ptsr PushRepresentationsResultMessage
+		if err := json.Unmarshal(body, &ptsr); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if len(ptsr.Error) != 0 {
+			log.Printf("Error: %s, from: %s\n", ptsr.Error, p.conn.RemoteAddr())
+		}
+		for _, ptr := range ptsr.Results {
+			if len(ptr.Error) != 0 {
+				log.Printf("Error: %s, from: %s\n", ptr.Error, p.conn.RemoteAddr())
 			}
+		}
 
-		case websocket.CloseMessage:
-			log.Printf("Received close message from: %s\n", p.conn.RemoteAddr())
+	case "filter_load":
+		var fl FilterLoadMessage
+		if err := json.Unmarshal(body, &fl); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onFilterLoad(fl.Type, fl.Filter, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
+
+	case "filter_add":
+		var fa FilterAddMessage
+		if err := json.Unmarshal(body, &fa); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if err := p.onFilterAdd(fa.PublicKeys, outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
 			break
 		}
+
+	case "get_filter_representation_queue":
+		p.onGetFilterRepresentationQueue(outChan)
+
+	case "get_peer_addresses":
+		if err := p.onGetPeerAddresses(outChan); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			break
+		}
+
+	case "peer_addresses":
+		var pa PeerAddressesMessage
+		if err := json.Unmarshal(body, &pa); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		p.onPeerAddresses(pa.Addresses)
+
+	case "get_work":
+		var gw GetWorkMessage
+		if err := json.Unmarshal(body, &gw); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		log.Printf("Received get_work message, from: %s\n", p.conn.RemoteAddr())
+		getWorkChan <- gw
+
+	case "submit_work":
+		var sw SubmitWorkMessage
+		if err := json.Unmarshal(body, &sw); err != nil {
+			log.Printf("Error: %s, from: %s\n", err, p.conn.RemoteAddr())
+			return false, true
+		}
+		if sw.Header == nil {
+			log.Printf("Error: received nil header, from: %s\n", p.conn.RemoteAddr())
+			return false, true
+		}
+		log.Printf("Received submit_work message, from: %s\n", p.conn.RemoteAddr())
+		submitWorkChan <- sw
+
+	default:
+		log.Printf("Unknown message: %s, from: %s\n", msgType, p.conn.RemoteAddr())
 	}
+	return newPlot, false
+}
+
+// Run a message handler on the calling goroutine recovering from any panic. If it doesn't complete
+// before the timeout onTimeout is called, e.g. to close the connection so the handler's reads and
+// writes fail, and an error is returned once the handler does complete
+func runMessageHandler(msgType string, timeout time.Duration, onTimeout, handler func()) (err error) {
+	timer := time.AfterFunc(timeout, onTimeout)
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic handling %s message: %v\n%s", msgType, r, debug.Stack())
+			err = fmt.Errorf("Handler for %s message panicked: %v", msgType, r)
+		}
+		if !timer.Stop() && err == nil {
+			err = fmt.Errorf("Handler for %s message didn't complete within %s", msgType, timeout)
+		}
+	}()
+	handler()
+	return nil
 }
 
 // Handle a message from a peer indicating plot inventory available for download
@@ -837,17 +989,12 @@ func (p *Peer) onGetPlot(id PlotID, outChan chan<- Message) error {
 // Handle a request for a plot by height from a peer
 func (p *Peer) onGetPlotByHeight(height int64, outChan chan<- Message) error {
 	log.Printf("Received get_plot_by_height: %d, from: %s\n", height, p.conn.RemoteAddr())
-	id, err := p.ledger.GetPlotIDForHeight(height)
+	id, err := p.plotIDForRequestedHeight(height, nil)
 	if err != nil {
 		// not found
-		outChan <- Message{Type: "plot"}
+		outChan <- Message{Type: "plot", Body: PlotMessage{Error: err.Error()}}
 		return err
 	}
-	if id == nil {
-		// not found
-		outChan <- Message{Type: "plot"}
-		return fmt.Errorf("No plot found at height %d", height)
-	}
 	return p.getPlot(*id, outChan)
 }
 
@@ -857,19 +1004,21 @@ func (p *Peer) getPlot(id PlotID, outChan chan<- Message) error {
 	if err != nil {
 		// not found
 		outChan <- Message{Type: "plot", Body: PlotMessage{PlotID: &id}}
+		if err == ErrPlotNotFound {
+			return fmt.Errorf("No plot found with ID %s", id)
+		}
 		return err
 	}
-	if len(plotJson) == 0 {
-		// not found
-		outChan <- Message{Type: "plot", Body: PlotMessage{PlotID: &id}}
-		return fmt.Errorf("No plot found with ID %s", id)
-	}
 
 	// send out the raw bytes
 	body := []byte(`{"plot_id":"`)
 	body = append(body, []byte(id.String())...)
 	body = append(body, []byte(`","plot":`)...)
 	body = append(body, plotJson...)
+	if branchType, err := p.ledger.GetBranchType(id); err == nil {
+		// let the client know if the plot is canonical
+		body = append(body, []byte(`,"branch":"`+branchType.String()+`"`)...)
+	}
 	body = append(body, []byte(`}`)...)
 	outChan <- Message{Type: "plot", Body: json.RawMessage(body)}
 
@@ -929,12 +1078,12 @@ func (p *Peer) onPlot(plot *Plot, ibd bool, outChan chan<- Message) (bool, error
 	var accepted bool
 
 	// is it an orphan?
-	header, _, err := p.plotStore.GetPlotHeader(plot.Header.Previous)
-	if err != nil || header == nil {
+	_, _, err = p.plotStore.GetPlotHeader(plot.Header.Previous)
+	if err != nil {
 		p.localInflightQueue.Remove(id, "")
 		p.globalInflightQueue.Remove(id, p.conn.RemoteAddr().String())
 
-		if err != nil {
+		if err != ErrPlotNotFound {
 			return false, err
 		}
 
@@ -948,6 +1097,12 @@ func (p *Peer) onPlot(plot *Plot, ibd bool, outChan chan<- Message) (bool, error
 	} else {
 		// process the plot
 		if err := p.processor.ProcessPlot(id, plot, p.conn.RemoteAddr().String()); err != nil {
+			if err == ErrOrphanPlot {
+				// its parent was stored but not processed yet. the processor holds on to it
+				p.localInflightQueue.Remove(id, "")
+				p.globalInflightQueue.Remove(id, p.conn.RemoteAddr().String())
+				return false, err
+			}
 			// disconnect a peer that sends us a bad plot
 			p.conn.Close()
 			return false, err
@@ -1036,12 +1191,12 @@ func (p *Peer) sendFindCommonAncestor(startID *PlotID, writeNow bool, outChan ch
 		}
 	} else {
 		header, _, err := p.plotStore.GetPlotHeader(*startID)
+		if err == ErrPlotNotFound {
+			return fmt.Errorf("No header for plot %s", *startID)
+		}
 		if err != nil {
 			return err
 		}
-		if header == nil {
-			return fmt.Errorf("No header for plot %s", *startID)
-		}
 		height = header.Height
 	}
 	id := startID
@@ -1089,13 +1244,13 @@ func (p *Peer) onFindCommonAncestor(id PlotID, index, length int, outChan chan<-
 		id, index, length, p.conn.RemoteAddr())
 
 	header, _, err := p.plotStore.GetPlotHeader(id)
-	if err != nil {
-		return false, err
-	}
-	if header == nil {
+	if err == ErrPlotNotFound {
 		// don't have it
 		return false, nil
 	}
+	if err != nil {
+		return false, err
+	}
 	branchType, err := p.ledger.GetBranchType(id)
 	if err != nil {
 		return false, err
@@ -1142,20 +1297,86 @@ func (p *Peer) onGetPlotHeader(id PlotID, outChan chan<- Message) error {
 }
 
 // Handle a request for a plot header by ID from a peer
-func (p *Peer) onGetPlotHeaderByHeight(height int64, outChan chan<- Message) error {
+func (p *Peer) onGetPlotHeaderByHeight(height int64, tipID *PlotID, outChan chan<- Message) error {
 	log.Printf("Received get_plot_header_by_height: %d, from: %s\n", height, p.conn.RemoteAddr())
-	id, err := p.ledger.GetPlotIDForHeight(height)
+	id, err := p.plotIDForRequestedHeight(height, tipID)
 	if err != nil {
 		// not found
-		outChan <- Message{Type: "plot_header"}
+		outChan <- Message{Type: "plot_header", Body: PlotHeaderMessage{Error: err.Error()}}
 		return err
 	}
+	return p.getPlotHeader(*id, outChan)
+}
+
+// Return the ID of the plot at a height requested by a peer like plotIDAtHeight. Negative heights
+// and those above the tip are a HeightOutOfRangeError and ErrNotSynced is returned if we have no tip
+func (p *Peer) plotIDForRequestedHeight(height int64, tipID *PlotID) (*PlotID, error) {
+	if height < 0 {
+		return nil, HeightOutOfRangeError{Height: height}
+	}
+	if tipID == nil {
+		mainTipID, tipHeight, err := p.ledger.GetThreadTip()
+		if err != nil {
+			return nil, err
+		}
+		if mainTipID == nil {
+			return nil, ErrNotSynced
+		}
+		if height > tipHeight {
+			return nil, HeightOutOfRangeError{Height: height, TipHeight: tipHeight}
+		}
+	}
+	id, err := p.plotIDAtHeight(height, tipID)
+	if err != nil {
+		return nil, err
+	}
 	if id == nil {
-		// not found
-		outChan <- Message{Type: "plot_header"}
-		return fmt.Errorf("No plot found at height %d", height)
+		if tipID != nil {
+			tipHeader, _, err := p.plotStore.GetPlotHeader(*tipID)
+			if err != nil {
+				return nil, err
+			}
+			return nil, HeightOutOfRangeError{Height: height, TipHeight: tipHeader.Height}
+		}
+		// the tip moved
+		return nil, fmt.Errorf("No plot at height %d", height)
+	}
+	return id, nil
+}
+
+// Return the ID of the main branch plot at the given height or, if tipID is set,
+// the ID of that plot's ancestor at the given height. Returns nil if there's no such plot
+func (p *Peer) plotIDAtHeight(height int64, tipID *PlotID) (*PlotID, error) {
+	if tipID == nil {
+		return p.ledger.GetPlotIDForHeight(height)
+	}
+
+	id := *tipID
+	for {
+		header, _, err := p.plotStore.GetPlotHeader(id)
+		if err == ErrPlotNotFound {
+			return nil, fmt.Errorf("Plot header for %s not found", id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Height < height {
+			// above the tip
+			return nil, nil
+		}
+		if header.Height == height {
+			return &id, nil
+		}
+		branchType, err := p.ledger.GetBranchType(id)
+		if err != nil {
+			return nil, err
+		}
+		if branchType == MAIN {
+			// the rest of the way is on the main branch
+			return p.ledger.GetPlotIDForHeight(height)
+		}
+		id = header.Previous
 	}
-	return p.getPlotHeader(*id, outChan)
 }
 
 func (p *Peer) getPlotHeader(id PlotID, outChan chan<- Message) error {
@@ -1163,30 +1384,35 @@ func (p *Peer) getPlotHeader(id PlotID, outChan chan<- Message) error {
 	if err != nil {
 		// not found
 		outChan <- Message{Type: "plot_header", Body: PlotHeaderMessage{PlotID: &id}}
+		if err == ErrPlotNotFound {
+			return fmt.Errorf("Plot header for %s not found", id)
+		}
 		return err
 	}
-	if header == nil {
-		// not found
-		outChan <- Message{Type: "plot_header", Body: PlotHeaderMessage{PlotID: &id}}
-		return fmt.Errorf("Plot header for %s not found", id)
-	}
 	outChan <- Message{Type: "plot_header", Body: PlotHeaderMessage{PlotID: &id, PlotHeader: header}}
 	return nil
 }
 
 // Handle a request for a public key's plot graph
-func (p *Peer) onGetGraph(pubKey ed25519.PublicKey, outChan chan<- Message) error {
+func (p *Peer) onGetGraph(pubKey ed25519.PublicKey, scaleName string, outChan chan<- Message) error {
 	log.Printf("Received get_graph from: %s\n", p.conn.RemoteAddr())
 
+	scale, err := NodeScaleByName(scaleName)
+	if err != nil {
+		outChan <- Message{Type: "graph", Body: GraphMessage{PublicKey: pubKey}}
+		return err
+	}
+
 	pk := pubKeyToString(pubKey)
 
-	plotGraph := p.indexer.txGraph.ToDOT(pk)
+	plotGraph := p.indexer.txGraph.ToDOT(pk, scale)
+	latestID, latestHeight := p.indexer.LatestIndexed()
 
 	outChan <- Message{
 		Type: "graph",
 		Body: GraphMessage{
-			PlotID:   p.indexer.latestPlotID,
-			Height:    p.indexer.latestHeight,
+			PlotID:   latestID,
+			Height:    latestHeight,
 			PublicKey: pubKey,
 			Graph:   plotGraph,
 		},
@@ -1195,35 +1421,64 @@ func (p *Peer) onGetGraph(pubKey ed25519.PublicKey, outChan chan<- Message) erro
 	return nil
 }
 
+// Handle a request for the graph's summary statistics
+func (p *Peer) onGetGraphStats(outChan chan<- Message) error {
+	log.Printf("Received get_graph_stats from: %s\n", p.conn.RemoteAddr())
+
+	latestID, latestHeight := p.indexer.LatestIndexed()
+	outChan <- Message{
+		Type: "graph_stats",
+		Body: GraphStatsMessage{
+			PlotID: latestID,
+			Height: latestHeight,
+			Stats:  p.indexer.txGraph.Stats(),
+		},
+	}
+	return nil
+}
+
+// Handle a request for a public key's total plot rewards
+func (p *Peer) onGetScriberRewards(pubKey ed25519.PublicKey, outChan chan<- Message) error {
+	log.Printf("Received get_scriber_rewards from: %s\n", p.conn.RemoteAddr())
+
+	latestID, latestHeight := p.indexer.LatestIndexed()
+	outChan <- Message{
+		Type: "scriber_rewards",
+		Body: ScriberRewardsMessage{
+			PlotID:    latestID,
+			Height:    latestHeight,
+			PublicKey: pubKey,
+			Rewards:   p.indexer.ScriberRewards(pubKey),
+		},
+	}
+	return nil
+}
+
 // Handle a request for a public key's representivity ranking
 func (p *Peer) onGetRanking(pubKey ed25519.PublicKey, outChan chan<- Message) error {
 	log.Printf("Received get_ranking from: %s\n", p.conn.RemoteAddr())
 
 	pk := pubKeyToString(pubKey)
 
-	graph := p.indexer.txGraph
-
-	pkIndex, ok := graph.index[pk]
-	
+	ranking, ok := p.indexer.txGraph.ranking(pk)
+	latestID, latestHeight := p.indexer.LatestIndexed()
 
 	if ok {
-		node := graph.nodes[pkIndex]
-
 		outChan <- Message{
 			Type: "ranking",
 			Body: RankingMessage{
-				PlotID:   p.indexer.latestPlotID,
-				Height:    p.indexer.latestHeight,
+				PlotID:   latestID,
+				Height:    latestHeight,
 				PublicKey: pubKey,
-				Ranking:   node.ranking,
+				Ranking:   ranking,
 			},
 		}
 	}else {
 		outChan <- Message{
 			Type: "ranking",
 			Body: RankingMessage{
-				PlotID:   p.indexer.latestPlotID,
-				Height:    p.indexer.latestHeight,
+				PlotID:   latestID,
+				Height:    latestHeight,
 				PublicKey: pubKey,
 				Ranking:      0.00,
 			},
@@ -1245,10 +1500,11 @@ func (p *Peer) onGetRankings(pubKeys []ed25519.PublicKey, outChan chan<- Message
 	}
 
 	rankings := p.indexer.txGraph.rankings(pubKeys)
+	latestID, latestHeight := p.indexer.LatestIndexed()
 
 	rm := RankingsMessage{
-		PlotID: p.indexer.latestPlotID, 
-		Height: p.indexer.latestHeight,
+		PlotID: latestID,
+		Height: latestHeight,
 	}
 	rm.Rankings = make([]PublicKeyRanking, len(rankings))
 
@@ -1293,10 +1549,36 @@ func (p *Peer) onGetImbalance(pubKey ed25519.PublicKey, outChan chan<- Message)
 	return nil
 }
 
+// Handle a request for the height at which a public key first appeared on the main thread.
+func (p *Peer) onGetPublicKeyFirstSeen(pubKey ed25519.PublicKey, outChan chan<- Message) error {
+	log.Printf("Received get_public_key_first_seen from: %s\n", p.conn.RemoteAddr())
+
+	height, seen, err := p.ledger.GetPublicKeyFirstSeen(pubKey)
+	if err != nil {
+		outChan <- Message{
+			Type: "public_key_first_seen",
+			Body: PublicKeyFirstSeenMessage{PublicKey: pubKey, Error: err.Error()},
+		}
+		return err
+	}
+
+	outChan <- Message{
+		Type: "public_key_first_seen",
+		Body: PublicKeyFirstSeenMessage{PublicKey: pubKey, Height: height, Seen: seen},
+	}
+	return nil
+}
+
 // Handle a request for a set of public key imbalances.
-func (p *Peer) onGetImbalances(pubKeys []ed25519.PublicKey, outChan chan<- Message) error {
+func (p *Peer) onGetImbalances(pubKeys []ed25519.PublicKey, encoding string, outChan chan<- Message) error {
 	log.Printf("Received get_imbalances (count: %d) from: %s\n", len(pubKeys), p.conn.RemoteAddr())
 
+	if len(encoding) != 0 && encoding != IMBALANCES_ENCODING_BINARY {
+		err := fmt.Errorf("Unknown imbalances encoding: %s", encoding)
+		outChan <- Message{Type: "imbalances", Body: ImbalancesMessage{Error: err.Error()}}
+		return err
+	}
+
 	maxPublicKeys := 64
 	if len(pubKeys) > maxPublicKeys {
 		err := fmt.Errorf("Too many public keys, limit: %d", maxPublicKeys)
@@ -1321,6 +1603,15 @@ func (p *Peer) onGetImbalances(pubKeys []ed25519.PublicKey, outChan chan<- Messa
 		i++
 	}
 
+	if encoding == IMBALANCES_ENCODING_BINARY {
+		encoded, err := EncodeImbalances(bm.Imbalances)
+		if err != nil {
+			outChan <- Message{Type: "imbalances", Body: ImbalancesMessage{Error: err.Error()}}
+			return err
+		}
+		bm.Imbalances, bm.EncodedImbalances = nil, encoded
+	}
+
 	outChan <- Message{Type: "imbalances", Body: bm}
 	return nil
 }
@@ -1350,6 +1641,24 @@ func (p *Peer) onGetPublicKeyRepresentations(pubKey ed25519.PublicKey,
 	}
 
 	// build filter plots from the indices
+	fbs := p.createHistoryFilterPlots(bIDs, indices)
+
+	// send it to the writer
+	outChan <- Message{
+		Type: "public_key_representations",
+		Body: PublicKeyRepresentationsMessage{
+			PublicKey:    pubKey,
+			StartHeight:  startHeight,
+			StopHeight:   stopHeight,
+			StopIndex:    stopIndex,
+			FilterPlots: fbs,
+		},
+	}
+	return nil
+}
+
+// Group the representations at the given plot IDs and indices into filter plots
+func (p *Peer) createHistoryFilterPlots(bIDs []PlotID, indices []int) []*FilterPlotMessage {
 	var fbs []*FilterPlotMessage
 	for i, plotID := range bIDs {
 		// fetch representation and header
@@ -1376,21 +1685,77 @@ func (p *Peer) onGetPublicKeyRepresentations(pubKey ed25519.PublicKey,
 		}
 		fb.Representations = append(fb.Representations, tx)
 	}
+	return fbs
+}
 
-	// send it to the writer
-	outChan <- Message{
-		Type: "public_key_representations",
-		Body: PublicKeyRepresentationsMessage{
-			PublicKey:    pubKey,
-			StartHeight:  startHeight,
-			StopHeight:   stopHeight,
-			StopIndex:    stopIndex,
-			FilterPlots: fbs,
-		},
+// Handle a request for a public key's entire representation history
+func (p *Peer) onGetPublicKeyHistory(pubKey ed25519.PublicKey, cursor *PublicKeyHistoryCursor, limit int,
+	outChan chan<- Message) error {
+	log.Printf("Received get_public_key_history from: %s\n", p.conn.RemoteAddr())
+	history, err := p.getPublicKeyHistory(pubKey, cursor, limit)
+	if err != nil {
+		outChan <- Message{Type: "public_key_history", Body: PublicKeyHistoryMessage{PublicKey: pubKey, Error: err.Error()}}
+		return err
 	}
+	outChan <- Message{Type: "public_key_history", Body: history}
 	return nil
 }
 
+// Fetch the next page of a public key's representation history starting from the cursor or,
+// if it's nil, the key's first appearance on the main thread
+func (p *Peer) getPublicKeyHistory(pubKey ed25519.PublicKey, cursor *PublicKeyHistoryCursor, limit int) (
+	PublicKeyHistoryMessage, error) {
+	history := PublicKeyHistoryMessage{PublicKey: pubKey}
+
+	// enforce our limit
+	if limit > 32 || limit <= 0 {
+		limit = 32
+	}
+
+	tipID, tipHeight, err := p.ledger.GetThreadTip()
+	if err != nil {
+		return history, err
+	}
+	if tipID == nil {
+		return history, ErrNotSynced
+	}
+	history.TipHeight = tipHeight
+
+	var startHeight int64
+	var startIndex int
+	if cursor != nil {
+		if cursor.Height < 0 || cursor.Index < 0 {
+			return history, fmt.Errorf("Invalid cursor at height %d, index %d", cursor.Height, cursor.Index)
+		}
+		startHeight, startIndex = cursor.Height, cursor.Index
+	} else {
+		firstSeen, seen, err := p.ledger.GetPublicKeyFirstSeen(pubKey)
+		if err != nil {
+			return history, err
+		}
+		if !seen {
+			// no history
+			return history, nil
+		}
+		startHeight = firstSeen
+	}
+	if startHeight > tipHeight {
+		return history, nil
+	}
+
+	bIDs, indices, stopHeight, stopIndex, err := p.ledger.GetPublicKeyRepresentationIndicesRange(
+		pubKey, startHeight, tipHeight, startIndex, limit)
+	if err != nil {
+		return history, err
+	}
+	history.FilterPlots = p.createHistoryFilterPlots(bIDs, indices)
+	if len(indices) == limit {
+		// there may be more
+		history.Cursor = &PublicKeyHistoryCursor{Height: stopHeight, Index: stopIndex + 1}
+	}
+	return history, nil
+}
+
 // Handle a request for a representation
 func (p *Peer) onGetRepresentation(txID RepresentationID, outChan chan<- Message) error {
 	log.Printf("Received get_representation for %s, from: %s\n",
@@ -1411,20 +1776,21 @@ func (p *Peer) onGetRepresentation(txID RepresentationID, outChan chan<- Message
 	if err != nil {
 		// odd case but send back what we know at least
 		outChan <- Message{Type: "representation", Body: RepresentationMessage{PlotID: plotID, RepresentationID: txID}}
+		if err == ErrRepresentationNotFound {
+			return fmt.Errorf("Representation at plot %s, index %d not found",
+				*plotID, index)
+		}
 		return err
 	}
-	if tx == nil {
-		// another odd case
-		outChan <- Message{
-			Type: "representation",
-			Body: RepresentationMessage{
-				PlotID:       plotID,
-				Height:        header.Height,
-				RepresentationID: txID,
-			},
-		}
-		return fmt.Errorf("Representation at plot %s, index %d not found",
-			*plotID, index)
+
+	// let the client know if the plot is canonical and how deep it is
+	var branch string
+	if branchType, err := p.ledger.GetBranchType(*plotID); err == nil {
+		branch = branchType.String()
+	}
+	confirmations, _, err := p.ledger.GetRepresentationConfirmations(txID)
+	if err != nil {
+		log.Printf("Error retrieving confirmations for representation %s: %s\n", txID, err)
 	}
 
 	// send it
@@ -1435,11 +1801,103 @@ func (p *Peer) onGetRepresentation(txID RepresentationID, outChan chan<- Message
 			Height:        header.Height,
 			RepresentationID: txID,
 			Representation:   tx,
+			Branch:           branch,
+			Confirmations:    confirmations,
 		},
 	}
 	return nil
 }
 
+// Handle a request for the number of confirmed representations from a peer
+func (p *Peer) onGetConfirmedRepresentationCount(outChan chan<- Message) error {
+	log.Printf("Received get_confirmed_representation_count, from: %s\n", p.conn.RemoteAddr())
+	tipID, tipHeight, err := p.ledger.GetThreadTip()
+	if err != nil {
+		outChan <- Message{
+			Type: "confirmed_representation_count",
+			Body: ConfirmedRepresentationCountMessage{Error: err.Error()},
+		}
+		return err
+	}
+	count, err := p.ledger.GetConfirmedRepresentationCount()
+	if err != nil {
+		outChan <- Message{
+			Type: "confirmed_representation_count",
+			Body: ConfirmedRepresentationCountMessage{Error: err.Error()},
+		}
+		return err
+	}
+	outChan <- Message{
+		Type: "confirmed_representation_count",
+		Body: ConfirmedRepresentationCountMessage{PlotID: tipID, Height: tipHeight, Count: count},
+	}
+	return nil
+}
+
+// Handle a request for the representation queue's admission policy from a peer
+func (p *Peer) onGetQueuePolicy(outChan chan<- Message) {
+	log.Printf("Received get_queue_policy, from: %s\n", p.conn.RemoteAddr())
+	outChan <- Message{
+		Type: "queue_policy",
+		Body: QueuePolicyMessage{
+			Length:      p.txQueue.Len(),
+			Capacity:    MAX_REPRESENTATION_QUEUE_LENGTH,
+			SenderLimit: p.txQueue.SenderLimit(),
+		},
+	}
+}
+
+// Handle a request for our recent main thread reorganizations
+func (p *Peer) onGetReorgs(outChan chan<- Message) {
+	log.Printf("Received get_reorgs, from: %s\n", p.conn.RemoteAddr())
+	reorgs := p.processor.ReorgEvents()
+	if reorgs == nil {
+		reorgs = []ReorgEvent{}
+	}
+	outChan <- Message{Type: "reorgs", Body: ReorgsMessage{Reorgs: reorgs}}
+}
+
+// Handle a request for a summary of our state from a peer
+func (p *Peer) onGetStatus(outChan chan<- Message) error {
+	log.Printf("Received get_status, from: %s\n", p.conn.RemoteAddr())
+	status, err := p.getStatus()
+	if err != nil {
+		outChan <- Message{Type: "status", Body: StatusMessage{Protocol: Protocol, Error: err.Error()}}
+		return err
+	}
+	outChan <- Message{Type: "status", Body: status}
+	return nil
+}
+
+// Gather a summary of our state from the ledger, queue and indexer
+func (p *Peer) getStatus() (StatusMessage, error) {
+	status := StatusMessage{
+		Protocol:    Protocol,
+		QueueLength: p.txQueue.Len(),
+		Uptime:      int64(time.Since(p.startTime).Seconds()),
+	}
+	if p.peerCount != nil {
+		status.Peers = p.peerCount()
+	}
+
+	tipID, tipHeader, _, err := getThreadTipHeader(p.ledger, p.plotStore)
+	if err != nil {
+		return status, err
+	}
+	if tipHeader != nil {
+		status.PlotID = tipID
+		status.Height = tipHeader.Height
+		status.ThreadWork = &tipHeader.ThreadWork
+	}
+
+	if p.indexer != nil {
+		if status.IndexerCaughtUp, err = p.indexer.IsCaughtUp(); err != nil {
+			return status, err
+		}
+	}
+	return status, nil
+}
+
 // Handle a request for a plot header of the tip of the main thread from a peer
 func (p *Peer) onGetTipHeader(outChan chan<- Message) error {
 	log.Printf("Received get_tip_header, from: %s\n", p.conn.RemoteAddr())
@@ -1488,44 +1946,101 @@ func (p *Peer) onPushRepresentation(tx *Representation, outChan chan<- Message)
 	return err
 }
 
+// Handle a batch of representations pushed to us from a peer
+func (p *Peer) onPushRepresentations(txs []*Representation, outChan chan<- Message) error {
+	log.Printf("Received push_representations (representations: %d), from: %s\n",
+		len(txs), p.conn.RemoteAddr())
+
+	result, err := p.pushRepresentations(txs, p.conn.RemoteAddr().String())
+	outChan <- Message{Type: "push_representations_result", Body: result}
+	return err
+}
+
+// Process each representation in the batch independently and collect the individual results
+func (p *Peer) pushRepresentations(txs []*Representation, source string) (PushRepresentationsResultMessage, error) {
+	// check limit
+	if len(txs) > MAX_REPRESENTATIONS_PER_PUSH {
+		err := fmt.Errorf("Too many representations, limit: %d", MAX_REPRESENTATIONS_PER_PUSH)
+		return PushRepresentationsResultMessage{Error: err.Error()}, err
+	}
+
+	results := make([]PushRepresentationResultMessage, len(txs))
+	for i, tx := range txs {
+		if tx == nil {
+			results[i].Error = "Received nil representation"
+			continue
+		}
+		id, err := tx.ID()
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].RepresentationID = id
+
+		// process the representation if this is the first time we've seen it
+		if !p.txQueue.Exists(id) {
+			if err := p.processor.ProcessRepresentation(id, tx, source); err != nil {
+				results[i].Error = err.Error()
+			}
+		}
+	}
+	return PushRepresentationsResultMessage{Results: results}, nil
+}
+
 // Handle a request to set a representation filter for the connection
 func (p *Peer) onFilterLoad(filterType string, filterBytes []byte, outChan chan<- Message) error {
 	log.Printf("Received filter_load (size: %d), from: %s\n", len(filterBytes), p.conn.RemoteAddr())
 
-	// check filter type
-	if filterType != "cuckoo" {
-		err := fmt.Errorf("Unsupported filter type: %s", filterType)
+	if err := p.loadFilter(filterType, filterBytes); err != nil {
 		result := FilterResultMessage{Error: err.Error()}
 		outChan <- Message{Type: "filter_result", Body: result}
 		return err
 	}
 
-	// check limit
-	maxSize := 1 << 16
-	if len(filterBytes) > maxSize {
-		err := fmt.Errorf("Filter too large, max: %d\n", maxSize)
-		result := FilterResultMessage{Error: err.Error()}
-		outChan <- Message{Type: "filter_result", Body: result}
+	// send the empty result
+	outChan <- Message{Type: "filter_result"}
+	return nil
+}
+
+// Replace this connection's filter. Filter state is never shared between peers
+func (p *Peer) loadFilter(filterType string, filterBytes []byte) error {
+	// check filter type
+	if filterType != "cuckoo" {
+		return fmt.Errorf("Unsupported filter type: %s", filterType)
+	}
+
+	// check size and layout before decoding
+	if err := checkCuckooFilterBytes(filterBytes, p.maxFilterSize); err != nil {
 		return err
 	}
 
 	// decode it
 	filter, err := cuckoo.Decode(filterBytes)
 	if err != nil {
-		result := FilterResultMessage{Error: err.Error()}
-		outChan <- Message{Type: "filter_result", Body: result}
 		return err
 	}
 
 	// set the filter
-	func() {
-		p.filterLock.Lock()
-		defer p.filterLock.Unlock()
-		p.filter = filter
-	}()
+	p.filterLock.Lock()
+	defer p.filterLock.Unlock()
+	p.filter = filter
+	return nil
+}
 
-	// send the empty result
-	outChan <- Message{Type: "filter_result"}
+// Sanity check an encoded cuckoo filter. It's a power of 2 number of buckets each holding
+// 4 single byte fingerprints. Anything else would decode into a filter with nonsensical parameters
+func checkCuckooFilterBytes(filterBytes []byte, maxSize int) error {
+	const bucketSize = 4
+	if len(filterBytes) > maxSize {
+		return fmt.Errorf("Filter too large, max: %d", maxSize)
+	}
+	if len(filterBytes) < bucketSize || len(filterBytes)%bucketSize != 0 {
+		return fmt.Errorf("Invalid filter size %d, must be a multiple of %d", len(filterBytes), bucketSize)
+	}
+	numBuckets := len(filterBytes) / bucketSize
+	if numBuckets&(numBuckets-1) != 0 {
+		return fmt.Errorf("Invalid filter bucket count %d, must be a power of 2", numBuckets)
+	}
 	return nil
 }
 
@@ -1543,25 +2058,9 @@ func (p *Peer) onFilterAdd(pubKeys []ed25519.PublicKey, outChan chan<- Message)
 		return err
 	}
 
-	err := func() error {
-		p.filterLock.Lock()
-		defer p.filterLock.Unlock()
-		// set the filter if it's not set
-		if p.filter == nil {
-			p.filter = cuckoo.NewFilter(1 << 16)
-		}
-		// perform the inserts
-		for _, pubKey := range pubKeys {
-			if !p.filter.Insert(pubKey[:]) {
-				return fmt.Errorf("Unable to insert into filter")
-			}
-		}
-		return nil
-	}()
-
 	// send the result
 	var m Message
-	if err != nil {
+	if err := p.addToFilter(pubKeys); err != nil {
 		m = Message{Type: "filter_result", Body: FilterResultMessage{Error: err.Error()}}
 	} else {
 		m = Message{Type: "filter_result"}
@@ -1570,10 +2069,31 @@ func (p *Peer) onFilterAdd(pubKeys []ed25519.PublicKey, outChan chan<- Message)
 	return nil
 }
 
+// Add public keys to this connection's filter, creating it if it's not set
+func (p *Peer) addToFilter(pubKeys []ed25519.PublicKey) error {
+	p.filterLock.Lock()
+	defer p.filterLock.Unlock()
+	// set the filter if it's not set
+	if p.filter == nil {
+		p.filter = cuckoo.NewFilter(1 << 16)
+	}
+	// perform the inserts
+	for _, pubKey := range pubKeys {
+		if !p.filter.Insert(pubKey[:]) {
+			return fmt.Errorf("Unable to insert into filter")
+		}
+	}
+	return nil
+}
+
 // Send back a filtered view of the representation queue
 func (p *Peer) onGetFilterRepresentationQueue(outChan chan<- Message) {
 	log.Printf("Received get_filter_representation_queue, from: %s\n", p.conn.RemoteAddr())
+	outChan <- Message{Type: "filter_representation_queue", Body: p.filterRepresentationQueue()}
+}
 
+// Returns a view of the representation queue filtered by this connection's filter
+func (p *Peer) filterRepresentationQueue() FilterRepresentationQueueMessage {
 	ftq := FilterRepresentationQueueMessage{}
 
 	p.filterLock.RLock()
@@ -1581,15 +2101,14 @@ func (p *Peer) onGetFilterRepresentationQueue(outChan chan<- Message) {
 	if p.filter == nil {
 		ftq.Error = "No filter set"
 	} else {
-		representations := p.txQueue.Get(0)
+		representations := p.txQueue.GetAll()
 		for _, tx := range representations {
 			if p.filterLookup(tx) {
 				ftq.Representations = append(ftq.Representations, tx)
 			}
 		}
 	}
-
-	outChan <- Message{Type: "filter_representation_queue", Body: ftq}
+	return ftq
 }
 
 // Returns true if the representation is of interest to the peer
@@ -1606,6 +2125,44 @@ func (p *Peer) filterLookup(tx *Representation) bool {
 	return p.filter.Lookup(tx.To[:])
 }
 
+// Returns true if a newly verified representation should be relayed to the peer given the
+// current tip height.
+func (p *Peer) shouldRelay(tx *Representation, tipHeight int64) bool {
+	interested := func() bool {
+		p.filterLock.RLock()
+		defer p.filterLock.RUnlock()
+		return p.filterLookup(tx)
+	}()
+	if !interested {
+		return false
+	}
+
+	// the tip may have moved on before we got to it
+	return !tx.IsExpired(tipHeight + 1)
+}
+
+// Create the message announcing a tip change to the peer. Plots are never relayed unsolicited.
+// Peers with a filter loaded get the plot's matching representations in a filter_plot, or
+// filter_plot_undo on disconnection, and others get an inv_plot for newly connected plots and can
+// request the plot if they want it. Returns nil if there's nothing to send.
+func (p *Peer) createTipAnnouncement(tip TipChange) (*Message, error) {
+	fb, err := p.createFilterPlot(tip.PlotID, tip.Plot)
+	if err != nil {
+		return nil, err
+	}
+	if fb != nil {
+		m := &Message{Type: "filter_plot", Body: fb}
+		if !tip.Connect {
+			m.Type = "filter_plot_undo"
+		}
+		return m, nil
+	}
+	if !tip.Connect {
+		return nil, nil
+	}
+	return &Message{Type: "inv_plot", Body: InvPlotMessage{PlotIDs: []PlotID{tip.PlotID}}}, nil
+}
+
 // Called from the writer context
 func (p *Peer) createFilterPlot(id PlotID, plot *Plot) (*FilterPlotMessage, error) {
 	p.filterLock.RLock()
@@ -1672,11 +2229,7 @@ func (p *Peer) onGetWork(gw GetWorkMessage) {
 	var err error
 	if p.workPlot != nil {
 		err = fmt.Errorf("Peer already has work")
-	} else if len(gw.PublicKeys) == 0 {
-		err = fmt.Errorf("No public keys specified")
-	} else if len(gw.Memo) > MAX_MEMO_LENGTH {
-		err = fmt.Errorf("Max memo length (%d) exceeded: %d", MAX_MEMO_LENGTH, len(gw.Memo))
-	} else {
+	} else if err = checkGetWork(gw, p.poolKey != nil); err == nil {
 		var tipID *PlotID
 		var tipHeader *PlotHeader
 		tipID, tipHeader, _, err = getThreadTipHeader(p.ledger, p.plotStore)
@@ -1700,6 +2253,26 @@ func (p *Peer) onGetWork(gw GetWorkMessage) {
 	}
 }
 
+// Make sure a get_work request would produce a valid plotroot. If we're a pool the memo must leave
+// room for our attestation
+func checkGetWork(gw GetWorkMessage, pool bool) error {
+	if len(gw.PublicKeys) == 0 {
+		return fmt.Errorf("No public keys specified")
+	}
+	if len(gw.PublicKeys) > MAX_WORK_PUBLIC_KEYS {
+		return fmt.Errorf("Too many public keys, limit: %d", MAX_WORK_PUBLIC_KEYS)
+	}
+	for i, pubKey := range gw.PublicKeys {
+		if len(pubKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("Invalid public key at index %d", i)
+		}
+	}
+	if pool {
+		return checkPoolMemo(gw.Memo)
+	}
+	return DefaultThreadParams.CheckMemo(gw.Memo)
+}
+
 // Create a new work plot for a scribing peer. Called from the writer goroutine loop.
 func (p *Peer) createNewWorkPlot(tipID PlotID, tipHeader *PlotHeader) error {
 	if len(p.pubKeys) == 0 {
@@ -1707,17 +2280,21 @@ func (p *Peer) createNewWorkPlot(tipID PlotID, tipHeader *PlotHeader) error {
 		return nil
 	}
 
-	medianTimestamp, err := computeMedianTimestamp(tipHeader, p.plotStore)
+	minTime, err := DefaultThreadParams.MinTime(tipHeader, p.plotStore)
 	if err != nil {
-		log.Printf("Error computing median timestamp: %s, for: %s\n", err, p.conn.RemoteAddr())
+		log.Printf("Error computing minimum timestamp: %s, for: %s\n", err, p.conn.RemoteAddr())
 	} else {
 		// create a new plot
-		p.medianTimestamp = medianTimestamp
+		p.workMinTime = minTime
 		keyIndex := rand.Intn(len(p.pubKeys))
 		p.workID = rand.Int31()
 		p.workPlot, err = createNextPlot(tipID, tipHeader, p.txQueue, p.plotStore, p.ledger, p.pubKeys[keyIndex], p.memo)
 		if err != nil {
 			log.Printf("Error creating next plot: %s, for: %s\n", err, p.conn.RemoteAddr())
+		} else if p.poolKey != nil {
+			if err = AttestPlot(p.workPlot, p.poolKey, p.memo); err != nil {
+				log.Printf("Error attesting to next plot: %s, for: %s\n", err, p.conn.RemoteAddr())
+			}
 		}
 	}
 
@@ -1725,7 +2302,7 @@ func (p *Peer) createNewWorkPlot(tipID PlotID, tipHeader *PlotHeader) error {
 	if err != nil {
 		m.Body = WorkMessage{WorkID: p.workID, Error: err.Error()}
 	} else {
-		m.Body = WorkMessage{WorkID: p.workID, Header: p.workPlot.Header, MinTime: p.medianTimestamp + 1}
+		m.Body = WorkMessage{WorkID: p.workID, Header: p.workPlot.Header, MinTime: p.workMinTime}
 	}
 
 	p.conn.SetWriteDeadline(time.Now().Add(writeWait))
@@ -1750,6 +2327,13 @@ func (p *Peer) onSubmitWork(sw SubmitWorkMessage) {
 	} else if sw.WorkID != p.workID {
 		err = fmt.Errorf("Expected work ID %d, found %d", p.workID, sw.WorkID)
 		log.Printf("%s, from: %s\n", err.Error(), p.conn.RemoteAddr())
+	} else if sw.Header.Time < p.workMinTime {
+		err = fmt.Errorf("Timestamp %d is before the minimum %d", sw.Header.Time, p.workMinTime)
+		log.Printf("%s, from: %s\n", err.Error(), p.conn.RemoteAddr())
+	} else if !VerifyWork(sw.Header, p.workPlot.Header.Target) {
+		// don't bother the processor with insufficient work
+		err = fmt.Errorf("Plot %s doesn't satisfy the target %s", id, p.workPlot.Header.Target)
+		log.Printf("%s, from: %s\n", err.Error(), p.conn.RemoteAddr())
 	} else {
 		p.workPlot.Header = sw.Header
 		err = p.processor.ProcessPlot(id, p.workPlot, p.conn.RemoteAddr().String())
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	externalip "github.com/glendc/go-external-ip"
+	"golang.org/x/crypto/ed25519"
 )
 
 // PeerManager manages incoming and outgoing peer connections on behalf of the client.
@@ -32,11 +33,15 @@ type PeerManager struct {
 	keyPath           string
 	port              int
 	inboundLimit      int
+	outboundLimit     int
 	accept            bool
 	accepting         bool
 	irc               bool
 	dnsseed           bool
 	banMap            map[string]bool
+	maxFilterSize     int
+	poolKey           ed25519.PrivateKey
+	startTime         time.Time
 	inPeers           map[string]*Peer
 	inPeerCountByHost map[string]int
 	outPeers          map[string]*Peer
@@ -98,10 +103,13 @@ func NewPeerManager(
 		keyPath:           keyPath,
 		port:              port,
 		inboundLimit:      inboundLimit,
+		outboundLimit:     MAX_OUTBOUND_PEER_CONNECTIONS,
 		accept:            accept,
 		irc:               irc,
 		dnsseed:           dnsseed,
 		banMap:            banMap,
+		maxFilterSize:     DEFAULT_MAX_FILTER_SIZE,
+		startTime:         time.Now(),
 		inPeers:           make(map[string]*Peer),
 		inPeerCountByHost: make(map[string]int),
 		outPeers:          make(map[string]*Peer),
@@ -113,6 +121,25 @@ func NewPeerManager(
 	}
 }
 
+// SetMaxFilterSize sets the maximum size in bytes of a filter a peer may load.
+// It must be called before Run.
+func (p *PeerManager) SetMaxFilterSize(size int) {
+	p.maxFilterSize = size
+}
+
+// SetOutboundLimit sets the number of outbound peer connections to maintain. Outbound slots are
+// kept separate from inbound ones so a flood of inbound connections can't crowd them out.
+// It must be called before Run.
+func (p *PeerManager) SetOutboundLimit(limit int) {
+	p.outboundLimit = limit
+}
+
+// SetPoolKey sets the private key used to attest to the representations in work sent to scribing
+// peers. See AttestPlot. It must be called before Run.
+func (p *PeerManager) SetPoolKey(privKey ed25519.PrivateKey) {
+	p.poolKey = privKey
+}
+
 // Run executes the PeerManager's main loop in its own goroutine.
 // It determines our connectivity and manages sourcing peer addresses from seed sources
 // as well as maintaining full outbound connections and accepting inbound connections.
@@ -289,6 +316,20 @@ func (p *PeerManager) Shutdown() {
 	log.Println("Peer manager shutdown")
 }
 
+// Resync asks every connected peer to find our common ancestor again, e.g. when our tip is stale.
+func (p *PeerManager) Resync() {
+	p.outPeersLock.RLock()
+	for _, peer := range p.outPeers {
+		peer.Resync()
+	}
+	p.outPeersLock.RUnlock()
+	p.inPeersLock.RLock()
+	for _, peer := range p.inPeers {
+		peer.Resync()
+	}
+	p.inPeersLock.RUnlock()
+}
+
 func (p *PeerManager) inboundPeerCount() int {
 	p.inPeersLock.RLock()
 	defer p.inPeersLock.RUnlock()
@@ -301,6 +342,10 @@ func (p *PeerManager) outboundPeerCount() int {
 	return len(p.outPeers)
 }
 
+func (p *PeerManager) peerCount() int {
+	return p.inboundPeerCount() + p.outboundPeerCount()
+}
+
 // Try connecting to some recent peers
 func (p *PeerManager) connectToPeers(ctx context.Context) error {
 	if len(p.peer) != 0 {
@@ -333,7 +378,7 @@ func (p *PeerManager) connectToPeers(ctx context.Context) error {
 		want = 1
 	} else {
 		// otherwise try to keep us maximally connected
-		want = MAX_OUTBOUND_PEER_CONNECTIONS
+		want = p.outboundLimit
 	}
 
 	count := p.outboundPeerCount()
@@ -401,6 +446,10 @@ func (p *PeerManager) connectToPeers(ctx context.Context) error {
 // Connect to a peer
 func (p *PeerManager) connect(ctx context.Context, addr string) (int, *Peer, error) {
 	peer := NewPeer(nil, p.genesisID, p.peerStore, p.plotStore, p.ledger, p.processor, p.indexer, p.txQueue, p.plotQueue, p.addrChan)
+	peer.maxFilterSize = p.maxFilterSize
+	peer.poolKey = p.poolKey
+	peer.peerCount = p.peerCount
+	peer.startTime = p.startTime
 
 	if ok := p.addToOutboundSet(addr, peer); !ok {
 		return 0, nil, fmt.Errorf("Too many peer connections")
@@ -497,6 +546,13 @@ func (p *PeerManager) acceptConnections() {
 			return
 		}
 
+		// check the overall inbound connection limit before doing any more work
+		if !p.checkInboundConnectionLimit() {
+			log.Printf("Too many inbound connections, rejecting: %s\n", r.RemoteAddr)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
 		// check the connection limit for this peer address
 		if !p.checkHostConnectionLimit(r.RemoteAddr) {
 			log.Printf("Too many connections from this peer's host: %s\n", r.RemoteAddr)
@@ -551,6 +607,10 @@ func (p *PeerManager) acceptConnections() {
 		}
 
 		peer := NewPeer(conn, p.genesisID, p.peerStore, p.plotStore, p.ledger, p.processor, p.indexer, p.txQueue, p.plotQueue, p.addrChan)
+		peer.maxFilterSize = p.maxFilterSize
+		peer.poolKey = p.poolKey
+		peer.peerCount = p.peerCount
+		peer.startTime = p.startTime
 
 		if ok := p.addToInboundSet(r.RemoteAddr, peer); !ok {
 			// TODO: tell the peer why
@@ -591,7 +651,7 @@ func (p *PeerManager) acceptConnections() {
 func (p *PeerManager) addToOutboundSet(addr string, peer *Peer) bool {
 	p.outPeersLock.Lock()
 	defer p.outPeersLock.Unlock()
-	if len(p.outPeers) == MAX_OUTBOUND_PEER_CONNECTIONS {
+	if len(p.outPeers) >= p.outboundLimit {
 		// too many connections
 		return false
 	}
@@ -613,7 +673,7 @@ func (p *PeerManager) addToInboundSet(addr string, peer *Peer) bool {
 	}
 	p.inPeersLock.Lock()
 	defer p.inPeersLock.Unlock()
-	if len(p.inPeers) == p.inboundLimit {
+	if len(p.inPeers) >= p.inboundLimit {
 		// too many connections
 		return false
 	}
@@ -633,6 +693,11 @@ func (p *PeerManager) addToInboundSet(addr string, peer *Peer) bool {
 	return true
 }
 
+// Returns false if we have as many inbound connections as we allow.
+func (p *PeerManager) checkInboundConnectionLimit() bool {
+	return p.inboundPeerCount() < p.inboundLimit
+}
+
 // Returns false if this host has too many inbound connections already.
 func (p *PeerManager) checkHostConnectionLimit(addr string) bool {
 	// split host and port
@@ -802,9 +867,6 @@ func IsInitialPlotDownload(ledger Ledger, plotStore PlotStorage) (bool, int64, e
 	if tipID == nil {
 		return true, 0, nil
 	}
-	if tipHeader == nil {
-		return true, 0, nil
-	}
 	if CheckpointsEnabled && tipHeader.Height < LatestCheckpointHeight {
 		return true, tipHeader.Height, nil
 	}
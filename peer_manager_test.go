@@ -0,0 +1,50 @@
+package plotthread
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestPeerManagerConnectionLimits(t *testing.T) {
+	p := NewPeerManager(PlotID{}, nil, nil, nil, nil, nil, nil,
+		"", "", "", "", "", 0, 3, true, false, false, nil)
+	p.SetOutboundLimit(2)
+
+	// fill the inbound slots
+	for i := 0; i < 3; i++ {
+		if !p.checkInboundConnectionLimit() {
+			t.Fatalf("Expected inbound connection %d to be allowed", i)
+		}
+		if !p.addToInboundSet("10.0.0.1:"+strconv.Itoa(1000+i), &Peer{}) {
+			t.Fatalf("Expected inbound connection %d to be added", i)
+		}
+	}
+
+	// beyond the cap is refused
+	if p.checkInboundConnectionLimit() {
+		t.Fatal("Expected the inbound limit to be reached")
+	}
+	if p.addToInboundSet("10.0.0.2:1000", &Peer{}) {
+		t.Fatal("Expected an inbound connection beyond the limit to be refused")
+	}
+
+	// outbound slots are still available
+	for i := 0; i < 2; i++ {
+		if !p.addToOutboundSet("10.0.0.3:"+strconv.Itoa(1000+i), &Peer{}) {
+			t.Fatalf("Expected outbound connection %d to be added", i)
+		}
+	}
+	if p.addToOutboundSet("10.0.0.3:2000", &Peer{}) {
+		t.Fatal("Expected an outbound connection beyond the limit to be refused")
+	}
+
+	// an inbound peer leaving frees a slot
+	p.removeFromInboundSet("10.0.0.1:1000")
+	if !p.checkInboundConnectionLimit() {
+		t.Fatal("Expected an inbound slot to be free")
+	}
+	if p.inboundPeerCount() != 2 || p.outboundPeerCount() != 2 {
+		t.Fatalf("Expected 2 inbound and 2 outbound peers, found %d and %d",
+			p.inboundPeerCount(), p.outboundPeerCount())
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"net"
 	"sync"
 	"time"
 
@@ -67,6 +68,8 @@ func (p *PeerStorageDisk) Store(addr string) (bool, error) {
 }
 
 // Get returns some peers for us to attempt to connect to.
+// It prefers peers from network groups we aren't connected to and returns at most one per group
+// unless there aren't enough groups, so a single subnet can't monopolize our connections.
 func (p *PeerStorageDisk) Get(count int) ([]string, error) {
 	startKey, err := computeLastAttemptTimeKey(0, "")
 	if err != nil {
@@ -84,9 +87,13 @@ func (p *PeerStorageDisk) Get(count int) ([]string, error) {
 		return nil, err
 	}
 
-	var addrs []string
+	var addrs, sameGroup []string
 
 	connectedPeers := p.getConnectedPeers()
+	groups := make(map[string]bool)
+	for addr := range connectedPeers {
+		groups[addressGroup(addr)] = true
+	}
 
 	// try finding peers
 	iter := snapshot.NewIterator(&util.Range{Start: startKey, Limit: endKey}, nil)
@@ -111,6 +118,16 @@ func (p *PeerStorageDisk) Get(count int) ([]string, error) {
 			continue
 		}
 
+		// fall back to it only if we run out of other groups
+		group := addressGroup(addr)
+		if groups[group] {
+			if len(sameGroup) < count {
+				sameGroup = append(sameGroup, addr)
+			}
+			continue
+		}
+		groups[group] = true
+
 		// add it to the list
 		addrs = append(addrs, addr)
 		if len(addrs) == count {
@@ -122,6 +139,9 @@ func (p *PeerStorageDisk) Get(count int) ([]string, error) {
 		return nil, err
 	}
 
+	for i := 0; i < len(sameGroup) && len(addrs) < count; i++ {
+		addrs = append(addrs, sameGroup[i])
+	}
 	return addrs, nil
 }
 
@@ -344,6 +364,23 @@ func (p *PeerStorageDisk) getConnectedPeers() map[string]bool {
 	return connectedPeers
 }
 
+// Returns the network group of a peer address: the /16 of an IPv4 address, the /32 of an IPv6
+// address or otherwise the host itself
+func addressGroup(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(16, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(32, 128)).String()
+}
+
 // leveldb schema
 
 // p{addr}       -> serialized peerInfo
@@ -0,0 +1,91 @@
+package plotthread
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestPeerStorageDiskGroupDiversity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	peerStore, err := NewPeerStorageDisk(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerStore.Close()
+
+	// the book is dominated by one /16
+	for i := 0; i < 20; i++ {
+		addr := "203.0." + strconv.Itoa(i) + ".1:8832"
+		if _, err := peerStore.Store(addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, addr := range []string{"198.51.100.1:8832", "192.0.2.1:8832", "[2001:db8::1]:8832"} {
+		if _, err := peerStore.Store(addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every group is represented once
+	addrs, err := peerStore.Get(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := make(map[string]bool)
+	for _, addr := range addrs {
+		groups[addressGroup(addr)] = true
+	}
+	if len(addrs) != 4 || len(groups) != 4 {
+		t.Fatalf("Expected 4 addresses from 4 groups, found: %v", addrs)
+	}
+
+	// asking for more falls back to the crowded group
+	addrs, err = peerStore.Get(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 6 {
+		t.Fatalf("Expected 6 addresses, found: %v", addrs)
+	}
+
+	// groups we're connected to are avoided
+	if err := peerStore.OnConnectSuccess("198.51.100.1:8832"); err != nil {
+		t.Fatal(err)
+	}
+	if err := peerStore.OnConnectSuccess("203.0.0.1:8832"); err != nil {
+		t.Fatal(err)
+	}
+	addrs, err = peerStore.Get(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range addrs {
+		group := addressGroup(addr)
+		if group == "198.51.0.0" || group == "203.0.0.0" {
+			t.Fatalf("Expected groups we aren't connected to, found: %v", addrs)
+		}
+	}
+}
+
+func TestAddressGroup(t *testing.T) {
+	tests := []struct {
+		addr, group string
+	}{
+		{"203.0.113.7:8832", "203.0.0.0"},
+		{"203.0.1.7:8832", "203.0.0.0"},
+		{"[2001:db8:1234::1]:8832", "2001:db8::"},
+		{"example.com:8832", "example.com"},
+	}
+	for _, test := range tests {
+		if group := addressGroup(test.addr); group != test.group {
+			t.Fatalf("Expected group %s for %s, found %s", test.group, test.addr, group)
+		}
+	}
+}
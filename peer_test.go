@@ -0,0 +1,796 @@
+package plotthread
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	cuckoo "github.com/seiflotfy/cuckoofilter"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestPeerFilterIsolation(t *testing.T) {
+	var pubKeys []ed25519.PublicKey
+	for i := 0; i < 3; i++ {
+		pubKey, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	// queue a representation to each key from an unrelated sender
+	sender, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger := newTestLedger()
+	queue := NewRepresentationQueueMemory(ledger)
+	var txs []*Representation
+	for _, pubKey := range pubKeys {
+		tx := NewRepresentation(sender, pubKey, 0, 0, 0, "")
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		queue.txMap[id] = queue.txQueue.PushBack(tx)
+		txs = append(txs, tx)
+	}
+
+	// peer a loads a filter for key 0 and peer b adds key 1 to a new filter
+	a := &Peer{txQueue: queue, maxFilterSize: DEFAULT_MAX_FILTER_SIZE}
+	b := &Peer{txQueue: queue, maxFilterSize: DEFAULT_MAX_FILTER_SIZE}
+	filter := cuckoo.NewFilter(1 << 10)
+	filter.Insert(pubKeys[0])
+	if err := a.loadFilter("cuckoo", filter.Encode()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.addToFilter([]ed25519.PublicKey{pubKeys[1]}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a peer without a filter isn't sent filtered output
+	c := &Peer{txQueue: queue}
+	if ftq := c.filterRepresentationQueue(); len(ftq.Error) == 0 {
+		t.Fatal("Expected error for a peer without a filter")
+	}
+
+	plot, err := NewPlot(PlotID{}, 0, PlotID{}, PlotID{}, txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range []*Peer{a, b} {
+		fb, err := p.createFilterPlot(PlotID{}, plot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fb.Representations) != 1 || fb.Representations[0] != txs[i] {
+			t.Fatalf("Expected peer %d's filter plot to only contain its representation", i)
+		}
+
+		ftq := p.filterRepresentationQueue()
+		if len(ftq.Error) != 0 {
+			t.Fatal(ftq.Error)
+		}
+		if len(ftq.Representations) != 1 || ftq.Representations[0] != txs[i] {
+			t.Fatalf("Expected peer %d's filter queue to only contain its representation", i)
+		}
+	}
+
+	// adding to one peer's filter doesn't affect the other
+	if err := a.addToFilter([]ed25519.PublicKey{pubKeys[2]}); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.filterRepresentationQueue().Representations) != 2 {
+		t.Fatal("Expected peer a to match 2 representations")
+	}
+	if len(b.filterRepresentationQueue().Representations) != 1 {
+		t.Fatal("Expected peer b to still match 1 representation")
+	}
+}
+
+func TestPushRepresentationsPartial(t *testing.T) {
+	sender, senderPrivKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ledger := newTestLedger()
+	ledger.heights[0] = PlotID{1}
+	ledger.setImbalance(sender, 1)
+	queue := NewRepresentationQueueMemory(ledger)
+	processor := NewProcessor(PlotID{}, newTestPlotStore(), queue, ledger)
+	processor.Run()
+	defer processor.Shutdown()
+	p := &Peer{txQueue: queue, processor: processor}
+
+	valid := NewRepresentation(sender, recipient, 0, 0, 0, "valid")
+	if err := valid.Sign(senderPrivKey); err != nil {
+		t.Fatal(err)
+	}
+	unsigned := NewRepresentation(sender, recipient, 0, 0, 0, "unsigned")
+	plotroot := NewRepresentation(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)), recipient, 0, 0, 0, "")
+
+	txs := []*Representation{valid, unsigned, nil, plotroot, valid}
+	result, err := p.pushRepresentations(txs, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Results) != len(txs) {
+		t.Fatalf("Expected %d results, found %d", len(txs), len(result.Results))
+	}
+	for i, expectError := range []bool{false, true, true, true, false} {
+		if hasError := len(result.Results[i].Error) != 0; hasError != expectError {
+			t.Fatalf("Result %d: expected error %t, found %q", i, expectError, result.Results[i].Error)
+		}
+	}
+	validID, err := valid.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Results[0].RepresentationID != validID {
+		t.Fatal("Expected result to identify the representation")
+	}
+	if queue.Len() != 1 || !queue.Exists(validID) {
+		t.Fatal("Expected only the valid representation to be queued")
+	}
+
+	// oversized batches are rejected outright
+	txs = make([]*Representation, MAX_REPRESENTATIONS_PER_PUSH+1)
+	result, err = p.pushRepresentations(txs, "test")
+	if err == nil || len(result.Error) == 0 {
+		t.Fatal("Expected oversized batch to be rejected")
+	}
+	if len(result.Results) != 0 {
+		t.Fatal("Expected no individual results for a rejected batch")
+	}
+}
+
+func TestPeerFilterLimits(t *testing.T) {
+	p := &Peer{maxFilterSize: 1 << 10}
+
+	// within the limit
+	filter := cuckoo.NewFilter(1 << 10)
+	if err := p.loadFilter("cuckoo", filter.Encode()); err != nil {
+		t.Fatal(err)
+	}
+
+	// oversized
+	filter = cuckoo.NewFilter(1 << 12)
+	if err := p.loadFilter("cuckoo", filter.Encode()); err == nil {
+		t.Fatal("Expected oversized filter to be rejected")
+	}
+
+	// malformed
+	for _, size := range []int{0, 3, 6, 12} {
+		if err := p.loadFilter("cuckoo", make([]byte, size)); err == nil {
+			t.Fatalf("Expected filter of size %d to be rejected", size)
+		}
+	}
+
+	// unsupported
+	if err := p.loadFilter("bloom", make([]byte, 8)); err == nil {
+		t.Fatal("Expected unsupported filter type to be rejected")
+	}
+}
+
+func TestPushRepresentationExpired(t *testing.T) {
+	sender, senderPrivKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ledger := newTestLedger()
+	for height := int64(0); height <= 5; height++ {
+		ledger.heights[height] = PlotID{byte(height)}
+	}
+	ledger.setImbalance(sender, 2)
+	queue := NewRepresentationQueueMemory(ledger)
+	processor := NewProcessor(PlotID{}, newTestPlotStore(), queue, ledger)
+	processor.Run()
+	defer processor.Shutdown()
+	newTxChan := make(chan NewTx, 2)
+	processor.RegisterForNewRepresentations(newTxChan)
+	defer processor.UnregisterForNewRepresentations(newTxChan)
+	p := &Peer{txQueue: queue, processor: processor}
+
+	// expires at the current tip so it can't be included in the next plot
+	expired := NewRepresentation(sender, recipient, 0, 5, 5, "")
+	if err := expired.Sign(senderPrivKey); err != nil {
+		t.Fatal(err)
+	}
+	current := NewRepresentation(sender, recipient, 0, 6, 5, "")
+	if err := current.Sign(senderPrivKey); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := p.pushRepresentations([]*Representation{expired, current}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Results[0].Error) == 0 {
+		t.Fatal("Expected expired representation to be rejected")
+	}
+	if len(result.Results[1].Error) != 0 {
+		t.Fatal(result.Results[1].Error)
+	}
+
+	// only the current one is queued and relayed
+	expiredID, err := expired.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue.Exists(expiredID) || queue.Len() != 1 {
+		t.Fatal("Expected only the current representation to be queued")
+	}
+	newTx := <-newTxChan
+	if newTx.Representation != current {
+		t.Fatal("Expected only the current representation to be relayed")
+	}
+	select {
+	case <-newTxChan:
+		t.Fatal("Expected expired representation not to be relayed")
+	default:
+	}
+}
+
+func TestCheckGetWork(t *testing.T) {
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tooManyKeys := make([]ed25519.PublicKey, MAX_WORK_PUBLIC_KEYS+1)
+	for i := range tooManyKeys {
+		tooManyKeys[i] = pubKey
+	}
+
+	poolMemoLimit := MAX_MEMO_LENGTH - poolAttestationLength - 1
+
+	tests := []struct {
+		name  string
+		gw    GetWorkMessage
+		pool  bool
+		valid bool
+	}{
+		{"valid", GetWorkMessage{PublicKeys: []ed25519.PublicKey{pubKey}, Memo: "hi"}, false, true},
+		{"max memo", GetWorkMessage{PublicKeys: []ed25519.PublicKey{pubKey},
+			Memo: strings.Repeat("a", MAX_MEMO_LENGTH)}, false, true},
+		{"empty keys", GetWorkMessage{}, false, false},
+		{"too many keys", GetWorkMessage{PublicKeys: tooManyKeys}, false, false},
+		{"short key", GetWorkMessage{PublicKeys: []ed25519.PublicKey{pubKey[:16]}}, false, false},
+		{"long memo", GetWorkMessage{PublicKeys: []ed25519.PublicKey{pubKey},
+			Memo: strings.Repeat("a", MAX_MEMO_LENGTH+1)}, false, false},
+		{"invalid memo", GetWorkMessage{PublicKeys: []ed25519.PublicKey{pubKey}, Memo: "\xff"}, false, false},
+		{"pool no memo", GetWorkMessage{PublicKeys: []ed25519.PublicKey{pubKey}}, true, true},
+		{"pool max memo", GetWorkMessage{PublicKeys: []ed25519.PublicKey{pubKey},
+			Memo: strings.Repeat("a", poolMemoLimit)}, true, true},
+		{"pool long memo", GetWorkMessage{PublicKeys: []ed25519.PublicKey{pubKey},
+			Memo: strings.Repeat("a", poolMemoLimit+1)}, true, false},
+		{"pool invalid memo", GetWorkMessage{PublicKeys: []ed25519.PublicKey{pubKey}, Memo: "\xff"}, true, false},
+	}
+	for _, test := range tests {
+		err := checkGetWork(test.gw, test.pool)
+		if test.valid && err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Fatalf("%s: expected error", test.name)
+		}
+	}
+}
+
+func TestRunMessageHandler(t *testing.T) {
+	var timedOut bool
+	onTimeout := func() {
+		timedOut = true
+	}
+
+	// a handler which completes
+	var handled bool
+	if err := runMessageHandler("get_tip_header", time.Second, onTimeout, func() {
+		handled = true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !handled {
+		t.Fatal("Expected handler to run")
+	}
+
+	// a handler which panics, e.g. on a malformed input
+	err := runMessageHandler("get_graph", time.Second, onTimeout, func() {
+		var header *PlotHeader
+		_ = header.Height
+	})
+	if err == nil || !strings.Contains(err.Error(), "panicked") {
+		t.Fatalf("Expected panic to be recovered, found: %v", err)
+	}
+	if timedOut {
+		t.Fatal("Expected no timeout")
+	}
+
+	// a handler which hangs until the timeout closes its connection
+	closed := make(chan struct{})
+	err = runMessageHandler("get_graph", 50*time.Millisecond, func() {
+		close(closed)
+	}, func() {
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+		}
+	})
+	if err == nil || !strings.Contains(err.Error(), "didn't complete") {
+		t.Fatalf("Expected deadline to be exceeded, found: %v", err)
+	}
+	select {
+	case <-closed:
+	default:
+		t.Fatal("Expected the timeout to be called")
+	}
+}
+
+func TestPlotIDAtHeight(t *testing.T) {
+	ledger, plotStore := newTestLedger(), newTestPlotStore()
+	addPlot := func(id, previous PlotID, height int64, branchType BranchType) {
+		plotStore.plots[id] = &Plot{Header: &PlotHeader{Previous: previous, Height: height}}
+		ledger.branches[id] = branchType
+		if branchType == MAIN {
+			ledger.heights[height] = id
+		}
+	}
+
+	// the main branch is 0 <- 1 <- 2 and a side branch forks after 1 with 12 <- 13
+	addPlot(PlotID{0}, PlotID{}, 0, MAIN)
+	addPlot(PlotID{1}, PlotID{0}, 1, MAIN)
+	addPlot(PlotID{2}, PlotID{1}, 2, MAIN)
+	addPlot(PlotID{12}, PlotID{1}, 2, SIDE)
+	addPlot(PlotID{13}, PlotID{12}, 3, SIDE)
+	p := &Peer{ledger: ledger, plotStore: plotStore}
+
+	cases := []struct {
+		height   int64
+		tipID    *PlotID
+		expected *PlotID
+	}{
+		// the main branch by default
+		{2, nil, &PlotID{2}},
+		{3, nil, nil},
+		// a side branch tip's ancestors
+		{3, &PlotID{13}, &PlotID{13}},
+		{2, &PlotID{13}, &PlotID{12}},
+		{1, &PlotID{13}, &PlotID{1}},
+		{4, &PlotID{13}, nil},
+		// a main branch plot's ancestors
+		{0, &PlotID{1}, &PlotID{0}},
+		{2, &PlotID{1}, nil},
+	}
+	for i, c := range cases {
+		id, err := p.plotIDAtHeight(c.height, c.tipID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (id == nil) != (c.expected == nil) || (id != nil && *id != *c.expected) {
+			t.Fatalf("Case %d: unexpected plot ID %v at height %d", i, id, c.height)
+		}
+	}
+
+	// an unknown tip
+	if _, err := p.plotIDAtHeight(0, &PlotID{99}); err == nil {
+		t.Fatal("Expected unknown tip to be an error")
+	}
+}
+
+func TestPlotIDForRequestedHeight(t *testing.T) {
+	ledger, plotStore := newTestLedger(), newTestPlotStore()
+	p := &Peer{ledger: ledger, plotStore: plotStore}
+
+	// nothing to serve yet
+	if _, err := p.plotIDForRequestedHeight(0, nil); err != ErrNotSynced {
+		t.Fatalf("Expected not synced, found: %v", err)
+	}
+
+	// the main branch is 0 <- 1
+	for height := int64(0); height < 2; height++ {
+		id := PlotID{byte(height)}
+		plotStore.plots[id] = &Plot{Header: &PlotHeader{Previous: PlotID{byte(height - 1)}, Height: height}}
+		ledger.branches[id] = MAIN
+		ledger.heights[height] = id
+	}
+
+	cases := []struct {
+		height     int64
+		tipID      *PlotID
+		expected   *PlotID
+		outOfRange bool
+	}{
+		{-1, nil, nil, true},
+		{0, nil, &PlotID{0}, false},
+		{1, nil, &PlotID{1}, false},
+		{2, nil, nil, true},
+		{-1, &PlotID{1}, nil, true},
+		{0, &PlotID{1}, &PlotID{0}, false},
+		{2, &PlotID{1}, nil, true},
+	}
+	for i, c := range cases {
+		id, err := p.plotIDForRequestedHeight(c.height, c.tipID)
+		_, outOfRange := err.(HeightOutOfRangeError)
+		if outOfRange != c.outOfRange {
+			t.Fatalf("Case %d: unexpected error for height %d: %v", i, c.height, err)
+		}
+		if !c.outOfRange && (err != nil || id == nil || *id != *c.expected) {
+			t.Fatalf("Case %d: expected plot %s at height %d, found %v, %v", i, *c.expected, c.height, id, err)
+		}
+	}
+
+	// the error reports the tip height whether or not the tip was given
+	for _, tipID := range []*PlotID{nil, &PlotID{1}} {
+		_, err := p.plotIDForRequestedHeight(2, tipID)
+		if err != (HeightOutOfRangeError{Height: 2, TipHeight: 1}) {
+			t.Fatalf("Expected height 2 above tip height 1, found: %v", err)
+		}
+	}
+}
+
+func TestPeerPublicKeyHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plotStore := newTestPlotStore()
+	ledger, err := NewLedgerDisk(dir, false, false, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+	p := &Peer{ledger: ledger, plotStore: plotStore}
+
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroKey := ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+
+	// pubKey is only active at heights 3, 6, 7 and 10
+	type position struct {
+		height int64
+		index  int
+	}
+	var expected []position
+	var previous PlotID
+	for height := int64(0); height < 12; height++ {
+		var txs []*Representation
+		switch height {
+		case 3, 7:
+			txs = []*Representation{NewRepresentation(zeroKey, pubKey, 0, 0, height, "")}
+			expected = append(expected, position{height, 0})
+		case 6, 10:
+			txs = []*Representation{
+				NewRepresentation(zeroKey, otherKey, 0, 0, height, ""),
+				NewRepresentation(pubKey, otherKey, 0, 0, height, ""),
+			}
+			expected = append(expected, position{height, 1})
+		default:
+			txs = []*Representation{NewRepresentation(zeroKey, otherKey, 0, 0, height, "")}
+		}
+		plot, err := NewPlot(previous, height, target, PlotID{}, txs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := plot.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := plotStore.Store(id, plot, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ledger.ConnectPlot(id, plot); err != nil {
+			t.Fatal(err)
+		}
+		previous = id
+	}
+
+	// page through with a small limit until there's no cursor
+	var found []position
+	var cursor *PublicKeyHistoryCursor
+	for pages := 0; ; pages++ {
+		if pages > len(expected) {
+			t.Fatal("Cursor never cleared")
+		}
+		history, err := p.getPublicKeyHistory(pubKey, cursor, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if history.TipHeight != 11 {
+			t.Fatalf("Expected tip height 11, found %d", history.TipHeight)
+		}
+		for _, fb := range history.FilterPlots {
+			for _, tx := range fb.Representations {
+				if !tx.Contains(pubKey) {
+					t.Fatalf("Representation at height %d doesn't involve the key", fb.Header.Height)
+				}
+				index := 0
+				if tx.From.Equal(pubKey) {
+					index = 1
+				}
+				found = append(found, position{fb.Header.Height, index})
+			}
+		}
+		if history.Cursor == nil {
+			break
+		}
+		cursor = history.Cursor
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("Expected %d representations, found %d", len(expected), len(found))
+	}
+	for i := range expected {
+		if found[i] != expected[i] {
+			t.Fatalf("Expected %v at position %d, found %v", expected[i], i, found[i])
+		}
+	}
+
+	// an unseen key has no history
+	unseenKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := p.getPublicKeyHistory(unseenKey, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.FilterPlots) != 0 || history.Cursor != nil {
+		t.Fatal("Expected no history for an unseen key")
+	}
+}
+
+func TestPeerStatus(t *testing.T) {
+	ledger, plotStore := newTestLedger(), newTestPlotStore()
+	queue := NewRepresentationQueueMemory(ledger)
+
+	// the thread is at height 1 and the indexer has only seen genesis
+	ledger.heights[0], ledger.heights[1] = PlotID{0}, PlotID{1}
+	plotStore.plots[PlotID{0}] = &Plot{Header: &PlotHeader{Height: 0, ThreadWork: PlotID{0x01}}}
+	plotStore.plots[PlotID{1}] = &Plot{Header: &PlotHeader{Previous: PlotID{0}, Height: 1, ThreadWork: PlotID{0x02}}}
+	indexer := NewIndexer(plotStore, ledger, nil, PlotID{0})
+
+	// one representation is queued
+	sender, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := NewRepresentation(sender, recipient, 0, 0, 0, "")
+	id, err := tx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.txMap[id] = queue.txQueue.PushBack(tx)
+
+	p := &Peer{
+		ledger:    ledger,
+		plotStore: plotStore,
+		indexer:   indexer,
+		txQueue:   queue,
+		peerCount: func() int { return 3 },
+		startTime: time.Now().Add(-time.Minute),
+	}
+	status, err := p.getStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Protocol != Protocol {
+		t.Fatalf("Expected protocol %s, found %s", Protocol, status.Protocol)
+	}
+	if status.PlotID == nil || *status.PlotID != (PlotID{1}) || status.Height != 1 {
+		t.Fatalf("Expected tip 1 at height 1, found %v at height %d", status.PlotID, status.Height)
+	}
+	if status.ThreadWork == nil || *status.ThreadWork != (PlotID{0x02}) {
+		t.Fatalf("Expected the tip's thread work, found %v", status.ThreadWork)
+	}
+	if status.Peers != 3 || status.QueueLength != 1 {
+		t.Fatalf("Expected 3 peers and 1 queued representation, found %d and %d",
+			status.Peers, status.QueueLength)
+	}
+	if status.IndexerCaughtUp {
+		t.Fatal("Expected the indexer to be behind")
+	}
+	if status.Uptime < 60 {
+		t.Fatalf("Expected at least a minute of uptime, found %d", status.Uptime)
+	}
+
+	// the indexer catches up
+	indexer.indexRepresentations(plotStore.plots[PlotID{1}], PlotID{1}, true)
+	if status, err = p.getStatus(); err != nil {
+		t.Fatal(err)
+	}
+	if !status.IndexerCaughtUp {
+		t.Fatal("Expected the indexer to be caught up")
+	}
+}
+
+func TestPeerTipAnnouncement(t *testing.T) {
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plot, err := makeTestPlot(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := plot.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	connect := TipChange{PlotID: id, Plot: plot, Connect: true}
+	disconnect := TipChange{PlotID: id, Plot: plot}
+
+	// a full peer is announced the plot's ID
+	full := &Peer{}
+	m, err := full.createTipAnnouncement(connect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.Type != "inv_plot" {
+		t.Fatalf("Expected an inv_plot, found: %v", m)
+	}
+	if inv, ok := m.Body.(InvPlotMessage); !ok || len(inv.PlotIDs) != 1 || inv.PlotIDs[0] != id {
+		t.Fatalf("Expected the plot's ID, found: %v", m.Body)
+	}
+	if m, err := full.createTipAnnouncement(disconnect); err != nil || m != nil {
+		t.Fatalf("Expected nothing on disconnection, found: %v, %v", m, err)
+	}
+
+	// a filtered peer is sent a filter_plot instead
+	filtered := &Peer{maxFilterSize: DEFAULT_MAX_FILTER_SIZE}
+	if err := filtered.addToFilter([]ed25519.PublicKey{pubKey}); err != nil {
+		t.Fatal(err)
+	}
+	m, err = filtered.createTipAnnouncement(connect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.Type != "filter_plot" {
+		t.Fatalf("Expected a filter_plot, found: %v", m)
+	}
+	if fb, ok := m.Body.(*FilterPlotMessage); !ok || fb.PlotID != id || fb.Header != plot.Header {
+		t.Fatalf("Expected the plot's header, found: %v", m.Body)
+	}
+	m, err = filtered.createTipAnnouncement(disconnect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.Type != "filter_plot_undo" {
+		t.Fatalf("Expected a filter_plot_undo, found: %v", m)
+	}
+}
+
+func TestCreateFilterPlot(t *testing.T) {
+	var keys []ed25519.PublicKey
+	for i := 0; i < 6; i++ {
+		pubKey, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, pubKey)
+	}
+	scriber, a, b, c, d, other := keys[0], keys[1], keys[2], keys[3], keys[4], keys[5]
+	zero := ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+
+	plotroot := NewRepresentation(zero, scriber, 0, 0, 0, "")
+	tx1 := NewRepresentation(a, b, 0, 0, 0, "")
+	tx2 := NewRepresentation(c, d, 0, 0, 0, "")
+	plot, err := NewPlot(PlotID{}, 0, PlotID{}, PlotID{}, []*Representation{plotroot, tx1, tx2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		keys     []ed25519.PublicKey
+		expected []*Representation
+	}{
+		{"recipient", []ed25519.PublicKey{b}, []*Representation{tx1}},
+		{"sender", []ed25519.PublicKey{c}, []*Representation{tx2}},
+		{"scriber", []ed25519.PublicKey{scriber}, []*Representation{plotroot}},
+		{"all", []ed25519.PublicKey{scriber, a, d}, []*Representation{plotroot, tx1, tx2}},
+		{"none", []ed25519.PublicKey{other}, nil},
+		{"plotroot sender", []ed25519.PublicKey{zero}, nil},
+	}
+	for _, test := range tests {
+		p := &Peer{maxFilterSize: DEFAULT_MAX_FILTER_SIZE}
+		if err := p.addToFilter(test.keys); err != nil {
+			t.Fatal(err)
+		}
+		fb, err := p.createFilterPlot(PlotID{1}, plot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fb.PlotID != (PlotID{1}) || fb.Header != plot.Header {
+			t.Fatalf("%s: expected the plot's ID and header", test.name)
+		}
+		if len(fb.Representations) != len(test.expected) {
+			t.Fatalf("%s: expected %d representations, found %d",
+				test.name, len(test.expected), len(fb.Representations))
+		}
+		for i, tx := range test.expected {
+			if fb.Representations[i] != tx {
+				t.Fatalf("%s: unexpected representation at index %d", test.name, i)
+			}
+		}
+	}
+
+	// no filter, no filter plot
+	if fb, err := (&Peer{}).createFilterPlot(PlotID{1}, plot); err != nil || fb != nil {
+		t.Fatalf("Expected no filter plot without a filter, found: %v, %v", fb, err)
+	}
+}
+
+func TestPeerDoesntRelayExpiredAtNewTip(t *testing.T) {
+	sender, senderPrivKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ledger := newTestLedger()
+	for height := int64(0); height <= 5; height++ {
+		ledger.heights[height] = PlotID{byte(height)}
+	}
+	ledger.setImbalance(sender, 1)
+	queue := NewRepresentationQueueMemory(ledger)
+	processor := NewProcessor(PlotID{}, newTestPlotStore(), queue, ledger)
+	processor.Run()
+	defer processor.Shutdown()
+	newTxChan := make(chan NewTx, 1)
+	processor.RegisterForNewRepresentations(newTxChan)
+	defer processor.UnregisterForNewRepresentations(newTxChan)
+	p := &Peer{txQueue: queue, processor: processor}
+
+	// can be included in the next plot at height 6 but no later
+	tx := NewRepresentation(sender, recipient, 0, 6, 5, "")
+	if err := tx.Sign(senderPrivKey); err != nil {
+		t.Fatal(err)
+	}
+	result, err := p.pushRepresentations([]*Representation{tx}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Results[0].Error) != 0 {
+		t.Fatal(result.Results[0].Error)
+	}
+	newTx := <-newTxChan
+	if !p.shouldRelay(newTx.Representation, 5) {
+		t.Fatal("Expected representation to be relayed at the tip it was queued at")
+	}
+
+	// a plot at height 6 is connected without it before the peer gets to it
+	if p.shouldRelay(newTx.Representation, 6) {
+		t.Fatal("Expected representation expired at the new tip not to be relayed")
+	}
+}
@@ -1,12 +1,12 @@
 package plotthread
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"hash"
 	"math/big"
-	"math/rand"
 	"time"
 
 	"golang.org/x/crypto/sha3"
@@ -34,11 +34,18 @@ type PlotHeader struct {
 }
 
 // PlotID is a plot's unique identifier.
+// PlotIDs are arrays so they can be compared with == and used as map keys.
 type PlotID [32]byte // SHA3-256 hash
 
 // NewPlot creates and returns a new Plot to be scribed.
 func NewPlot(previous PlotID, height int64, target, threadWork PlotID, representations []*Representation) (
 	*Plot, error) {
+	return NewPlotWithRand(defaultRand, previous, height, target, threadWork, representations)
+}
+
+// NewPlotWithRand creates and returns a new Plot to be scribed with its initial nonce drawn from rng.
+func NewPlotWithRand(rng RandSource, previous PlotID, height int64, target, threadWork PlotID,
+	representations []*Representation) (*Plot, error) {
 
 	// enforce the hard cap representation limit
 	if len(representations) > MAX_REPRESENTATIONS_PER_PLOT {
@@ -52,28 +59,83 @@ func NewPlot(previous PlotID, height int64, target, threadWork PlotID, represent
 		return nil, err
 	}
 
-	// create the header and plot
+	// create the header
+	header, err := NewPlotHeaderWithRand(rng, previous, hashListRoot, target, threadWork, height,
+		int32(len(representations)))
+	if err != nil {
+		return nil, err
+	}
+
+	// create the plot
 	return &Plot{
-		Header: &PlotHeader{
-			Previous:         previous,
-			HashListRoot:     hashListRoot,
-			Time:             time.Now().Unix(), // just use the system time
-			Target:           target,
-			ThreadWork:        computeThreadWork(target, threadWork),
-			Nonce:            rand.Int63n(MAX_NUMBER),
-			Height:           height,
-			RepresentationCount: int32(len(representations)),
-		},
+		Header:          header,
 		Representations: representations,
 		hasher:       hasher, // save this to use while scribing
 	}, nil
 }
 
+// NewPlotHeader creates and returns a new PlotHeader to be scribed.
+// "threadWork" is the cumulative thread work of the previous plot. The time is set to the
+// current system time and the nonce is randomized.
+func NewPlotHeader(previous PlotID, hashListRoot RepresentationID, target, threadWork PlotID,
+	height int64, representationCount int32) (*PlotHeader, error) {
+	return NewPlotHeaderWithRand(defaultRand, previous, hashListRoot, target, threadWork, height, representationCount)
+}
+
+// NewPlotHeaderWithRand creates and returns a new PlotHeader to be scribed with its nonce drawn from rng.
+func NewPlotHeaderWithRand(rng RandSource, previous PlotID, hashListRoot RepresentationID, target,
+	threadWork PlotID, height int64, representationCount int32) (*PlotHeader, error) {
+	if height < 0 || height > MAX_NUMBER {
+		return nil, fmt.Errorf("Invalid plot height %d", height)
+	}
+	if representationCount < 1 {
+		return nil, fmt.Errorf("Invalid representation count %d, a plotroot is required", representationCount)
+	}
+	return &PlotHeader{
+		Previous:            previous,
+		HashListRoot:        hashListRoot,
+		Time:                time.Now().Unix(), // just use the system time
+		Target:              target,
+		ThreadWork:          computeThreadWork(target, threadWork),
+		Nonce:               rng.Int63n(MAX_NUMBER),
+		Height:              height,
+		RepresentationCount: representationCount,
+	}, nil
+}
+
 // ID computes an ID for a given plot.
 func (b Plot) ID() (PlotID, error) {
 	return b.Header.ID()
 }
 
+// Equal returns true if both plots have the same header ID and representations with the same IDs
+// in the same order. The unmarshaled hash state used while scribing is ignored. Two nils are equal.
+func (b *Plot) Equal(other *Plot) bool {
+	if b == nil || other == nil {
+		return b == other
+	}
+	if b.Header == nil || other.Header == nil {
+		return b.Header == other.Header
+	}
+	id, err := b.ID()
+	if err != nil {
+		return false
+	}
+	otherID, err := other.ID()
+	if err != nil {
+		return false
+	}
+	if id != otherID || len(b.Representations) != len(other.Representations) {
+		return false
+	}
+	for i, tx := range b.Representations {
+		if !tx.Equal(other.Representations[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 // CheckPOW verifies the plot's proof-of-work satisfies the declared target.
 func (b Plot) CheckPOW(id PlotID) bool {
 	return id.GetBigInt().Cmp(b.Header.Target.GetBigInt()) <= 0
@@ -97,6 +159,66 @@ func (b *Plot) AddRepresentation(id RepresentationID, tx *Representation) error
 	return nil
 }
 
+// UnmarshalJSON unmarshals a plot and rejects it if its representation count is out of bounds or
+// disagrees with its header. This happens before any expensive validation.
+func (b *Plot) UnmarshalJSON(data []byte) error {
+	var p struct {
+		Header          *PlotHeader     `json:"header"`
+		Representations json.RawMessage `json:"representations"`
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+
+	// check the declared count against the limit at the plot's height before decoding any
+	// representations and then decode no more than it declares
+	limit := MAX_REPRESENTATIONS_PER_PLOT
+	if p.Header != nil {
+		if p.Header.Height < 0 {
+			return fmt.Errorf("Invalid plot height %d", p.Header.Height)
+		}
+		if max := computeMaxRepresentationsPerPlot(p.Header.Height); int(p.Header.RepresentationCount) > max {
+			return fmt.Errorf("Plot contains too many representations %d, max: %d",
+				p.Header.RepresentationCount, max)
+		}
+		limit = int(p.Header.RepresentationCount)
+	}
+	txs, err := decodeRepresentations(p.Representations, limit)
+	if err != nil {
+		return err
+	}
+	if p.Header != nil && len(txs) != limit {
+		return fmt.Errorf("Representation count %d in header doesn't match %d representations in plot",
+			p.Header.RepresentationCount, len(txs))
+	}
+	*b = Plot{Header: p.Header, Representations: txs}
+	return nil
+}
+
+// Decode a JSON array of representations. It fails as soon as there are more than limit
+func decodeRepresentations(data json.RawMessage, limit int) ([]*Representation, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	txs := []*Representation{}
+	for dec.More() {
+		if len(txs) >= limit {
+			return nil, fmt.Errorf("Representation count %d in header doesn't match more representations in plot",
+				limit)
+		}
+		var tx *Representation
+		if err := dec.Decode(&tx); err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
 // Compute a hash list root of all representation hashes
 func computeHashListRoot(hasher hash.Hash, representations []*Representation) (RepresentationID, error) {
 	if hasher == nil {
@@ -104,8 +226,9 @@ func computeHashListRoot(hasher hash.Hash, representations []*Representation) (R
 	}
 
 	// don't include plotroot in the first round
+	idHasher := NewRepresentationIDHasher()
 	for _, tx := range representations[1:] {
-		id, err := tx.ID()
+		id, err := idHasher.ID(tx)
 		if err != nil {
 			return RepresentationID{}, err
 		}
@@ -164,11 +287,7 @@ func computeThreadWork(target, threadWork PlotID) (newThreadWork PlotID) {
 
 // ID computes an ID for a given plot header.
 func (header PlotHeader) ID() (PlotID, error) {
-	headerJson, err := json.Marshal(header)
-	if err != nil {
-		return PlotID{}, err
-	}
-	return sha3.Sum256([]byte(headerJson)), nil
+	return sha3.Sum256(encodePlotHeaderCanonical(&header)), nil
 }
 
 // IDFast computes an ID for a given plot header when scribing.
@@ -182,36 +301,90 @@ func (header *PlotHeader) IDFast(scriberNum int) (*big.Int, int64) {
 // Compare returns true if the header indicates it is a better thread than "theirHeader" up to both points.
 // "thisWhen" is the timestamp of when we stored this plot header.
 // "theirWhen" is the timestamp of when we stored "theirHeader".
-func (header PlotHeader) Compare(theirHeader *PlotHeader, thisWhen, theirWhen int64) bool {
+func (header PlotHeader) Compare(theirHeader *PlotHeader, thisWhen, theirWhen int64) (bool, error) {
 	thisWorkInt := header.ThreadWork.GetBigInt()
 	theirWorkInt := theirHeader.ThreadWork.GetBigInt()
 
 	// most work wins
 	if thisWorkInt.Cmp(theirWorkInt) > 0 {
-		return true
+		return true, nil
 	}
 	if thisWorkInt.Cmp(theirWorkInt) < 0 {
-		return false
+		return false, nil
 	}
 
 	// tie goes to the plot we stored first
 	if thisWhen < theirWhen {
-		return true
+		return true, nil
 	}
 	if thisWhen > theirWhen {
-		return false
+		return false, nil
 	}
 
 	// if we still need to break a tie go by the lesser id
 	thisID, err := header.ID()
 	if err != nil {
-		panic(err)
+		return false, err
 	}
 	theirID, err := theirHeader.ID()
 	if err != nil {
-		panic(err)
+		return false, err
 	}
-	return thisID.GetBigInt().Cmp(theirID.GetBigInt()) < 0
+	return thisID.Less(theirID), nil
+}
+
+// Check that a genesis plot's thread work is exactly its own plot's work
+func checkGenesisThreadWork(header *PlotHeader) error {
+	threadWork := computeThreadWork(header.Target, PlotID{})
+	if header.ThreadWork != threadWork {
+		return fmt.Errorf("Genesis thread work %s, expected %s", header.ThreadWork, threadWork)
+	}
+	return nil
+}
+
+// ValidateHeaderChain checks that the headers form a thread following the plot with ID "startPrev".
+// Each header must link to the one before it, be one plot higher, accumulate its plot's work onto the
+// previous thread work and satisfy its own target. The first header's thread work is only checked to
+// include its own plot's work since the previous header isn't given, unless it's a genesis header whose
+// thread work must be exactly its own plot's work. The error identifies the index of
+// the first invalid header.
+func ValidateHeaderChain(headers []*PlotHeader, startPrev PlotID) error {
+	prevID := startPrev
+	var prevHeader *PlotHeader
+	for i, header := range headers {
+		if header == nil {
+			return fmt.Errorf("Header %d: missing", i)
+		}
+		if header.Previous != prevID {
+			return fmt.Errorf("Header %d: previous %s, expected %s", i, header.Previous, prevID)
+		}
+
+		if prevHeader != nil {
+			if header.Height != prevHeader.Height+1 {
+				return fmt.Errorf("Header %d: height %d, expected %d", i, header.Height, prevHeader.Height+1)
+			}
+			threadWork := computeThreadWork(header.Target, prevHeader.ThreadWork)
+			if header.ThreadWork != threadWork {
+				return fmt.Errorf("Header %d: thread work %s, expected %s", i, header.ThreadWork, threadWork)
+			}
+		} else if header.Height == 0 {
+			if err := checkGenesisThreadWork(header); err != nil {
+				return fmt.Errorf("Header %d: %s", i, err)
+			}
+		} else if header.ThreadWork.GetBigInt().Cmp(computePlotWork(header.Target)) < 0 {
+			return fmt.Errorf("Header %d: thread work %s is less than its plot's work", i, header.ThreadWork)
+		}
+
+		id, err := header.ID()
+		if err != nil {
+			return fmt.Errorf("Header %d: %s", i, err)
+		}
+		if id.GetBigInt().Cmp(header.Target.GetBigInt()) > 0 {
+			return fmt.Errorf("Header %d: insufficient proof-of-work for plot %s", i, id)
+		}
+		prevID, prevHeader = id, header
+	}
+	return nil
 }
 
 // String implements the Stringer interface
@@ -255,3 +428,8 @@ func (id *PlotID) SetBigInt(i *big.Int) *PlotID {
 func (id PlotID) GetBigInt() *big.Int {
 	return new(big.Int).SetBytes(id[:])
 }
+
+// Less returns true if id is numerically less than other when both are read as big-endian integers.
+func (id PlotID) Less(other PlotID) bool {
+	return bytes.Compare(id[:], other[:]) < 0
+}
@@ -1,8 +1,11 @@
 package plotthread
 
 import (
+	"bytes"
 	"encoding/hex"
+	"fmt"
 	"hash"
+	"log"
 	"math/big"
 	"strconv"
 
@@ -36,6 +39,10 @@ type PlotHeaderHasher struct {
 	resultBuf        [32]byte
 	result           *big.Int
 	hashesPerAttempt int64
+
+	// used for scribing on a device
+	device         DeviceScriber
+	devicePrepared bool
 }
 
 // HashWithRead extends hash.Hash to provide a Read interface.
@@ -74,6 +81,101 @@ func NewPlotHeaderHasher() *PlotHeaderHasher {
 	}
 }
 
+// VerifyWork returns true if the header's ID is at or below the given target. It's read-only and
+// doesn't otherwise validate the header so it can check work against a share target easier than
+// the header's own as well as against the network target.
+func VerifyWork(header *PlotHeader, target PlotID) bool {
+	hash, _ := NewPlotHeaderHasher().Update(0, header)
+	return hash.Cmp(target.GetBigInt()) <= 0
+}
+
+// PlotHeaderHasherState is a snapshot of an initialized PlotHeaderHasher's buffer and offsets.
+// A pool can hand it to workers so each restores it instead of initializing its own hasher.
+type PlotHeaderHasherState struct {
+	Buffer                    []byte           `json:"buffer"`
+	HashListRoot              RepresentationID `json:"hash_list_root"`
+	Time                      int64            `json:"time"`
+	Nonce                     int64            `json:"nonce"`
+	RepresentationCount       int32            `json:"representation_count"`
+	HashListRootOffset        int              `json:"hash_list_root_offset"`
+	TimeOffset                int              `json:"time_offset"`
+	NonceOffset               int              `json:"nonce_offset"`
+	RepresentationCountOffset int              `json:"representation_count_offset"`
+}
+
+// SetDeviceScriber sets a device to search for solving nonces instead of hashing each attempt on the
+// CPU. Any nonce it finds is double-checked on the CPU. A nil device restores CPU scribing.
+func (h *PlotHeaderHasher) SetDeviceScriber(device DeviceScriber) {
+	h.device = device
+	h.devicePrepared = false
+	h.hashesPerAttempt = 1
+}
+
+// State returns a snapshot of the hasher's state. The hasher must have been updated at least once.
+func (h *PlotHeaderHasher) State() (*PlotHeaderHasherState, error) {
+	if !h.initialized {
+		return nil, fmt.Errorf("Plot header hasher isn't initialized")
+	}
+	return &PlotHeaderHasherState{
+		Buffer:                    append([]byte(nil), h.buffer[:h.bufLen]...),
+		HashListRoot:              h.previousHashListRoot,
+		Time:                      h.previousTime,
+		Nonce:                     h.previousNonce,
+		RepresentationCount:       h.previousRepresentationCount,
+		HashListRootOffset:        h.hashListRootOffset,
+		TimeOffset:                h.timeOffset,
+		NonceOffset:               h.nonceOffset,
+		RepresentationCountOffset: h.representationCountOffset,
+	}, nil
+}
+
+// Restore replaces the hasher's state with the snapshot. It's then used with the header the
+// snapshot was taken from or one differing only in its hash list root, time, nonce or
+// representation count. The snapshot is checked for consistency but not against the header.
+func (h *PlotHeaderHasher) Restore(state *PlotHeaderHasherState) error {
+	if len(state.Buffer) > len(h.buffer) {
+		return fmt.Errorf("Plot header hasher state buffer too large: %d", len(state.Buffer))
+	}
+
+	// each mutable field must be where the state says it is
+	hashListRoot := make([]byte, hex.EncodedLen(len(state.HashListRoot)))
+	hex.Encode(hashListRoot, state.HashListRoot[:])
+	fields := []struct {
+		offset int
+		value  []byte
+	}{
+		{state.HashListRootOffset, hashListRoot},
+		{state.TimeOffset, strconv.AppendInt(nil, state.Time, 10)},
+		{state.NonceOffset, strconv.AppendInt(nil, state.Nonce, 10)},
+		{state.RepresentationCountOffset, strconv.AppendInt(nil, int64(state.RepresentationCount), 10)},
+	}
+	for _, field := range fields {
+		end := field.offset + len(field.value)
+		if field.offset < 0 || end > len(state.Buffer) || !bytes.Equal(state.Buffer[field.offset:end], field.value) {
+			return fmt.Errorf("Inconsistent plot header hasher state")
+		}
+	}
+	if !bytes.HasSuffix(state.Buffer, hdrEnd) {
+		return fmt.Errorf("Inconsistent plot header hasher state")
+	}
+
+	h.bufLen = copy(h.buffer, state.Buffer)
+	h.previousHashListRoot = state.HashListRoot
+	h.previousTime = state.Time
+	h.previousNonce = state.Nonce
+	h.previousRepresentationCount = state.RepresentationCount
+	h.hashListRootOffset = state.HashListRootOffset
+	h.timeOffset = state.TimeOffset
+	h.nonceOffset = state.NonceOffset
+	h.representationCountOffset = state.RepresentationCountOffset
+	h.timeLen = len(fields[1].value)
+	h.nonceLen = len(fields[2].value)
+	h.txCountLen = len(fields[3].value)
+	h.initialized = true
+	h.devicePrepared = false
+	return nil
+}
+
 // Initialize the buffer to be hashed
 func (h *PlotHeaderHasher) initBuffer(header *PlotHeader) {
 	// lots of mixing append on slices with writes to array offsets.
@@ -146,16 +248,16 @@ func (h *PlotHeaderHasher) initBuffer(header *PlotHeader) {
 
 // Update is called everytime the header is updated and the caller wants its new hash value/ID.
 func (h *PlotHeaderHasher) Update(scriberNum int, header *PlotHeader) (*big.Int, int64) {
-	var deviceScribing bool = false
-	//var bufferChanged bool
+	deviceScribing := h.device != nil
+	var bufferChanged bool
 
 	if !h.initialized {
 		h.initBuffer(header)
-		//bufferChanged = true
+		bufferChanged = true
 	} else {
 		// hash_list_root
 		if h.previousHashListRoot != header.HashListRoot {
-			//bufferChanged = true
+			bufferChanged = true
 			// write out the new value
 			h.previousHashListRoot = header.HashListRoot
 			hex.Encode(h.buffer[h.hashListRootOffset:], header.HashListRoot[:])
@@ -165,7 +267,7 @@ func (h *PlotHeaderHasher) Update(scriberNum int, header *PlotHeader) (*big.Int,
 
 		// time
 		if h.previousTime != header.Time {
-			//bufferChanged = true
+			bufferChanged = true
 			h.previousTime = header.Time
 
 			// write out the new value
@@ -200,7 +302,7 @@ func (h *PlotHeaderHasher) Update(scriberNum int, header *PlotHeader) (*big.Int,
 
 		// nonce
 		if offset != 0 || (!deviceScribing && h.previousNonce != header.Nonce) {
-			//bufferChanged = true
+			bufferChanged = true
 			h.previousNonce = header.Nonce
 
 			// write out the new value (or old value at a new location)
@@ -227,7 +329,7 @@ func (h *PlotHeaderHasher) Update(scriberNum int, header *PlotHeader) (*big.Int,
 
 		// representation_count
 		if offset != 0 || h.previousRepresentationCount != header.RepresentationCount {
-			//bufferChanged = true
+			bufferChanged = true
 			h.previousRepresentationCount = header.RepresentationCount
 
 			// write out the new value (or old value at a new location)
@@ -250,28 +352,32 @@ func (h *PlotHeaderHasher) Update(scriberNum int, header *PlotHeader) (*big.Int,
 		h.bufLen += offset
 	}
 
-	// if deviceScribing {
-	// 	// devices don't return a hash just a solving nonce (if found)
-	// 	nonce := h.updateDevice(scriberNum, header, bufferChanged)
-	// 	if nonce == 0x7FFFFFFFFFFFFFFF {
-	// 		// not found
-	// 		h.result.SetBytes(
-	// 			// indirectly let scriber.go know we failed
-	// 			[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
-	// 				0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
-	// 				0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
-	// 				0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
-	// 		)
-	// 		return h.result, h.hashesPerAttempt
-	// 	} else {
-	// 		log.Printf("GPU scriber %d found a possible solution: %d, double-checking it...\n",
-	// 			scriberNum, nonce)
-	// 		// rebuild the buffer with the new nonce since we don't update it
-	// 		// per attempt when using CUDA/OpenCL.
-	// 		header.Nonce = nonce
-	// 		h.initBuffer(header)
-	// 	}
-	//}
+	if deviceScribing {
+		// devices don't return a hash just a solving nonce (if found)
+		if bufferChanged || !h.devicePrepared {
+			// update the device's copy of the buffer
+			h.hashesPerAttempt = h.device.Prepare(h.buffer, h.bufLen, h.nonceOffset, h.nonceLen, header.Target)
+			h.devicePrepared = true
+		}
+		nonce, found := h.device.Scribe(header.Nonce)
+		if !found {
+			h.result.SetBytes(
+				// indirectly let scriber.go know we failed
+				[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+					0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+					0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+					0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			)
+			return h.result, h.hashesPerAttempt
+		}
+		log.Printf("Device scriber %d found a possible solution: %d, double-checking it...\n",
+			scriberNum, nonce)
+		// rebuild the buffer with the new nonce since we don't update it
+		// per attempt when using a device
+		header.Nonce = nonce
+		h.initBuffer(header)
+		h.devicePrepared = false
+	}
 
 	// hash it
 	h.hasher.Reset()
@@ -280,26 +386,3 @@ func (h *PlotHeaderHasher) Update(scriberNum int, header *PlotHeader) (*big.Int,
 	h.result.SetBytes(h.resultBuf[:])
 	return h.result, h.hashesPerAttempt
 }
-
-// Handle scribing with GPU devices
-// func (h *PlotHeaderHasher) updateDevice(scriberNum int, header *PlotHeader, bufferChanged bool) int64 {
-// 	if bufferChanged {
-// 		// update the device's copy of the buffer
-// 		lastOffset := h.nonceOffset + h.nonceLen
-// 		if CUDA_ENABLED {
-// 			h.hashesPerAttempt = CudaScriberUpdate(scriberNum, h.buffer, h.bufLen,
-// 				h.nonceOffset, lastOffset, header.Target)
-// 		} else {
-// 			h.hashesPerAttempt = OpenCLScriberUpdate(scriberNum, h.buffer, h.bufLen,
-// 				h.nonceOffset, lastOffset, header.Target)
-// 		}
-// 	}
-// 	// try for a solution
-// 	var nonce int64
-// 	if CUDA_ENABLED {
-// 		nonce = CudaScriberScribe(scriberNum, header.Nonce)
-// 	} else {
-// 		nonce = OpenCLScriberScribe(scriberNum, header.Nonce)
-// 	}
-// 	return nonce
-// }
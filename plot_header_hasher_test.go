@@ -2,7 +2,9 @@ package plotthread
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
 	"testing"
@@ -58,6 +60,103 @@ func makeTestPlot(n int) (*Plot, error) {
 	return plot, nil
 }
 
+func TestVerifyWork(t *testing.T) {
+	plot, err := makeTestPlot(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := plot.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a share target the header just meets and a network target it just misses
+	var shareTarget, networkTarget PlotID
+	shareTarget.SetBigInt(id.GetBigInt())
+	networkTarget.SetBigInt(new(big.Int).Sub(id.GetBigInt(), big.NewInt(1)))
+
+	if !VerifyWork(plot.Header, shareTarget) {
+		t.Fatal("Expected the header to meet the share target")
+	}
+	if VerifyWork(plot.Header, networkTarget) {
+		t.Fatal("Expected the header not to meet the network target")
+	}
+
+	// it agrees with the plot's own check
+	if VerifyWork(plot.Header, plot.Header.Target) != plot.CheckPOW(id) {
+		t.Fatal("Expected VerifyWork to agree with CheckPOW")
+	}
+
+	// and doesn't modify the header
+	header := *plot.Header
+	VerifyWork(plot.Header, shareTarget)
+	if *plot.Header != header {
+		t.Fatal("Expected the header to be unchanged")
+	}
+}
+
+func TestPlotHeaderHasherState(t *testing.T) {
+	plot, err := makeTestPlot(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := *plot.Header
+	header.Nonce = 1
+
+	// nothing to snapshot yet
+	hasher := NewPlotHeaderHasher()
+	if _, err := hasher.State(); err == nil {
+		t.Fatal("Expected an uninitialized hasher to have no state")
+	}
+
+	// snapshot an initialized hasher and send it to a worker
+	hasher.Update(0, &header)
+	state, err := hasher.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateJson, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received PlotHeaderHasherState
+	if err := json.Unmarshal(stateJson, &received); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewPlotHeaderHasher()
+	if err := restored.Restore(&received); err != nil {
+		t.Fatal(err)
+	}
+
+	// it produces the same IDs as a fresh hasher across nonces of varying length and a new time
+	fresh := NewPlotHeaderHasher()
+	for nonce := int64(1); nonce < 100000; nonce += 7 {
+		header.Nonce = nonce
+		if nonce > 50000 {
+			header.Time = 1234567890
+		}
+		expected, _ := fresh.Update(0, &header)
+		id, _ := restored.Update(0, &header)
+		if id.Cmp(expected) != 0 {
+			t.Fatalf("ID mismatch at nonce %d", nonce)
+		}
+	}
+	id, err := header.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoredID, _ := restored.Update(0, &header)
+	if *new(PlotID).SetBigInt(restoredID) != id {
+		t.Fatal("ID mismatch with the header's")
+	}
+
+	// an inconsistent state is rejected
+	received.NonceOffset++
+	if err := NewPlotHeaderHasher().Restore(&received); err == nil {
+		t.Fatal("Expected an inconsistent state to be rejected")
+	}
+}
+
 func TestPlotHeaderHasher(t *testing.T) {
 	plot, err := makeTestPlot(10)
 	if err != nil {
@@ -121,3 +220,80 @@ func compareIDs(plot *Plot) bool {
 	id2 := new(PlotID).SetBigInt(idInt)
 	return id == *id2
 }
+
+// a device which finds a fixed nonce on its nth attempt
+type testDeviceScriber struct {
+	NoopDeviceScriber
+	nonce    int64
+	after    int
+	attempts int
+	prepared int
+}
+
+func (d *testDeviceScriber) Prepare(buffer []byte, bufLen, nonceOffset, nonceLen int, target PlotID) int64 {
+	d.prepared++
+	return d.NoopDeviceScriber.Prepare(buffer, bufLen, nonceOffset, nonceLen, target)
+}
+
+func (d *testDeviceScriber) Scribe(startNonce int64) (int64, bool) {
+	d.attempts++
+	return d.nonce, d.attempts == d.after
+}
+
+func TestPlotHeaderHasherDevice(t *testing.T) {
+	plot, err := makeTestPlot(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := plot.Header
+
+	// the stub never finds a solution so nothing is hashed on the CPU
+	hasher := NewPlotHeaderHasher()
+	hasher.SetDeviceScriber(NoopDeviceScriber{HashesPerAttempt: 64})
+	for i := 0; i < 3; i++ {
+		hash, attempts := hasher.Update(0, header)
+		if attempts != 64 {
+			t.Fatalf("Expected 64 hashes per attempt, found %d", attempts)
+		}
+		if hash.Cmp(header.Target.GetBigInt()) <= 0 || len(hash.Bytes()) != 32 {
+			t.Fatalf("Expected no solution, found %x", hash.Bytes())
+		}
+		header.Nonce += attempts
+	}
+
+	// without a device it falls back to CPU hashing
+	hasher.SetDeviceScriber(nil)
+	hash, attempts := hasher.Update(0, header)
+	id, err := header.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 1 || *new(PlotID).SetBigInt(hash) != id {
+		t.Fatalf("Expected CPU hash %s with 1 attempt, found %x with %d", id, hash.Bytes(), attempts)
+	}
+
+	// a found nonce is double-checked on the CPU
+	device := &testDeviceScriber{nonce: 123456789012, after: 2}
+	hasher.SetDeviceScriber(device)
+	if _, attempts := hasher.Update(0, header); attempts != 1 {
+		t.Fatalf("Expected 1 hash per attempt, found %d", attempts)
+	}
+	header.Nonce++
+	hash, _ = hasher.Update(0, header)
+	if header.Nonce != device.nonce {
+		t.Fatalf("Expected header nonce %d, found %d", device.nonce, header.Nonce)
+	}
+	if id, err = header.ID(); err != nil {
+		t.Fatal(err)
+	}
+	if *new(PlotID).SetBigInt(hash) != id {
+		t.Fatalf("Expected double-checked hash %s, found %x", id, hash.Bytes())
+	}
+
+	// the device is prepared again after the buffer is rebuilt
+	header.Nonce++
+	hasher.Update(0, header)
+	if device.prepared != 2 {
+		t.Fatalf("Expected the device to be prepared twice, found %d", device.prepared)
+	}
+}
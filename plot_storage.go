@@ -1,19 +1,29 @@
 package plotthread
 
+import "errors"
+
+// ErrPlotNotFound is returned when a referenced plot isn't in storage.
+var ErrPlotNotFound = errors.New("Plot not found")
+
+// ErrRepresentationNotFound is returned when a plot has no representation at the referenced index.
+var ErrRepresentationNotFound = errors.New("Representation not found")
+
 // PlotStorage is an interface for storing plots and their representations.
 type PlotStorage interface {
 	// Store is called to store all of the plot's information.
 	Store(id PlotID, plot *Plot, now int64) error
 
-	// Get returns the referenced plot.
+	// Get returns the referenced plot or ErrPlotNotFound.
 	GetPlot(id PlotID) (*Plot, error)
 
-	// GetPlotBytes returns the referenced plot as a byte slice.
+	// GetPlotBytes returns the referenced plot as a byte slice or ErrPlotNotFound.
 	GetPlotBytes(id PlotID) ([]byte, error)
 
-	// GetPlotHeader returns the referenced plot's header and the timestamp of when it was stored.
+	// GetPlotHeader returns the referenced plot's header and the timestamp of when it was stored
+	// or ErrPlotNotFound.
 	GetPlotHeader(id PlotID) (*PlotHeader, int64, error)
 
 	// GetRepresentation returns a representation within a plot and the plot's header.
+	// It returns ErrPlotNotFound or ErrRepresentationNotFound if either is missing.
 	GetRepresentation(id PlotID, index int) (*Representation, *PlotHeader, error)
 }
@@ -0,0 +1,140 @@
+package plotthread
+
+import "context"
+
+// PlotStorageContext is a context-aware version of the PlotStorage interface.
+// Calls return the context's error if it's cancelled or its deadline passes before they complete.
+type PlotStorageContext interface {
+	// Store is called to store all of the plot's information.
+	Store(ctx context.Context, id PlotID, plot *Plot, now int64) error
+
+	// Get returns the referenced plot.
+	GetPlot(ctx context.Context, id PlotID) (*Plot, error)
+
+	// GetPlotBytes returns the referenced plot as a byte slice.
+	GetPlotBytes(ctx context.Context, id PlotID) ([]byte, error)
+
+	// GetPlotHeader returns the referenced plot's header and the timestamp of when it was stored.
+	GetPlotHeader(ctx context.Context, id PlotID) (*PlotHeader, int64, error)
+
+	// GetRepresentation returns a representation within a plot and the plot's header.
+	GetRepresentation(ctx context.Context, id PlotID, index int) (*Representation, *PlotHeader, error)
+}
+
+// NewPlotStorageContext adapts a PlotStorage to the PlotStorageContext interface.
+// The underlying call can't be interrupted. On cancellation it's abandoned and its result discarded.
+func NewPlotStorageContext(plotStore PlotStorage) PlotStorageContext {
+	return plotStorageContextAdapter{plotStore: plotStore}
+}
+
+type plotStorageContextAdapter struct {
+	plotStore PlotStorage
+}
+
+// Store is called to store all of the plot's information.
+func (a plotStorageContextAdapter) Store(ctx context.Context, id PlotID, plot *Plot, now int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- a.plotStore.Store(id, plot, now)
+	}()
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Get returns the referenced plot.
+func (a plotStorageContextAdapter) GetPlot(ctx context.Context, id PlotID) (*Plot, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		plot *Plot
+		err  error
+	}
+	resultChan := make(chan result, 1)
+	go func() {
+		plot, err := a.plotStore.GetPlot(id)
+		resultChan <- result{plot: plot, err: err}
+	}()
+	select {
+	case r := <-resultChan:
+		return r.plot, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// GetPlotBytes returns the referenced plot as a byte slice.
+func (a plotStorageContextAdapter) GetPlotBytes(ctx context.Context, id PlotID) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		plotBytes []byte
+		err       error
+	}
+	resultChan := make(chan result, 1)
+	go func() {
+		plotBytes, err := a.plotStore.GetPlotBytes(id)
+		resultChan <- result{plotBytes: plotBytes, err: err}
+	}()
+	select {
+	case r := <-resultChan:
+		return r.plotBytes, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// GetPlotHeader returns the referenced plot's header and the timestamp of when it was stored.
+func (a plotStorageContextAdapter) GetPlotHeader(ctx context.Context, id PlotID) (*PlotHeader, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	type result struct {
+		header *PlotHeader
+		when   int64
+		err    error
+	}
+	resultChan := make(chan result, 1)
+	go func() {
+		header, when, err := a.plotStore.GetPlotHeader(id)
+		resultChan <- result{header: header, when: when, err: err}
+	}()
+	select {
+	case r := <-resultChan:
+		return r.header, r.when, r.err
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+}
+
+// GetRepresentation returns a representation within a plot and the plot's header.
+func (a plotStorageContextAdapter) GetRepresentation(ctx context.Context, id PlotID, index int) (
+	*Representation, *PlotHeader, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	type result struct {
+		tx     *Representation
+		header *PlotHeader
+		err    error
+	}
+	resultChan := make(chan result, 1)
+	go func() {
+		tx, header, err := a.plotStore.GetRepresentation(id, index)
+		resultChan <- result{tx: tx, header: header, err: err}
+	}()
+	select {
+	case r := <-resultChan:
+		return r.tx, r.header, r.err
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
@@ -0,0 +1,52 @@
+package plotthread
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// slowPlotStore blocks reads until released
+type slowPlotStore struct {
+	PlotStorage
+	release chan struct{}
+}
+
+func (s slowPlotStore) GetPlot(id PlotID) (*Plot, error) {
+	<-s.release
+	return nil, nil
+}
+
+func TestPlotStorageContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	plotStore := NewPlotStorageContext(slowPlotStore{release: release})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := plotStore.GetPlot(ctx, PlotID{})
+		errChan <- err
+	}()
+
+	select {
+	case err := <-errChan:
+		if err != context.Canceled {
+			t.Fatalf("Expected context.Canceled, found: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Cancelled GetPlot didn't return")
+	}
+
+	// an already expired context doesn't reach storage
+	ctx, cancel = context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if _, err := plotStore.GetPlot(ctx, PlotID{}); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, found: %v", err)
+	}
+}
@@ -114,7 +114,7 @@ func (b PlotStorageDisk) Store(id PlotID, plot *Plot, now int64) error {
 	return b.db.Put(id[:], encodedPlotHeader, &wo)
 }
 
-// Get returns the referenced plot.
+// Get returns the referenced plot or ErrPlotNotFound.
 func (b PlotStorageDisk) GetPlot(id PlotID) (*Plot, error) {
 	plotJson, err := b.GetPlotBytes(id)
 	if err != nil {
@@ -129,7 +129,7 @@ func (b PlotStorageDisk) GetPlot(id PlotID) (*Plot, error) {
 	return plot, nil
 }
 
-// GetPlotBytes returns the referenced plot as a byte slice.
+// GetPlotBytes returns the referenced plot as a byte slice or ErrPlotNotFound.
 func (b PlotStorageDisk) GetPlotBytes(id PlotID) ([]byte, error) {
 	var ext [2]string
 	if b.compress {
@@ -146,8 +146,7 @@ func (b PlotStorageDisk) GetPlotBytes(id PlotID) ([]byte, error) {
 		compressed = !compressed
 		plotPath = filepath.Join(b.dirPath, id.String()+ext[1])
 		if _, err := os.Stat(plotPath); os.IsNotExist(err) {
-			// not found
-			return nil, nil
+			return nil, ErrPlotNotFound
 		}
 	}
 
@@ -171,12 +170,13 @@ func (b PlotStorageDisk) GetPlotBytes(id PlotID) ([]byte, error) {
 	return plotBytes, nil
 }
 
-// GetPlotHeader returns the referenced plot's header and the timestamp of when it was stored.
+// GetPlotHeader returns the referenced plot's header and the timestamp of when it was stored
+// or ErrPlotNotFound.
 func (b PlotStorageDisk) GetPlotHeader(id PlotID) (*PlotHeader, int64, error) {
 	// fetch it
 	encodedHeader, err := b.db.Get(id[:], nil)
 	if err == leveldb.ErrNotFound {
-		return nil, 0, nil
+		return nil, 0, ErrPlotNotFound
 	}
 	if err != nil {
 		return nil, 0, err
@@ -187,6 +187,7 @@ func (b PlotStorageDisk) GetPlotHeader(id PlotID) (*PlotHeader, int64, error) {
 }
 
 // GetRepresentation returns a representation within a plot and the plot's header.
+// It returns ErrPlotNotFound or ErrRepresentationNotFound if either is missing.
 func (b PlotStorageDisk) GetRepresentation(id PlotID, index int) (
 	*Representation, *PlotHeader, error) {
 	plotJson, err := b.GetPlotBytes(id)
@@ -197,6 +198,9 @@ func (b PlotStorageDisk) GetRepresentation(id PlotID, index int) (
 	// pick out and unmarshal the representation at the index
 	idx := "[" + strconv.Itoa(index) + "]"
 	txJson, _, _, err := jsonparser.Get(plotJson, "representations", idx)
+	if err == jsonparser.KeyPathNotFoundError {
+		return nil, nil, ErrRepresentationNotFound
+	}
 	if err != nil {
 		return nil, nil, err
 	}
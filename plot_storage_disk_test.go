@@ -2,6 +2,9 @@ package plotthread
 
 import (
 	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"golang.org/x/crypto/ed25519"
@@ -49,3 +52,59 @@ func TestEncodePlotHeader(t *testing.T) {
 		t.Fatal("Decoded timestamp doesn't match original")
 	}
 }
+
+func TestPlotStorageDiskNotFound(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plotStore, err := NewPlotStorageDisk(filepath.Join(dir, "plots"), filepath.Join(dir, "headers"), false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plotStore.Close()
+
+	plot, err := makeTestPlot(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := plot.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing stored yet
+	if _, err := plotStore.GetPlot(id); err != ErrPlotNotFound {
+		t.Fatalf("Expected ErrPlotNotFound, found: %v", err)
+	}
+	if _, err := plotStore.GetPlotBytes(id); err != ErrPlotNotFound {
+		t.Fatalf("Expected ErrPlotNotFound, found: %v", err)
+	}
+	if _, _, err := plotStore.GetRepresentation(id, 0); err != ErrPlotNotFound {
+		t.Fatalf("Expected ErrPlotNotFound, found: %v", err)
+	}
+	if _, _, err := plotStore.GetPlotHeader(id); err != ErrPlotNotFound {
+		t.Fatalf("Expected ErrPlotNotFound, found: %v", err)
+	}
+
+	if err := plotStore.Store(id, plot, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plotStore.GetPlot(id); err != nil {
+		t.Fatal(err)
+	}
+	tx, _, err := plotStore.GetRepresentation(id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Equal(plot.Representations[1]) {
+		t.Fatal("Expected the stored representation")
+	}
+
+	// past the end of the plot
+	if _, _, err := plotStore.GetRepresentation(id, len(plot.Representations)); err != ErrRepresentationNotFound {
+		t.Fatalf("Expected ErrRepresentationNotFound, found: %v", err)
+	}
+}
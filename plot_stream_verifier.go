@@ -0,0 +1,148 @@
+package plotthread
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// VerifyStoredPlot verifies the proof-of-work and hash list root of a stored plot using
+// VerifyPlotBytes. It returns the plot's header.
+func VerifyStoredPlot(store PlotStorage, id PlotID) (*PlotHeader, error) {
+	plotJson, err := store.GetPlotBytes(id)
+	if err != nil {
+		return nil, err
+	}
+	plotID, header, err := VerifyPlotBytes(plotJson)
+	if err != nil {
+		return nil, fmt.Errorf("%s, plot %s", err, id)
+	}
+	if plotID != id {
+		return nil, fmt.Errorf("Stored plot has ID %s, expected %s", plotID, id)
+	}
+	return header, nil
+}
+
+// VerifyPlotBytes verifies the proof-of-work and hash list root of a JSON encoded plot and returns
+// its ID and header. Representations are decoded and hashed one at a time and never retained, so
+// memory use beyond the encoded plot is bounded by the largest representation regardless of how
+// many the plot contains. Other context-free checks are left to the caller.
+func VerifyPlotBytes(plotJson []byte) (PlotID, *PlotHeader, error) {
+	dec := json.NewDecoder(bytes.NewReader(plotJson))
+	if err := expectDelim(dec, '{'); err != nil {
+		return PlotID{}, nil, err
+	}
+
+	var header *PlotHeader
+	var plotroot *Representation
+	var count int
+	var listSeen bool
+	hasher := sha3.New256()
+	idHasher := NewRepresentationIDHasher()
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return PlotID{}, nil, err
+		}
+		switch key {
+		case "header":
+			if err := dec.Decode(&header); err != nil {
+				return PlotID{}, nil, err
+			}
+
+		case "representations":
+			if listSeen {
+				return PlotID{}, nil, fmt.Errorf("Duplicate representation list")
+			}
+			listSeen = true
+			tok, err := dec.Token()
+			if err != nil {
+				return PlotID{}, nil, err
+			}
+			if tok == nil {
+				// null
+				break
+			}
+			if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+				return PlotID{}, nil, fmt.Errorf("Expected representation list, found %v", tok)
+			}
+			for dec.More() {
+				if count == MAX_REPRESENTATIONS_PER_PLOT {
+					return PlotID{}, nil, fmt.Errorf("Plot contains too many representations")
+				}
+				tx := new(Representation)
+				if err := dec.Decode(tx); err != nil {
+					return PlotID{}, nil, err
+				}
+				count++
+				if plotroot == nil {
+					// the plotroot is hashed last
+					plotroot = tx
+					continue
+				}
+				id, err := idHasher.ID(tx)
+				if err != nil {
+					return PlotID{}, nil, err
+				}
+				hasher.Write(id[:])
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return PlotID{}, nil, err
+			}
+
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return PlotID{}, nil, err
+			}
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return PlotID{}, nil, err
+	}
+
+	if header == nil {
+		return PlotID{}, nil, fmt.Errorf("Plot has no header")
+	}
+	if plotroot == nil {
+		return PlotID{}, nil, fmt.Errorf("Plot has no representations")
+	}
+	if int(header.RepresentationCount) != count {
+		return PlotID{}, nil, fmt.Errorf("Representation count %d in header doesn't match %d representations",
+			header.RepresentationCount, count)
+	}
+
+	// check the hash list root
+	hashListRoot, err := addPlotrootToHashListRoot(hasher, plotroot)
+	if err != nil {
+		return PlotID{}, nil, err
+	}
+	if hashListRoot != header.HashListRoot {
+		return PlotID{}, nil, fmt.Errorf("Hash list root mismatch")
+	}
+
+	// check proof-of-work
+	id, err := header.ID()
+	if err != nil {
+		return PlotID{}, nil, err
+	}
+	if !(Plot{Header: header}).CheckPOW(id) {
+		return PlotID{}, nil, fmt.Errorf("Insufficient proof-of-work")
+	}
+	return id, header, nil
+}
+
+// Consume the next token and make sure it's the given delimiter
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("Expected %s, found %v", delim, tok)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package plotthread
+
+import (
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Make a test plot with n representations whose ID satisfies its target
+func makeTestPlotWithPOW(n int) (*Plot, error) {
+	plot, err := makeTestPlot(n)
+	if err != nil {
+		return nil, err
+	}
+	for i := range plot.Header.Target {
+		plot.Header.Target[i] = 0xff
+	}
+	return plot, nil
+}
+
+func TestVerifyPlotBytes(t *testing.T) {
+	plot, err := makeTestPlotWithPOW(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedID, err := plot.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plotJson, err := json.Marshal(plot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, header, err := VerifyPlotBytes(plotJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != expectedID || header.RepresentationCount != 5 {
+		t.Fatalf("Expected plot %s with 5 representations, found %s with %d",
+			expectedID, id, header.RepresentationCount)
+	}
+
+	// stored plots verify by ID
+	store := newTestPlotStore()
+	if err := store.Store(id, plot, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyStoredPlot(store, id); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, err string
+		tamper    func(string) string
+	}{
+		{"representation", "Hash list root mismatch", func(s string) string {
+			return strings.Replace(s, `"nonce":123456790`, `"nonce":123456791`, 1)
+		}},
+		{"count", "doesn't match", func(s string) string {
+			return strings.Replace(s, `"representation_count":5`, `"representation_count":4`, 1)
+		}},
+		{"no list", "no representations", func(s string) string {
+			return s[:strings.Index(s, `,"representations"`)] + "}"
+		}},
+		{"truncated", "EOF", func(s string) string {
+			return s[:len(s)/2]
+		}},
+	}
+	for _, test := range tests {
+		_, _, err := VerifyPlotBytes([]byte(test.tamper(string(plotJson))))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("%s: expected error containing %q, found: %v", test.name, test.err, err)
+		}
+	}
+
+	// insufficient work
+	plot.Header.Target = PlotID{}
+	plotJson, err = json.Marshal(plot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := VerifyPlotBytes(plotJson); err == nil || !strings.Contains(err.Error(), "proof-of-work") {
+		t.Fatalf("Expected insufficient proof-of-work, found: %v", err)
+	}
+}
+
+// Streaming only holds the header once verified so its retained-B metric stays near zero regardless
+// of plot size. Compare with BenchmarkVerifyPlotUnmarshal which holds every representation until the
+// plot is verified.
+func BenchmarkVerifyPlotBytes(b *testing.B) {
+	plotJson := makeBenchmarkPlotJson(b)
+	verify := func() interface{} {
+		_, header, err := VerifyPlotBytes(plotJson)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return header
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		verify()
+	}
+	b.StopTimer()
+	reportRetainedHeap(b, verify)
+}
+
+func BenchmarkVerifyPlotUnmarshal(b *testing.B) {
+	plotJson := makeBenchmarkPlotJson(b)
+	verify := func() interface{} {
+		plot := new(Plot)
+		if err := json.Unmarshal(plotJson, plot); err != nil {
+			b.Fatal(err)
+		}
+		id, err := plot.ID()
+		if err != nil {
+			b.Fatal(err)
+		}
+		hashListRoot, err := computeHashListRoot(nil, plot.Representations)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if hashListRoot != plot.Header.HashListRoot || !plot.CheckPOW(id) {
+			b.Fatal("Expected plot to verify")
+		}
+		return plot
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		verify()
+	}
+	b.StopTimer()
+	reportRetainedHeap(b, verify)
+}
+
+// Report how much heap the result of verification holds on to
+func reportRetainedHeap(b *testing.B, verify func() interface{}) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	result := verify()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(result)
+	runtime.KeepAlive(verify) // and the encoded plot
+	var retained uint64
+	if after.HeapAlloc > before.HeapAlloc {
+		retained = after.HeapAlloc - before.HeapAlloc
+	}
+	b.ReportMetric(float64(retained), "retained-B")
+}
+
+// A plot with the maximum number of representations allowed at genesis
+func makeBenchmarkPlotJson(b *testing.B) []byte {
+	plot, err := makeTestPlotWithPOW(INITIAL_MAX_REPRESENTATIONS_PER_PLOT)
+	if err != nil {
+		b.Fatal(err)
+	}
+	plotJson, err := json.Marshal(plot)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return plotJson
+}
@@ -0,0 +1,307 @@
+package plotthread
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPlotHeaderCompare(t *testing.T) {
+	var work1, work2 PlotID
+	work1.SetBigInt(computePlotWork(PlotID{0: 0x01}))
+	work2.SetBigInt(computePlotWork(PlotID{0: 0x02}))
+
+	header1 := &PlotHeader{ThreadWork: work1, Nonce: 1}
+	header2 := &PlotHeader{ThreadWork: work2, Nonce: 2}
+
+	compare := func(a, b *PlotHeader, aWhen, bWhen int64) bool {
+		better, err := a.Compare(b, aWhen, bWhen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return better
+	}
+
+	// most work wins regardless of when they were stored
+	if !compare(header1, header2, 2, 1) {
+		t.Fatal("Expected more work to win")
+	}
+	if compare(header2, header1, 1, 2) {
+		t.Fatal("Expected less work to lose")
+	}
+
+	// equal work, different times. the one stored first wins
+	header3 := &PlotHeader{ThreadWork: work1, Nonce: 3}
+	if !compare(header1, header3, 1, 2) {
+		t.Fatal("Expected earlier stored plot to win")
+	}
+	if compare(header1, header3, 2, 1) {
+		t.Fatal("Expected later stored plot to lose")
+	}
+
+	// equal work, equal times. the lesser ID wins
+	id1, err := header1.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id3, err := header3.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lesser, greater := header1, header3
+	if id1.GetBigInt().Cmp(id3.GetBigInt()) > 0 {
+		lesser, greater = header3, header1
+	}
+	if !compare(lesser, greater, 1, 1) {
+		t.Fatal("Expected lesser ID to win")
+	}
+	if compare(greater, lesser, 1, 1) {
+		t.Fatal("Expected greater ID to lose")
+	}
+
+	// a plot isn't better than itself
+	if compare(header1, header1, 1, 1) {
+		t.Fatal("Expected identical header not to win")
+	}
+}
+
+func TestPlotEqual(t *testing.T) {
+	plot, err := makeTestPlot(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// round trip it. the hash state isn't marshaled
+	plotJson, err := json.Marshal(plot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plot2 Plot
+	if err := json.Unmarshal(plotJson, &plot2); err != nil {
+		t.Fatal(err)
+	}
+	if !plot.Equal(&plot2) {
+		t.Fatal("Expected plots to be equal")
+	}
+
+	// signatures don't matter
+	plot2.Representations[1].Signature = nil
+	if !plot.Equal(&plot2) {
+		t.Fatal("Expected plots differing only by signature to be equal")
+	}
+
+	// the header does
+	plot2.Header.Nonce++
+	if plot.Equal(&plot2) {
+		t.Fatal("Expected plots with different headers to differ")
+	}
+	plot2.Header.Nonce--
+
+	// as do the representations even if the header doesn't commit to them
+	plot2.Representations[1], plot2.Representations[2] = plot2.Representations[2], plot2.Representations[1]
+	if plot.Equal(&plot2) {
+		t.Fatal("Expected plots with reordered representations to differ")
+	}
+	plot2.Representations = plot2.Representations[:2]
+	if plot.Equal(&plot2) {
+		t.Fatal("Expected plots with different representation counts to differ")
+	}
+
+	var nilPlot *Plot
+	if plot.Equal(nil) || nilPlot.Equal(plot) || !nilPlot.Equal(nil) {
+		t.Fatal("Expected only nil to equal nil")
+	}
+}
+
+func TestIDLess(t *testing.T) {
+	// in ascending order
+	ids := []PlotID{
+		{},
+		{31: 0x01},
+		{31: 0xff},
+		{30: 0x01},
+		{0: 0x01},
+		{0: 0x01, 31: 0x01},
+		{0: 0xff},
+	}
+	for i := range ids {
+		for j := range ids {
+			if ids[i].Less(ids[j]) != (i < j) {
+				t.Fatalf("Expected %s less than %s to be %v", ids[i], ids[j], i < j)
+			}
+			if RepresentationID(ids[i]).Less(RepresentationID(ids[j])) != (i < j) {
+				t.Fatalf("Representation ID order differs from plot ID order at %d, %d", i, j)
+			}
+			if (ids[i] == ids[j]) != (i == j) {
+				t.Fatalf("Expected %s equal to %s to be %v", ids[i], ids[j], i == j)
+			}
+		}
+	}
+}
+
+func TestNewPlotHeader(t *testing.T) {
+	// every ID satisfies this target
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+	previous, hashListRoot := PlotID{1}, RepresentationID{2}
+
+	header, err := NewPlotHeader(previous, hashListRoot, target, PlotID{}, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// equivalent to one constructed by hand
+	header2 := &PlotHeader{
+		Previous:            previous,
+		HashListRoot:        hashListRoot,
+		Time:                header.Time,
+		Target:              target,
+		ThreadWork:          computeThreadWork(target, PlotID{}),
+		Nonce:               header.Nonce,
+		Height:              1,
+		RepresentationCount: 1,
+	}
+	id, err := header.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := header2.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != id2 {
+		t.Fatalf("Expected ID %s, found %s", id2, id)
+	}
+
+	// the scriber's fast ID agrees
+	idInt, _ := header.IDFast(0)
+	if *new(PlotID).SetBigInt(idInt) != id {
+		t.Fatal("Expected IDFast to match ID")
+	}
+
+	// invalid fields
+	if _, err := NewPlotHeader(previous, hashListRoot, target, PlotID{}, -1, 1); err == nil {
+		t.Fatal("Expected negative height to be rejected")
+	}
+	if _, err := NewPlotHeader(previous, hashListRoot, target, PlotID{}, 1, 0); err == nil {
+		t.Fatal("Expected missing plotroot to be rejected")
+	}
+	if _, err := NewPlotHeader(previous, hashListRoot, target, PlotID{}, MAX_NUMBER+1, 1); err == nil {
+		t.Fatal("Expected oversized height to be rejected")
+	}
+}
+
+func TestPlotUnmarshalRepresentationCount(t *testing.T) {
+	plot, err := makeTestPlot(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plotJson, err := json.Marshal(plot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a consistent plot round trips
+	var plot2 Plot
+	if err := json.Unmarshal(plotJson, &plot2); err != nil {
+		t.Fatal(err)
+	}
+	if !plot.Equal(&plot2) {
+		t.Fatal("Expected unmarshaled plot to equal the original")
+	}
+
+	// the declared count disagrees with the array
+	for _, count := range []int32{2, 4, -1} {
+		plot.Header.RepresentationCount = count
+		plotJson, err = json.Marshal(plot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var plot3 Plot
+		err = json.Unmarshal(plotJson, &plot3)
+		if err == nil || !strings.Contains(err.Error(), "doesn't match") {
+			t.Fatalf("Expected count %d to be rejected, found: %v", count, err)
+		}
+	}
+
+	// a declared count over the limit at the plot's height is rejected before decoding
+	plot.Header.RepresentationCount = int32(computeMaxRepresentationsPerPlot(plot.Header.Height) + 1)
+	tooMany, err := json.Marshal(plot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plot4 Plot
+	if err := json.Unmarshal(tooMany, &plot4); err == nil || !strings.Contains(err.Error(), "too many") {
+		t.Fatalf("Expected too many representations to be rejected, found: %v", err)
+	}
+
+	// also when nested in a message
+	var pm PlotMessage
+	if err := json.Unmarshal([]byte(`{"plot":`+string(plotJson)+`}`), &pm); err == nil {
+		t.Fatal("Expected mismatched plot message to be rejected")
+	}
+}
+
+func TestValidateHeaderChain(t *testing.T) {
+	// every ID satisfies this target
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+
+	makeChain := func() []*PlotHeader {
+		var headers []*PlotHeader
+		previous, threadWork := PlotID{1}, PlotID{}
+		for height := int64(1); height <= 5; height++ {
+			header, err := NewPlotHeader(previous, RepresentationID{byte(height)}, target, threadWork, height, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			headers = append(headers, header)
+			if previous, err = header.ID(); err != nil {
+				t.Fatal(err)
+			}
+			threadWork = header.ThreadWork
+		}
+		return headers
+	}
+
+	if err := ValidateHeaderChain(makeChain(), PlotID{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateHeaderChain(nil, PlotID{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		index      int
+		start      PlotID
+		breakChain func(headers []*PlotHeader)
+	}{
+		{0, PlotID{2}, func(headers []*PlotHeader) {}},
+		{2, PlotID{1}, func(headers []*PlotHeader) { headers[2].Previous = PlotID{3} }},
+		{3, PlotID{1}, func(headers []*PlotHeader) { headers[3] = nil }},
+		{4, PlotID{1}, func(headers []*PlotHeader) { headers[4].Height = 6 }},
+		{1, PlotID{1}, func(headers []*PlotHeader) { headers[1].ThreadWork = headers[0].ThreadWork }},
+		{0, PlotID{1}, func(headers []*PlotHeader) { headers[0].ThreadWork = PlotID{} }},
+		{0, PlotID{1}, func(headers []*PlotHeader) {
+			// a target it almost certainly doesn't satisfy
+			headers[0].Target = PlotID{31: 1}
+			headers[0].ThreadWork = computeThreadWork(headers[0].Target, PlotID{})
+		}},
+	}
+	for i, c := range cases {
+		headers := makeChain()
+		c.breakChain(headers)
+		err := ValidateHeaderChain(headers, c.start)
+		if err == nil {
+			t.Fatalf("Case %d: expected an invalid chain", i)
+		}
+		if !strings.HasPrefix(err.Error(), fmt.Sprintf("Header %d:", c.index)) {
+			t.Fatalf("Case %d: expected header %d to be invalid, found: %s", i, c.index, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package plotthread
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/sha3"
+)
+
+// POOL_ATTESTATION_PREFIX begins a plotroot memo carrying a pool attestation. The memo has the form
+// "pool:<base64 public key>:<base64 signature>" optionally followed by a space and any other memo.
+const POOL_ATTESTATION_PREFIX = "pool:"
+
+// The length of an attestation in a plotroot memo not counting the space before any other memo
+var poolAttestationLength = len(POOL_ATTESTATION_PREFIX) + base64.StdEncoding.EncodedLen(ed25519.PublicKeySize) +
+	len(":") + base64.StdEncoding.EncodedLen(ed25519.SignatureSize)
+
+// Return an error if the memo is invalid or wouldn't fit in a plotroot memo after a pool attestation
+func checkPoolMemo(memo string) error {
+	if err := DefaultThreadParams.CheckMemo(memo); err != nil {
+		return err
+	}
+	if len(memo) == 0 {
+		return nil
+	}
+	limit := DefaultThreadParams.MaxMemoLength - poolAttestationLength - len(" ")
+	if len(memo) > limit {
+		return fmt.Errorf("Memo length %d exceeds limit %d when following a pool attestation", len(memo), limit)
+	}
+	return nil
+}
+
+// AttestPlot signs the plot's representations other than the plotroot with a pool's private key and
+// records the attestation in the plotroot's memo, followed by the given memo if any. Participants
+// can then check the set of representations they worked on was the one the pool assembled. The
+// plotroot is left out of what's signed since the memo is part of it. The attestation has no
+// effect on consensus. It must be redone if representations are added to the plot afterward.
+func AttestPlot(plot *Plot, privKey ed25519.PrivateKey, memo string) error {
+	message, err := computePoolAttestationMessage(plot)
+	if err != nil {
+		return err
+	}
+	signature := ed25519.Sign(privKey, message)
+	pubKey := privKey.Public().(ed25519.PublicKey)
+
+	attestation := POOL_ATTESTATION_PREFIX + base64.StdEncoding.EncodeToString(pubKey) +
+		":" + base64.StdEncoding.EncodeToString(signature)
+	if len(memo) != 0 {
+		attestation += " " + memo
+	}
+	if err := DefaultThreadParams.CheckMemo(attestation); err != nil {
+		return err
+	}
+
+	// the plotroot's ID changes with its memo
+	plot.Representations[0].Memo = attestation
+	plot.Header.HashListRoot, err = computeHashListRoot(nil, plot.Representations)
+	return err
+}
+
+// VerifyPlotAttestation returns the public key of the pool which attested to the plot's
+// representations and whether or not the attestation is valid. It returns a nil key if the
+// plotroot's memo carries no attestation.
+func VerifyPlotAttestation(plot *Plot) (ed25519.PublicKey, bool, error) {
+	if len(plot.Representations) == 0 || !strings.HasPrefix(plot.Representations[0].Memo, POOL_ATTESTATION_PREFIX) {
+		return nil, false, nil
+	}
+	attestation := strings.TrimPrefix(plot.Representations[0].Memo, POOL_ATTESTATION_PREFIX)
+	if i := strings.Index(attestation, " "); i != -1 {
+		// drop the rest of the memo
+		attestation = attestation[:i]
+	}
+	parts := strings.Split(attestation, ":")
+	if len(parts) != 2 {
+		return nil, false, fmt.Errorf("Malformed pool attestation")
+	}
+	pubKey, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, false, err
+	}
+	if len(pubKey) != ed25519.PublicKeySize {
+		return nil, false, fmt.Errorf("Invalid pool public key length: %d", len(pubKey))
+	}
+	signature, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, false, err
+	}
+
+	message, err := computePoolAttestationMessage(plot)
+	if err != nil {
+		return nil, false, err
+	}
+	return ed25519.PublicKey(pubKey), ed25519.Verify(pubKey, message, signature), nil
+}
+
+// Compute what a pool signs: the hash of the previous plot ID, the height and the IDs of the
+// representations following the plotroot
+func computePoolAttestationMessage(plot *Plot) ([]byte, error) {
+	if len(plot.Representations) == 0 {
+		return nil, fmt.Errorf("Plot has no plotroot")
+	}
+	hasher := sha3.New256()
+	hasher.Write(plot.Header.Previous[:])
+	if err := binary.Write(hasher, binary.BigEndian, plot.Header.Height); err != nil {
+		return nil, err
+	}
+	for _, tx := range plot.Representations[1:] {
+		id, err := tx.ID()
+		if err != nil {
+			return nil, err
+		}
+		hasher.Write(id[:])
+	}
+	return hasher.Sum(nil), nil
+}
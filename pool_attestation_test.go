@@ -0,0 +1,94 @@
+package plotthread
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestPoolAttestation(t *testing.T) {
+	plot, err := makeTestPlot(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no attestation
+	pubKey, ok, err := VerifyPlotAttestation(plot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pubKey != nil || ok {
+		t.Fatal("Expected no attestation")
+	}
+
+	poolPubKey, poolPrivKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AttestPlot(plot, poolPrivKey, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(plot.Representations[0].Memo, " hello") {
+		t.Fatalf("Expected the memo to be kept, found: %s", plot.Representations[0].Memo)
+	}
+
+	// the header commits to the new plotroot
+	hashListRoot, err := computeHashListRoot(nil, plot.Representations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashListRoot != plot.Header.HashListRoot {
+		t.Fatal("Expected the hash list root to be updated")
+	}
+
+	// participants can verify it
+	pubKey, ok, err = VerifyPlotAttestation(plot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || !bytes.Equal(pubKey, poolPubKey) {
+		t.Fatal("Expected a valid attestation from the pool")
+	}
+
+	// it survives the scriber varying the header
+	plot.Header.Nonce++
+	plot.Header.Time++
+	if _, ok, err := VerifyPlotAttestation(plot); err != nil || !ok {
+		t.Fatalf("Expected a valid attestation, found: %v, %v", ok, err)
+	}
+
+	// but not a different set of representations
+	plot.Representations[1], plot.Representations[2] = plot.Representations[2], plot.Representations[1]
+	if _, ok, err := VerifyPlotAttestation(plot); err != nil || ok {
+		t.Fatalf("Expected an invalid attestation, found: %v, %v", ok, err)
+	}
+
+	// or a different plotroot memo
+	plot.Representations[1], plot.Representations[2] = plot.Representations[2], plot.Representations[1]
+	plot.Representations[0].Memo = POOL_ATTESTATION_PREFIX + "garbage"
+	if _, _, err := VerifyPlotAttestation(plot); err == nil {
+		t.Fatal("Expected a malformed attestation")
+	}
+
+	// the memo must fit
+	if err := AttestPlot(plot, poolPrivKey, strings.Repeat("x", MAX_MEMO_LENGTH)); err == nil {
+		t.Fatal("Expected the memo to be too long")
+	}
+
+	// the longest memo checkPoolMemo allows can be attested
+	memo := strings.Repeat("x", MAX_MEMO_LENGTH-poolAttestationLength-1)
+	if err := checkPoolMemo(memo); err != nil {
+		t.Fatal(err)
+	}
+	if err := AttestPlot(plot, poolPrivKey, memo); err != nil {
+		t.Fatal(err)
+	}
+	if len(plot.Representations[0].Memo) != MAX_MEMO_LENGTH {
+		t.Fatalf("Expected a memo of length %d, found %d", MAX_MEMO_LENGTH, len(plot.Representations[0].Memo))
+	}
+	if err := checkPoolMemo(memo + "x"); err == nil {
+		t.Fatal("Expected the memo to be too long to follow an attestation")
+	}
+}
@@ -3,13 +3,12 @@ package plotthread
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
-	"sort"
 	"sync"
 	"time"
-	"unicode/utf8"
 
 	"golang.org/x/crypto/ed25519"
 )
@@ -29,10 +28,20 @@ type Processor struct {
 	unregisterTipChangeChan chan chan<- TipChange         // receive unregistration requests for tip change notifications
 	newTxChannels           map[chan<- NewTx]struct{}     // channels needing notification of newly processed representations
 	tipChangeChannels       map[chan<- TipChange]struct{} // channels needing notification of changes to main thread tip plots
+	requireRefers           bool                          // require referenced representations to be confirmed before queueing
+	slowPlotThreshold       time.Duration                 // log the phase timings of plots taking longer than this to process
+	timings                 PlotTimings                   // phase timings of the plot being processed
+	propagation             *PropagationTracker           // propagation delays of recently connected plots
+	orphans                 *OrphanPool                   // plots waiting for their parent to be processed
+	reorgs                  *ReorgLog                     // recent reorganizations of the main thread. nil if disabled
 	shutdownChan            chan struct{}
 	wg                      sync.WaitGroup
 }
 
+// ErrOrphanPlot is returned when a plot's parent hasn't been processed. The plot is held and
+// processed once its parent is.
+var ErrOrphanPlot = errors.New("Orphan plot")
+
 // NewTx is a message sent to registered new representation channels when a representation is queued.
 type NewTx struct {
 	RepresentationID RepresentationID // representation ID
@@ -49,6 +58,50 @@ type TipChange struct {
 	More    bool    // true if the tip has been connected and more connections are expected
 }
 
+// PlotTimings records how long each phase of processing a plot took.
+type PlotTimings struct {
+	Check  time.Duration // context-free sanity checks
+	Verify time.Duration // header and representation context checks including signature verification
+	Store  time.Duration // storing the plot
+	Ledger time.Duration // connecting and disconnecting plots in the ledger
+	Queue  time.Duration // updating the representation queue
+	Notify time.Duration // notifying tip change channels, e.g. the indexer
+}
+
+// Total returns the total time spent across all phases.
+func (t PlotTimings) Total() time.Duration {
+	return t.Check + t.Verify + t.Store + t.Ledger + t.Queue + t.Notify
+}
+
+// Dominant returns the name of the phase which took the longest and its duration.
+func (t PlotTimings) Dominant() (string, time.Duration) {
+	phases := []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"check", t.Check},
+		{"verify", t.Verify},
+		{"store", t.Store},
+		{"ledger", t.Ledger},
+		{"queue", t.Queue},
+		{"notify", t.Notify},
+	}
+	var name string
+	var max time.Duration
+	for _, phase := range phases {
+		if phase.duration > max {
+			name, max = phase.name, phase.duration
+		}
+	}
+	return name, max
+}
+
+// String implements the Stringer interface.
+func (t PlotTimings) String() string {
+	return fmt.Sprintf("check: %s, verify: %s, store: %s, ledger: %s, queue: %s, notify: %s",
+		t.Check, t.Verify, t.Store, t.Ledger, t.Queue, t.Notify)
+}
+
 type txToProcess struct {
 	id         RepresentationID // representation ID
 	tx         *Representation  // representation to process
@@ -78,10 +131,51 @@ func NewProcessor(genesisID PlotID, plotStore PlotStorage, txQueue Representatio
 		unregisterTipChangeChan: make(chan chan<- TipChange),
 		newTxChannels:           make(map[chan<- NewTx]struct{}),
 		tipChangeChannels:       make(map[chan<- TipChange]struct{}),
+		slowPlotThreshold:       DEFAULT_SLOW_PLOT_THRESHOLD * time.Second,
+		propagation:             NewPropagationTracker(PROPAGATION_STATS_WINDOW),
+		orphans:                 NewOrphanPool(MAX_ORPHAN_PLOTS, MAX_ORPHAN_PLOTS_PER_SOURCE),
 		shutdownChan:            make(chan struct{}),
 	}
 }
 
+// SetSlowPlotThreshold sets how long processing a plot may take before the time spent in each phase is logged.
+// It must be called before Run.
+func (p *Processor) SetSlowPlotThreshold(threshold time.Duration) {
+	p.slowPlotThreshold = threshold
+}
+
+// SetRequireRefers sets whether or not a new representation's referenced representation must already
+// be confirmed for it to be queued. It's a relay policy and doesn't affect plot validation.
+// It must be called before Run.
+func (p *Processor) SetRequireRefers(require bool) {
+	p.requireRefers = require
+}
+
+// SetReorgLogSize sets how many of the most recent main thread reorganizations are kept. Passing 0
+// disables the log, which is the default. It must be called before Run.
+func (p *Processor) SetReorgLogSize(size int) {
+	if size <= 0 {
+		p.reorgs = nil
+		return
+	}
+	p.reorgs = NewReorgLog(size)
+}
+
+// ReorgEvents returns the most recent main thread reorganizations, oldest first. It returns nil if
+// the log is disabled. It's safe to call from any goroutine.
+func (p *Processor) ReorgEvents() []ReorgEvent {
+	if p.reorgs == nil {
+		return nil
+	}
+	return p.reorgs.Events()
+}
+
+// PropagationStats returns the distribution of how long recently connected plots took to reach this node.
+// It's safe to call from any goroutine.
+func (p *Processor) PropagationStats() PropagationStats {
+	return p.propagation.Stats()
+}
+
 // Run executes the Processor's main loop in its own goroutine.
 // It verifies and processes plots and representations.
 func (p *Processor) Run() {
@@ -117,6 +211,11 @@ func (p *Processor) run() {
 				(after-before)/int64(time.Millisecond),
 				len(plotToProcess.plot.Representations),
 				p.txQueue.Len())
+			if total := p.timings.Total(); total > p.slowPlotThreshold {
+				phase, duration := p.timings.Dominant()
+				log.Printf("Slow plot %s took %s, mostly %s (%s), %s\n",
+					plotToProcess.id, total, phase, duration, p.timings)
+			}
 
 			// send back the result
 			plotToProcess.resultChan <- err
@@ -211,6 +310,17 @@ func (p *Processor) processRepresentation(id RepresentationID, tx *Representatio
 		return fmt.Errorf("Representation %s is already confirmed", id)
 	}
 
+	// is the referenced representation confirmed?
+	if p.requireRefers && tx.Refers != nil {
+		refersPlotID, _, err := p.ledger.GetRepresentationIndex(*tx.Refers)
+		if err != nil {
+			return err
+		}
+		if refersPlotID == nil {
+			return fmt.Errorf("Representation %s refers to unconfirmed representation %s", id, *tx.Refers)
+		}
+	}
+
 	// check series, maturity and expiration
 	tipID, tipHeight, err := p.ledger.GetThreadTip()
 	if err != nil {
@@ -225,6 +335,11 @@ func (p *Processor) processRepresentation(id RepresentationID, tx *Representatio
 		return fmt.Errorf("Representation %s would have invalid series", id)
 	}
 
+	// are its optional fields active in the next plot?
+	if err := DefaultThreadParams.CheckReferences(tx, tipHeight+1); err != nil {
+		return fmt.Errorf("%s, representation: %s", err, id)
+	}
+
 	// would it be mature if included in the next plot?
 	if !tx.IsMature(tipHeight + 1) {
 		return fmt.Errorf("Representation %s would not be mature", id)
@@ -294,6 +409,9 @@ func checkRepresentation(id RepresentationID, tx *Representation) error {
 		if len(tx.From) != ed25519.PublicKeySize {
 			return fmt.Errorf("Invalid representation sender, representation: %s", id)
 		}
+		if !IsCanonicalPublicKey(tx.From) {
+			return fmt.Errorf("Non-canonical representation sender key, representation: %s", id)
+		}
 		// sanity check signature
 		if len(tx.Signature) != ed25519.SignatureSize {
 			return fmt.Errorf("Invalid representation signature, representation: %s", id)
@@ -307,20 +425,23 @@ func checkRepresentation(id RepresentationID, tx *Representation) error {
 	if len(tx.To) != ed25519.PublicKeySize {
 		return fmt.Errorf("Invalid representation recipient, representation: %s", id)
 	}
+	if !IsCanonicalPublicKey(tx.To) {
+		return fmt.Errorf("Non-canonical representation recipient key, representation: %s", id)
+	}
 
 	// no pays to self
 	if bytes.Equal(tx.From, tx.To) {
 		return fmt.Errorf("Representation %s to self is invalid", id)
 	}
 
-	// make sure memo is valid ascii/utf8
-	if !utf8.ValidString(tx.Memo) {
-		return fmt.Errorf("Representation %s memo contains invalid utf8 characters", id)
+	// make sure memo is valid ascii/utf8 and not too long
+	if err := DefaultThreadParams.CheckMemo(tx.Memo); err != nil {
+		return fmt.Errorf("%s, representation: %s", err, id)
 	}
 
-	// check memo length
-	if len(tx.Memo) > MAX_MEMO_LENGTH {
-		return fmt.Errorf("Representation %s memo length exceeded", id)
+	// a content hash is opaque but it must be set if present
+	if tx.ContentHash != nil && *tx.ContentHash == (ContentHash{}) {
+		return fmt.Errorf("Empty content hash, representation: %s", id)
 	}
 
 	// sanity check maturity, expiration and series
@@ -359,6 +480,7 @@ func (p *Processor) processPlot(id PlotID, plot *Plot, source string) error {
 	log.Printf("Processing plot %s\n", id)
 
 	now := time.Now().Unix()
+	p.timings = PlotTimings{}
 
 	// did we process this plot already?
 	branchType, err := p.ledger.GetBranchType(id)
@@ -371,7 +493,10 @@ func (p *Processor) processPlot(id PlotID, plot *Plot, source string) error {
 	}
 
 	// sanity check the plot
-	if err := checkPlot(id, plot, now); err != nil {
+	start := time.Now()
+	err = checkPlot(id, plot, now)
+	p.timings.Check += time.Since(start)
+	if err != nil {
 		return err
 	}
 
@@ -383,22 +508,62 @@ func (p *Processor) processPlot(id PlotID, plot *Plot, source string) error {
 	if branchType != MAIN && branchType != SIDE {
 		if id == p.genesisID {
 			// store it
-			if err := p.plotStore.Store(id, plot, now); err != nil {
+			start := time.Now()
+			err := p.plotStore.Store(id, plot, now)
+			p.timings.Store += time.Since(start)
+			if err != nil {
 				return err
 			}
 			// begin the ledger
-			if err := p.connectPlot(id, plot, source, false); err != nil {
+			if err := p.connectPlot(id, plot, now, source, false); err != nil {
 				return err
 			}
 			log.Printf("Connected plot %s\n", id)
+			p.processOrphans(id)
 			return nil
 		}
-		// current plot is an orphan
-		return fmt.Errorf("Plot %s is an orphan", id)
+		// current plot is an orphan. hold on to it until its parent arrives
+		// unless it's too far from our tip to be connected any time soon
+		_, tipHeight, err := p.ledger.GetThreadTip()
+		if err != nil {
+			return err
+		}
+		distance := plot.Header.Height - tipHeight
+		if distance < 0 {
+			distance = -distance
+		}
+		if distance > MAX_ORPHAN_HEIGHT_DISTANCE {
+			log.Printf("Dropping orphan plot %s at height %d, tip height: %d\n",
+				id, plot.Header.Height, tipHeight)
+		} else if p.orphans.Add(id, plot, source) {
+			log.Printf("Holding orphan plot %s until its parent %s is processed, %d orphan(s)\n",
+				id, plot.Header.Previous, p.orphans.Len())
+		}
+		return ErrOrphanPlot
 	}
 
 	// attempt to extend the thread
-	return p.acceptPlot(id, plot, now, source)
+	if err := p.acceptPlot(id, plot, now, source); err != nil {
+		return err
+	}
+	p.processOrphans(id)
+	return nil
+}
+
+// Process any orphans which were waiting for the given plot and, in turn, their descendants
+func (p *Processor) processOrphans(parentID PlotID) {
+	queue := []PlotID{parentID}
+	for len(queue) != 0 {
+		parentID, queue = queue[0], queue[1:]
+		for _, orphan := range p.orphans.Take(parentID) {
+			log.Printf("Processing orphan plot %s from: %s\n", orphan.ID, orphan.Source)
+			if err := p.acceptPlot(orphan.ID, orphan.Plot, time.Now().Unix(), orphan.Source); err != nil {
+				log.Printf("Error: %s, orphan plot %s\n", err, orphan.ID)
+				continue
+			}
+			queue = append(queue, orphan.ID)
+		}
+	}
 }
 
 // Context-free plot sanity checker
@@ -433,6 +598,13 @@ func checkPlot(id PlotID, plot *Plot, now int64) error {
 		return fmt.Errorf("Height value is invalid, plot %s", id)
 	}
 
+	// a genesis plot has no parent work to add to its own
+	if plot.Header.Height == 0 {
+		if err := checkGenesisThreadWork(plot.Header); err != nil {
+			return fmt.Errorf("%s, plot %s", err, id)
+		}
+	}
+
 	// check against known checkpoints
 	if err := CheckpointCheck(id, plot.Header.Height); err != nil {
 		return err
@@ -444,7 +616,8 @@ func checkPlot(id PlotID, plot *Plot, now int64) error {
 	}
 
 	if int(plot.Header.RepresentationCount) != len(plot.Representations) {
-		return fmt.Errorf("Representation count in header doesn't match plot %s", id)
+		return fmt.Errorf("Representation count %d in header doesn't match %d representations in plot %s",
+			plot.Header.RepresentationCount, len(plot.Representations), id)
 	}
 
 	// must have at least one representation
@@ -468,27 +641,26 @@ func checkPlot(id PlotID, plot *Plot, now int64) error {
 	if len(plot.Representations) > 1 {
 		for i := 1; i < len(plot.Representations); i++ {
 			if plot.Representations[i].IsPlotroot() {
-				return fmt.Errorf("Multiple plotroot representations in plot %s", id)
+				return fmt.Errorf("Multiple plotroot representations in plot %s, another at index %d", id, i)
 			}
 		}
 	}
 
-	// basic representation checks that don't depend on context
-	txIDs := make(map[RepresentationID]bool)
-	for _, tx := range plot.Representations {
-		id, err := tx.ID()
+	// basic representation checks that don't depend on context.
+	// also check for duplicate representations which would be applied twice
+	txIDs := make(map[RepresentationID]int)
+	for i, tx := range plot.Representations {
+		txID, err := tx.ID()
 		if err != nil {
 			return err
 		}
-		if err := checkRepresentation(id, tx); err != nil {
+		if err := checkRepresentation(txID, tx); err != nil {
 			return err
 		}
-		txIDs[id] = true
-	}
-
-	// check for duplicate representations
-	if len(txIDs) != len(plot.Representations) {
-		return fmt.Errorf("Duplicate representation in plot %s", id)
+		if j, ok := txIDs[txID]; ok {
+			return fmt.Errorf("Duplicate representation %s at indices %d and %d in plot %s", txID, j, i, id)
+		}
+		txIDs[txID] = i
 	}
 
 	// verify hash list root
@@ -525,17 +697,13 @@ func computeMaxRepresentationsPerPlot(height int64) int {
 // Attempt to extend the thread with the new plot
 func (p *Processor) acceptPlot(id PlotID, plot *Plot, now int64, source string) error {
 	prevHeader, _, err := p.plotStore.GetPlotHeader(plot.Header.Previous)
+	if err == ErrPlotNotFound {
+		return fmt.Errorf("Parent %s of plot %s not found", plot.Header.Previous, id)
+	}
 	if err != nil {
 		return err
 	}
 
-	// check height
-	newHeight := prevHeader.Height + 1
-	if plot.Header.Height != newHeight {
-		return fmt.Errorf("Expected height %d found %d for plot %s",
-			newHeight, plot.Header.Height, id)
-	}
-
 	// did we process it already?
 	branchType, err := p.ledger.GetBranchType(id)
 	if err != nil {
@@ -546,41 +714,100 @@ func (p *Processor) acceptPlot(id PlotID, plot *Plot, now int64, source string)
 		return nil
 	}
 
+	// check the header against its parent
+	start := time.Now()
+	if err := checkPlotHeaderContext(id, plot.Header, prevHeader, p.plotStore, p.ledger); err != nil {
+		return err
+	}
+
+	// check series, maturity, expiration then verify signatures
+	err = checkPlotRepresentationsContext(plot, p.txQueue)
+	p.timings.Verify += time.Since(start)
+	if err != nil {
+		return err
+	}
+
+	// store the plot if we think we're going to accept it
+	start = time.Now()
+	err = p.plotStore.Store(id, plot, now)
+	p.timings.Store += time.Since(start)
+	if err != nil {
+		return err
+	}
+
+	// get the current tip before we try adjusting the thread
+	tipID, _, err := p.ledger.GetThreadTip()
+	if err != nil {
+		return err
+	}
+
+	// finish accepting the plot if possible
+	if err := p.acceptPlotContinue(id, plot, now, prevHeader, source); err != nil {
+		// we may have disconnected the old best thread and partially
+		// connected the new one before encountering a problem. re-activate it now
+		if err2 := p.reconnectTip(*tipID, source); err2 != nil {
+			log.Printf("Error reconnecting tip: %s, plot: %s\n", err2, *tipID)
+		}
+		// return the original error
+		return err
+	}
+
+	return nil
+}
+
+// Check the header's height, target, thread work and timestamp against its parent
+func checkPlotHeaderContext(id PlotID, header, prevHeader *PlotHeader, plotStore PlotStorage, ledger Ledger) error {
+	// check height
+	newHeight := prevHeader.Height + 1
+	if header.Height != newHeight {
+		return fmt.Errorf("Expected height %d found %d for plot %s",
+			newHeight, header.Height, id)
+	}
+
 	// check declared proof of work is correct
-	target, err := computeTarget(prevHeader, p.plotStore, p.ledger)
+	target, err := computeTarget(prevHeader, plotStore, ledger)
 	if err != nil {
 		return err
 	}
-	if plot.Header.Target != target {
+	if header.Target != target {
 		return fmt.Errorf("Incorrect target %s, expected %s for plot %s",
-			plot.Header.Target, target, id)
+			header.Target, target, id)
 	}
 
 	// check that cumulative work is correct
-	threadWork := computeThreadWork(plot.Header.Target, prevHeader.ThreadWork)
-	if plot.Header.ThreadWork != threadWork {
+	threadWork := computeThreadWork(header.Target, prevHeader.ThreadWork)
+	if header.ThreadWork != threadWork {
 		return fmt.Errorf("Incorrect thread work %s, expected %s for plot %s",
-			plot.Header.ThreadWork, threadWork, id)
+			header.ThreadWork, threadWork, id)
 	}
 
 	// check that the timestamp isn't too far in the past
-	medianTimestamp, err := computeMedianTimestamp(prevHeader, p.plotStore)
+	minTime, err := DefaultThreadParams.MinTime(prevHeader, plotStore)
 	if err != nil {
 		return err
 	}
-	if plot.Header.Time <= medianTimestamp {
+	if header.Time < minTime {
 		return fmt.Errorf("Timestamp is too early for plot %s", id)
 	}
+	return nil
+}
 
-	// check series, maturity, expiration then verify signatures
+// Check series, optional field activation, maturity and expiration of the plot's representations then
+// verify signatures.
+// If txQueue is non-nil representations queued with the same signature aren't verified again
+func checkPlotRepresentationsContext(plot *Plot, txQueue RepresentationQueue) error {
+	idHasher := NewRepresentationIDHasher()
 	for _, tx := range plot.Representations {
-		txID, err := tx.ID()
+		txID, err := idHasher.ID(tx)
 		if err != nil {
 			return err
 		}
 		if !checkRepresentationSeries(tx, plot.Header.Height) {
 			return fmt.Errorf("Representation %s would have invalid series", txID)
 		}
+		if err := DefaultThreadParams.CheckReferences(tx, plot.Header.Height); err != nil {
+			return fmt.Errorf("%s, representation: %s", err, txID)
+		}
 		if !tx.IsPlotroot() {
 			if !tx.IsMature(plot.Header.Height) {
 				return fmt.Errorf("Representation %s is immature", txID)
@@ -589,7 +816,7 @@ func (p *Processor) acceptPlot(id PlotID, plot *Plot, now int64, source string)
 				return fmt.Errorf("Representation %s is expired", txID)
 			}
 			// if it's in the queue with the same signature we've verified it already
-			if !p.txQueue.ExistsSigned(txID, tx.Signature) {
+			if txQueue == nil || !txQueue.ExistsSigned(txID, tx.Signature) {
 				ok, err := tx.Verify()
 				if err != nil {
 					return err
@@ -600,29 +827,90 @@ func (p *Processor) acceptPlot(id PlotID, plot *Plot, now int64, source string)
 			}
 		}
 	}
+	return nil
+}
+
+// ValidatePlot fully validates a plot as the next plot after prevHeader without storing it or
+// modifying the ledger or the representation queue. ledgerView must reflect the main thread
+// with prevHeader at its tip. It returns the first failure encountered.
+func ValidatePlot(plot *Plot, prevHeader *PlotHeader, plotStore PlotStorage, ledgerView Ledger) error {
+	id, err := plot.ID()
+	if err != nil {
+		return err
+	}
 
-	// store the plot if we think we're going to accept it
-	if err := p.plotStore.Store(id, plot, now); err != nil {
+	// context-free checks
+	if err := checkPlot(id, plot, time.Now().Unix()); err != nil {
 		return err
 	}
 
-	// get the current tip before we try adjusting the thread
-	tipID, _, err := p.ledger.GetThreadTip()
+	// check the plot connects to the given parent
+	prevID, err := prevHeader.ID()
 	if err != nil {
 		return err
 	}
+	if plot.Header.Previous != prevID {
+		return fmt.Errorf("Previous %s doesn't match parent %s for plot %s",
+			plot.Header.Previous, prevID, id)
+	}
 
-	// finish accepting the plot if possible
-	if err := p.acceptPlotContinue(id, plot, now, prevHeader, source); err != nil {
-		// we may have disconnected the old best thread and partially
-		// connected the new one before encountering a problem. re-activate it now
-		if err2 := p.reconnectTip(*tipID, source); err2 != nil {
-			log.Printf("Error reconnecting tip: %s, plot: %s\n", err2, *tipID)
-		}
-		// return the original error
+	// contextual checks
+	if err := checkPlotHeaderContext(id, plot.Header, prevHeader, plotStore, ledgerView); err != nil {
 		return err
 	}
+	if err := checkPlotRepresentationsContext(plot, nil); err != nil {
+		return err
+	}
+
+	// apply the representations to a scratch view of the imbalances like the ledger would
+	imbalanceCache := NewImbalanceCache(ledgerView)
+	for _, tx := range plot.Representations {
+		txID, err := tx.ID()
+		if err != nil {
+			return err
+		}
+
+		// verify the representation hasn't been processed already
+		txPlotID, _, err := ledgerView.GetRepresentationIndex(txID)
+		if err != nil {
+			return err
+		}
+		if txPlotID != nil {
+			return fmt.Errorf("Representation %s already processed", txID)
+		}
+
+		txToApply := tx
+		if tx.IsPlotroot() {
+			// the ledger only applies the plotroot from PLOTROOT_MATURITY plots ago
+			txToApply = nil
+			if plot.Header.Height-PLOTROOT_MATURITY >= 0 {
+				oldID, err := ledgerView.GetPlotIDForHeight(plot.Header.Height - PLOTROOT_MATURITY)
+				if err != nil {
+					return err
+				}
+				if oldID == nil {
+					return fmt.Errorf("Missing plot at height %d",
+						plot.Header.Height-PLOTROOT_MATURITY)
+				}
+				oldTx, _, err := plotStore.GetRepresentation(*oldID, 0)
+				if err != nil {
+					return err
+				}
+				txToApply = oldTx
+			}
+		}
 
+		if txToApply != nil {
+			ok, err := imbalanceCache.Apply(txToApply)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				txID, _ := txToApply.ID()
+				return fmt.Errorf("Sender has insufficient imbalance in representation %s", txID)
+			}
+		}
+	}
 	return nil
 }
 
@@ -659,8 +947,9 @@ func computeTargetBitcoin(prevHeader *PlotHeader, plotStore PlotStorage) (PlotID
 
 	actualTimespan := prevHeader.Time - firstHeader.Time
 
-	minTimespan := int64(RETARGET_TIME / 4)
-	maxTimespan := int64(RETARGET_TIME * 4)
+	retargetTime := RETARGET_INTERVAL * DefaultThreadParams.TargetSpacing
+	minTimespan := retargetTime / 4
+	maxTimespan := retargetTime * 4
 
 	if actualTimespan < minTimespan {
 		actualTimespan = minTimespan
@@ -670,7 +959,7 @@ func computeTargetBitcoin(prevHeader *PlotHeader, plotStore PlotStorage) (PlotID
 	}
 
 	actualTimespanInt := big.NewInt(actualTimespan)
-	retargetTimeInt := big.NewInt(RETARGET_TIME)
+	retargetTimeInt := big.NewInt(retargetTime)
 
 	initialTargetBytes, err := hex.DecodeString(INITIAL_TARGET)
 	if err != nil {
@@ -706,15 +995,16 @@ func computeTargetBitcoinCash(prevHeader *PlotHeader, plotStore PlotStorage, led
 	}
 
 	workInt := new(big.Int).Sub(prevHeader.ThreadWork.GetBigInt(), firstHeader.ThreadWork.GetBigInt())
-	workInt.Mul(workInt, big.NewInt(TARGET_SPACING))
+	targetSpacing := DefaultThreadParams.TargetSpacing
+	workInt.Mul(workInt, big.NewInt(targetSpacing))
 
 	// "In order to avoid difficulty cliffs, we bound the amplitude of the
 	// adjustment we are going to do to a factor in [0.5, 2]." - Bitcoin-ABC
 	actualTimespan := prevHeader.Time - firstHeader.Time
-	if actualTimespan > 2*RETARGET_SMA_WINDOW*TARGET_SPACING {
-		actualTimespan = 2 * RETARGET_SMA_WINDOW * TARGET_SPACING
-	} else if actualTimespan < (RETARGET_SMA_WINDOW/2)*TARGET_SPACING {
-		actualTimespan = (RETARGET_SMA_WINDOW / 2) * TARGET_SPACING
+	if actualTimespan > 2*RETARGET_SMA_WINDOW*targetSpacing {
+		actualTimespan = 2 * RETARGET_SMA_WINDOW * targetSpacing
+	} else if actualTimespan < (RETARGET_SMA_WINDOW/2)*targetSpacing {
+		actualTimespan = (RETARGET_SMA_WINDOW / 2) * targetSpacing
 	}
 
 	workInt.Div(workInt, big.NewInt(actualTimespan))
@@ -739,26 +1029,6 @@ func computeTargetBitcoinCash(prevHeader *PlotHeader, plotStore PlotStorage, led
 	return
 }
 
-// Compute the median timestamp of the last NUM_PLOTS_FOR_MEDIAN_TIMESTAMP plots
-func computeMedianTimestamp(prevHeader *PlotHeader, plotStore PlotStorage) (int64, error) {
-	var timestamps []int64
-	var err error
-	for i := 0; i < NUM_PLOTS_FOR_MEDIAN_TMESTAMP; i++ {
-		timestamps = append(timestamps, prevHeader.Time)
-		prevHeader, _, err = plotStore.GetPlotHeader(prevHeader.Previous)
-		if err != nil {
-			return 0, err
-		}
-		if prevHeader == nil {
-			break
-		}
-	}
-	sort.Slice(timestamps, func(i, j int) bool {
-		return timestamps[i] < timestamps[j]
-	})
-	return timestamps[len(timestamps)/2], nil
-}
-
 // Continue accepting the plot
 func (p *Processor) acceptPlotContinue(
 	id PlotID, plot *Plot, plotWhen int64, prevHeader *PlotHeader, source string) error {
@@ -774,7 +1044,11 @@ func (p *Processor) acceptPlotContinue(
 	}
 
 	// is this plot better than the current tip?
-	if !plot.Header.Compare(tipHeader, plotWhen, tipWhen) {
+	better, err := plot.Header.Compare(tipHeader, plotWhen, tipWhen)
+	if err != nil {
+		return err
+	}
+	if !better {
 		// flag this as a side branch plot
 		log.Printf("Plot %s does not represent the tip of the best thread", id)
 		return p.ledger.SetBranchType(id, SIDE)
@@ -845,19 +1119,36 @@ func (p *Processor) acceptPlotContinue(
 		if err != nil {
 			return err
 		}
-		if err := p.connectPlot(id, plotToConnect, source, true); err != nil {
+		if err := p.connectPlot(id, plotToConnect, 0, source, true); err != nil {
 			return err
 		}
 	}
 
 	// and finally connect the new plot
-	return p.connectPlot(id, plot, source, false)
+	if err := p.connectPlot(id, plot, plotWhen, source, false); err != nil {
+		return err
+	}
+
+	if len(plotsToDisconnect) != 0 && p.reorgs != nil {
+		p.reorgs.Record(ReorgEvent{
+			OldTip:         *tipID,
+			NewTip:         id,
+			CommonAncestor: tipAncestorID,
+			AncestorHeight: tipAncestor.Height,
+			Depth:          len(plotsToDisconnect),
+			Connected:      len(plotsToConnect) + 1,
+			Time:           time.Now().Unix(),
+		})
+	}
+	return nil
 }
 
 // Update the ledger and representation queue and notify undo tip channels
 func (p *Processor) disconnectPlot(id PlotID, plot *Plot, source string) error {
 	// Update the ledger
+	start := time.Now()
 	txIDs, err := p.ledger.DisconnectPlot(id, plot)
+	p.timings.Ledger += time.Since(start)
 	if err != nil {
 		return err
 	}
@@ -865,36 +1156,54 @@ func (p *Processor) disconnectPlot(id PlotID, plot *Plot, source string) error {
 	log.Printf("Plot %s has been disconnected, height: %d\n", id, plot.Header.Height)
 
 	// Add newly disconnected non-plotroot representations back to the queue
-	if err := p.txQueue.AddBatch(txIDs[1:], plot.Representations[1:], plot.Header.Height-1); err != nil {
+	start = time.Now()
+	err = p.txQueue.AddBatch(txIDs[1:], plot.Representations[1:], plot.Header.Height-1)
+	p.timings.Queue += time.Since(start)
+	if err != nil {
 		return err
 	}
 
 	// Notify tip change channels
+	start = time.Now()
 	for ch := range p.tipChangeChannels {
 		ch <- TipChange{PlotID: id, Plot: plot, Source: source}
 	}
+	p.timings.Notify += time.Since(start)
 	return nil
 }
 
-// Update the ledger and representation queue and notify new tip channels
-func (p *Processor) connectPlot(id PlotID, plot *Plot, source string, more bool) error {
+// Update the ledger and representation queue and notify new tip channels.
+// "when" is when the plot was first seen. It's ignored if more is true
+func (p *Processor) connectPlot(id PlotID, plot *Plot, when int64, source string, more bool) error {
 	// Update the ledger
+	start := time.Now()
 	txIDs, err := p.ledger.ConnectPlot(id, plot)
+	p.timings.Ledger += time.Since(start)
 	if err != nil {
 		return err
 	}
 
 	log.Printf("Plot %s is the new tip, height: %d\n", id, plot.Header.Height)
 
+	if !more {
+		// record how long it took to reach us
+		p.propagation.Record(plot.Header, when)
+	}
+
 	// Remove newly confirmed non-plotroot representations from the queue
-	if err := p.txQueue.RemoveBatch(txIDs[1:], plot.Header.Height, more); err != nil {
+	start = time.Now()
+	err = p.txQueue.RemoveBatch(txIDs[1:], plot.Header.Height, more)
+	p.timings.Queue += time.Since(start)
+	if err != nil {
 		return err
 	}
 
 	// Notify tip change channels
+	start = time.Now()
 	for ch := range p.tipChangeChannels {
 		ch <- TipChange{PlotID: id, Plot: plot, Source: source, Connect: true, More: more}
 	}
+	p.timings.Notify += time.Since(start)
 	return nil
 }
 
@@ -904,9 +1213,6 @@ func (p *Processor) reconnectTip(id PlotID, source string) error {
 	if err != nil {
 		return err
 	}
-	if plot == nil {
-		return fmt.Errorf("Plot %s not found", id)
-	}
 	_, when, err := p.plotStore.GetPlotHeader(id)
 	if err != nil {
 		return err
@@ -1,6 +1,64 @@
 package plotthread
 
-import "testing"
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// testPlotStore is an in-memory PlotStorage
+type testPlotStore struct {
+	plots map[PlotID]*Plot
+}
+
+func newTestPlotStore() *testPlotStore {
+	return &testPlotStore{plots: make(map[PlotID]*Plot)}
+}
+
+func (s *testPlotStore) Store(id PlotID, plot *Plot, now int64) error {
+	s.plots[id] = plot
+	return nil
+}
+
+func (s *testPlotStore) GetPlot(id PlotID) (*Plot, error) {
+	plot, ok := s.plots[id]
+	if !ok {
+		return nil, ErrPlotNotFound
+	}
+	return plot, nil
+}
+
+func (s *testPlotStore) GetPlotBytes(id PlotID) ([]byte, error) {
+	plot, ok := s.plots[id]
+	if !ok {
+		return nil, ErrPlotNotFound
+	}
+	return json.Marshal(plot)
+}
+
+func (s *testPlotStore) GetPlotHeader(id PlotID) (*PlotHeader, int64, error) {
+	plot, ok := s.plots[id]
+	if !ok {
+		return nil, 0, ErrPlotNotFound
+	}
+	return plot.Header, 0, nil
+}
+
+func (s *testPlotStore) GetRepresentation(id PlotID, index int) (*Representation, *PlotHeader, error) {
+	plot, ok := s.plots[id]
+	if !ok {
+		return nil, nil, ErrPlotNotFound
+	}
+	if index < 0 || index >= len(plot.Representations) {
+		return nil, nil, ErrRepresentationNotFound
+	}
+	return plot.Representations[index], plot.Header, nil
+}
 
 func TestComputeMaxRepresentationsPerPlot(t *testing.T) {
 	var maxDoublings int64 = 64
@@ -57,3 +115,587 @@ func TestComputeMaxRepresentationsPerPlot(t *testing.T) {
 			MAX_REPRESENTATIONS_PER_PLOT_EXCEEDED_AT_HEIGHT-1, max)
 	}
 }
+
+func TestValidatePlot(t *testing.T) {
+	// create a scriber, a funded sender and a recipient
+	scriberPubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey2, privKey2, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger := newTestLedger()
+	ledger.setImbalance(pubKey, 1)
+	plotStore := newTestPlotStore()
+
+	// every ID satisfies this target
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+
+	// create and store the parent plot
+	const height = 5
+	plotroot := NewRepresentation(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)),
+		scriberPubKey, 0, 0, height-1, "")
+	parent, err := NewPlot(PlotID{}, height-1, target, PlotID{}, []*Representation{plotroot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.Header.Time = time.Now().Unix() - TARGET_SPACING
+	parentID, err := parent.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plotStore.Store(parentID, parent, 0)
+	ledger.heights[height-1] = parentID
+
+	makeTx := func(matures, expires int64, privKey ed25519.PrivateKey) *Representation {
+		tx := NewRepresentation(pubKey, pubKey2, matures, expires, height, "")
+		if err := tx.Sign(privKey); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	makePlot := func(txs []*Representation, mutate func(*PlotHeader)) *Plot {
+		plotroot := NewRepresentation(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)),
+			scriberPubKey, 0, 0, height, "")
+		plot, err := NewPlot(parentID, height, target, parent.Header.ThreadWork,
+			append([]*Representation{plotroot}, txs...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mutate != nil {
+			mutate(plot.Header)
+		}
+		return plot
+	}
+
+	// a valid plot
+	validTx := makeTx(0, 0, privKey)
+	validTxID, err := validTx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidatePlot(makePlot([]*Representation{validTx}, nil), parent.Header, plotStore, ledger); err != nil {
+		t.Fatal(err)
+	}
+
+	// a plot whose only plotroot isn't first
+	noPlotroot, err := NewPlot(parentID, height, target, parent.Header.ThreadWork,
+		[]*Representation{validTx, NewRepresentation(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)),
+			scriberPubKey, 0, 0, height, "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// and a second plotroot
+	extraPlotroot := NewRepresentation(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)),
+		pubKey2, 0, 0, height, "")
+
+	// mark a representation as already processed
+	processedTx := makeTx(0, 0, privKey)
+	processedTxID, err := processedTx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger.txIndex[processedTxID] = parentID
+
+	tests := []struct {
+		name   string
+		plot   *Plot
+		expect string
+	}{
+		{"pow", makePlot(nil, func(h *PlotHeader) { h.Target = PlotID{31: 1} }), "proof-of-work"},
+		{"hash list root", makePlot(nil, func(h *PlotHeader) { h.HashListRoot = RepresentationID{} }),
+			"Hash list root mismatch"},
+		{"previous", makePlot(nil, func(h *PlotHeader) { h.Previous = PlotID{1} }), "doesn't match parent"},
+		{"height", makePlot(nil, func(h *PlotHeader) { h.Height++ }), "Expected height"},
+		{"count high", makePlot([]*Representation{validTx}, func(h *PlotHeader) { h.RepresentationCount++ }),
+			"Representation count 3 in header doesn't match 2"},
+		{"count low", makePlot([]*Representation{validTx}, func(h *PlotHeader) { h.RepresentationCount-- }),
+			"Representation count 1 in header doesn't match 2"},
+		{"target", makePlot(nil, func(h *PlotHeader) { h.Target[31] = 0xfe }), "Incorrect target"},
+		{"thread work", makePlot(nil, func(h *PlotHeader) { h.ThreadWork = PlotID{} }), "Incorrect thread work"},
+		{"timestamp", makePlot(nil, func(h *PlotHeader) { h.Time = parent.Header.Time }), "too early"},
+		{"immature", makePlot([]*Representation{makeTx(height-2, 0, privKey)}, nil), "immature"},
+		{"expired", makePlot([]*Representation{makeTx(0, height-2, privKey)}, nil), "expired"},
+		{"signature", makePlot([]*Representation{makeTx(0, 0, privKey2)}, nil), "Signature verification failed"},
+		{"processed", makePlot([]*Representation{processedTx}, nil), "already processed"},
+		{"missing plotroot", noPlotroot, "First representation is not a plotroot"},
+		{"misplaced plotroot", makePlot([]*Representation{validTx, extraPlotroot}, nil),
+			"Multiple plotroot representations"},
+		{"duplicate", makePlot([]*Representation{validTx, validTx}, nil), "Duplicate representation " + validTxID.String()},
+		{"imbalance", makePlot([]*Representation{validTx, makeTx(0, 0, privKey)}, nil),
+			"insufficient imbalance"},
+	}
+
+	for _, test := range tests {
+		err := ValidatePlot(test.plot, parent.Header, plotStore, ledger)
+		if err == nil {
+			t.Fatalf("Expected %s failure", test.name)
+		}
+		if !strings.Contains(err.Error(), test.expect) {
+			t.Fatalf("Expected %s failure, found: %s", test.name, err)
+		}
+	}
+
+	// nothing should have been modified
+	if imbalance, _ := ledger.GetPublicKeyImbalance(pubKey); imbalance != 1 {
+		t.Fatalf("Expected sender imbalance 1, found %d", imbalance)
+	}
+	if len(plotStore.plots) != 1 {
+		t.Fatalf("Expected 1 stored plot, found %d", len(plotStore.plots))
+	}
+}
+
+func TestGenesisThreadWork(t *testing.T) {
+	// the embedded genesis plot passes
+	genesis, genesisID, err := LoadGenesisPlot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPlot(genesisID, genesis, time.Now().Unix()); err != nil {
+		t.Fatal(err)
+	}
+
+	// tampered thread work fails
+	header := *genesis.Header
+	header.ThreadWork[len(header.ThreadWork)-1]++
+	if err := checkGenesisThreadWork(&header); err == nil {
+		t.Fatal("Expected tampered genesis thread work to fail")
+	}
+
+	// a genesis plot claiming parent work is rejected by checkPlot
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var target, parentWork PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+	parentWork[len(parentWork)-1] = 1
+	zeroKey := ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+	plotroot := NewRepresentation(zeroKey, pubKey, 0, 0, 0, "")
+	plot, err := NewPlot(PlotID{}, 0, target, parentWork, []*Representation{plotroot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := plot.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkPlot(id, plot, time.Now().Unix())
+	if err == nil || !strings.Contains(err.Error(), "Genesis thread work") {
+		t.Fatalf("Expected a genesis thread work error, found: %v", err)
+	}
+	if err := ValidateHeaderChain([]*PlotHeader{plot.Header}, PlotID{}); err == nil {
+		t.Fatal("Expected header chain validation to fail")
+	}
+}
+
+func TestProcessorPlotTimings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "processor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plotStore := newTestPlotStore()
+	ledger, err := NewLedgerDisk(dir, false, false, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroKey := ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+
+	// every ID satisfies this target
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+
+	// build a plot paying the scriber on top of the previous one
+	start := time.Now().Unix() - 1000
+	makePlot := func(previous *Plot, height int64, txs []*Representation) (PlotID, *Plot) {
+		var previousID, threadWork PlotID
+		if previous != nil {
+			var err error
+			if previousID, err = previous.ID(); err != nil {
+				t.Fatal(err)
+			}
+			threadWork = previous.Header.ThreadWork
+		}
+		plotroot := NewRepresentation(zeroKey, pubKey, 0, 0, height, "")
+		plot, err := NewPlot(previousID, height, target, threadWork, append([]*Representation{plotroot}, txs...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		plot.Header.Time = start + height
+		id, err := plot.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id, plot
+	}
+
+	genesisID, genesis := makePlot(nil, 0, nil)
+	processor := NewProcessor(genesisID, plotStore, NewRepresentationQueueMemory(ledger), ledger)
+	if err := processor.processPlot(genesisID, genesis, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if processor.timings.Verify != 0 || processor.timings.Ledger == 0 {
+		t.Fatalf("Unexpected genesis plot timings: %s", processor.timings)
+	}
+
+	// fund the scriber
+	count := 20
+	previous := genesis
+	for height := int64(1); height <= int64(count); height++ {
+		id, plot := makePlot(previous, height, nil)
+		if err := processor.processPlot(id, plot, "test"); err != nil {
+			t.Fatal(err)
+		}
+		previous = plot
+	}
+
+	// a plot with many representations to verify and apply
+	var txs []*Representation
+	for i := 0; i < count; i++ {
+		recipient, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := NewRepresentation(pubKey, recipient, 0, 0, int64(count+1), "")
+		if err := tx.Sign(privKey); err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+	id, plot := makePlot(previous, int64(count+1), txs)
+	if err := processor.processPlot(id, plot, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	timings := processor.timings
+	if timings.Check == 0 || timings.Verify == 0 || timings.Store == 0 ||
+		timings.Ledger == 0 || timings.Queue == 0 {
+		t.Fatalf("Expected each phase to be timed, found: %s", timings)
+	}
+	if timings.Total() != timings.Check+timings.Verify+timings.Store+timings.Ledger+timings.Queue+timings.Notify {
+		t.Fatal("Expected total to be the sum of the phases")
+	}
+	phase, duration := timings.Dominant()
+	if len(phase) == 0 || duration < timings.Verify || duration < timings.Ledger {
+		t.Fatalf("Unexpected dominant phase %s (%s): %s", phase, duration, timings)
+	}
+	t.Logf("%d representations, %s", len(plot.Representations), timings)
+}
+
+func TestProcessorOrphanPlots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "processor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plotStore := newTestPlotStore()
+	ledger, err := NewLedgerDisk(dir, false, false, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroKey := ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+
+	// every ID satisfies this target
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+
+	start := time.Now().Unix() - 1000
+	var ids []PlotID
+	var plots []*Plot
+	for height := int64(0); height < 6; height++ {
+		var previousID, threadWork PlotID
+		if height > 0 {
+			previousID, threadWork = ids[height-1], plots[height-1].Header.ThreadWork
+		}
+		plotroot := NewRepresentation(zeroKey, pubKey, 0, 0, height, "")
+		plot, err := NewPlot(previousID, height, target, threadWork, []*Representation{plotroot})
+		if err != nil {
+			t.Fatal(err)
+		}
+		plot.Header.Time = start + height
+		id, err := plot.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids, plots = append(ids, id), append(plots, plot)
+	}
+
+	processor := NewProcessor(ids[0], plotStore, NewRepresentationQueueMemory(ledger), ledger)
+
+	// in order
+	for i := 0; i < 3; i++ {
+		if err := processor.processPlot(ids[i], plots[i], "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// out of order. the children wait for their parent
+	for _, i := range []int{5, 4} {
+		err := processor.processPlot(ids[i], plots[i], "test")
+		if err != ErrOrphanPlot {
+			t.Fatalf("Expected plot %d to be an orphan, found: %v", i, err)
+		}
+	}
+	if processor.orphans.Len() != 2 {
+		t.Fatalf("Expected 2 orphans, found %d", processor.orphans.Len())
+	}
+	tipID, _, err := ledger.GetThreadTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *tipID != ids[2] {
+		t.Fatalf("Expected tip %s, found %s", ids[2], *tipID)
+	}
+
+	// the parent arriving connects them
+	if err := processor.processPlot(ids[3], plots[3], "test"); err != nil {
+		t.Fatal(err)
+	}
+	if processor.orphans.Len() != 0 {
+		t.Fatalf("Expected no orphans, found %d", processor.orphans.Len())
+	}
+	tipID, height, err := ledger.GetThreadTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *tipID != ids[5] || height != 5 {
+		t.Fatalf("Expected tip %s at height 5, found %s at height %d", ids[5], *tipID, height)
+	}
+
+	// an orphan far from our tip isn't held
+	farHeight := height + MAX_ORPHAN_HEIGHT_DISTANCE + 1
+	plotroot := NewRepresentation(zeroKey, pubKey, 0, 0, farHeight, "")
+	farPlot, err := NewPlot(PlotID{9}, farHeight, target, PlotID{}, []*Representation{plotroot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	farPlot.Header.Time = start + 6
+	farID, err := farPlot.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := processor.processPlot(farID, farPlot, "test"); err != ErrOrphanPlot {
+		t.Fatalf("Expected the far plot to be an orphan, found: %v", err)
+	}
+	if processor.orphans.Len() != 0 {
+		t.Fatalf("Expected no orphans, found %d", processor.orphans.Len())
+	}
+}
+
+func TestProcessorRejectsConfirmedRepresentation(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger := newTestLedger()
+	ledger.setImbalance(pubKey, 2)
+	ledger.heights[0] = PlotID{1}
+
+	tx := NewRepresentation(pubKey, recipient, 0, 0, 1, "")
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	id, err := tx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger.txIndex[id] = PlotID{1}
+
+	queue := NewRepresentationQueueMemory(ledger)
+	processor := NewProcessor(PlotID{1}, newTestPlotStore(), queue, ledger)
+	err = processor.processRepresentation(id, tx, "test")
+	if err == nil || !strings.Contains(err.Error(), "already confirmed") {
+		t.Fatalf("Expected already confirmed error, found: %v", err)
+	}
+	if queue.Len() != 0 {
+		t.Fatal("Expected confirmed representation not to be queued")
+	}
+}
+
+func TestProcessorReorgLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "processor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plotStore := newTestPlotStore()
+	ledger, err := NewLedgerDisk(dir, false, false, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroKey := ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+
+	// every ID satisfies this target
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+
+	start := time.Now().Unix() - 1000
+	makePlot := func(previous *Plot, previousID PlotID, memo string) (PlotID, *Plot) {
+		var height int64
+		var threadWork PlotID
+		if previous != nil {
+			height, threadWork = previous.Header.Height+1, previous.Header.ThreadWork
+		}
+		plotroot := NewRepresentation(zeroKey, pubKey, 0, 0, height, memo)
+		plot, err := NewPlot(previousID, height, target, threadWork, []*Representation{plotroot})
+		if err != nil {
+			t.Fatal(err)
+		}
+		plot.Header.Time = start + height
+		id, err := plot.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id, plot
+	}
+
+	// the main thread is 0 through 4
+	var ids []PlotID
+	var plots []*Plot
+	var previous *Plot
+	var previousID PlotID
+	for height := 0; height < 5; height++ {
+		id, plot := makePlot(previous, previousID, "")
+		ids, plots = append(ids, id), append(plots, plot)
+		previous, previousID = plot, id
+	}
+
+	processor := NewProcessor(ids[0], plotStore, NewRepresentationQueueMemory(ledger), ledger)
+	processor.SetReorgLogSize(DEFAULT_REORG_LOG_SIZE)
+	for i := range ids {
+		if err := processor.processPlot(ids[i], plots[i], "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if events := processor.ReorgEvents(); len(events) != 0 {
+		t.Fatalf("Expected no reorgs, found %d", len(events))
+	}
+
+	// a longer branch from plot 2 replaces plots 3 and 4
+	previous, previousID = plots[2], ids[2]
+	var branchID PlotID
+	for i := 0; i < 3; i++ {
+		id, plot := makePlot(previous, previousID, "branch")
+		if err := processor.processPlot(id, plot, "test"); err != nil {
+			t.Fatal(err)
+		}
+		previous, previousID, branchID = plot, id, id
+	}
+
+	events := processor.ReorgEvents()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 reorg, found %d", len(events))
+	}
+	event := events[0]
+	if event.OldTip != ids[4] || event.NewTip != branchID {
+		t.Fatalf("Expected reorg from %s to %s, found %s to %s", ids[4], branchID, event.OldTip, event.NewTip)
+	}
+	if event.CommonAncestor != ids[2] || event.AncestorHeight != 2 {
+		t.Fatalf("Expected common ancestor %s at height 2, found %s at height %d",
+			ids[2], event.CommonAncestor, event.AncestorHeight)
+	}
+	if event.Depth != 2 || event.Connected != 3 {
+		t.Fatalf("Expected depth 2 and 3 connected, found %d and %d", event.Depth, event.Connected)
+	}
+	if event.Time == 0 {
+		t.Fatal("Expected reorg time to be set")
+	}
+
+	// disabled by default
+	if events := NewProcessor(ids[0], plotStore, nil, ledger).ReorgEvents(); events != nil {
+		t.Fatalf("Expected no reorg log, found %d events", len(events))
+	}
+}
+
+func TestProcessorReferencesActivation(t *testing.T) {
+	defer func(params ThreadParams) {
+		DefaultThreadParams = params
+	}(DefaultThreadParams)
+	DefaultThreadParams.ReferencesHeight = 5
+
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger := newTestLedger()
+	ledger.setImbalance(pubKey, 1)
+
+	refers := RepresentationID{0x01}
+	tx := NewRepresentation(pubKey, recipient, 0, 0, 1, "")
+	tx.Refers = &refers
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	id, err := tx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the next plot is at the height before activation
+	for height := int64(0); height <= 3; height++ {
+		ledger.heights[height] = PlotID{byte(height)}
+	}
+	queue := NewRepresentationQueueMemory(ledger)
+	processor := NewProcessor(PlotID{}, newTestPlotStore(), queue, ledger)
+	err = processor.processRepresentation(id, tx, "test")
+	if err == nil || !strings.Contains(err.Error(), "allowed before height 5") {
+		t.Fatalf("Expected refers to be rejected before activation, found: %v", err)
+	}
+
+	// the next plot is at the activation height
+	ledger.heights[4] = PlotID{4}
+	if err := processor.processRepresentation(id, tx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if !queue.Exists(id) {
+		t.Fatal("Expected representation to be queued at activation")
+	}
+}
@@ -0,0 +1,84 @@
+package plotthread
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// PropagationStats summarizes how long recently connected plots took to reach this node. Each delay is
+// from the time in the plot's header to when the node first saw the plot. Delays are negative when the
+// scriber's clock is ahead of ours.
+type PropagationStats struct {
+	Count  int           `json:"count"`
+	Min    time.Duration `json:"min"`
+	Median time.Duration `json:"median"`
+	P90    time.Duration `json:"p90"`
+	Max    time.Duration `json:"max"`
+	Mean   time.Duration `json:"mean"`
+}
+
+// PropagationTracker keeps the propagation delays of a rolling window of recently connected plots.
+// It's safe for concurrent use.
+type PropagationTracker struct {
+	delays []int64 // seconds. used as a ring buffer
+	next   int
+	full   bool
+	lock   sync.Mutex
+}
+
+// NewPropagationTracker returns a new PropagationTracker keeping the delays of the last "window" plots.
+func NewPropagationTracker(window int) *PropagationTracker {
+	if window < 1 {
+		window = 1
+	}
+	return &PropagationTracker{delays: make([]int64, window)}
+}
+
+// Record records the propagation delay of a plot first seen at the given time. Plots seen more than
+// MAX_PROPAGATION_DELAY seconds after their header time are assumed to have been synced, not relayed,
+// and are ignored.
+func (t *PropagationTracker) Record(header *PlotHeader, timeSeen int64) {
+	delay := timeSeen - header.Time
+	if delay > MAX_PROPAGATION_DELAY {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.delays[t.next] = delay
+	t.next = (t.next + 1) % len(t.delays)
+	if t.next == 0 {
+		t.full = true
+	}
+}
+
+// Stats returns the distribution of the recorded delays.
+func (t *PropagationTracker) Stats() PropagationStats {
+	t.lock.Lock()
+	count := t.next
+	if t.full {
+		count = len(t.delays)
+	}
+	delays := make([]int64, count)
+	copy(delays, t.delays[:count])
+	t.lock.Unlock()
+
+	if count == 0 {
+		return PropagationStats{}
+	}
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+
+	var sum int64
+	for _, delay := range delays {
+		sum += delay
+	}
+	seconds := func(s int64) time.Duration { return time.Duration(s) * time.Second }
+	return PropagationStats{
+		Count:  count,
+		Min:    seconds(delays[0]),
+		Median: seconds(delays[count/2]),
+		P90:    seconds(delays[count*9/10]),
+		Max:    seconds(delays[count-1]),
+		Mean:   time.Duration(sum) * time.Second / time.Duration(count),
+	}
+}
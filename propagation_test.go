@@ -0,0 +1,37 @@
+package plotthread
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPropagationTracker(t *testing.T) {
+	tracker := NewPropagationTracker(4)
+	if stats := tracker.Stats(); stats.Count != 0 {
+		t.Fatalf("Expected no delays, found %d", stats.Count)
+	}
+
+	seen := int64(1000000)
+	record := func(delay int64) {
+		tracker.Record(&PlotHeader{Time: seen - delay}, seen)
+		seen += 600
+	}
+
+	// the first is pushed out of the window and a synced plot is ignored
+	for _, delay := range []int64{100, 3, 10, -1, 3 * 60 * 60, 5} {
+		record(delay)
+	}
+
+	stats := tracker.Stats()
+	expected := PropagationStats{
+		Count:  4,
+		Min:    -1 * time.Second,
+		Median: 5 * time.Second,
+		P90:    10 * time.Second,
+		Max:    10 * time.Second,
+		Mean:   17 * time.Second / 4,
+	}
+	if stats != expected {
+		t.Fatalf("Expected %+v, found %+v", expected, stats)
+	}
+}
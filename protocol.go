@@ -24,6 +24,8 @@ type GetPlotMessage struct {
 }
 
 // GetPlotByHeightMessage is used to request a plot for download.
+// A negative height or one above the tip is answered with a HeightOutOfRangeError. A node without
+// a thread tip answers with ErrNotSynced.
 // Type: "get_plot_by_height".
 type GetPlotByHeightMessage struct {
 	Height int64 `json:"height"`
@@ -34,6 +36,8 @@ type GetPlotByHeightMessage struct {
 type PlotMessage struct {
 	PlotID *PlotID `json:"plot_id,omitempty"`
 	Plot   *Plot   `json:"plot,omitempty"`
+	Branch string  `json:"branch,omitempty"`
+	Error  string  `json:"error,omitempty"`
 }
 
 // GetPlotHeaderMessage is used to request a plot header.
@@ -43,9 +47,13 @@ type GetPlotHeaderMessage struct {
 }
 
 // GetPlotHeaderByHeightMessage is used to request a plot header.
+// The header of the main branch plot at the given height is returned unless TipID is set.
+// Then it's the header of that plot's ancestor at the given height.
+// Heights out of range and a node without a tip are reported as with GetPlotByHeightMessage.
 // Type: "get_plot_header_by_height".
 type GetPlotHeaderByHeightMessage struct {
-	Height int64 `json:"height"`
+	Height int64   `json:"height"`
+	TipID  *PlotID `json:"tip_id,omitempty"`
 }
 
 // PlotHeaderMessage is used to send a peer a plot's header.
@@ -53,6 +61,7 @@ type GetPlotHeaderByHeightMessage struct {
 type PlotHeaderMessage struct {
 	PlotID     *PlotID     `json:"plot_id,omitempty"`
 	PlotHeader *PlotHeader `json:"header,omitempty"`
+	Error      string      `json:"error,omitempty"`
 }
 
 // FindCommonAncestorMessage is used to find a common ancestor with a peer.
@@ -65,6 +74,7 @@ type FindCommonAncestorMessage struct {
 // Type: "get_graph".
 type GetGraphMessage struct {
 	PublicKey ed25519.PublicKey `json:"public_key"`
+	Scale     string            `json:"scale,omitempty"` // node sizing: "linear" (default) or "log"
 }
 
 // PlotGraphMessage is used to send a public key's plot graph representations to a peer.
@@ -76,6 +86,14 @@ type GraphMessage struct {
 	Graph   string       		`json:"graph"`
 }
 
+// GraphStatsMessage is used to send summary statistics of the representation graph to a peer.
+// Type: "graph_stats". It is sent in response to the empty "get_graph_stats" message type.
+type GraphStatsMessage struct {
+	PlotID PlotID     `json:"plot_id,omitempty"`
+	Height int64      `json:"height,omitempty"`
+	Stats  GraphStats `json:"stats"`
+}
+
 // GetRankingMessage requests a public key's representivity ranking.
 // Type: "get_ranking".
 type GetRankingMessage struct {
@@ -92,6 +110,22 @@ type RankingMessage struct {
 	Error     string            `json:"error,omitempty"`
 }
 
+// GetScriberRewardsMessage requests the total plot rewards received by a public key.
+// Type: "get_scriber_rewards".
+type GetScriberRewardsMessage struct {
+	PublicKey ed25519.PublicKey `json:"public_key"`
+}
+
+// ScriberRewardsMessage is used to send a public key's total plot rewards on the main branch to a peer.
+// Rewards are counted when scribed, including those which have yet to mature.
+// Type: "scriber_rewards".
+type ScriberRewardsMessage struct {
+	PlotID    PlotID            `json:"plot_id,omitempty"`
+	Height    int64             `json:"height,omitempty"`
+	PublicKey ed25519.PublicKey `json:"public_key"`
+	Rewards   int64             `json:"rewards"`
+}
+
 // GetRankingsMessage requests a set of public key rankings.
 // Type: "get_rankings".
 type GetRankingsMessage struct {
@@ -129,18 +163,39 @@ type ImbalanceMessage struct {
 	Error     string            `json:"error,omitempty"`
 }
 
+// GetPublicKeyFirstSeenMessage requests the height at which a public key first appeared on the main thread.
+// Type: "get_public_key_first_seen".
+type GetPublicKeyFirstSeenMessage struct {
+	PublicKey ed25519.PublicKey `json:"public_key"`
+}
+
+// PublicKeyFirstSeenMessage is used to send a peer the lowest main thread height of a plot with a
+// representation involving a public key. Seen is false if there's none.
+// Type: "public_key_first_seen".
+type PublicKeyFirstSeenMessage struct {
+	PublicKey ed25519.PublicKey `json:"public_key"`
+	Height    int64             `json:"height,omitempty"`
+	Seen      bool              `json:"seen"`
+	Error     string            `json:"error,omitempty"`
+}
+
 // GetImbalancesMessage requests a set of public key imbalances.
+// If Encoding is "binary" the imbalances are sent in EncodedImbalances instead.
 // Type: "get_imbalances".
 type GetImbalancesMessage struct {
 	PublicKeys []ed25519.PublicKey `json:"public_keys"`
+	Encoding   string              `json:"encoding,omitempty"`
 }
 
 // ImbalancesMessage is used to send public key imbalances to a peer.
+// EncodedImbalances holds them as encoded by EncodeImbalances when requested, base64-encoded like
+// any other []byte in JSON.
 // Type: "imbalances".
 type ImbalancesMessage struct {
 	PlotID  *PlotID           `json:"plot_id,omitempty"`
 	Height   int64              `json:"height,omitempty"`
 	Imbalances []PublicKeyImbalance `json:"imbalances,omitempty"`
+	EncodedImbalances []byte      `json:"encoded_imbalances,omitempty"`
 	Error    string             `json:"error,omitempty"`
 }
 
@@ -163,6 +218,49 @@ type RepresentationMessage struct {
 	Height        int64         `json:"height,omitempty"`
 	RepresentationID RepresentationID `json:"representation_id"`
 	Representation   *Representation  `json:"representation,omitempty"`
+	Branch           string           `json:"branch,omitempty"`
+	Confirmations    int64            `json:"confirmations,omitempty"` // 0 if not on the main thread
+}
+
+// ConfirmedRepresentationCountMessage is used to send the total number of representations confirmed
+// on the main thread as of the given tip to a peer.
+// Type: "confirmed_representation_count". It is sent in response to the empty
+// "get_confirmed_representation_count" message type.
+type ConfirmedRepresentationCountMessage struct {
+	PlotID *PlotID `json:"plot_id,omitempty"`
+	Height int64   `json:"height,omitempty"`
+	Count  int64   `json:"count"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// QueuePolicyMessage is used to send a peer the representation queue's current admission policy so
+// wallets can avoid queueing more from one sender than the queue will accept.
+// Type: "queue_policy". It is sent in response to the empty "get_queue_policy" message type.
+type QueuePolicyMessage struct {
+	Length      int `json:"length"`
+	Capacity    int `json:"capacity"`
+	SenderLimit int `json:"sender_limit,omitempty"` // 0 if there's no limit
+}
+
+// ReorgsMessage is used to send a peer this node's most recent main thread reorganizations, oldest
+// first. It's empty if the node doesn't keep a reorg log.
+// Type: "reorgs". It is sent in response to the empty "get_reorgs" message type.
+type ReorgsMessage struct {
+	Reorgs []ReorgEvent `json:"reorgs"`
+}
+
+// StatusMessage is used to send a peer a summary of this node's state in a single reply.
+// Type: "status". It is sent in response to the empty "get_status" message type.
+type StatusMessage struct {
+	Protocol        string  `json:"protocol"`
+	PlotID          *PlotID `json:"plot_id,omitempty"`
+	Height          int64   `json:"height"`
+	ThreadWork      *PlotID `json:"thread_work,omitempty"`
+	Peers           int     `json:"peers"`
+	QueueLength     int     `json:"queue_length"`
+	IndexerCaughtUp bool    `json:"indexer_caught_up"`
+	Uptime          int64   `json:"uptime"` // seconds
+	Error           string  `json:"error,omitempty"`
 }
 
 // TipHeaderMessage is used to send a peer the header for the tip plot in the plot thread.
@@ -186,15 +284,31 @@ type PushRepresentationResultMessage struct {
 	Error         string        `json:"error,omitempty"`
 }
 
+// PushRepresentationsMessage is used to push a batch of unconfirmed representations to a peer.
+// Each representation is processed independently. At most MAX_REPRESENTATIONS_PER_PUSH are allowed.
+// Type: "push_representations".
+type PushRepresentationsMessage struct {
+	Representations []*Representation `json:"representations"`
+}
+
+// PushRepresentationsResultMessage is sent in response to a PushRepresentationsMessage.
+// Results are in the same order as the pushed representations. Error is set if the whole batch was rejected.
+// Type: "push_representations_result".
+type PushRepresentationsResultMessage struct {
+	Results []PushRepresentationResultMessage `json:"results,omitempty"`
+	Error   string                            `json:"error,omitempty"`
+}
+
 // FilterLoadMessage is used to request that we load a filter which is used to
 // filter representations returned to the peer based on interest.
+// Each connection has its own filter. Filters larger than the node's configured maximum are rejected.
 // Type: "filter_load"
 type FilterLoadMessage struct {
 	Type   string `json:"type"`
 	Filter []byte `json:"filter"`
 }
 
-// FilterAddMessage is used to request the addition of the given public keys to the current filter.
+// FilterAddMessage is used to request the addition of the given public keys to the connection's filter.
 // The filter is created if it's not set.
 // Type: "filter_add".
 type FilterAddMessage struct {
@@ -224,7 +338,8 @@ type FilterRepresentationQueueMessage struct {
 }
 
 // GetPublicKeyRepresentationsMessage requests representations associated with a given public key over a given
-// height range of the plot thread.
+// height range of the plot thread. If StartHeight > EndHeight the range is walked in reverse.
+// StartIndex is the first index within the plot at StartHeight to include.
 // Type: "get_public_key_representations".
 type GetPublicKeyRepresentationsMessage struct {
 	PublicKey   ed25519.PublicKey `json:"public_key"`
@@ -235,7 +350,10 @@ type GetPublicKeyRepresentationsMessage struct {
 }
 
 // PublicKeyRepresentationsMessage is used to return a list of plot headers and the representations relevant to
-// the public key over a given height range of the plot thread.
+// the public key over a given height range of the plot thread. Representations are in the order of their
+// height then their index within the plot, or the reverse, and are the same on every call.
+// StopHeight and StopIndex locate the last one returned. To fetch the next page request from StopHeight
+// with StartIndex set to StopIndex+1, or StopIndex-1 in reverse.
 // Type: "public_key_representations".
 type PublicKeyRepresentationsMessage struct {
 	PublicKey    ed25519.PublicKey     `json:"public_key"`
@@ -246,6 +364,33 @@ type PublicKeyRepresentationsMessage struct {
 	Error        string                `json:"error,omitempty"`
 }
 
+// GetPublicKeyHistoryMessage requests representations involving a given public key from its first
+// appearance on the main thread to the tip. Leave Cursor unset for the first page then send the Cursor
+// from each response until a response has none.
+// Type: "get_public_key_history".
+type GetPublicKeyHistoryMessage struct {
+	PublicKey ed25519.PublicKey       `json:"public_key"`
+	Cursor    *PublicKeyHistoryCursor `json:"cursor,omitempty"`
+	Limit     int                     `json:"limit"`
+}
+
+// PublicKeyHistoryCursor locates the next representation to return in a public key's history.
+type PublicKeyHistoryCursor struct {
+	Height int64 `json:"height"`
+	Index  int   `json:"index"`
+}
+
+// PublicKeyHistoryMessage is used to return a page of a public key's representation history in plot index
+// order. Cursor is set if there may be more.
+// Type: "public_key_history".
+type PublicKeyHistoryMessage struct {
+	PublicKey   ed25519.PublicKey       `json:"public_key"`
+	TipHeight   int64                   `json:"tip_height"`
+	FilterPlots []*FilterPlotMessage    `json:"filter_plots,omitempty"`
+	Cursor      *PublicKeyHistoryCursor `json:"cursor,omitempty"`
+	Error       string                  `json:"error,omitempty"`
+}
+
 // PeerAddressesMessage is used to communicate a list of potential peer addresses known by a peer.
 // Type: "peer_addresses". Sent in response to the empty "get_peer_addresses" message type.
 type PeerAddressesMessage struct {
@@ -253,6 +398,7 @@ type PeerAddressesMessage struct {
 }
 
 // GetWorkMessage is used by a scribing peer to request scribing work.
+// At least 1 and at most MAX_WORK_PUBLIC_KEYS public keys must be given.
 // Type: "get_work"
 type GetWorkMessage struct {
 	PublicKeys []ed25519.PublicKey `json:"public_keys"`
@@ -263,6 +409,8 @@ type GetWorkMessage struct {
 // The timestamp and nonce in the header can be manipulated by the scribing peer.
 // It is the scribing peer's responsibility to ensure the timestamp is not set below
 // the minimum timestamp and that the nonce does not exceed MAX_NUMBER (2^53-1).
+// MinTime is one second past the median timestamp of the previous plots (see ThreadParams.)
+// Work submitted with an earlier timestamp is rejected.
 // Type: "work"
 type WorkMessage struct {
 	WorkID  int32        `json:"work_id"`
@@ -0,0 +1,35 @@
+package plotthread
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RandSource provides the pseudorandom nonces for new plots and representations.
+// *rand.Rand implements it but isn't safe for concurrent use.
+type RandSource interface {
+	Int31() int32
+	Int63n(n int64) int64
+}
+
+// lockedRand is a RandSource safe for concurrent use
+type lockedRand struct {
+	rng  *rand.Rand
+	lock sync.Mutex
+}
+
+func (r *lockedRand) Int31() int32 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rng.Int31()
+}
+
+func (r *lockedRand) Int63n(n int64) int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rng.Int63n(n)
+}
+
+// the source used when none is given. it's seeded independently of the global math/rand source
+var defaultRand RandSource = &lockedRand{rng: rand.New(rand.NewSource(time.Now().UnixNano()))}
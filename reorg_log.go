@@ -0,0 +1,53 @@
+package plotthread
+
+import "sync"
+
+// ReorgEvent describes a reorganization of the main thread.
+type ReorgEvent struct {
+	OldTip         PlotID `json:"old_tip"`
+	NewTip         PlotID `json:"new_tip"`
+	CommonAncestor PlotID `json:"common_ancestor"`
+	AncestorHeight int64  `json:"ancestor_height"`
+	Depth          int    `json:"depth"`     // main thread plots disconnected
+	Connected      int    `json:"connected"` // plots connected including the new tip
+	Time           int64  `json:"time"`      // when it happened
+}
+
+// ReorgLog keeps the most recent reorganizations of the main thread. It's safe for concurrent use.
+type ReorgLog struct {
+	events []ReorgEvent // used as a ring buffer
+	next   int
+	full   bool
+	lock   sync.Mutex
+}
+
+// NewReorgLog returns a new ReorgLog keeping the last "size" events.
+func NewReorgLog(size int) *ReorgLog {
+	if size < 1 {
+		size = 1
+	}
+	return &ReorgLog{events: make([]ReorgEvent, size)}
+}
+
+// Record records an event, replacing the oldest if the log is full.
+func (l *ReorgLog) Record(event ReorgEvent) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.events[l.next] = event
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Events returns the recorded events, oldest first.
+func (l *ReorgLog) Events() []ReorgEvent {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.full {
+		return append([]ReorgEvent(nil), l.events[:l.next]...)
+	}
+	events := make([]ReorgEvent, 0, len(l.events))
+	events = append(events, l.events[l.next:]...)
+	return append(events, l.events[:l.next]...)
+}
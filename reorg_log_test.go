@@ -0,0 +1,28 @@
+package plotthread
+
+import "testing"
+
+func TestReorgLog(t *testing.T) {
+	log := NewReorgLog(3)
+	if events := log.Events(); len(events) != 0 {
+		t.Fatalf("Expected no events, found %d", len(events))
+	}
+
+	// the oldest are replaced once it's full
+	for i := 1; i <= 5; i++ {
+		log.Record(ReorgEvent{Depth: i})
+		events := log.Events()
+		expected := i
+		if expected > 3 {
+			expected = 3
+		}
+		if len(events) != expected {
+			t.Fatalf("Expected %d events, found %d", expected, len(events))
+		}
+		for j, event := range events {
+			if event.Depth != i-len(events)+j+1 {
+				t.Fatalf("Expected depth %d at %d, found %d", i-len(events)+j+1, j, event.Depth)
+			}
+		}
+	}
+}
@@ -4,9 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"math/rand"
 	"time"
 
 	"golang.org/x/crypto/ed25519"
@@ -15,29 +13,48 @@ import (
 
 // Representation represents a ledger representation. It transfers value from one public key to another.
 type Representation struct {
-	Time      int64             `json:"time"`
-	Nonce     int32             `json:"nonce"` // collision prevention. pseudorandom. not used for crypto
-	From      ed25519.PublicKey `json:"from"`
-	To        ed25519.PublicKey `json:"to"`
-	Memo      string            `json:"memo,omitempty"`    // max 100 characters
-	Matures   int64             `json:"matures,omitempty"` // plot height. if set representation can't be scribed before
-	Expires   int64             `json:"expires,omitempty"` // plot height. if set representation can't be scribed after
-	Series    int64             `json:"series"`            // +1 roughly once a week to allow for pruning history
-	Signature Signature         `json:"signature,omitempty"`
+	Time        int64             `json:"time"`
+	Nonce       int32             `json:"nonce"` // collision prevention. pseudorandom. not used for crypto
+	From        ed25519.PublicKey `json:"from"`
+	To          ed25519.PublicKey `json:"to"`
+	Memo        string            `json:"memo,omitempty"`         // max 100 characters
+	Refers      *RepresentationID `json:"refers,omitempty"`       // a prior representation this one refers to, e.g. a reply
+	ContentHash *ContentHash      `json:"content_hash,omitempty"` // hash of off-thread content the representation refers to
+	Matures     int64             `json:"matures,omitempty"`      // plot height. if set representation can't be scribed before
+	Expires     int64             `json:"expires,omitempty"`      // plot height. if set representation can't be scribed after
+	Series      int64             `json:"series"`                 // +1 roughly once a week to allow for pruning history
+	Signature   Signature         `json:"signature,omitempty"`
 }
 
 // RepresentationID is a representation's unique identifier.
+// RepresentationIDs are arrays so they can be compared with == and used as map keys.
 type RepresentationID [32]byte // SHA3-256 hash
 
+// ContentHash is the hash of content kept off the thread. How it's computed and where the content is
+// found is up to applications. It lets a representation make a verifiable reference to more data
+// than fits in its memo.
+type ContentHash [32]byte
+
 // Signature is a representation's signature.
 type Signature []byte
 
+// Equal returns true if the signatures are byte-for-byte identical. Slices can't be compared with ==.
+func (s Signature) Equal(other Signature) bool {
+	return bytes.Equal(s, other)
+}
+
 // NewRepresentation returns a new unsigned representation.
 func NewRepresentation(from, to ed25519.PublicKey, matures, expires, height int64, memo string) *Representation {
+	return NewRepresentationWithRand(defaultRand, from, to, matures, expires, height, memo)
+}
+
+// NewRepresentationWithRand returns a new unsigned representation with its nonce drawn from rng.
+func NewRepresentationWithRand(rng RandSource, from, to ed25519.PublicKey, matures, expires, height int64,
+	memo string) *Representation {
 	baseKey, _ := base64.StdEncoding.DecodeString("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")	
 	return &Representation{
 		Time:    time.Now().Unix(),
-		Nonce:   rand.Int31(),
+		Nonce:   rng.Int31(),
 		From:    from,
 		To:      to,
 		Memo:    memo,
@@ -51,17 +68,12 @@ func NewRepresentation(from, to ed25519.PublicKey, matures, expires, height int6
 func (tx Representation) ID() (RepresentationID, error) {
 	// never include the signature in the ID
 	// this way we never have to think about signature malleability
-	tx.Signature = nil
-	txJson, err := json.Marshal(tx)
-	if err != nil {
-		return RepresentationID{}, err
-	}
-	return sha3.Sum256([]byte(txJson)), nil
+	return sha3.Sum256(encodeRepresentationCanonical(&tx)), nil
 }
 
 // Sign is called to sign a representation.
 func (tx *Representation) Sign(privKey ed25519.PrivateKey) error {
-	id, err := tx.ID()
+	id, err := tx.SigningHash()
 	if err != nil {
 		return err
 	}
@@ -69,6 +81,29 @@ func (tx *Representation) Sign(privKey ed25519.PrivateKey) error {
 	return nil
 }
 
+// SigningHash returns the digest to be signed for the representation.
+// It's used with ApplySignature when the private key is held externally (e.g. a hardware wallet.)
+func (tx Representation) SigningHash() (RepresentationID, error) {
+	return tx.ID()
+}
+
+// ApplySignature attaches an externally produced signature to the representation.
+// It returns an error if the signature isn't valid for the sender.
+func (tx *Representation) ApplySignature(sig Signature) error {
+	id, err := tx.SigningHash()
+	if err != nil {
+		return err
+	}
+	if len(tx.From) != ed25519.PublicKeySize {
+		return fmt.Errorf("Representation %s sender has an invalid public key length", id)
+	}
+	if !ed25519.Verify(tx.From, id[:], sig) {
+		return fmt.Errorf("Signature is not valid for representation %s", id)
+	}
+	tx.Signature = sig
+	return nil
+}
+
 // Verify is called to verify only that the representation is properly signed.
 func (tx Representation) Verify() (bool, error) {
 	id, err := tx.ID()
@@ -86,6 +121,62 @@ func (tx Representation) IsPlotroot() bool {
 	return bytes.Equal(baseKey, tx.From)
 }
 
+// IsCanonicalPublicKey returns true if the public key is the unique encoding of its point. An encoding is
+// the little-endian y coordinate with the sign of x in the top bit. It isn't canonical if y isn't reduced
+// modulo 2^255-19 or if x is zero but the sign bit is set, i.e. y is 1 or -1. The key isn't checked to be
+// on the curve since recipients needn't be.
+func IsCanonicalPublicKey(pubKey ed25519.PublicKey) bool {
+	if len(pubKey) != ed25519.PublicKeySize {
+		return false
+	}
+	last := len(pubKey) - 1
+	sign := pubKey[last] & 0x80
+
+	// are bits 8 through 254 all set? then y >= 2^255-19 unless the low byte is small
+	allSet := pubKey[last]&0x7f == 0x7f
+	for i := 1; allSet && i < last; i++ {
+		allSet = pubKey[i] == 0xff
+	}
+	if allSet && pubKey[0] >= 0xed {
+		return false
+	}
+	if sign == 0 {
+		return true
+	}
+
+	// negative zero x where y is 2^255-20 (-1)
+	if allSet && pubKey[0] == 0xec {
+		return false
+	}
+	// or y is 1
+	if pubKey[0] != 1 || pubKey[last]&0x7f != 0 {
+		return true
+	}
+	for i := 1; i < last; i++ {
+		if pubKey[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Equal returns true if both representations have the same ID. Signatures aren't part of the ID
+// so representations differing only by signature are equal. Two nils are equal.
+func (tx *Representation) Equal(other *Representation) bool {
+	if tx == nil || other == nil {
+		return tx == other
+	}
+	id, err := tx.ID()
+	if err != nil {
+		return false
+	}
+	otherID, err := other.ID()
+	if err != nil {
+		return false
+	}
+	return id == otherID
+}
+
 // Contains returns true if the representation is relevant to the given public key.
 func (tx Representation) Contains(pubKey ed25519.PublicKey) bool {
 	if !tx.IsPlotroot() {
@@ -112,11 +203,33 @@ func (tx Representation) IsExpired(height int64) bool {
 	return tx.Expires < height
 }
 
+// FindRepresentation returns a confirmed representation and the header of the plot containing it
+// using the ledger's representation index. It returns nils if the representation isn't confirmed.
+// It's used to resolve the representation referred to by Refers.
+func FindRepresentation(id RepresentationID, ledger Ledger, plotStore PlotStorage) (
+	*Representation, *PlotHeader, error) {
+	plotID, index, err := ledger.GetRepresentationIndex(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if plotID == nil {
+		// not confirmed
+		return nil, nil, nil
+	}
+	return plotStore.GetRepresentation(*plotID, index)
+}
+
 // String implements the Stringer interface.
 func (id RepresentationID) String() string {
 	return hex.EncodeToString(id[:])
 }
 
+// Less returns true if id is numerically less than other when both are read as big-endian integers.
+// This is the same order as PlotID.Less.
+func (id RepresentationID) Less(other RepresentationID) bool {
+	return bytes.Compare(id[:], other[:]) < 0
+}
+
 // MarshalJSON marshals RepresentationID as a hex string.
 func (id RepresentationID) MarshalJSON() ([]byte, error) {
 	s := "\"" + id.String() + "\""
@@ -136,6 +249,30 @@ func (id *RepresentationID) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// String implements the Stringer interface.
+func (h ContentHash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// MarshalJSON marshals ContentHash as a hex string.
+func (h ContentHash) MarshalJSON() ([]byte, error) {
+	s := "\"" + h.String() + "\""
+	return []byte(s), nil
+}
+
+// UnmarshalJSON unmarshals a hex string to ContentHash.
+func (h *ContentHash) UnmarshalJSON(b []byte) error {
+	if len(b) != 64+2 {
+		return fmt.Errorf("Invalid content hash")
+	}
+	hashBytes, err := hex.DecodeString(string(b[1 : len(b)-1]))
+	if err != nil {
+		return err
+	}
+	copy(h[:], hashBytes)
+	return nil
+}
+
 // Compute the series to use for a new representation.
 func computeRepresentationSeries(isPlotroot bool, height int64) int64 {
 	if isPlotroot {
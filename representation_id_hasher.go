@@ -0,0 +1,29 @@
+package plotthread
+
+import "golang.org/x/crypto/sha3"
+
+// RepresentationIDHasher computes representation IDs reusing its encoding buffer and SHA3 state
+// so hashing many representations doesn't allocate for each. The IDs are the same as those returned
+// by Representation.ID. It isn't safe for concurrent use.
+type RepresentationIDHasher struct {
+	buffer    []byte
+	hasher    HashWithRead
+	resultBuf RepresentationID // reading into a local would escape
+}
+
+// NewRepresentationIDHasher returns a new RepresentationIDHasher.
+func NewRepresentationIDHasher() *RepresentationIDHasher {
+	return &RepresentationIDHasher{
+		buffer: make([]byte, 0, 256),
+		hasher: sha3.New256().(HashWithRead),
+	}
+}
+
+// ID returns the representation's ID.
+func (h *RepresentationIDHasher) ID(tx *Representation) (RepresentationID, error) {
+	h.buffer = withSHA3Slack(appendRepresentationCanonical(h.buffer[:0], tx))
+	h.hasher.Reset()
+	h.hasher.Write(h.buffer)
+	h.hasher.Read(h.resultBuf[:])
+	return h.resultBuf, nil
+}
@@ -0,0 +1,74 @@
+package plotthread
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func makeTestRepresentations(t testing.TB, n int) []*Representation {
+	from, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs := make([]*Representation, n)
+	for i := range txs {
+		txs[i] = NewRepresentation(from, to, int64(i%3), int64(i%5), int64(i), strings.Repeat("x", i%40))
+		if i%2 == 0 {
+			txs[i].Refers = &RepresentationID{byte(i)}
+		}
+		if i%3 == 0 {
+			txs[i].ContentHash = &ContentHash{byte(i)}
+		}
+	}
+	return txs
+}
+
+func TestRepresentationIDHasher(t *testing.T) {
+	hasher := NewRepresentationIDHasher()
+	for i, tx := range makeTestRepresentations(t, 100) {
+		expected, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := hasher.ID(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != expected {
+			t.Fatalf("Representation %d: expected ID %s, found %s", i, expected, id)
+		}
+	}
+}
+
+func BenchmarkRepresentationID(b *testing.B) {
+	txs := makeTestRepresentations(b, 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, tx := range txs {
+			if _, err := tx.ID(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkRepresentationIDHasher(b *testing.B) {
+	txs := makeTestRepresentations(b, 10000)
+	hasher := NewRepresentationIDHasher()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, tx := range txs {
+			if _, err := hasher.ID(tx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
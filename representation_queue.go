@@ -14,9 +14,13 @@ type RepresentationQueue interface {
 	// "more" indicates if more connections are coming.
 	RemoveBatch(ids []RepresentationID, height int64, more bool) error
 
-	// Get returns representations in the queue for the scriber.
+	// Get returns up to limit representations in the queue for the scriber.
+	// A limit of zero or less returns none.
 	Get(limit int) []*Representation
 
+	// GetAll returns all representations in the queue.
+	GetAll() []*Representation
+
 	// Exists returns true if the given representation is in the queue.
 	Exists(id RepresentationID) bool
 
@@ -25,4 +29,7 @@ type RepresentationQueue interface {
 
 	// Len returns the queue length.
 	Len() int
+
+	// SenderLimit returns how many representations each sender may currently have queued. Zero means there's no limit.
+	SenderLimit() int
 }
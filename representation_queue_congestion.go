@@ -0,0 +1,42 @@
+package plotthread
+
+// CongestionCurve limits how many representations each sender may have queued as the queue fills.
+// Representations carry no fee to raise during congestion. Instead the per-sender limit falls, slowly at
+// first and steeply near capacity, so no one sender can crowd out everyone else.
+type CongestionCurve struct {
+	Capacity     int     `json:"capacity"`       // queue length at which the queue is full
+	Knee         float64 `json:"knee"`           // occupancy (0 to 1) up to which MaxPerSender applies
+	MaxPerSender int     `json:"max_per_sender"` // limit at low occupancy
+	MinPerSender int     `json:"min_per_sender"` // limit at capacity
+}
+
+// DefaultCongestionCurve lets a sender fill a plot until the queue is half full and only
+// queue one representation at a time once it's full.
+var DefaultCongestionCurve = CongestionCurve{
+	Capacity:     MAX_REPRESENTATION_QUEUE_LENGTH,
+	Knee:         0.5,
+	MaxPerSender: MAX_REPRESENTATIONS_TO_INCLUDE_PER_PLOT,
+	MinPerSender: 1,
+}
+
+// SenderLimit returns how many representations a sender may have queued when the queue has the given length.
+func (c CongestionCurve) SenderLimit(queueLen int) int {
+	if c.Capacity <= 0 {
+		return c.MaxPerSender
+	}
+	occupancy := float64(queueLen) / float64(c.Capacity)
+	if occupancy <= c.Knee {
+		return c.MaxPerSender
+	}
+	if occupancy >= 1 || c.Knee >= 1 {
+		return c.MinPerSender
+	}
+
+	// fall quadratically from the knee to capacity
+	x := (occupancy - c.Knee) / (1 - c.Knee)
+	limit := c.MaxPerSender - int(float64(c.MaxPerSender-c.MinPerSender)*x*x)
+	if limit < c.MinPerSender {
+		return c.MinPerSender
+	}
+	return limit
+}
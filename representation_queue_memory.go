@@ -4,36 +4,138 @@ import (
 	"bytes"
 	"container/list"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
 )
 
 // RepresentationQueueMemory is an in-memory FIFO implementation of the RepresentationQueue interface.
+// Representations are copied on insertion and never modified while queued. Callers of Get and GetAll
+// may read the returned representations without holding any lock but must not modify them.
+// A representation may spend what a queued representation sends its sender. Such chains are
+// limited to MAX_REPRESENTATION_CHAIN_DEPTH and FIFO order keeps each behind what it depends on.
 type RepresentationQueueMemory struct {
 	txMap        map[RepresentationID]*list.Element
 	txQueue      *list.List
 	imbalanceCache *ImbalanceCache
+	chainDebits  map[[ed25519.PublicKeySize]byte]int64 // queued representations sent by each public key
+	chainDepths  map[[ed25519.PublicKeySize]byte]int   // longest queued chain sending to each public key
+	maxChainDepth int
+	congestion   *CongestionCurve // limits queued representations per sender as the queue fills. nil if disabled
+	ledger       Ledger
+	fair         bool
+	agingInterval time.Duration // how long a representation waits to move up a round in fair selection
+	unconfirmed  map[RepresentationID]bool // formerly confirmed representations returned by AddBatch
+	onDropUnconfirmed func(id RepresentationID, reason string)
+	onEvict      func(id RepresentationID, reason string)
+	evictions    []queueEviction // pending notifications
+	queuedTime   map[*list.Element]time.Time // when each queued representation was first queued
+	dropped      map[RepresentationID]*list.Element // recently evicted representations
+	droppedOrder *list.List                      // recently evicted representations in order of eviction
+	requeueWindow time.Duration
+	metrics      RepresentationQueueMetrics
+	policy       AdmissionPolicy
 	lock         sync.RWMutex
 }
 
+// A recently evicted representation
+type droppedRepresentation struct {
+	id      RepresentationID
+	queued  time.Time // when it was first queued
+	dropped time.Time
+}
+
 // NewRepresentationQueueMemory returns a new NewRepresentationQueueMemory instance.
 func NewRepresentationQueueMemory(ledger Ledger) *RepresentationQueueMemory {
 
 	return &RepresentationQueueMemory{
 		txMap:        make(map[RepresentationID]*list.Element),
 		txQueue:      list.New(),
+		unconfirmed:  make(map[RepresentationID]bool),
+		queuedTime:   make(map[*list.Element]time.Time),
+		dropped:      make(map[RepresentationID]*list.Element),
+		droppedOrder: list.New(),
 		imbalanceCache: NewImbalanceCache(ledger),
+		chainDebits:  make(map[[ed25519.PublicKeySize]byte]int64),
+		chainDepths:  make(map[[ed25519.PublicKeySize]byte]int),
+		maxChainDepth: MAX_REPRESENTATION_CHAIN_DEPTH,
+		ledger:       ledger,
+		metrics:      noopQueueMetrics{},
 	}
 }
 
 // Add adds the representation to the queue. Returns true if the representation was added to the queue on this call.
 func (t *RepresentationQueueMemory) Add(id RepresentationID, tx *Representation) (bool, error) {
+	return t.add(id, tx, nil)
+}
+
+// AddWithTrace is like Add but also returns a trace of each check made and its outcome.
+// It's meant for debugging why a representation was rejected.
+func (t *RepresentationQueueMemory) AddWithTrace(id RepresentationID, tx *Representation) (
+	bool, *AdmissionTrace, error) {
+	trace := &AdmissionTrace{ID: id}
+	ok, err := t.add(id, tx, trace)
+	return ok, trace, err
+}
+
+func (t *RepresentationQueueMemory) add(id RepresentationID, tx *Representation, trace *AdmissionTrace) (bool, error) {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 	if _, ok := t.txMap[id]; ok {
 		// already exists
+		trace.record("duplicate", fmt.Errorf("Representation %s is already queued", id))
 		return false, nil
 	}
+	trace.record("duplicate", nil)
+
+	if t.policy != nil {
+		// does the admission policy allow it in the next plot?
+		tipID, tipHeight, err := t.ledger.GetThreadTip()
+		if err != nil {
+			return false, err
+		}
+		var height int64
+		if tipID != nil {
+			height = tipHeight + 1
+		}
+		if trace != nil {
+			trace.Height = height
+		}
+		if err := acceptTraced(t.policy, tx, height, trace); err != nil {
+			return false, fmt.Errorf("Representation %s rejected by admission policy: %s", id, err)
+		}
+	}
+
+	// how many queued representations does it depend on?
+	depth, err := t.chainDepth(tx)
+	if err != nil {
+		return false, err
+	}
+	if depth > t.maxChainDepth {
+		return false, trace.record("chain depth",
+			fmt.Errorf("Representation %s would extend a chain of queued representations to %d, max: %d",
+				id, depth, t.maxChainDepth))
+	}
+	trace.record("chain depth", nil)
+
+	// does the sender already have as many queued as the queue's congestion allows?
+	if limit := t.senderLimit(); limit > 0 && !tx.IsPlotroot() {
+		var fpk [ed25519.PublicKeySize]byte
+		copy(fpk[:], tx.From)
+		if queued := t.chainDebits[fpk]; queued >= int64(limit) {
+			return false, trace.record("sender limit",
+				fmt.Errorf("Representation %s sender %s already has %d queued, limit: %d",
+					id, base64.StdEncoding.EncodeToString(tx.From[:]), queued, limit))
+		}
+		trace.record("sender limit", nil)
+	}
 
 	// check sender imbalance and update sender and receiver imbalances
 	ok, err := t.imbalanceCache.Apply(tx)
@@ -42,16 +144,46 @@ func (t *RepresentationQueueMemory) Add(id RepresentationID, tx *Representation)
 	}
 	if !ok {
 		// insufficient sender imbalance
-		return false, fmt.Errorf("Representation %s sender %s has insufficient imbalance",
-			id, base64.StdEncoding.EncodeToString(tx.From[:]))
+		return false, trace.record("imbalance", fmt.Errorf("Representation %s sender %s has insufficient imbalance",
+			id, base64.StdEncoding.EncodeToString(tx.From[:])))
+	}
+	trace.record("imbalance", nil)
+	t.extendChain(tx, depth)
+
+	if de, ok := t.dropped[id]; ok {
+		d := t.droppedOrder.Remove(de).(droppedRepresentation)
+		delete(t.dropped, id)
+		// it can't move ahead of anything it depends on
+		if depth == 1 && time.Since(d.dropped) < t.requeueWindow {
+			// it regains its place
+			e := t.insertByQueuedTime(copyRepresentation(tx), d.queued)
+			t.txMap[id] = e
+			t.queuedTime[e] = d.queued
+			t.metrics.Added("add", 1)
+			t.metrics.SetLength(t.txQueue.Len())
+			return true, nil
+		}
 	}
 
 	// add to the back of the queue
-	e := t.txQueue.PushBack(tx)
+	e := t.txQueue.PushBack(copyRepresentation(tx))
 	t.txMap[id] = e
+	t.queuedTime[e] = time.Now()
+	t.metrics.Added("add", 1)
+	t.metrics.SetLength(t.txQueue.Len())
 	return true, nil
 }
 
+// Insert the representation behind everything queued no later than the given time
+func (t *RepresentationQueueMemory) insertByQueuedTime(tx *Representation, queued time.Time) *list.Element {
+	for e := t.txQueue.Back(); e != nil; e = e.Prev() {
+		if !t.queuedTime[e].After(queued) {
+			return t.txQueue.InsertAfter(tx, e)
+		}
+	}
+	return t.txQueue.PushFront(tx)
+}
+
 // AddBatch adds a batch of representations to the queue (a plot has been disconnected.)
 // "height" is the plot thread height after this disconnection.
 func (t *RepresentationQueueMemory) AddBatch(ids []RepresentationID, txs []*Representation, height int64) error {
@@ -65,10 +197,16 @@ func (t *RepresentationQueueMemory) AddBatch(ids []RepresentationID, txs []*Repr
 		if e, ok := t.txMap[ids[i]]; ok {
 			// remove it from its current position
 			t.txQueue.Remove(e)
+			delete(t.queuedTime, e)
 		}
-		e := t.txQueue.PushFront(txs[i])
+		e := t.txQueue.PushFront(copyRepresentation(txs[i]))
 		t.txMap[ids[i]] = e
+		t.unconfirmed[ids[i]] = true
+		// it's ahead of everything queued
+		t.queuedTime[e] = time.Time{}
 	}
+	t.metrics.Added("batch", len(txs))
+	t.metrics.SetLength(t.txQueue.Len())
 
 	// we don't want to invalidate anything based on maturity/expiration/imbalance yet.
 	// if we're disconnecting a plot we're going to be connecting some shortly.
@@ -80,7 +218,9 @@ func (t *RepresentationQueueMemory) AddBatch(ids []RepresentationID, txs []*Repr
 // "more" indicates if more connections are coming.
 func (t *RepresentationQueueMemory) RemoveBatch(ids []RepresentationID, height int64, more bool) error {
 	t.lock.Lock()
+	defer t.notifyEvictions()
 	defer t.lock.Unlock()
+	var removed int
 	for _, id := range ids {
 		e, ok := t.txMap[id]
 		if !ok {
@@ -90,6 +230,13 @@ func (t *RepresentationQueueMemory) RemoveBatch(ids []RepresentationID, height i
 		// remove it
 		t.txQueue.Remove(e)
 		delete(t.txMap, id)
+		delete(t.unconfirmed, id)
+		delete(t.queuedTime, e)
+		removed++
+	}
+	if removed != 0 {
+		t.metrics.Removed(removed)
+		t.metrics.SetLength(t.txQueue.Len())
 	}
 
 	if more {
@@ -105,24 +252,46 @@ func (t *RepresentationQueueMemory) RemoveBatch(ids []RepresentationID, height i
 func (t *RepresentationQueueMemory) reprocessQueue(height int64) error {
 	// invalidate the cache
 	t.imbalanceCache.Reset()
+	t.chainDebits = make(map[[ed25519.PublicKeySize]byte]int64)
+	t.chainDepths = make(map[[ed25519.PublicKeySize]byte]int)
+	t.metrics.Reprocessed()
+	defer func() { t.metrics.SetLength(t.txQueue.Len()) }()
 
-	// remove invalidated representations from the queue
-	tmpQueue := list.New()
-	tmpQueue.PushBackList(t.txQueue)
-	for e := tmpQueue.Front(); e != nil; e = e.Next() {
+	// remove invalidated representations from the queue.
+	// we walk the queue in place to avoid copying it. next is captured
+	// before any removal since Remove clears the element's links
+	var next *list.Element
+	for e := t.txQueue.Front(); e != nil; e = next {
+		next = e.Next()
 		tx := e.Value.(*Representation)
 		// check that the series would still be valid
-		if !checkRepresentationSeries(tx, height+1) ||
+		var reason string
+		if !checkRepresentationSeries(tx, height+1) {
+			reason = "invalid series"
+		} else if !tx.IsMature(height+1) {
 			// check maturity and expiration if included in the next plot
-			!tx.IsMature(height+1) || tx.IsExpired(height+1) {
+			reason = "immature"
+		} else if tx.IsExpired(height+1) {
+			reason = "expired"
+		}
+		if len(reason) != 0 {
 			// representation has been invalidated. remove and continue
-			id, err := tx.ID()
-			if err != nil {
+			if err := t.drop(e, tx, reason); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// check chain depth
+		depth, err := t.chainDepth(tx)
+		if err != nil {
+			return err
+		}
+		if depth > t.maxChainDepth {
+			// representation has been invalidated. remove and continue
+			if err := t.drop(e, tx, "chain too deep"); err != nil {
 				return err
 			}
-			e := t.txMap[id]
-			t.txQueue.Remove(e)
-			delete(t.txMap, id)
 			continue
 		}
 
@@ -133,35 +302,440 @@ func (t *RepresentationQueueMemory) reprocessQueue(height int64) error {
 		}
 		if !ok {
 			// representation has been invalidated. remove and continue
-			id, err := tx.ID()
-			if err != nil {
+			if err := t.drop(e, tx, "insufficient imbalance"); err != nil {
 				return err
 			}
-			e := t.txMap[id]
-			t.txQueue.Remove(e)
-			delete(t.txMap, id)
 			continue
 		}
+		t.extendChain(tx, depth)
 	}
 	return nil
 }
 
-// Get returns representations in the queue for the scriber.
+// Compute the length of the chain of queued representations ending with this one. It's 1 if the
+// sender's confirmed imbalance covers it after everything the sender already has queued. Otherwise
+// it spends what queued representations sent and extends the longest of their chains
+func (t *RepresentationQueueMemory) chainDepth(tx *Representation) (int, error) {
+	if tx.IsPlotroot() {
+		return 1, nil
+	}
+	var fpk [ed25519.PublicKeySize]byte
+	copy(fpk[:], tx.From)
+	depth, ok := t.chainDepths[fpk]
+	if !ok {
+		// nothing queued sends to it
+		return 1, nil
+	}
+	imbalance, err := t.ledger.GetPublicKeyImbalance(tx.From)
+	if err != nil {
+		return 0, err
+	}
+	if imbalance-t.chainDebits[fpk] >= 1 {
+		return 1, nil
+	}
+	return depth + 1, nil
+}
+
+// Record the representation's place in the chain of queued representations
+func (t *RepresentationQueueMemory) extendChain(tx *Representation, depth int) {
+	if !tx.IsPlotroot() {
+		var fpk [ed25519.PublicKeySize]byte
+		copy(fpk[:], tx.From)
+		t.chainDebits[fpk]++
+	}
+	var tpk [ed25519.PublicKeySize]byte
+	copy(tpk[:], tx.To)
+	if depth > t.chainDepths[tpk] {
+		t.chainDepths[tpk] = depth
+	}
+}
+
+// A representation evicted from the queue pending notification
+type queueEviction struct {
+	id          RepresentationID
+	reason      string
+	unconfirmed bool // it was formerly confirmed
+}
+
+// Remove an invalidated representation and queue notification of its eviction
+func (t *RepresentationQueueMemory) drop(e *list.Element, tx *Representation, reason string) error {
+	id, err := tx.ID()
+	if err != nil {
+		return err
+	}
+	unconfirmed, queued := t.unconfirmed[id], t.queuedTime[e]
+	if err := t.remove(e, tx); err != nil {
+		return err
+	}
+	if t.requeueWindow > 0 {
+		t.rememberDropped(id, queued)
+	}
+	t.metrics.Evicted(reason)
+	if t.onEvict != nil || (unconfirmed && t.onDropUnconfirmed != nil) {
+		t.evictions = append(t.evictions, queueEviction{id: id, reason: reason, unconfirmed: unconfirmed})
+	}
+	return nil
+}
+
+// Call the handlers for any pending evictions. It must be called with the queue unlocked
+// so a slow handler can't stall the queue
+func (t *RepresentationQueueMemory) notifyEvictions() {
+	t.lock.Lock()
+	evictions := t.evictions
+	t.evictions = nil
+	onEvict, onDropUnconfirmed := t.onEvict, t.onDropUnconfirmed
+	t.lock.Unlock()
+
+	for _, eviction := range evictions {
+		if onEvict != nil {
+			onEvict(eviction.id, eviction.reason)
+		}
+		if eviction.unconfirmed && onDropUnconfirmed != nil {
+			onDropUnconfirmed(eviction.id, eviction.reason)
+		}
+	}
+}
+
+// Remove the given queue element and its index entry
+func (t *RepresentationQueueMemory) remove(e *list.Element, tx *Representation) error {
+	id, err := tx.ID()
+	if err != nil {
+		return err
+	}
+	t.txQueue.Remove(e)
+	delete(t.txMap, id)
+	delete(t.unconfirmed, id)
+	delete(t.queuedTime, e)
+	return nil
+}
+
+// Remember when an evicted representation was queued and forget any dropped outside of the window.
+// Evictions are kept in the order they happened so only those expiring are visited
+func (t *RepresentationQueueMemory) rememberDropped(id RepresentationID, queued time.Time) {
+	now := time.Now()
+	for e := t.droppedOrder.Front(); e != nil; e = t.droppedOrder.Front() {
+		d := e.Value.(droppedRepresentation)
+		if now.Sub(d.dropped) < t.requeueWindow {
+			break
+		}
+		t.droppedOrder.Remove(e)
+		delete(t.dropped, d.id)
+	}
+	if e, ok := t.dropped[id]; ok {
+		t.droppedOrder.Remove(e)
+	}
+	t.dropped[id] = t.droppedOrder.PushBack(droppedRepresentation{id: id, queued: queued, dropped: now})
+}
+
+// QUEUE_SNAPSHOT_VERSION is the current version of the representation queue snapshot format.
+// It must be incremented whenever the format changes.
+const QUEUE_SNAPSHOT_VERSION = 1
+
+// queueSnapshot is the on-disk format of the representation queue.
+type queueSnapshot struct {
+	Version         int               `json:"version"`
+	Representations []*Representation `json:"representations"` // in FIFO order
+}
+
+// SaveSnapshot writes the queued representations to w in FIFO order.
+func (t *RepresentationQueueMemory) SaveSnapshot(w io.Writer) error {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	txs := make([]*Representation, 0, t.txQueue.Len())
+	for e := t.txQueue.Front(); e != nil; e = e.Next() {
+		txs = append(txs, e.Value.(*Representation))
+	}
+	return json.NewEncoder(w).Encode(queueSnapshot{Version: QUEUE_SNAPSHOT_VERSION, Representations: txs})
+}
+
+// LoadSnapshot reads representations previously written with SaveSnapshot and appends them to the queue
+// in their original order. "height" is the current plot thread height. Representations failing the
+// processor's context-free checks or signature verification are skipped since the snapshot may have
+// been modified on disk. The queue is reprocessed after loading so anything no longer valid is dropped.
+// A snapshot of any other version is rejected and the queue is left unmodified.
+func (t *RepresentationQueueMemory) LoadSnapshot(r io.Reader, height int64) error {
+	var snapshot queueSnapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return err
+	}
+	if snapshot.Version != QUEUE_SNAPSHOT_VERSION {
+		return fmt.Errorf("Unsupported representation queue snapshot version %d, expected %d",
+			snapshot.Version, QUEUE_SNAPSHOT_VERSION)
+	}
+
+	t.lock.Lock()
+	defer t.notifyEvictions()
+	defer t.lock.Unlock()
+	var added int
+	for _, tx := range snapshot.Representations {
+		id, err := tx.ID()
+		if err != nil {
+			return err
+		}
+		if _, ok := t.txMap[id]; ok {
+			// already exists
+			continue
+		}
+		if err := checkRepresentation(id, tx); err != nil {
+			log.Printf("Skipping invalid snapshot representation: %s\n", err)
+			continue
+		}
+		if tx.IsPlotroot() {
+			log.Printf("Skipping snapshot plotroot representation %s\n", id)
+			continue
+		}
+		if ok, err := tx.Verify(); err != nil || !ok {
+			log.Printf("Skipping snapshot representation %s with an invalid signature\n", id)
+			continue
+		}
+		e := t.txQueue.PushBack(tx)
+		t.txMap[id] = e
+		t.queuedTime[e] = time.Now()
+		added++
+	}
+	t.metrics.Added("snapshot", added)
+	return t.reprocessQueue(height)
+}
+
+// SetSenderFairness enables or disables sender fairness. When enabled and Get is limited
+// representations are selected round-robin across senders instead of strictly in FIFO order.
+func (t *RepresentationQueueMemory) SetSenderFairness(fair bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.fair = fair
+}
+
+// SetPriorityAging sets how long a representation must wait to move up a round in sender fairness
+// selection, letting a sender's older representations eventually be taken ahead of newer ones from
+// other senders. Representations formerly confirmed are treated as having waited indefinitely.
+// Zero, the default, disables aging.
+func (t *RepresentationQueueMemory) SetPriorityAging(interval time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.agingInterval = interval
+}
+
+// OnDropUnconfirmed sets a handler to be called when a representation which was confirmed until a plot
+// was disconnected is dropped from the queue because it's no longer valid at the new tip. It's then
+// neither confirmed nor queued. The handler is called after the queue is unlocked.
+func (t *RepresentationQueueMemory) OnDropUnconfirmed(handler func(id RepresentationID, reason string)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.onDropUnconfirmed = handler
+}
+
+// SetRequeueWindow sets how long after a representation is evicted it keeps its place in the queue if
+// it's added again. It's then queued behind only those representations queued before it originally was
+// instead of at the back. Zero, the default, disables this.
+func (t *RepresentationQueueMemory) SetRequeueWindow(window time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.requeueWindow = window
+	if window == 0 {
+		t.dropped = make(map[RepresentationID]*list.Element)
+		t.droppedOrder.Init()
+	}
+}
+
+// OnEvict sets a handler to be called when a representation is evicted from the queue because it's
+// no longer valid, with the reason why. The handler is called after the queue is unlocked.
+func (t *RepresentationQueueMemory) OnEvict(handler func(id RepresentationID, reason string)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.onEvict = handler
+}
+
+// SetMetrics sets the receiver of the queue's statistics. Passing nil restores the default which
+// discards them.
+func (t *RepresentationQueueMemory) SetMetrics(metrics RepresentationQueueMetrics) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if metrics == nil {
+		metrics = noopQueueMetrics{}
+	}
+	t.metrics = metrics
+	t.metrics.SetLength(t.txQueue.Len())
+}
+
+// SetAdmissionPolicy sets the policy Add consults before queueing a representation. Passing nil
+// removes the policy, which is the default.
+func (t *RepresentationQueueMemory) SetAdmissionPolicy(policy AdmissionPolicy) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.policy = policy
+}
+
+// SetCongestionCurve limits how many representations each sender may have queued according to
+// the given curve and the queue's length. Passing nil removes the limit, which is the default.
+func (t *RepresentationQueueMemory) SetCongestionCurve(curve *CongestionCurve) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.congestion = curve
+}
+
+// SenderLimit returns how many representations each sender may currently have queued. Zero means there's no limit.
+func (t *RepresentationQueueMemory) SenderLimit() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.senderLimit()
+}
+
+func (t *RepresentationQueueMemory) senderLimit() int {
+	if t.congestion == nil {
+		return 0
+	}
+	return t.congestion.SenderLimit(t.txQueue.Len())
+}
+
+// Get returns up to limit representations in the queue for the scriber.
+// A limit of zero or less returns none.
 func (t *RepresentationQueueMemory) Get(limit int) []*Representation {
-	var txs []*Representation
 	t.lock.RLock()
 	defer t.lock.RUnlock()
-	if limit == 0 || t.txQueue.Len() < limit {
-		txs = make([]*Representation, t.txQueue.Len())
+	if limit <= 0 {
+		return []*Representation{}
+	}
+	if t.fair && t.txQueue.Len() > limit {
+		txs, err := t.getFair(limit)
+		if err == nil {
+			return txs
+		}
+		log.Printf("Error selecting representations fairly, falling back to FIFO: %s\n", err)
+	}
+	return t.get(limit)
+}
+
+// GetAll returns all representations in the queue.
+func (t *RepresentationQueueMemory) GetAll() []*Representation {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.get(t.txQueue.Len())
+}
+
+// Return up to limit representations from the front of the queue
+func (t *RepresentationQueueMemory) get(limit int) []*Representation {
+	if t.txQueue.Len() < limit {
+		limit = t.txQueue.Len()
+	}
+	txs := make([]*Representation, 0, limit)
+	for e := t.txQueue.Front(); e != nil && len(txs) < limit; e = e.Next() {
+		txs = append(txs, e.Value.(*Representation))
+	}
+	return txs
+}
+
+// Select up to limit representations taking one from each sender in turn.
+// The selection is returned in FIFO order. Anything whose sender would lack the imbalance
+// without an unselected representation preceding it is left out
+func (t *RepresentationQueueMemory) getFair(limit int) ([]*Representation, error) {
+	// group the queue by sender preserving FIFO order within each
+	var senders [][]*list.Element
+	senderIndex := make(map[[ed25519.PublicKeySize]byte]int)
+	for e := t.txQueue.Front(); e != nil; e = e.Next() {
+		tx := e.Value.(*Representation)
+		var fpk [ed25519.PublicKeySize]byte
+		copy(fpk[:], tx.From)
+		i, ok := senderIndex[fpk]
+		if !ok {
+			i = len(senders)
+			senderIndex[fpk] = i
+			senders = append(senders, nil)
+		}
+		senders[i] = append(senders[i], e)
+	}
+
+	var selected map[*list.Element]bool
+	if t.agingInterval > 0 {
+		selected = t.selectAged(senders, limit)
 	} else {
-		txs = make([]*Representation, limit)
+		// take the next representation from each sender in turn
+		selected = make(map[*list.Element]bool, limit)
+		for round := 0; len(selected) < limit; round++ {
+			for _, elements := range senders {
+				if round < len(elements) {
+					selected[elements[round]] = true
+					if len(selected) == limit {
+						break
+					}
+				}
+			}
+		}
 	}
-	i := 0
+
+	// make sure the selection is valid on its own
+	imbalanceCache := NewImbalanceCache(t.imbalanceCache.ledger)
+	txs := make([]*Representation, 0, limit)
 	for e := t.txQueue.Front(); e != nil; e = e.Next() {
-		txs[i] = e.Value.(*Representation)
-		i++
-		if i == limit {
-			break
+		if !selected[e] {
+			continue
+		}
+		tx := e.Value.(*Representation)
+		ok, err := imbalanceCache.Apply(tx)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			txs = append(txs, tx)
+		}
+	}
+	return txs, nil
+}
+
+// Select up to limit representations by round as getFair does except each one moves up a round for
+// every aging interval it's been queued. Those in the same round are taken in FIFO order
+func (t *RepresentationQueueMemory) selectAged(senders [][]*list.Element, limit int) map[*list.Element]bool {
+	// each representation's round after aging
+	rounds := make(map[*list.Element]int, t.txQueue.Len())
+	var maxRound int
+	now := time.Now()
+	for _, elements := range senders {
+		for round, e := range elements {
+			round -= int(now.Sub(t.queuedTime[e]) / t.agingInterval)
+			if round < 0 {
+				round = 0
+			}
+			rounds[e] = round
+			if round > maxRound {
+				maxRound = round
+			}
+		}
+	}
+
+	// bucket them by round in FIFO order and take from the earliest rounds
+	buckets := make([][]*list.Element, maxRound+1)
+	for e := t.txQueue.Front(); e != nil; e = e.Next() {
+		round := rounds[e]
+		buckets[round] = append(buckets[round], e)
+	}
+	selected := make(map[*list.Element]bool, limit)
+	for _, bucket := range buckets {
+		for _, e := range bucket {
+			if len(selected) == limit {
+				return selected
+			}
+			selected[e] = true
+		}
+	}
+	return selected
+}
+
+// GetExpiringSoon returns the queued representations which are valid in the next plot after the
+// given tip height but which will expire, or fall out of their series, within the following
+// "withinHeights" plots. Wallets can be warned to rebroadcast or replace them. They're returned in
+// queue order.
+func (t *RepresentationQueueMemory) GetExpiringSoon(withinHeights int, tipHeight int64) []*Representation {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	nextHeight, lastHeight := tipHeight+1, tipHeight+1+int64(withinHeights)
+	var txs []*Representation
+	for e := t.txQueue.Front(); e != nil; e = e.Next() {
+		tx := e.Value.(*Representation)
+		if !checkRepresentationSeries(tx, nextHeight) || tx.IsExpired(nextHeight) {
+			// already invalid
+			continue
+		}
+		if !checkRepresentationSeries(tx, lastHeight) || tx.IsExpired(lastHeight) {
+			txs = append(txs, tx)
 		}
 	}
 	return txs
@@ -192,3 +766,72 @@ func (t *RepresentationQueueMemory) Len() int {
 	defer t.lock.RUnlock()
 	return t.txQueue.Len()
 }
+
+// VerifyCacheConsistency recomputes the imbalances the queue's cache should hold by applying every
+// queued representation in order to the imbalances in the given ledger and compares them with the
+// cache. It returns an error describing any discrepancies. It's a read-only maintenance check. The
+// cache is only expected to be consistent once plots are connected and the queue is reprocessed,
+// not between an AddBatch or a RemoveBatch with more plots to come and the next reprocessing.
+func (t *RepresentationQueueMemory) VerifyCacheConsistency(ledger Ledger) error {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	expected := NewImbalanceCache(ledger)
+	for e := t.txQueue.Front(); e != nil; e = e.Next() {
+		tx := e.Value.(*Representation)
+		ok, err := expected.Apply(tx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			id, err := tx.ID()
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("Queued representation %s sender %s has insufficient imbalance",
+				id, base64.StdEncoding.EncodeToString(tx.From[:]))
+		}
+	}
+
+	var discrepancies []string
+	cached := t.imbalanceCache.Imbalances()
+	for pk, imbalance := range expected.Imbalances() {
+		cachedImbalance, ok := cached[pk]
+		if !ok {
+			discrepancies = append(discrepancies, fmt.Sprintf("%s: missing, expected %d",
+				base64.StdEncoding.EncodeToString(pk[:]), imbalance))
+		} else if cachedImbalance != imbalance {
+			discrepancies = append(discrepancies, fmt.Sprintf("%s: cached %d, expected %d",
+				base64.StdEncoding.EncodeToString(pk[:]), cachedImbalance, imbalance))
+		}
+	}
+	for pk, cachedImbalance := range cached {
+		if _, ok := expected.Imbalances()[pk]; !ok {
+			discrepancies = append(discrepancies, fmt.Sprintf("%s: cached %d, not involved in any queued representation",
+				base64.StdEncoding.EncodeToString(pk[:]), cachedImbalance))
+		}
+	}
+	if len(discrepancies) != 0 {
+		sort.Strings(discrepancies)
+		return fmt.Errorf("Imbalance cache is inconsistent for %d public key(s): %s",
+			len(discrepancies), strings.Join(discrepancies, "; "))
+	}
+	return nil
+}
+
+// Return a copy of the representation which shares no memory with the original
+func copyRepresentation(tx *Representation) *Representation {
+	txCopy := *tx
+	txCopy.From = append(ed25519.PublicKey(nil), tx.From...)
+	txCopy.To = append(ed25519.PublicKey(nil), tx.To...)
+	txCopy.Signature = append(Signature(nil), tx.Signature...)
+	if tx.Refers != nil {
+		refers := *tx.Refers
+		txCopy.Refers = &refers
+	}
+	if tx.ContentHash != nil {
+		contentHash := *tx.ContentHash
+		txCopy.ContentHash = &contentHash
+	}
+	return &txCopy
+}
@@ -0,0 +1,1440 @@
+package plotthread
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// testLedger is a minimal Ledger which only tracks public key imbalances, main thread plot heights
+// and representation indices
+type testLedger struct {
+	Ledger
+	imbalances map[[ed25519.PublicKeySize]byte]int64
+	heights    map[int64]PlotID
+	txIndex    map[RepresentationID]PlotID
+	branches   map[PlotID]BranchType
+}
+
+func newTestLedger() *testLedger {
+	return &testLedger{
+		imbalances: make(map[[ed25519.PublicKeySize]byte]int64),
+		heights:    make(map[int64]PlotID),
+		txIndex:    make(map[RepresentationID]PlotID),
+		branches:   make(map[PlotID]BranchType),
+	}
+}
+
+func (l *testLedger) GetBranchType(id PlotID) (BranchType, error) {
+	branchType, ok := l.branches[id]
+	if !ok {
+		return UNKNOWN, nil
+	}
+	return branchType, nil
+}
+
+func (l *testLedger) GetPlotIDForHeight(height int64) (*PlotID, error) {
+	id, ok := l.heights[height]
+	if !ok {
+		return nil, nil
+	}
+	return &id, nil
+}
+
+func (l *testLedger) GetThreadTip() (*PlotID, int64, error) {
+	if len(l.heights) == 0 {
+		return nil, 0, nil
+	}
+	tipHeight := int64(len(l.heights) - 1)
+	tipID := l.heights[tipHeight]
+	return &tipID, tipHeight, nil
+}
+
+func (l *testLedger) Imbalance() (int64, error) {
+	var total int64
+	for _, imbalance := range l.imbalances {
+		total += imbalance
+	}
+	return total, nil
+}
+
+func (l *testLedger) GetRepresentationIndex(id RepresentationID) (*PlotID, int, error) {
+	plotID, ok := l.txIndex[id]
+	if !ok {
+		return nil, 0, nil
+	}
+	return &plotID, 0, nil
+}
+
+func (l *testLedger) setImbalance(pubKey ed25519.PublicKey, imbalance int64) {
+	var pk [ed25519.PublicKeySize]byte
+	copy(pk[:], pubKey)
+	l.imbalances[pk] = imbalance
+}
+
+func (l *testLedger) GetPublicKeyImbalance(pubKey ed25519.PublicKey) (int64, error) {
+	var pk [ed25519.PublicKeySize]byte
+	copy(pk[:], pubKey)
+	return l.imbalances[pk], nil
+}
+
+// makeTestQueue fills a queue with a mix of valid, expired, immature and underfunded representations
+func makeTestQueue(t testing.TB, ledger *testLedger, n int) *RepresentationQueueMemory {
+	// create some senders. only half of them are funded
+	var senders []ed25519.PublicKey
+	var privKeys []ed25519.PrivateKey
+	for i := 0; i < 8; i++ {
+		pubKey, privKey, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 {
+			ledger.setImbalance(pubKey, int64(n/8))
+		}
+		senders, privKeys = append(senders, pubKey), append(privKeys, privKey)
+	}
+
+	// create a recipient
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add directly to the underlying queue so the imbalance check in Add doesn't filter anything
+	queue := NewRepresentationQueueMemory(ledger)
+	for i := 0; i < n; i++ {
+		var matures, expires int64
+		switch i % 5 {
+		case 1:
+			expires = 5
+		case 2:
+			matures = 20
+		}
+		tx := NewRepresentation(senders[i%len(senders)], recipient, matures, expires, 0, "")
+		if err := tx.Sign(privKeys[i%len(privKeys)]); err != nil {
+			t.Fatal(err)
+		}
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		queue.txMap[id] = queue.txQueue.PushBack(tx)
+	}
+	return queue
+}
+
+// reprocessQueueCopy is the original implementation of reprocessQueue which copies the queue first
+func reprocessQueueCopy(t *RepresentationQueueMemory, height int64) error {
+	t.imbalanceCache.Reset()
+	tmpQueue := list.New()
+	tmpQueue.PushBackList(t.txQueue)
+	for e := tmpQueue.Front(); e != nil; e = e.Next() {
+		tx := e.Value.(*Representation)
+		ok := checkRepresentationSeries(tx, height+1) && tx.IsMature(height+1) && !tx.IsExpired(height+1)
+		if ok {
+			var err error
+			ok, err = t.imbalanceCache.Apply(tx)
+			if err != nil {
+				return err
+			}
+		}
+		if !ok {
+			id, err := tx.ID()
+			if err != nil {
+				return err
+			}
+			t.txQueue.Remove(t.txMap[id])
+			delete(t.txMap, id)
+		}
+	}
+	return nil
+}
+
+func queueIDs(t *testing.T, queue *RepresentationQueueMemory) []RepresentationID {
+	var ids []RepresentationID
+	for _, tx := range queue.GetAll() {
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestReprocessQueue(t *testing.T) {
+	ledger := newTestLedger()
+	queue := makeTestQueue(t, ledger, 200)
+
+	// make an identical copy of the queue to process with the original implementation
+	queue2 := NewRepresentationQueueMemory(ledger)
+	for e := queue.txQueue.Front(); e != nil; e = e.Next() {
+		tx := e.Value.(*Representation)
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		queue2.txMap[id] = queue2.txQueue.PushBack(tx)
+	}
+
+	for _, height := range []int64{10, 30} {
+		if err := queue.reprocessQueue(height); err != nil {
+			t.Fatal(err)
+		}
+		if err := reprocessQueueCopy(queue2, height); err != nil {
+			t.Fatal(err)
+		}
+
+		ids, ids2 := queueIDs(t, queue), queueIDs(t, queue2)
+		if len(ids) != len(ids2) {
+			t.Fatalf("Expected %d representations in the queue at height %d, found %d",
+				len(ids2), height, len(ids))
+		}
+		for i := range ids {
+			if ids[i] != ids2[i] {
+				t.Fatalf("Representation mismatch at index %d at height %d", i, height)
+			}
+		}
+		if len(queue.txMap) != queue.txQueue.Len() {
+			t.Fatalf("Expected map length %d, found %d", queue.txQueue.Len(), len(queue.txMap))
+		}
+	}
+
+	// sanity check something was actually dropped but not everything
+	if queue.Len() == 0 || queue.Len() == 200 {
+		t.Fatalf("Unexpected queue length %d", queue.Len())
+	}
+}
+
+func TestQueueSnapshot(t *testing.T) {
+	ledger := newTestLedger()
+
+	// create a funded sender
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger.setImbalance(pubKey, 10)
+
+	// create a recipient
+	pubKey2, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// queue some representations. the second one expires at height 5
+	queue := NewRepresentationQueueMemory(ledger)
+	var ids []RepresentationID
+	for i := 0; i < 4; i++ {
+		var expires int64
+		if i == 1 {
+			expires = 5
+		}
+		tx := NewRepresentation(pubKey, pubKey2, 0, expires, 0, "")
+		if err := tx.Sign(privKey); err != nil {
+			t.Fatal(err)
+		}
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := queue.Add(id, tx); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	var buf bytes.Buffer
+	if err := queue.SaveSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// load it at a height where the second representation has expired
+	queue2 := NewRepresentationQueueMemory(ledger)
+	if err := queue2.LoadSnapshot(&buf, 10); err != nil {
+		t.Fatal(err)
+	}
+	if queue2.Exists(ids[1]) {
+		t.Fatalf("Expected representation %s to be dropped", ids[1])
+	}
+
+	expected := []RepresentationID{ids[0], ids[2], ids[3]}
+	loaded := queueIDs(t, queue2)
+	if len(loaded) != len(expected) {
+		t.Fatalf("Expected %d representations, found %d", len(expected), len(loaded))
+	}
+	for i := range expected {
+		if loaded[i] != expected[i] {
+			t.Fatalf("Representation mismatch at index %d", i)
+		}
+	}
+}
+
+func TestQueueSnapshotSkipsInvalid(t *testing.T) {
+	ledger := newTestLedger()
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger.setImbalance(pubKey, 10)
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := NewRepresentation(pubKey, recipient, 0, 0, 0, "")
+	if err := valid.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	validID, err := valid.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// altered after signing
+	forged := NewRepresentation(pubKey, recipient, 0, 0, 0, "a")
+	if err := forged.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	forged.Memo = "b"
+	// sent to itself
+	self := NewRepresentation(pubKey, pubKey, 0, 0, 0, "")
+	if err := self.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := json.Marshal(queueSnapshot{
+		Version:         QUEUE_SNAPSHOT_VERSION,
+		Representations: []*Representation{forged, valid, self},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := NewRepresentationQueueMemory(ledger)
+	if err := queue.LoadSnapshot(bytes.NewReader(snapshot), 0); err != nil {
+		t.Fatal(err)
+	}
+	if ids := queueIDs(t, queue); len(ids) != 1 || ids[0] != validID {
+		t.Fatalf("Expected only the valid representation to be loaded, found %d", len(ids))
+	}
+}
+
+func TestQueueSnapshotVersion(t *testing.T) {
+	ledger := newTestLedger()
+	queue := makeTestQueue(t, ledger, 16)
+	if err := queue.reprocessQueue(0); err != nil {
+		t.Fatal(err)
+	}
+	ids := queueIDs(t, queue)
+	if len(ids) == 0 {
+		t.Fatal("Expected a non-empty queue")
+	}
+
+	var buf bytes.Buffer
+	if err := queue.SaveSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var snapshot queueSnapshot
+	if err := json.Unmarshal(buf.Bytes(), &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Version != QUEUE_SNAPSHOT_VERSION {
+		t.Fatalf("Expected version %d, found %d", QUEUE_SNAPSHOT_VERSION, snapshot.Version)
+	}
+
+	// the current version round-trips
+	queue2 := NewRepresentationQueueMemory(ledger)
+	if err := queue2.LoadSnapshot(bytes.NewReader(buf.Bytes()), 0); err != nil {
+		t.Fatal(err)
+	}
+	loaded := queueIDs(t, queue2)
+	if len(loaded) != len(ids) {
+		t.Fatalf("Expected %d representations, found %d", len(ids), len(loaded))
+	}
+	for i := range ids {
+		if loaded[i] != ids[i] {
+			t.Fatalf("Representation mismatch at index %d", i)
+		}
+	}
+
+	// a future version is rejected without touching the queue
+	snapshot.Version = QUEUE_SNAPSHOT_VERSION + 1
+	futureBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue3 := NewRepresentationQueueMemory(ledger)
+	if err := queue3.LoadSnapshot(bytes.NewReader(futureBytes), 0); err == nil {
+		t.Fatal("Expected future version to be rejected")
+	}
+	if queue3.Len() != 0 {
+		t.Fatalf("Expected empty queue, found %d", queue3.Len())
+	}
+}
+
+func TestQueueGetLimit(t *testing.T) {
+	ledger := newTestLedger()
+	queue := makeTestQueue(t, ledger, 10)
+	if err := queue.reprocessQueue(0); err != nil {
+		t.Fatal(err)
+	}
+	n := queue.Len()
+	if n == 0 {
+		t.Fatal("Expected a non-empty queue")
+	}
+	all := queue.GetAll()
+	if len(all) != n {
+		t.Fatalf("Expected %d representations from GetAll, found %d", n, len(all))
+	}
+
+	for _, test := range []struct{ limit, expect int }{
+		{-1, 0}, {0, 0}, {1, 1}, {n, n}, {n + 1, n},
+	} {
+		txs := queue.Get(test.limit)
+		if txs == nil {
+			t.Fatalf("Expected a non-nil slice for limit %d", test.limit)
+		}
+		if len(txs) != test.expect {
+			t.Fatalf("Expected %d representations for limit %d, found %d",
+				test.expect, test.limit, len(txs))
+		}
+		for i := range txs {
+			if txs[i] != all[i] {
+				t.Fatalf("Representation mismatch at index %d for limit %d", i, test.limit)
+			}
+		}
+	}
+}
+
+func TestQueueSenderFairness(t *testing.T) {
+	ledger := newTestLedger()
+
+	// create a recipient
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first sender queues 10 representations followed by 2 each from 2 other senders
+	queue := NewRepresentationQueueMemory(ledger)
+	var senders []ed25519.PublicKey
+	for i, count := range []int{10, 2, 2} {
+		pubKey, privKey, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ledger.setImbalance(pubKey, int64(count))
+		senders = append(senders, pubKey)
+		for j := 0; j < count; j++ {
+			tx := NewRepresentation(pubKey, recipient, 0, 0, 0, "")
+			tx.Nonce = int32(i*100 + j)
+			if err := tx.Sign(privKey); err != nil {
+				t.Fatal(err)
+			}
+			id, err := tx.ID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := queue.Add(id, tx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	countSenders := func(txs []*Representation) map[string]int {
+		counts := make(map[string]int)
+		for _, tx := range txs {
+			counts[pubKeyToString(tx.From)]++
+		}
+		return counts
+	}
+
+	// FIFO only sees the first sender
+	txs := queue.Get(6)
+	if counts := countSenders(txs); len(txs) != 6 || len(counts) != 1 {
+		t.Fatalf("Expected 6 representations from 1 sender, found %d from %d", len(txs), len(counts))
+	}
+
+	// fairness spreads the plot across all senders
+	queue.SetSenderFairness(true)
+	txs = queue.Get(6)
+	counts := countSenders(txs)
+	if len(txs) != 6 || len(counts) != 3 {
+		t.Fatalf("Expected 6 representations from 3 senders, found %d from %d", len(txs), len(counts))
+	}
+	for _, sender := range senders {
+		if counts[pubKeyToString(sender)] != 2 {
+			t.Fatalf("Expected 2 representations from each sender, found %d",
+				counts[pubKeyToString(sender)])
+		}
+	}
+
+	// FIFO order is preserved within the selection
+	if !bytes.Equal(txs[0].From, senders[0]) || !bytes.Equal(txs[5].From, senders[2]) {
+		t.Fatal("Expected selection in FIFO order")
+	}
+
+	// GetAll returns everything regardless
+	if len(queue.GetAll()) != 14 {
+		t.Fatalf("Expected 14 representations, found %d", len(queue.GetAll()))
+	}
+}
+
+func TestQueuePriorityAging(t *testing.T) {
+	ledger := newTestLedger()
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first sender queues 4 representations followed by 2 each from 2 other senders
+	queue := NewRepresentationQueueMemory(ledger)
+	queue.SetSenderFairness(true)
+	var senders []ed25519.PublicKey
+	var oldIDs []RepresentationID
+	for i, count := range []int{4, 2, 2} {
+		pubKey, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ledger.setImbalance(pubKey, int64(count))
+		senders = append(senders, pubKey)
+		for j := 0; j < count; j++ {
+			tx := NewRepresentation(pubKey, recipient, 0, 0, 0, "")
+			tx.Nonce = int32(i*100 + j)
+			id, err := tx.ID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := queue.Add(id, tx); err != nil {
+				t.Fatal(err)
+			}
+			if i == 0 {
+				oldIDs = append(oldIDs, id)
+			}
+		}
+	}
+
+	countFirstSender := func(txs []*Representation) int {
+		var count int
+		for _, tx := range txs {
+			if bytes.Equal(tx.From, senders[0]) {
+				count++
+			}
+		}
+		return count
+	}
+
+	// the first sender's representations have waited 3 hours
+	for _, id := range oldIDs {
+		queue.queuedTime[queue.txMap[id]] = time.Now().Add(-3 * time.Hour)
+	}
+
+	// without aging each sender gets 2
+	if count := countFirstSender(queue.Get(6)); count != 2 {
+		t.Fatalf("Expected 2 representations from the first sender, found %d", count)
+	}
+
+	// with aging they've all moved up to the first round and precede the newer ones
+	queue.SetPriorityAging(time.Hour)
+	txs := queue.Get(6)
+	if count := countFirstSender(txs); len(txs) != 6 || count != 4 {
+		t.Fatalf("Expected 4 of 6 representations from the first sender, found %d of %d", count, len(txs))
+	}
+
+	// not long enough to catch up completely
+	queue.SetPriorityAging(2 * time.Hour)
+	if count := countFirstSender(queue.Get(6)); count != 3 {
+		t.Fatalf("Expected 3 representations from the first sender, found %d", count)
+	}
+}
+
+func TestQueueSenderFairnessDependency(t *testing.T) {
+	ledger := newTestLedger()
+
+	// a funds b and b then sends on to c. a has more representations queued after that
+	pubKeyA, privKeyA, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKeyB, privKeyB, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKeyC, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger.setImbalance(pubKeyA, 3)
+
+	queue := NewRepresentationQueueMemory(ledger)
+	queue.SetSenderFairness(true)
+	add := func(from, to ed25519.PublicKey, privKey ed25519.PrivateKey) *Representation {
+		tx := NewRepresentation(from, to, 0, 0, 0, "")
+		if err := tx.Sign(privKey); err != nil {
+			t.Fatal(err)
+		}
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := queue.Add(id, tx); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	add(pubKeyA, pubKeyC, privKeyA)
+	add(pubKeyA, pubKeyB, privKeyA)
+	add(pubKeyB, pubKeyC, privKeyB)
+	add(pubKeyA, pubKeyC, privKeyA)
+
+	// round-robin picks a's first and b's only representation but b isn't funded without a's second
+	txs := queue.Get(2)
+	if len(txs) != 1 || !bytes.Equal(txs[0].From, pubKeyA) {
+		t.Fatalf("Expected only a's first representation, found %d", len(txs))
+	}
+}
+
+func TestQueueAdmissionPolicy(t *testing.T) {
+	ledger := newTestLedger()
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger.setImbalance(pubKey, 10)
+	for height := int64(0); height <= 5; height++ {
+		ledger.heights[height] = PlotID{byte(height)}
+	}
+
+	// the standard policy plus a blocklisted recipient
+	queue := NewRepresentationQueueMemory(ledger)
+	queue.SetAdmissionPolicy(AdmissionPolicies{
+		StandardAdmissionPolicy{},
+		AdmissionPolicyFunc(func(tx *Representation, height int64) error {
+			if bytes.Equal(tx.To, blocked) {
+				return fmt.Errorf("Recipient is blocked")
+			}
+			return nil
+		}),
+	})
+
+	add := func(tx *Representation) (bool, error) {
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return queue.Add(id, tx)
+	}
+
+	ok, err := add(NewRepresentation(pubKey, blocked, 0, 0, 0, ""))
+	if err == nil || !strings.Contains(err.Error(), "Recipient is blocked") || ok {
+		t.Fatalf("Expected blocked recipient to be rejected, found: %v", err)
+	}
+	if ok, err := add(NewRepresentation(pubKey, recipient, 0, 0, 0, "")); err != nil || !ok {
+		t.Fatalf("Expected representation to be queued, err: %v", err)
+	}
+
+	// the standard policy still applies
+	ok, err = add(NewRepresentation(pubKey, recipient, 0, 3, 0, ""))
+	if err == nil || !strings.Contains(err.Error(), "expired") || ok {
+		t.Fatalf("Expected expired representation to be rejected, found: %v", err)
+	}
+	if queue.Len() != 1 {
+		t.Fatalf("Expected 1 queued representation, found %d", queue.Len())
+	}
+
+	// the default policy doesn't block anyone
+	queue.SetAdmissionPolicy(nil)
+	if ok, err := add(NewRepresentation(pubKey, blocked, 0, 0, 0, "")); err != nil || !ok {
+		t.Fatalf("Expected representation to be queued under the default policy, err: %v", err)
+	}
+}
+
+func TestQueueAdmissionTrace(t *testing.T) {
+	ledger := newTestLedger()
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unfunded, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger.setImbalance(pubKey, 10)
+	for height := int64(0); height <= 5; height++ {
+		ledger.heights[height] = PlotID{byte(height)}
+	}
+	queue := NewRepresentationQueueMemory(ledger)
+	queue.SetAdmissionPolicy(StandardAdmissionPolicy{})
+
+	addWithTrace := func(tx *Representation) (bool, *AdmissionTrace, error) {
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return queue.AddWithTrace(id, tx)
+	}
+
+	checkTrace := func(trace *AdmissionTrace, expected []string, failed string) {
+		var names []string
+		for _, check := range trace.Checks {
+			names = append(names, check.Name)
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Fatalf("Expected checks %v, found %v", expected, names)
+		}
+		check := trace.Failed()
+		if failed == "" {
+			if check != nil {
+				t.Fatalf("Expected no failed check, found %s: %s", check.Name, check.Error)
+			}
+			return
+		}
+		if check == nil || check.Name != failed || check.Error == "" {
+			t.Fatalf("Expected %s check to fail, found %+v", failed, check)
+		}
+	}
+
+	tx := NewRepresentation(pubKey, recipient, 0, 0, 0, "")
+	ok, trace, err := addWithTrace(tx)
+	if err != nil || !ok {
+		t.Fatalf("Expected representation to be queued, err: %v", err)
+	}
+	checkTrace(trace, []string{"duplicate", "series", "maturity", "expiration", "chain depth", "imbalance"}, "")
+	if trace.Height != 6 {
+		t.Fatalf("Expected trace at height 6, found %d", trace.Height)
+	}
+
+	ok, trace, err = addWithTrace(tx)
+	if err != nil || ok {
+		t.Fatalf("Expected duplicate not to be queued, err: %v", err)
+	}
+	checkTrace(trace, []string{"duplicate"}, "duplicate")
+
+	_, trace, err = addWithTrace(NewRepresentation(pubKey, recipient, 0, 3, 0, ""))
+	if err == nil {
+		t.Fatal("Expected expired representation to be rejected")
+	}
+	checkTrace(trace, []string{"duplicate", "series", "maturity", "expiration"}, "expiration")
+
+	_, trace, err = addWithTrace(NewRepresentation(unfunded, recipient, 0, 0, 0, ""))
+	if err == nil {
+		t.Fatal("Expected unfunded representation to be rejected")
+	}
+	checkTrace(trace, []string{"duplicate", "series", "maturity", "expiration", "chain depth", "imbalance"},
+		"imbalance")
+
+	// policies which don't trace their own checks are recorded as one
+	queue.SetAdmissionPolicy(AdmissionPolicyFunc(func(tx *Representation, height int64) error {
+		return fmt.Errorf("Nothing is allowed")
+	}))
+	_, trace, err = addWithTrace(NewRepresentation(pubKey, recipient, 0, 0, 0, ""))
+	if err == nil {
+		t.Fatal("Expected representation to be rejected by the policy")
+	}
+	checkTrace(trace, []string{"duplicate", "policy"}, "policy")
+
+	// without a policy only the queue's own checks are made
+	queue.SetAdmissionPolicy(nil)
+	_, trace, err = addWithTrace(NewRepresentation(pubKey, recipient, 0, 0, 0, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTrace(trace, []string{"duplicate", "chain depth", "imbalance"}, "")
+}
+
+func TestQueueConcurrentGet(t *testing.T) {
+	ledger := newTestLedger()
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger.setImbalance(pubKey, 1000)
+	queue := NewRepresentationQueueMemory(ledger)
+
+	// the queue owns its own copy
+	tx := NewRepresentation(pubKey, recipient, 0, 0, 0, "original")
+	id, err := tx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Add(id, tx); err != nil {
+		t.Fatal(err)
+	}
+	tx.Memo = "modified"
+	tx.To[0]++
+	queued := queue.Get(1)[0]
+	queuedID, err := queued.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued.Memo != "original" || queuedID != id {
+		t.Fatal("Expected queued representation to be unaffected by changes to the original")
+	}
+	if err := queue.RemoveBatch([]RepresentationID{id}, 0, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// add and remove while reading. run with -race
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			tx := NewRepresentation(pubKey, recipient, 0, 0, 0, "")
+			tx.Nonce = int32(i)
+			id, err := tx.ID()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := queue.Add(id, tx); err != nil {
+				t.Error(err)
+				return
+			}
+			// mutating the caller's copy must not race with readers
+			tx.Memo = "modified"
+			if i%2 == 1 {
+				if err := queue.RemoveBatch([]RepresentationID{id}, 0, true); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			if queue.Len() != 50 {
+				t.Fatalf("Expected 50 queued representations, found %d", queue.Len())
+			}
+			return
+		default:
+		}
+		for _, tx := range queue.Get(10) {
+			if tx.Memo != "" || len(tx.From) != ed25519.PublicKeySize {
+				t.Fatal("Observed a modified queued representation")
+			}
+		}
+	}
+}
+
+func TestQueueDropUnconfirmed(t *testing.T) {
+	ledger := newTestLedger()
+	var senders []ed25519.PublicKey
+	for i := 0; i < 3; i++ {
+		pubKey, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		senders = append(senders, pubKey)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := NewRepresentationQueueMemory(ledger)
+	dropped := make(map[RepresentationID]string)
+	queue.OnDropUnconfirmed(func(id RepresentationID, reason string) {
+		dropped[id] = reason
+	})
+
+	// a representation which was only ever queued is dropped without notification
+	ledger.setImbalance(senders[2], 1)
+	queuedTx := NewRepresentation(senders[2], recipient, 0, 0, 0, "")
+	queuedID, err := queuedTx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Add(queuedID, queuedTx); err != nil {
+		t.Fatal(err)
+	}
+	ledger.setImbalance(senders[2], 0)
+
+	// a plot confirming 2 representations at height 2 is disconnected. the first sender's
+	// imbalance came from a plot on the same branch and the second's representation expires
+	tx1 := NewRepresentation(senders[0], recipient, 0, 0, 0, "")
+	tx2 := NewRepresentation(senders[1], recipient, 0, 3, 0, "")
+	id1, err := tx1.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := tx2.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger.setImbalance(senders[1], 1)
+	if err := queue.AddBatch([]RepresentationID{id1, id2}, []*Representation{tx1, tx2}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new branch connects 2 plots without them
+	if err := queue.RemoveBatch(nil, 2, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.RemoveBatch(nil, 3, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if queue.Len() != 0 {
+		t.Fatalf("Expected an empty queue, found %d", queue.Len())
+	}
+	if len(dropped) != 2 {
+		t.Fatalf("Expected 2 notifications, found %d", len(dropped))
+	}
+	if dropped[id1] != "insufficient imbalance" {
+		t.Fatalf("Expected insufficient imbalance, found: %s", dropped[id1])
+	}
+	if dropped[id2] != "expired" {
+		t.Fatalf("Expected expired, found: %s", dropped[id2])
+	}
+}
+
+func TestQueueEvict(t *testing.T) {
+	ledger := newTestLedger()
+	var senders []ed25519.PublicKey
+	for i := 0; i < 3; i++ {
+		pubKey, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ledger.setImbalance(pubKey, 1)
+		senders = append(senders, pubKey)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := NewRepresentationQueueMemory(ledger)
+	evicted := make(map[RepresentationID]string)
+	queue.OnEvict(func(id RepresentationID, reason string) {
+		// the queue isn't locked
+		if queue.Exists(id) {
+			t.Errorf("Expected %s to be evicted before notification", id)
+		}
+		evicted[id] = reason
+	})
+
+	var ids []RepresentationID
+	for i, expires := range []int64{2, 0, 0} {
+		tx := NewRepresentation(senders[i], recipient, 0, expires, 0, "")
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := queue.Add(id, tx); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	// the first expires and the second sender's imbalance is spent elsewhere
+	ledger.setImbalance(senders[1], 0)
+	if err := queue.RemoveBatch(nil, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(evicted) != 2 {
+		t.Fatalf("Expected 2 evictions, found %d", len(evicted))
+	}
+	if evicted[ids[0]] != "expired" {
+		t.Fatalf("Expected expired, found: %s", evicted[ids[0]])
+	}
+	if evicted[ids[1]] != "insufficient imbalance" {
+		t.Fatalf("Expected insufficient imbalance, found: %s", evicted[ids[1]])
+	}
+	if !queue.Exists(ids[2]) {
+		t.Fatal("Expected the third representation to remain queued")
+	}
+}
+
+func TestQueueRequeueWindow(t *testing.T) {
+	ledger := newTestLedger()
+	var senders []ed25519.PublicKey
+	for i := 0; i < 3; i++ {
+		pubKey, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ledger.setImbalance(pubKey, 1)
+		senders = append(senders, pubKey)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var txs []*Representation
+	var ids []RepresentationID
+	for _, sender := range senders {
+		tx := NewRepresentation(sender, recipient, 0, 0, 0, "")
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+		ids = append(ids, id)
+	}
+
+	for _, window := range []time.Duration{0, time.Minute} {
+		queue := NewRepresentationQueueMemory(ledger)
+		queue.SetRequeueWindow(window)
+
+		// the first is queued and then evicted when its sender briefly lacks the imbalance
+		if _, err := queue.Add(ids[0], txs[0]); err != nil {
+			t.Fatal(err)
+		}
+		ledger.setImbalance(senders[0], 0)
+		if err := queue.RemoveBatch(nil, 0, false); err != nil {
+			t.Fatal(err)
+		}
+		ledger.setImbalance(senders[0], 1)
+
+		// newer ones are queued and then it's pushed again
+		for i := 1; i < len(txs); i++ {
+			if _, err := queue.Add(ids[i], txs[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := queue.Add(ids[0], txs[0]); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []RepresentationID{ids[1], ids[2], ids[0]}
+		if window != 0 {
+			// it's regained its place
+			expected = []RepresentationID{ids[0], ids[1], ids[2]}
+		}
+		for i, tx := range queue.GetAll() {
+			id, err := tx.ID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != expected[i] {
+				t.Fatalf("Window %s: unexpected representation at position %d", window, i)
+			}
+		}
+	}
+
+	// evictions outside of the window are forgotten on the next eviction
+	queue := NewRepresentationQueueMemory(ledger)
+	queue.SetRequeueWindow(time.Minute)
+	queue.rememberDropped(ids[0], time.Now())
+	queue.dropped[ids[0]].Value = droppedRepresentation{id: ids[0], dropped: time.Now().Add(-time.Hour)}
+	queue.rememberDropped(ids[1], time.Now())
+	if _, ok := queue.dropped[ids[0]]; ok || len(queue.dropped) != 1 || queue.droppedOrder.Len() != 1 {
+		t.Fatalf("Expected only the recent eviction to be remembered, found %d", len(queue.dropped))
+	}
+}
+
+func TestQueueChain(t *testing.T) {
+	ledger := newTestLedger()
+	var keys []ed25519.PublicKey
+	for i := 0; i < 4; i++ {
+		pubKey, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, pubKey)
+	}
+	// only the first key has a confirmed imbalance
+	ledger.setImbalance(keys[0], 1)
+
+	// each representation spends what the previous one sent. the middle one expires
+	var txs []*Representation
+	var ids []RepresentationID
+	for i, expires := range []int64{0, 1, 0} {
+		tx := NewRepresentation(keys[i], keys[i+1], 0, expires, 0, "")
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+		ids = append(ids, id)
+	}
+
+	// a 3-deep chain is accepted in order
+	queue := NewRepresentationQueueMemory(ledger)
+	for i := range txs {
+		if _, err := queue.Add(ids[i], txs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, tx := range queue.Get(len(txs)) {
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != ids[i] {
+			t.Fatalf("Expected representation %d to precede what depends on it", i)
+		}
+	}
+
+	// once the middle one expires the last can't be funded
+	if err := queue.RemoveBatch(nil, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if !queue.Exists(ids[0]) || queue.Exists(ids[1]) || queue.Exists(ids[2]) {
+		t.Fatal("Expected only the first representation to remain queued")
+	}
+
+	// without the middle one the last is rejected
+	queue = NewRepresentationQueueMemory(ledger)
+	if _, err := queue.Add(ids[0], txs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Add(ids[2], txs[2]); err == nil {
+		t.Fatal("Expected insufficient imbalance")
+	}
+
+	// chains are limited in depth
+	queue = NewRepresentationQueueMemory(ledger)
+	queue.maxChainDepth = 2
+	for i := 0; i < 2; i++ {
+		if _, err := queue.Add(ids[i], txs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := queue.Add(ids[2], txs[2])
+	if err == nil || !strings.Contains(err.Error(), "chain") {
+		t.Fatalf("Expected the chain to be too deep, found: %v", err)
+	}
+}
+
+func TestQueueCongestion(t *testing.T) {
+	curve := CongestionCurve{Capacity: 10, Knee: 0.5, MaxPerSender: 5, MinPerSender: 1}
+
+	// the limit falls as the queue grows
+	last := curve.SenderLimit(0)
+	if last != curve.MaxPerSender {
+		t.Fatalf("Expected limit %d when empty, found %d", curve.MaxPerSender, last)
+	}
+	for length := 1; length <= curve.Capacity+1; length++ {
+		limit := curve.SenderLimit(length)
+		if limit > last {
+			t.Fatalf("Expected limit to fall as the queue grows, found %d at length %d after %d",
+				limit, length, last)
+		}
+		last = limit
+	}
+	if last != curve.MinPerSender {
+		t.Fatalf("Expected limit %d when full, found %d", curve.MinPerSender, last)
+	}
+
+	ledger := newTestLedger()
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newFundedRepresentation := func() (RepresentationID, *Representation) {
+		pubKey, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ledger.setImbalance(pubKey, 2)
+		tx := NewRepresentation(pubKey, recipient, 0, 0, 0, "")
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id, tx
+	}
+
+	// a sender's second representation
+	id1, tx1 := newFundedRepresentation()
+	tx2 := NewRepresentation(tx1.From, recipient, 0, 0, 0, "")
+	id2, err := tx2.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// is accepted when the queue is empty
+	queue := NewRepresentationQueueMemory(ledger)
+	queue.SetCongestionCurve(&curve)
+	if _, err := queue.Add(id1, tx1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Add(id2, tx2); err != nil {
+		t.Fatal(err)
+	}
+
+	// and rejected when it's full
+	queue = NewRepresentationQueueMemory(ledger)
+	queue.SetCongestionCurve(&curve)
+	for i := 0; i < curve.Capacity; i++ {
+		id, tx := newFundedRepresentation()
+		if _, err := queue.Add(id, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if limit := queue.SenderLimit(); limit != curve.MinPerSender {
+		t.Fatalf("Expected limit %d, found %d", curve.MinPerSender, limit)
+	}
+	if _, err := queue.Add(id1, tx1); err != nil {
+		t.Fatal(err)
+	}
+	_, err = queue.Add(id2, tx2)
+	if err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Fatalf("Expected the sender to be over the limit, found: %v", err)
+	}
+
+	// without a curve there's no limit
+	queue.SetCongestionCurve(nil)
+	if limit := queue.SenderLimit(); limit != 0 {
+		t.Fatalf("Expected no limit, found %d", limit)
+	}
+	if _, err := queue.Add(id2, tx2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueueVerifyCacheConsistency(t *testing.T) {
+	ledger := newTestLedger()
+	var keys []ed25519.PublicKey
+	for i := 0; i < 3; i++ {
+		pubKey, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, pubKey)
+	}
+	ledger.setImbalance(keys[0], 2)
+
+	// keys[0] -> keys[1] twice and keys[1] -> keys[2] spending one of them
+	queue := NewRepresentationQueueMemory(ledger)
+	for _, pair := range [][2]int{{0, 1}, {0, 1}, {1, 2}} {
+		tx := NewRepresentation(keys[pair[0]], keys[pair[1]], 0, 0, 0, "")
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := queue.Add(id, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := queue.VerifyCacheConsistency(ledger); err != nil {
+		t.Fatal(err)
+	}
+
+	// still consistent after reprocessing
+	if err := queue.RemoveBatch(nil, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.VerifyCacheConsistency(ledger); err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupt the cache
+	var pk [ed25519.PublicKeySize]byte
+	copy(pk[:], keys[1])
+	queue.imbalanceCache.cache[pk]++
+	err := queue.VerifyCacheConsistency(ledger)
+	if err == nil || !strings.Contains(err.Error(), pubKeyToString(keys[1])) {
+		t.Fatalf("Expected an inconsistency for %s, found: %v", pubKeyToString(keys[1]), err)
+	}
+
+	// lose an entry
+	queue.imbalanceCache.cache[pk]--
+	copy(pk[:], keys[2])
+	delete(queue.imbalanceCache.cache, pk)
+	err = queue.VerifyCacheConsistency(ledger)
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("Expected a missing entry, found: %v", err)
+	}
+}
+
+func TestQueueGetExpiringSoon(t *testing.T) {
+	ledger := newTestLedger()
+	sender, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the tip is 5 plots before a new series
+	tipHeight := int64(2*PLOTS_UNTIL_NEW_SERIES - 5)
+
+	// add directly to the underlying queue. the memos identify them
+	queue := NewRepresentationQueueMemory(ledger)
+	add := func(expires, height int64, memo string) {
+		tx := NewRepresentation(sender, recipient, 0, expires, height, memo)
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		queue.txMap[id] = queue.txQueue.PushBack(tx)
+	}
+	add(0, tipHeight, "never")
+	add(tipHeight-1, tipHeight, "expired")
+	add(tipHeight+1, tipHeight, "next")
+	add(tipHeight+3, tipHeight, "soon")
+	add(tipHeight+30, tipHeight, "later")
+	add(0, PLOTS_UNTIL_NEW_SERIES-1, "old series")
+
+	memos := func(txs []*Representation) []string {
+		var memos []string
+		for _, tx := range txs {
+			memos = append(memos, tx.Memo)
+		}
+		return memos
+	}
+
+	if txs := memos(queue.GetExpiringSoon(3, tipHeight)); !reflect.DeepEqual(txs, []string{"next", "soon"}) {
+		t.Fatalf("Expected next and soon, found: %v", txs)
+	}
+
+	// the previous series falls out of the grace period
+	expected := []string{"next", "soon", "old series"}
+	if txs := memos(queue.GetExpiringSoon(10, tipHeight)); !reflect.DeepEqual(txs, expected) {
+		t.Fatalf("Expected %v, found: %v", expected, txs)
+	}
+
+	if txs := queue.GetExpiringSoon(0, tipHeight); len(txs) != 0 {
+		t.Fatalf("Expected nothing, found: %v", memos(txs))
+	}
+}
+
+// testQueueMetrics records the events a queue emits
+type testQueueMetrics struct {
+	events []string
+	length int
+}
+
+func (m *testQueueMetrics) Added(source string, count int) {
+	m.events = append(m.events, fmt.Sprintf("added %s %d", source, count))
+}
+
+func (m *testQueueMetrics) Removed(count int) {
+	m.events = append(m.events, fmt.Sprintf("removed %d", count))
+}
+
+func (m *testQueueMetrics) Evicted(reason string) {
+	m.events = append(m.events, "evicted "+reason)
+}
+
+func (m *testQueueMetrics) Reprocessed() {
+	m.events = append(m.events, "reprocessed")
+}
+
+func (m *testQueueMetrics) SetLength(length int) {
+	m.length = length
+}
+
+func TestQueueMetrics(t *testing.T) {
+	ledger := newTestLedger()
+	var senders []ed25519.PublicKey
+	for i := 0; i < 3; i++ {
+		pubKey, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ledger.setImbalance(pubKey, 1)
+		senders = append(senders, pubKey)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := NewRepresentationQueueMemory(ledger)
+	metrics := &testQueueMetrics{}
+	queue.SetMetrics(metrics)
+
+	var ids []RepresentationID
+	var txs []*Representation
+	for i, expires := range []int64{0, 2, 0} {
+		tx := NewRepresentation(senders[i], recipient, 0, expires, 0, "")
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := queue.Add(id, tx); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		txs = append(txs, tx)
+	}
+	if metrics.length != 3 {
+		t.Fatalf("Expected length 3, found %d", metrics.length)
+	}
+
+	// the first is confirmed and the second expires
+	if err := queue.RemoveBatch(ids[:1], 2, false); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.length != 1 {
+		t.Fatalf("Expected length 1, found %d", metrics.length)
+	}
+
+	// the confirming plot is disconnected
+	if err := queue.AddBatch(ids[:1], txs[:1], 1); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.length != 2 {
+		t.Fatalf("Expected length 2, found %d", metrics.length)
+	}
+
+	expected := []string{
+		"added add 1",
+		"added add 1",
+		"added add 1",
+		"removed 1",
+		"reprocessed",
+		"evicted expired",
+		"added batch 1",
+	}
+	if strings.Join(metrics.events, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("Unexpected events: %s", strings.Join(metrics.events, ", "))
+	}
+
+	// the default discards everything
+	queue.SetMetrics(nil)
+	if err := queue.RemoveBatch(ids[:1], 2, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics.events) != len(expected) {
+		t.Fatal("Expected no events after the metrics were unset")
+	}
+}
+
+func BenchmarkReprocessQueue(b *testing.B) {
+	ledger := newTestLedger()
+	queue := makeTestQueue(b, ledger, 10000)
+	// process once up front so every iteration sees the same queue
+	if err := queue.reprocessQueue(0); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := queue.reprocessQueue(0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
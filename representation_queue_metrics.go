@@ -0,0 +1,31 @@
+package plotthread
+
+// RepresentationQueueMetrics receives statistics from a RepresentationQueueMemory, e.g. to export them
+// via expvar or Prometheus. Its methods are called with the queue locked so they must be cheap and
+// must not call back into the queue.
+type RepresentationQueueMetrics interface {
+	// Added counts representations added to the queue. "source" is one of "add", "batch" or "snapshot".
+	Added(source string, count int)
+
+	// Removed counts representations removed from the queue because they were confirmed.
+	Removed(count int)
+
+	// Evicted counts a representation evicted from the queue because it's no longer valid.
+	// "reason" is why, e.g. "expired".
+	Evicted(reason string)
+
+	// Reprocessed counts a revalidation of the entire queue.
+	Reprocessed()
+
+	// SetLength sets the current queue length.
+	SetLength(length int)
+}
+
+// A RepresentationQueueMetrics implementation which discards everything
+type noopQueueMetrics struct{}
+
+func (noopQueueMetrics) Added(source string, count int) {}
+func (noopQueueMetrics) Removed(count int)              {}
+func (noopQueueMetrics) Evicted(reason string)          {}
+func (noopQueueMetrics) Reprocessed()                   {}
+func (noopQueueMetrics) SetLength(length int)           {}
@@ -0,0 +1,117 @@
+package plotthread
+
+import "fmt"
+
+// AdmissionPolicy decides whether a representation may enter a RepresentationQueueMemory.
+// "height" is the height of the next plot it could be included in. Accept is called with the queue
+// locked so it must be cheap and must not call back into the queue. The sender's imbalance is
+// always checked by the queue after the policy accepts.
+type AdmissionPolicy interface {
+	Accept(tx *Representation, height int64) error
+}
+
+// AdmissionPolicyFunc adapts an ordinary function to the AdmissionPolicy interface.
+type AdmissionPolicyFunc func(tx *Representation, height int64) error
+
+// Accept implements the AdmissionPolicy interface.
+func (f AdmissionPolicyFunc) Accept(tx *Representation, height int64) error {
+	return f(tx, height)
+}
+
+// AdmissionPolicies composes policies. A representation is accepted only if each accepts it in turn.
+type AdmissionPolicies []AdmissionPolicy
+
+// Accept implements the AdmissionPolicy interface.
+func (policies AdmissionPolicies) Accept(tx *Representation, height int64) error {
+	return policies.acceptTraced(tx, height, nil)
+}
+
+func (policies AdmissionPolicies) acceptTraced(tx *Representation, height int64, trace *AdmissionTrace) error {
+	for _, policy := range policies {
+		if err := acceptTraced(policy, tx, height, trace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StandardAdmissionPolicy accepts representations whose series is current and which are mature and
+// unexpired at the given height. The processor already makes these checks before queueing so the
+// queue doesn't consult it by default. Embedders queueing representations directly may compose
+// their own rules with it.
+type StandardAdmissionPolicy struct{}
+
+// Accept implements the AdmissionPolicy interface.
+func (p StandardAdmissionPolicy) Accept(tx *Representation, height int64) error {
+	return p.acceptTraced(tx, height, nil)
+}
+
+func (StandardAdmissionPolicy) acceptTraced(tx *Representation, height int64, trace *AdmissionTrace) error {
+	var err error
+	if !checkRepresentationSeries(tx, height) {
+		err = fmt.Errorf("Representation would have invalid series %d at height %d", tx.Series, height)
+	}
+	if err := trace.record("series", err); err != nil {
+		return err
+	}
+	if !tx.IsMature(height) {
+		err = fmt.Errorf("Representation would not be mature at height %d, matures: %d", height, tx.Matures)
+	}
+	if err := trace.record("maturity", err); err != nil {
+		return err
+	}
+	if tx.IsExpired(height) {
+		err = fmt.Errorf("Representation would be expired at height %d, expires: %d", height, tx.Expires)
+	}
+	return trace.record("expiration", err)
+}
+
+// AdmissionTrace records each check RepresentationQueueMemory.AddWithTrace made and its outcome in
+// order. Checks stop at the first failure. Signatures aren't among them as the processor verifies
+// them before representations are queued.
+type AdmissionTrace struct {
+	ID     RepresentationID `json:"id"`
+	Height int64            `json:"height"` // height of the next plot
+	Checks []AdmissionCheck `json:"checks"`
+}
+
+// AdmissionCheck is the outcome of a single check in an AdmissionTrace.
+type AdmissionCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Failed returns the check which rejected the representation or nil if none did.
+func (tr *AdmissionTrace) Failed() *AdmissionCheck {
+	if tr == nil || len(tr.Checks) == 0 || tr.Checks[len(tr.Checks)-1].Passed {
+		return nil
+	}
+	return &tr.Checks[len(tr.Checks)-1]
+}
+
+// Record the outcome of a check and return its error. A nil trace records nothing
+func (tr *AdmissionTrace) record(name string, err error) error {
+	if tr == nil {
+		return err
+	}
+	check := AdmissionCheck{Name: name, Passed: err == nil}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	tr.Checks = append(tr.Checks, check)
+	return err
+}
+
+// Implemented by policies which record their individual checks
+type tracedAdmissionPolicy interface {
+	acceptTraced(tx *Representation, height int64, trace *AdmissionTrace) error
+}
+
+// Consult the policy. Policies which don't record their own checks are recorded as a single check
+func acceptTraced(policy AdmissionPolicy, tx *Representation, height int64, trace *AdmissionTrace) error {
+	if traced, ok := policy.(tracedAdmissionPolicy); ok {
+		return traced.acceptTraced(tx, height, trace)
+	}
+	return trace.record("policy", policy.Accept(tx, height))
+}
@@ -3,9 +3,12 @@ package plotthread
 import (
 	"encoding/base64"
 	"encoding/json"
+	"math/rand"
+	"strings"
 	"testing"
 
 	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/sha3"
 )
 
 func TestRepresentation(t *testing.T) {
@@ -53,6 +56,274 @@ func TestRepresentation(t *testing.T) {
 	}
 }
 
+func TestRepresentationEqual(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey2, privKey2, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := NewRepresentation(pubKey, pubKey2, 0, 0, 0, "for lunch")
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// a copy differing only by signature has the same ID
+	txCopy := *tx
+	if err := txCopy.Sign(privKey2); err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Equal(&txCopy) || !txCopy.Equal(tx) {
+		t.Fatal("Expected representations differing only by signature to be equal")
+	}
+
+	// any other difference matters
+	txCopy.Memo = "for dinner"
+	if tx.Equal(&txCopy) {
+		t.Fatal("Expected representations with different memos to differ")
+	}
+
+	var nilTx *Representation
+	if tx.Equal(nil) || nilTx.Equal(tx) || !nilTx.Equal(nil) {
+		t.Fatal("Expected only nil to equal nil")
+	}
+}
+
+func TestSignatureEqual(t *testing.T) {
+	cases := []struct {
+		a, b  Signature
+		equal bool
+	}{
+		{nil, nil, true},
+		{nil, Signature{}, true},
+		{Signature{1, 2, 3}, Signature{1, 2, 3}, true},
+		{Signature{1, 2, 3}, Signature{1, 2, 4}, false},
+		{Signature{1, 2, 3}, Signature{1, 2}, false},
+		{Signature{1}, nil, false},
+	}
+	for i, c := range cases {
+		if c.a.Equal(c.b) != c.equal || c.b.Equal(c.a) != c.equal {
+			t.Fatalf("Case %d: expected equal to be %v", i, c.equal)
+		}
+	}
+}
+
+func TestRepresentationExternalSignature(t *testing.T) {
+	// create a sender
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create a recipient
+	pubKey2, privKey2, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create the unsigned representation
+	tx := NewRepresentation(pubKey, pubKey2, 0, 0, 0, "for lunch")
+
+	// sign the hash externally
+	hash, err := tx.SigningHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := ed25519.Sign(privKey, hash[:])
+
+	// a signature from the wrong key should be rejected
+	if err := tx.ApplySignature(ed25519.Sign(privKey2, hash[:])); err == nil {
+		t.Fatal("Expected wrong key signature to be rejected")
+	}
+	if tx.Signature != nil {
+		t.Fatal("Expected no signature to be attached")
+	}
+
+	// attach the valid signature
+	if err := tx.ApplySignature(sig); err != nil {
+		t.Fatal(err)
+	}
+
+	// verify the representation
+	ok, err := tx.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Errorf("Verification failed")
+	}
+
+	// the hash shouldn't depend on the signature
+	hash2, err := tx.SigningHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != hash2 {
+		t.Fatal("Signing hash changed after signing")
+	}
+}
+
+func TestRepresentationRefers(t *testing.T) {
+	// create a sender
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create a recipient
+	pubKey2, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create and confirm the original representation
+	tx := NewRepresentation(pubKey, pubKey2, 0, 0, 0, "hello")
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	txID, err := tx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plot := &Plot{Header: &PlotHeader{Height: 1}, Representations: []*Representation{tx}}
+	plotStore := newTestPlotStore()
+	plotStore.Store(PlotID{1}, plot, 0)
+	ledger := newTestLedger()
+	ledger.txIndex[txID] = PlotID{1}
+
+	// no reference isn't serialized
+	txJson, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(txJson), "refers") {
+		t.Fatalf("Expected no refers field, found: %s", txJson)
+	}
+
+	// the reference is part of the ID
+	reply := NewRepresentation(pubKey, pubKey2, 0, 0, 0, "a reply")
+	replyID, err := reply.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply.Refers = &txID
+	replyID2, err := reply.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replyID == replyID2 {
+		t.Fatal("Expected the reference to change the ID")
+	}
+
+	// it survives a round trip
+	replyJson, err := json.Marshal(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply2 := new(Representation)
+	if err := json.Unmarshal(replyJson, reply2); err != nil {
+		t.Fatal(err)
+	}
+	if reply2.Refers == nil || *reply2.Refers != txID {
+		t.Fatal("Reference lost in round trip")
+	}
+
+	// resolve the reference
+	refersTx, header, err := FindRepresentation(*reply2.Refers, ledger, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refersTx != tx || header.Height != 1 {
+		t.Fatal("Failed to resolve the referenced representation")
+	}
+
+	// an unconfirmed reference resolves to nothing
+	refersTx, _, err = FindRepresentation(replyID2, ledger, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refersTx != nil {
+		t.Fatal("Expected unconfirmed representation not to resolve")
+	}
+}
+
+func TestRepresentationContentHash(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey2, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no content hash isn't serialized
+	tx := NewRepresentation(pubKey, pubKey2, 0, 0, 0, "see attached")
+	txJson, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(txJson), "content_hash") {
+		t.Fatalf("Expected no content_hash field, found: %s", txJson)
+	}
+	txID, err := tx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the content hash is part of the ID
+	contentHash := ContentHash(sha3.Sum256([]byte("off-thread content")))
+	tx.ContentHash = &contentHash
+	txID2, err := tx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txID == txID2 {
+		t.Fatal("Expected the content hash to change the ID")
+	}
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRepresentation(txID2, tx); err != nil {
+		t.Fatal(err)
+	}
+
+	// it survives a round trip
+	txJson, err = json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx2 := new(Representation)
+	if err := json.Unmarshal(txJson, tx2); err != nil {
+		t.Fatal(err)
+	}
+	if tx2.ContentHash == nil || *tx2.ContentHash != contentHash {
+		t.Fatal("Content hash lost in round trip")
+	}
+	if id, err := tx2.ID(); err != nil || id != txID2 {
+		t.Fatalf("Expected the same ID after a round trip, found: %s, %v", id, err)
+	}
+
+	// malformed
+	if err := json.Unmarshal([]byte(`"abcd"`), new(ContentHash)); err == nil {
+		t.Fatal("Expected a short content hash to be rejected")
+	}
+	tx.ContentHash = &ContentHash{}
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	txID3, err := tx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRepresentation(txID3, tx); err == nil {
+		t.Fatal("Expected an empty content hash to be rejected")
+	}
+}
+
 func TestRepresentationTestVector1(t *testing.T) {
 	// create representation for Test Vector 1
 	pubKeyBytes, err := base64.StdEncoding.DecodeString("80tvqyCax0UdXB+TPvAQwre7NxUHhISm/bsEOtbF+yI=")
@@ -143,3 +414,124 @@ func TestRepresentationTestVector1(t *testing.T) {
 		t.Errorf("Expected verification failure")
 	}
 }
+
+func TestNewRepresentationWithRand(t *testing.T) {
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey2, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sources with the same seed produce the same representations
+	rng1, rng2 := rand.New(rand.NewSource(1)), rand.New(rand.NewSource(1))
+	for i := 0; i < 3; i++ {
+		tx1 := NewRepresentationWithRand(rng1, pubKey, pubKey2, 0, 0, 0, "")
+		tx2 := NewRepresentationWithRand(rng2, pubKey, pubKey2, 0, 0, 0, "")
+		tx2.Time = tx1.Time
+		id1, err := tx1.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		id2, err := tx2.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id1 != id2 {
+			t.Fatalf("Expected representation %d to be reproducible, nonces %d and %d", i, tx1.Nonce, tx2.Nonce)
+		}
+	}
+
+	// as do plots
+	tx := NewRepresentationWithRand(rng1, pubKey, pubKey2, 0, 0, 0, "")
+	plot1, err := NewPlotWithRand(rand.New(rand.NewSource(2)), PlotID{}, 0, PlotID{}, PlotID{}, []*Representation{tx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plot2, err := NewPlotWithRand(rand.New(rand.NewSource(2)), PlotID{}, 0, PlotID{}, PlotID{}, []*Representation{tx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plot1.Header.Nonce != plot2.Header.Nonce {
+		t.Fatalf("Expected the same plot nonce, found %d and %d", plot1.Header.Nonce, plot2.Header.Nonce)
+	}
+}
+
+func TestIsCanonicalPublicKey(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// y = 2^255-19 is a non-canonical encoding of y = 0
+	unreduced := make([]byte, ed25519.PublicKeySize)
+	for i := range unreduced {
+		unreduced[i] = 0xff
+	}
+	unreduced[0], unreduced[31] = 0xed, 0x7f
+
+	// y = 1 with x = 0 but the sign bit set
+	negativeZero := make([]byte, ed25519.PublicKeySize)
+	negativeZero[0], negativeZero[31] = 0x01, 0x80
+
+	// y = 1 is the identity. it's canonical with the sign bit clear
+	identity := make([]byte, ed25519.PublicKeySize)
+	identity[0] = 0x01
+
+	// the largest canonical y
+	largest := make([]byte, ed25519.PublicKeySize)
+	copy(largest, unreduced)
+	largest[0] = 0xeb
+	largest[31] = 0xff
+
+	tests := []struct {
+		name      string
+		key       []byte
+		canonical bool
+	}{
+		{"valid", pubKey, true},
+		{"zero", make([]byte, ed25519.PublicKeySize), true},
+		{"identity", identity, true},
+		{"largest", largest, true},
+		{"unreduced", unreduced, false},
+		{"negative zero", negativeZero, false},
+		{"short", pubKey[:31], false},
+	}
+	for _, test := range tests {
+		if IsCanonicalPublicKey(ed25519.PublicKey(test.key)) != test.canonical {
+			t.Fatalf("Expected %s key canonical to be %v", test.name, test.canonical)
+		}
+	}
+
+	// a representation to a non-canonical key is rejected
+	tx := NewRepresentation(pubKey, ed25519.PublicKey(unreduced), 0, 0, 0, "")
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	id, err := tx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkRepresentation(id, tx)
+	if err == nil || !strings.Contains(err.Error(), "Non-canonical representation recipient") {
+		t.Fatalf("Expected non-canonical recipient error, found: %v", err)
+	}
+
+	// a valid recipient is accepted
+	pubKey2, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx = NewRepresentation(pubKey, pubKey2, 0, 0, 0, "")
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	if id, err = tx.ID(); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRepresentation(id, tx); err != nil {
+		t.Fatal(err)
+	}
+}
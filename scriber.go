@@ -2,6 +2,7 @@ package plotthread
 
 import (
 	"encoding/base64"
+	"fmt"
 	"log"
 	"math/big"
 	"math/rand"
@@ -21,6 +22,7 @@ type Scriber struct {
 	processor      *Processor
 	num            int
 	keyIndex       int
+	idleWait       time.Duration // how long to wait for representations before scribing a plotroot-only plot
 	hashUpdateChan chan int64
 	shutdownChan   chan struct{}
 	wg             sync.WaitGroup
@@ -29,6 +31,9 @@ type Scriber struct {
 // HashrateMonitor collects hash counts from all scribers in order to monitor and display the aggregate hashrate.
 type HashrateMonitor struct {
 	hashUpdateChan chan int64
+	window         *hashrateWindow
+	lock           sync.Mutex
+	now            func() time.Time
 	shutdownChan   chan struct{}
 	wg             sync.WaitGroup
 }
@@ -56,10 +61,19 @@ func NewScriber(pubKeys []ed25519.PublicKey, memo string,
 func NewHashrateMonitor(hashUpdateChan chan int64) *HashrateMonitor {
 	return &HashrateMonitor{
 		hashUpdateChan: hashUpdateChan,
+		window:         newHashrateWindow(HASHRATE_WINDOW*time.Second, time.Now()),
+		now:            time.Now,
 		shutdownChan:   make(chan struct{}),
 	}
 }
 
+// SetIdleWait sets how long the scriber waits for at least one representation to confirm before
+// it scribes a plot containing only the plotroot. If zero, the default, it never waits.
+// It must be called before Run.
+func (m *Scriber) SetIdleWait(wait time.Duration) {
+	m.idleWait = wait
+}
+
 // Run executes the scriber's main loop in its own goroutine.
 func (m *Scriber) Run() {
 	m.wg.Add(1)
@@ -113,8 +127,9 @@ func (m *Scriber) run() {
 	defer m.processor.UnregisterForNewRepresentations(newTxChan)
 
 	// main scribing loop
-	var hashes, medianTimestamp int64
+	var hashes, minTime int64
 	var plot *Plot
+	var plotCreated time.Time
 	var targetInt *big.Int
 	for {
 		select {
@@ -134,13 +149,14 @@ func (m *Scriber) run() {
 				// ledger state is broken
 				panic(err)
 			}
+			plotCreated = time.Now()
 			// make sure we're at least +1 the median timestamp
-			medianTimestamp, err = computeMedianTimestamp(tip.Plot.Header, m.plotStore)
+			minTime, err = DefaultThreadParams.MinTime(tip.Plot.Header, m.plotStore)
 			if err != nil {
 				panic(err)
 			}
-			if plot.Header.Time <= medianTimestamp {
-				plot.Header.Time = medianTimestamp + 1
+			if plot.Header.Time < minTime {
+				plot.Header.Time = minTime
 			}
 			// convert our target to a big.Int
 			targetInt = plot.Header.Target.GetBigInt()
@@ -180,7 +196,7 @@ func (m *Scriber) run() {
 			if plot != nil {
 				// update plot time every so often
 				now := time.Now().Unix()
-				if now > medianTimestamp {
+				if now >= minTime {
 					plot.Header.Time = now
 				}
 			}
@@ -197,19 +213,27 @@ func (m *Scriber) run() {
 				if err != nil {
 					panic(err)
 				}
+				plotCreated = time.Now()
 				// make sure we're at least +1 the median timestamp
-				medianTimestamp, err = computeMedianTimestamp(tipHeader, m.plotStore)
+				minTime, err = DefaultThreadParams.MinTime(tipHeader, m.plotStore)
 				if err != nil {
 					panic(err)
 				}
-				if plot.Header.Time <= medianTimestamp {
-					plot.Header.Time = medianTimestamp + 1
+				if plot.Header.Time < minTime {
+					plot.Header.Time = minTime
 				}
 				// convert our target to a big.Int
 				targetInt = plot.Header.Target.GetBigInt()
 			}
 
-			// hash the plot and check the proof-of-work
+			if isIdle(plot, time.Since(plotCreated), m.idleWait) {
+				// nothing to confirm yet. don't spin
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+
+			// hash the plot and check the proof-of-work.
+			// a single attempt may cover many hashes when scribing on a device
 			idInt, attempts := plot.Header.IDFast(m.num)
 			hashes += attempts
 			if idInt.Cmp(targetInt) <= 0 {
@@ -242,6 +266,70 @@ func (m *Scriber) Shutdown() {
 	log.Printf("Scriber %d shutdown\n", m.num)
 }
 
+// DrainToPlot assembles a plot from the current tip and representation queue and scribes it on this
+// goroutine, giving up after timeout. The plot is processed and returned once a solution is found.
+// It's meant for shutting down private and test threads so it refuses targets whose expected work
+// exceeds MAX_DRAIN_PLOT_WORK. It should be called after Shutdown and before the processor shuts down.
+func (m *Scriber) DrainToPlot(timeout time.Duration) (*Plot, error) {
+	deadline := time.Now().Add(timeout)
+
+	tipID, tipHeader, _, err := getThreadTipHeader(m.ledger, m.plotStore)
+	if err != nil {
+		return nil, err
+	}
+	if tipID == nil {
+		return nil, fmt.Errorf("No thread tip to drain representations onto")
+	}
+	plot, err := m.createNextPlot(*tipID, tipHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	// is it practical?
+	work := computePlotWork(plot.Header.Target)
+	if work.Cmp(big.NewInt(MAX_DRAIN_PLOT_WORK)) > 0 {
+		return nil, fmt.Errorf("Expected work %s to drain into a plot exceeds limit %d",
+			work, MAX_DRAIN_PLOT_WORK)
+	}
+
+	// make sure we're at least +1 the median timestamp
+	minTime, err := DefaultThreadParams.MinTime(tipHeader, m.plotStore)
+	if err != nil {
+		return nil, err
+	}
+	if plot.Header.Time < minTime {
+		plot.Header.Time = minTime
+	}
+
+	log.Printf("Scriber %d draining %d representation(s) into a final plot\n",
+		m.num, len(plot.Representations)-1)
+	targetInt := plot.Header.Target.GetBigInt()
+	for {
+		idInt, attempts := plot.Header.IDFast(m.num)
+		if idInt.Cmp(targetInt) <= 0 {
+			// found a solution
+			id := new(PlotID).SetBigInt(idInt)
+			log.Printf("Scriber %d scribed final plot %s\n", m.num, *id)
+			if err := m.processor.ProcessPlot(*id, plot, "localhost"); err != nil {
+				return nil, err
+			}
+			return plot, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("No solution found for the final plot within %s", timeout)
+		}
+		plot.Header.Nonce += attempts
+		if plot.Header.Nonce > MAX_NUMBER {
+			plot.Header.Nonce = 0
+		}
+	}
+}
+
+// Returns true if the plot has nothing but the plotroot and we should keep waiting for representations
+func isIdle(plot *Plot, waited, idleWait time.Duration) bool {
+	return idleWait > 0 && len(plot.Representations) == 1 && waited < idleWait
+}
+
 // Create a new plot off of the given tip plot.
 func (m *Scriber) createNextPlot(tipID PlotID, tipHeader *PlotHeader) (*Plot, error) {
 	log.Printf("Scriber %d scribing new plot from current tip %s\n", m.num, tipID)
@@ -259,6 +347,10 @@ func createNextPlot(tipID PlotID, tipHeader *PlotHeader, txQueue RepresentationQ
 	// calculate total plot reward
 	var newHeight int64 = tipHeader.Height + 1
 
+	// the queue may not have been reprocessed for this height yet.
+	// skip anything the plot would be rejected for
+	txs = filterScribable(txs, newHeight)
+
 	// build plotroot
 	baseKey, _ := base64.StdEncoding.DecodeString("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")
 	//baseKey := ed25519.PublicKey(rootKeyBytes)
@@ -281,6 +373,18 @@ func createNextPlot(tipID PlotID, tipHeader *PlotHeader, txQueue RepresentationQ
 	return plot, nil
 }
 
+// Return the representations which may be scribed in a plot at the given height
+func filterScribable(txs []*Representation, height int64) []*Representation {
+	scribable := make([]*Representation, 0, len(txs))
+	for _, tx := range txs {
+		if !checkRepresentationSeries(tx, height) || !tx.IsMature(height) || tx.IsExpired(height) {
+			continue
+		}
+		scribable = append(scribable, tx)
+	}
+	return scribable
+}
+
 // Run executes the hashrate monitor's main loop in its own goroutine.
 func (h *HashrateMonitor) Run() {
 	h.wg.Add(1)
@@ -290,7 +394,6 @@ func (h *HashrateMonitor) Run() {
 func (h *HashrateMonitor) run() {
 	defer h.wg.Done()
 
-	var totalHashes int64
 	updateInterval := 1 * time.Minute
 	ticker := time.NewTicker(updateInterval)
 	defer ticker.Stop()
@@ -303,15 +406,75 @@ func (h *HashrateMonitor) run() {
 				return
 			}
 		case hashes := <-h.hashUpdateChan:
-			totalHashes += hashes
+			h.addHashes(hashes)
 		case <-ticker.C:
-			hps := float64(totalHashes) / updateInterval.Seconds()
-			totalHashes = 0
-			log.Printf("Hashrate: %.2f MH/s", hps/1000/1000)
+			log.Printf("Hashrate: %.2f MH/s", h.Hashrate()/1000/1000)
 		}
 	}
 }
 
+// Record hashes reported by a scriber
+func (h *HashrateMonitor) addHashes(hashes int64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.window.add(hashes, h.now())
+}
+
+// Hashrate returns the aggregate hashes per second of all scribers over the last HASHRATE_WINDOW seconds.
+func (h *HashrateMonitor) Hashrate() float64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.window.rate(h.now())
+}
+
+// hashrateWindow sums hash counts reported over a rolling window of time.
+type hashrateWindow struct {
+	length  time.Duration
+	start   time.Time // when counting began
+	samples []hashrateSample
+	total   int64
+}
+
+type hashrateSample struct {
+	when   time.Time
+	hashes int64
+}
+
+func newHashrateWindow(length time.Duration, start time.Time) *hashrateWindow {
+	return &hashrateWindow{length: length, start: start}
+}
+
+// Add hashes reported at the given time
+func (w *hashrateWindow) add(hashes int64, now time.Time) {
+	w.samples = append(w.samples, hashrateSample{when: now, hashes: hashes})
+	w.total += hashes
+	w.expire(now)
+}
+
+// Return hashes per second over the window ending now. Until a full window has passed the rate is
+// over the time since counting began
+func (w *hashrateWindow) rate(now time.Time) float64 {
+	w.expire(now)
+	elapsed := now.Sub(w.start)
+	if elapsed > w.length {
+		elapsed = w.length
+	}
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(w.total) / elapsed.Seconds()
+}
+
+// Drop samples which have fallen out of the window
+func (w *hashrateWindow) expire(now time.Time) {
+	var i int
+	for i < len(w.samples) && now.Sub(w.samples[i].when) >= w.length {
+		w.total -= w.samples[i].hashes
+		i++
+	}
+	w.samples = w.samples[i:]
+}
+
 // Shutdown stops the hashrate monitor synchronously.
 func (h *HashrateMonitor) Shutdown() {
 	close(h.shutdownChan)
@@ -0,0 +1,343 @@
+package plotthread
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestScriberIdle(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every ID satisfies this target
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+	ledger := newTestLedger()
+	ledger.setImbalance(pubKey, 1)
+	plotroot := NewRepresentation(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)), pubKey, 0, 0, 0, "")
+	tip, err := NewPlot(PlotID{}, 0, target, PlotID{}, []*Representation{plotroot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tipID, err := tip.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plotStore := newTestPlotStore()
+	plotStore.Store(tipID, tip, 0)
+	ledger.heights[0] = tipID
+
+	// an empty queue yields a plotroot-only plot
+	queue := NewRepresentationQueueMemory(ledger)
+	plot, err := createNextPlot(tipID, tip.Header, queue, plotStore, ledger, pubKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plot.Representations) != 1 || !plot.Representations[0].IsPlotroot() {
+		t.Fatal("Expected a plotroot-only plot")
+	}
+
+	// by default it's scribed right away
+	if isIdle(plot, 0, 0) {
+		t.Fatal("Expected plotroot-only plot to be scribed without an idle wait")
+	}
+
+	// otherwise it waits until the fallback
+	if !isIdle(plot, time.Second, time.Minute) {
+		t.Fatal("Expected plotroot-only plot to wait")
+	}
+	if isIdle(plot, time.Minute, time.Minute) {
+		t.Fatal("Expected plotroot-only plot to be scribed after the idle wait")
+	}
+
+	// or until there's something to confirm
+	tx := NewRepresentation(pubKey, recipient, 0, 0, 1, "")
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	id, err := tx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plot.AddRepresentation(id, tx); err != nil {
+		t.Fatal(err)
+	}
+	if isIdle(plot, time.Second, time.Minute) {
+		t.Fatal("Expected plot with a representation to be scribed")
+	}
+}
+
+func TestCreateNextPlotSkipsUnscribable(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every ID satisfies this target
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+	ledger := newTestLedger()
+	ledger.setImbalance(pubKey, 10)
+	queue := NewRepresentationQueueMemory(ledger)
+
+	// the next plot is the last of the first series
+	height := int64(PLOTS_UNTIL_NEW_SERIES - 1)
+	tipHeader := &PlotHeader{Height: height - 1, Target: target}
+
+	txs := map[string]*Representation{
+		"valid":       NewRepresentation(pubKey, recipient, 0, 0, height, ""),
+		"next series": NewRepresentation(pubKey, recipient, 0, 0, height+1+100, ""),
+		"immature":    NewRepresentation(pubKey, recipient, height-1, 0, height, ""),
+		"expired":     NewRepresentation(pubKey, recipient, 0, height-1, height, ""),
+	}
+	ids := make(map[RepresentationID]string)
+	for name, tx := range txs {
+		if err := tx.Sign(privKey); err != nil {
+			t.Fatal(err)
+		}
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := queue.Add(id, tx); err != nil {
+			t.Fatal(err)
+		}
+		ids[id] = name
+	}
+
+	included := func(plot *Plot) map[string]bool {
+		names := make(map[string]bool)
+		for _, tx := range plot.Representations[1:] {
+			id, err := tx.ID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			names[ids[id]] = true
+		}
+		return names
+	}
+
+	// only the valid representation makes it into this plot
+	plot, err := createNextPlot(PlotID{}, tipHeader, queue, nil, ledger, pubKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := included(plot); len(names) != 1 || !names["valid"] {
+		t.Fatalf("Expected only the valid representation, found: %v", names)
+	}
+	if err := checkPlotRepresentationsContext(plot, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the next series begins with the following plot
+	plotID, err := plot.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plot, err = createNextPlot(plotID, plot.Header, queue, nil, ledger, pubKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := included(plot); len(names) != 2 || !names["valid"] || !names["next series"] {
+		t.Fatalf("Expected the valid and next series representations, found: %v", names)
+	}
+	if err := checkPlotRepresentationsContext(plot, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashrateMonitor(t *testing.T) {
+	start := time.Unix(1000000, 0)
+	now := start
+	h := NewHashrateMonitor(nil)
+	h.window = newHashrateWindow(HASHRATE_WINDOW*time.Second, start)
+	h.now = func() time.Time { return now }
+
+	plot, err := makeTestPlot(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each second a cpu scriber makes 100 attempts and a device scriber 10 attempts of 256 hashes each
+	for i := 0; i < 60; i++ {
+		now = now.Add(time.Second)
+		var cpu, device int64
+		for j := 0; j < 100; j++ {
+			_, attempts := plot.Header.IDFast(0)
+			cpu += attempts
+			plot.Header.Nonce += attempts
+		}
+		for j := 0; j < 10; j++ {
+			device += 256
+		}
+		h.addHashes(cpu)
+		h.addHashes(device)
+	}
+	if rate := h.Hashrate(); rate != 100+10*256 {
+		t.Fatalf("Expected %d hashes per second, found %f", 100+10*256, rate)
+	}
+
+	// the rate is over the full window once it has passed
+	now = start.Add(HASHRATE_WINDOW * time.Second)
+	expected := float64(60*(100+10*256)) / HASHRATE_WINDOW
+	if rate := h.Hashrate(); rate != expected {
+		t.Fatalf("Expected %f hashes per second, found %f", expected, rate)
+	}
+
+	// and older counts drop out of it
+	now = now.Add(30 * time.Second)
+	expected = float64(30*(100+10*256)) / HASHRATE_WINDOW
+	if rate := h.Hashrate(); rate != expected {
+		t.Fatalf("Expected %f hashes per second, found %f", expected, rate)
+	}
+	now = now.Add(HASHRATE_WINDOW * time.Second)
+	if rate := h.Hashrate(); rate != 0 {
+		t.Fatalf("Expected no hashes, found %f", rate)
+	}
+}
+
+func TestScriberDrainToPlot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scriber")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plotStore := newTestPlotStore()
+	ledger, err := NewLedgerDisk(dir, false, false, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroKey := ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+
+	// a regtest thread where every ID satisfies the target
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+	plotroot := NewRepresentation(zeroKey, pubKey, 0, 0, 0, "")
+	genesis, err := NewPlot(PlotID{}, 0, target, PlotID{}, []*Representation{plotroot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis.Header.Time = time.Now().Unix() - 1000
+	genesisID, err := genesis.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := NewRepresentationQueueMemory(ledger)
+	processor := NewProcessor(genesisID, plotStore, queue, ledger)
+	processor.Run()
+	defer processor.Shutdown()
+	if err := processor.ProcessPlot(genesisID, genesis, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// fund the scriber by draining an empty queue first
+	scriber := NewScriber([]ed25519.PublicKey{pubKey}, "", plotStore, queue, ledger, processor, nil, 0)
+	if _, err := scriber.DrainToPlot(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// queue what its reward allows
+	var ids []RepresentationID
+	recipient, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := NewRepresentation(pubKey, recipient, 0, 0, 2, "")
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	id, err := tx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := processor.ProcessRepresentation(id, tx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	ids = append(ids, id)
+
+	plot, err := scriber.DrainToPlot(10 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the plot is the new tip and contains the queue
+	plotID, err := plot.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tipID, height, err := ledger.GetThreadTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *tipID != plotID || height != 2 {
+		t.Fatalf("Expected tip %s at height 2, found %s at height %d", plotID, *tipID, height)
+	}
+	if len(plot.Representations) != len(ids)+1 {
+		t.Fatalf("Expected %d representations, found %d", len(ids)+1, len(plot.Representations))
+	}
+	for i, id := range ids {
+		txID, err := plot.Representations[i+1].ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if txID != id {
+			t.Fatalf("Expected representation %s, found %s", id, txID)
+		}
+	}
+	if queue.Len() != 0 {
+		t.Fatalf("Expected the queue to be drained, found %d", queue.Len())
+	}
+
+	// a realistic difficulty is refused
+	targetBytes, err := hex.DecodeString(INITIAL_TARGET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hardTip := &PlotHeader{Height: 0, Time: genesis.Header.Time}
+	copy(hardTip.Target[:], targetBytes)
+	hardLedger, hardStore := newTestLedger(), newTestPlotStore()
+	hardLedger.heights[0] = PlotID{1}
+	hardStore.plots[PlotID{1}] = &Plot{Header: hardTip}
+	hardScriber := NewScriber([]ed25519.PublicKey{pubKey}, "", hardStore, NewRepresentationQueueMemory(hardLedger),
+		hardLedger, nil, nil, 0)
+	if _, err := hardScriber.DrainToPlot(time.Second); err == nil || !strings.Contains(err.Error(), "exceeds limit") {
+		t.Fatalf("Expected draining to be refused, found: %v", err)
+	}
+
+	// no tip yet is an error rather than a panic
+	emptyLedger := newTestLedger()
+	emptyScriber := NewScriber([]ed25519.PublicKey{pubKey}, "", newTestPlotStore(),
+		NewRepresentationQueueMemory(emptyLedger), emptyLedger, nil, nil, 0)
+	if _, err := emptyScriber.DrainToPlot(time.Second); err == nil {
+		t.Fatal("Expected draining without a tip to fail")
+	}
+}
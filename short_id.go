@@ -0,0 +1,90 @@
+package plotthread
+
+import (
+	"encoding/hex"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// SHORT_ID_LENGTH is the length in bytes of a short representation ID.
+const SHORT_ID_LENGTH = 6
+
+// ShortRepresentationID is an abbreviated representation ID used to relay plots compactly.
+// It's the first SHORT_ID_LENGTH bytes of the SHA3-256 hash of the plot's short ID salt
+// followed by the representation ID. Salting by plot means a collision between two
+// representations in one plot is unlikely to recur in another.
+type ShortRepresentationID [SHORT_ID_LENGTH]byte
+
+// ShortIDSalt is the per-plot key for computing short representation IDs.
+type ShortIDSalt [32]byte
+
+// ComputeShortIDSalt returns the salt for short representation IDs in the given plot.
+// It's the SHA3-256 hash of the plot ID followed by the ASCII string "short_id".
+func ComputeShortIDSalt(plotID PlotID) ShortIDSalt {
+	buf := make([]byte, 0, len(plotID)+8)
+	buf = append(buf, plotID[:]...)
+	buf = append(buf, "short_id"...)
+	return ShortIDSalt(sha3.Sum256(buf))
+}
+
+// ShortID computes the short ID for the representation ID with the given salt.
+func (salt ShortIDSalt) ShortID(id RepresentationID) ShortRepresentationID {
+	buf := make([]byte, 0, len(salt)+len(id))
+	buf = append(buf, salt[:]...)
+	buf = append(buf, id[:]...)
+	hash := sha3.Sum256(buf)
+	var shortID ShortRepresentationID
+	copy(shortID[:], hash[:])
+	return shortID
+}
+
+// MatchShortIDs matches each short ID to one of the candidate representations, e.g. from the queue.
+// It returns the matched representations in the same order as the short IDs. Any short ID without
+// exactly one matching candidate is left nil and its index is returned in missing. Those representations
+// must be requested in full. Colliding candidates are never guessed between.
+func MatchShortIDs(salt ShortIDSalt, shortIDs []ShortRepresentationID, candidates []*Representation) (
+	matched []*Representation, missing []int, err error) {
+	return matchShortIDs(salt.ShortID, shortIDs, candidates)
+}
+
+// Match short IDs computed by the given function
+func matchShortIDs(shortIDOf func(RepresentationID) ShortRepresentationID,
+	shortIDs []ShortRepresentationID, candidates []*Representation) (
+	matched []*Representation, missing []int, err error) {
+	// index the candidates by short ID noting any collisions
+	index := make(map[ShortRepresentationID]*Representation, len(candidates))
+	collisions := make(map[ShortRepresentationID]bool)
+	for _, tx := range candidates {
+		id, err := tx.ID()
+		if err != nil {
+			return nil, nil, err
+		}
+		shortID := shortIDOf(id)
+		if other, ok := index[shortID]; ok && other != tx {
+			otherID, err := other.ID()
+			if err != nil {
+				return nil, nil, err
+			}
+			if otherID != id {
+				collisions[shortID] = true
+			}
+		}
+		index[shortID] = tx
+	}
+
+	matched = make([]*Representation, len(shortIDs))
+	for i, shortID := range shortIDs {
+		tx, ok := index[shortID]
+		if !ok || collisions[shortID] {
+			missing = append(missing, i)
+			continue
+		}
+		matched[i] = tx
+	}
+	return matched, missing, nil
+}
+
+// String implements the Stringer interface.
+func (id ShortRepresentationID) String() string {
+	return hex.EncodeToString(id[:])
+}
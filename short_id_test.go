@@ -0,0 +1,86 @@
+package plotthread
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func makeShortIDTestRepresentations(t *testing.T, n int) ([]*Representation, []RepresentationID) {
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var txs []*Representation
+	var ids []RepresentationID
+	for i := 0; i < n; i++ {
+		tx := NewRepresentation(pubKey, pubKey, 0, 0, 0, "")
+		tx.Nonce = int32(i)
+		id, err := tx.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+		ids = append(ids, id)
+	}
+	return txs, ids
+}
+
+func TestShortIDSalt(t *testing.T) {
+	_, ids := makeShortIDTestRepresentations(t, 100)
+	salt1, salt2 := ComputeShortIDSalt(PlotID{1}), ComputeShortIDSalt(PlotID{2})
+	if salt1 == salt2 {
+		t.Fatal("Expected salts to differ by plot")
+	}
+	if salt1 != ComputeShortIDSalt(PlotID{1}) {
+		t.Fatal("Expected salt to be deterministic")
+	}
+
+	// the short IDs in one plot tell us nothing about those in another
+	var same int
+	for _, id := range ids {
+		if salt1.ShortID(id) == salt2.ShortID(id) {
+			same++
+		}
+	}
+	if same != 0 {
+		t.Fatalf("Expected short IDs to differ across plots, found %d the same", same)
+	}
+}
+
+func TestMatchShortIDs(t *testing.T) {
+	txs, ids := makeShortIDTestRepresentations(t, 4)
+	salt := ComputeShortIDSalt(PlotID{1})
+
+	// the plot has the first 3. we only know about the last 3
+	shortIDs := []ShortRepresentationID{salt.ShortID(ids[0]), salt.ShortID(ids[1]), salt.ShortID(ids[2])}
+	matched, missing, err := MatchShortIDs(salt, shortIDs, txs[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || missing[0] != 0 {
+		t.Fatalf("Expected only the first representation to be missing, found %v", missing)
+	}
+	if matched[0] != nil || matched[1] != txs[1] || matched[2] != txs[2] {
+		t.Fatal("Unexpected matches")
+	}
+
+	// the last collides with the first and the rest are unique
+	collide := func(id RepresentationID) ShortRepresentationID {
+		if id == ids[0] || id == ids[3] {
+			return ShortRepresentationID{1}
+		}
+		return salt.ShortID(id)
+	}
+	shortIDs = []ShortRepresentationID{collide(ids[0]), collide(ids[1])}
+	matched, missing, err = matchShortIDs(collide, shortIDs, txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || missing[0] != 0 || matched[0] != nil {
+		t.Fatal("Expected colliding short ID to require the full representation")
+	}
+	if matched[1] != txs[1] {
+		t.Fatal("Expected unique short ID to match")
+	}
+}
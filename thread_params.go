@@ -0,0 +1,81 @@
+package plotthread
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// ThreadParams are the plot thread's timing and representation parameters.
+type ThreadParams struct {
+	TargetSpacing        int64 `json:"target_spacing"`         // seconds between plots targeted by retargeting
+	MedianTimestampPlots int   `json:"median_timestamp_plots"` // plots whose median timestamp a new plot must exceed
+	MaxMemoLength        int   `json:"max_memo_length"`        // bytes of UTF-8, not characters
+	ReferencesHeight     int64 `json:"references_height"`      // plot height from which refers and content_hash are allowed
+}
+
+// DefaultThreadParams are the consensus parameters. Test networks may change them before starting.
+var DefaultThreadParams = ThreadParams{
+	TargetSpacing:        TARGET_SPACING,
+	MedianTimestampPlots: NUM_PLOTS_FOR_MEDIAN_TMESTAMP,
+	MaxMemoLength:        MAX_MEMO_LENGTH,
+	ReferencesHeight:     REFERENCES_ACTIVATION_HEIGHT,
+}
+
+// CheckMemo returns an error if the memo isn't valid UTF-8 or is longer than MaxMemoLength bytes.
+func (params ThreadParams) CheckMemo(memo string) error {
+	if !utf8.ValidString(memo) {
+		return fmt.Errorf("Memo contains invalid utf8 characters")
+	}
+	if len(memo) > params.MaxMemoLength {
+		return fmt.Errorf("Max memo length (%d) exceeded: %d", params.MaxMemoLength, len(memo))
+	}
+	return nil
+}
+
+// CheckReferences returns an error if the representation sets refers or content_hash in a plot before
+// ReferencesHeight. Both change a representation's ID so nodes which predate them can't validate
+// representations setting them until the network activates them.
+func (params ThreadParams) CheckReferences(tx *Representation, height int64) error {
+	if height >= params.ReferencesHeight {
+		return nil
+	}
+	if tx.Refers != nil {
+		return fmt.Errorf("Refers isn't allowed before height %d", params.ReferencesHeight)
+	}
+	if tx.ContentHash != nil {
+		return fmt.Errorf("Content hash isn't allowed before height %d", params.ReferencesHeight)
+	}
+	return nil
+}
+
+// MedianTimePast returns the median timestamp of the last MedianTimestampPlots plots ending with prevHeader.
+func (params ThreadParams) MedianTimePast(prevHeader *PlotHeader, plotStore PlotStorage) (int64, error) {
+	var timestamps []int64
+	var err error
+	for i := 0; i < params.MedianTimestampPlots; i++ {
+		timestamps = append(timestamps, prevHeader.Time)
+		prevHeader, _, err = plotStore.GetPlotHeader(prevHeader.Previous)
+		if err == ErrPlotNotFound {
+			// past genesis
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+	return timestamps[len(timestamps)/2], nil
+}
+
+// MinTime returns the earliest valid timestamp for a plot following prevHeader. It's one second past
+// the median time past.
+func (params ThreadParams) MinTime(prevHeader *PlotHeader, plotStore PlotStorage) (int64, error) {
+	medianTimestamp, err := params.MedianTimePast(prevHeader, plotStore)
+	if err != nil {
+		return 0, err
+	}
+	return medianTimestamp + 1, nil
+}
@@ -0,0 +1,146 @@
+package plotthread
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestThreadParamsMinTime(t *testing.T) {
+	plotStore := newTestPlotStore()
+
+	// 13 plots with out of order timestamps
+	times := []int64{100, 900, 200, 700, 300, 1100, 400, 500, 1000, 600, 1200, 800, 1300}
+	var prevID PlotID
+	var tip *PlotHeader
+	for height, time := range times {
+		header := &PlotHeader{Previous: prevID, Time: time, Height: int64(height)}
+		id, err := header.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		plotStore.Store(id, &Plot{Header: header}, 0)
+		prevID, tip = id, header
+	}
+
+	// the median of the last 11 (200 through 1300 less 100 and 900) is 700
+	params := DefaultThreadParams
+	medianTimePast, err := params.MedianTimePast(tip, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minTime, err := params.MinTime(tip, plotStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if medianTimePast != 700 || minTime != medianTimePast+1 {
+		t.Fatalf("Expected median time past 700 and min time 701, found %d and %d", medianTimePast, minTime)
+	}
+
+	// a shorter window
+	params.MedianTimestampPlots = 3
+	if minTime, err = params.MinTime(tip, plotStore); err != nil {
+		t.Fatal(err)
+	}
+	if minTime != 1201 {
+		t.Fatalf("Expected min time 1201, found %d", minTime)
+	}
+
+	// the window is truncated at genesis
+	params.MedianTimestampPlots = 100
+	if minTime, err = params.MinTime(tip, plotStore); err != nil {
+		t.Fatal(err)
+	}
+	if minTime != 701 {
+		t.Fatalf("Expected min time 701, found %d", minTime)
+	}
+}
+
+func TestThreadParamsCheckMemo(t *testing.T) {
+	params := DefaultThreadParams
+	if params.MaxMemoLength != MAX_MEMO_LENGTH {
+		t.Fatalf("Expected default max memo length %d, found %d", MAX_MEMO_LENGTH, params.MaxMemoLength)
+	}
+
+	cases := []struct {
+		maxMemoLength int
+		memo          string
+		ok            bool
+	}{
+		{MAX_MEMO_LENGTH, strings.Repeat("x", MAX_MEMO_LENGTH), true},
+		{MAX_MEMO_LENGTH, strings.Repeat("x", MAX_MEMO_LENGTH+1), false},
+		{MAX_MEMO_LENGTH, "\xff", false},
+		{100, strings.Repeat("x", 100), true},
+		{100, strings.Repeat("x", 101), false},
+		{MAX_MEMO_LENGTH + 100, strings.Repeat("x", MAX_MEMO_LENGTH+100), true},
+		// the length is in bytes. each of these is 2
+		{100, strings.Repeat("é", 50), true},
+		{100, strings.Repeat("é", 51), false},
+	}
+	for i, c := range cases {
+		params.MaxMemoLength = c.maxMemoLength
+		if err := params.CheckMemo(c.memo); (err == nil) != c.ok {
+			t.Fatalf("Case %d: expected ok to be %v, found: %v", i, c.ok, err)
+		}
+	}
+
+	// representation validation follows the parameter
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey2, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := NewRepresentation(pubKey, pubKey2, 0, 0, 0, strings.Repeat("x", MAX_MEMO_LENGTH+1))
+	if err := tx.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	id, err := tx.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRepresentation(id, tx); err == nil || !strings.Contains(err.Error(), "Max memo length") {
+		t.Fatalf("Expected memo length error, found: %v", err)
+	}
+	defer func(params ThreadParams) {
+		DefaultThreadParams = params
+	}(DefaultThreadParams)
+	DefaultThreadParams.MaxMemoLength = MAX_MEMO_LENGTH + 1
+	if err := checkRepresentation(id, tx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestThreadParamsCheckReferences(t *testing.T) {
+	params := DefaultThreadParams
+	if params.ReferencesHeight != REFERENCES_ACTIVATION_HEIGHT {
+		t.Fatalf("Expected default references height %d, found %d",
+			REFERENCES_ACTIVATION_HEIGHT, params.ReferencesHeight)
+	}
+
+	// not scheduled by default
+	refers := RepresentationID{0x01}
+	if err := params.CheckReferences(&Representation{Refers: &refers}, MAX_NUMBER-1); err == nil {
+		t.Fatal("Expected refers not to be active by default")
+	}
+
+	params.ReferencesHeight = 10
+
+	tx := NewRepresentation(nil, nil, 0, 0, 0, "")
+	if err := params.CheckReferences(tx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	contentHash := ContentHash{0x02}
+	for _, tx := range []*Representation{{Refers: &refers}, {ContentHash: &contentHash}} {
+		if err := params.CheckReferences(tx, 9); err == nil || !strings.Contains(err.Error(), "allowed before height 10") {
+			t.Fatalf("Expected activation error, found: %v", err)
+		}
+		if err := params.CheckReferences(tx, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package plotthread
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// VerifyThreadOptions controls how thoroughly VerifyThread checks the stored plot thread.
+type VerifyThreadOptions struct {
+	// Full enables signature verification and imbalance reconciliation.
+	// Otherwise only plot structure, linkage and proof-of-work are checked.
+	Full bool
+}
+
+// VerifyThread walks the main thread from height "from" to "to" inclusive verifying each stored plot.
+// It returns an error describing the first inconsistency found along with its height.
+// In full mode imbalances are replayed when starting from genesis and, if "to" is the current tip,
+// reconciled against the ledger.
+func VerifyThread(store PlotStorage, ledger Ledger, from, to int64, opts VerifyThreadOptions) error {
+	if from < 0 || to < from {
+		return fmt.Errorf("Invalid height range %d to %d", from, to)
+	}
+
+	// replayed imbalances are only meaningful from genesis
+	replay := opts.Full && from == 0
+	var imbalances map[[ed25519.PublicKeySize]byte]int64
+	plotroots := make(map[int64]*Representation)
+	if replay {
+		imbalances = make(map[[ed25519.PublicKeySize]byte]int64)
+	}
+
+	var prevID PlotID
+	var prevHeader *PlotHeader
+	if from > 0 {
+		id, err := ledger.GetPlotIDForHeight(from - 1)
+		if err != nil {
+			return err
+		}
+		if id == nil {
+			return fmt.Errorf("Height %d: no plot found", from-1)
+		}
+		prevID = *id
+		prevHeader, _, err = store.GetPlotHeader(prevID)
+		if err == ErrPlotNotFound {
+			return fmt.Errorf("Height %d: plot header %s not found", from-1, prevID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().Unix()
+	for height := from; height <= to; height++ {
+		id, err := ledger.GetPlotIDForHeight(height)
+		if err != nil {
+			return err
+		}
+		if id == nil {
+			return fmt.Errorf("Height %d: no plot found", height)
+		}
+		plot, err := store.GetPlot(*id)
+		if err == ErrPlotNotFound {
+			return fmt.Errorf("Height %d: plot %s not found", height, *id)
+		}
+		if err != nil {
+			return fmt.Errorf("Height %d: %s", height, err)
+		}
+
+		// structure and proof-of-work
+		plotID, err := plot.ID()
+		if err != nil {
+			return fmt.Errorf("Height %d: %s", height, err)
+		}
+		if plotID != *id {
+			return fmt.Errorf("Height %d: stored plot has ID %s, expected %s", height, plotID, *id)
+		}
+		if err := checkPlot(plotID, plot, now); err != nil {
+			return fmt.Errorf("Height %d: %s", height, err)
+		}
+		if plot.Header.Height != height {
+			return fmt.Errorf("Height %d: plot %s has height %d", height, *id, plot.Header.Height)
+		}
+
+		// linkage and cumulative work
+		if prevHeader != nil {
+			if plot.Header.Previous != prevID {
+				return fmt.Errorf("Height %d: plot %s previous %s, expected %s",
+					height, *id, plot.Header.Previous, prevID)
+			}
+			threadWork := computeThreadWork(plot.Header.Target, prevHeader.ThreadWork)
+			if plot.Header.ThreadWork != threadWork {
+				return fmt.Errorf("Height %d: plot %s thread work %s, expected %s",
+					height, *id, plot.Header.ThreadWork, threadWork)
+			}
+		}
+
+		if opts.Full {
+			if err := verifyThreadRepresentations(plot, imbalances, plotroots); err != nil {
+				return fmt.Errorf("Height %d: %s", height, err)
+			}
+		}
+
+		prevID, prevHeader = *id, plot.Header
+	}
+
+	if !replay {
+		return nil
+	}
+
+	// reconcile the replayed imbalances with the ledger if we've reached the tip
+	_, tipHeight, err := ledger.GetThreadTip()
+	if err != nil {
+		return err
+	}
+	if tipHeight != to {
+		return nil
+	}
+	var total int64
+	for pk, imbalance := range imbalances {
+		total += imbalance
+		ledgerImbalance, err := ledger.GetPublicKeyImbalance(ed25519.PublicKey(pk[:]))
+		if err != nil {
+			return err
+		}
+		if ledgerImbalance != imbalance {
+			return fmt.Errorf("Height %d: ledger imbalance %d for %s, expected %d",
+				to, ledgerImbalance, pubKeyToString(pk[:]), imbalance)
+		}
+	}
+	ledgerTotal, err := ledger.Imbalance()
+	if err != nil {
+		return err
+	}
+	if ledgerTotal != total {
+		return fmt.Errorf("Height %d: ledger total imbalance %d, expected %d", to, ledgerTotal, total)
+	}
+	return nil
+}
+
+// Verify signatures and, if imbalances is non-nil, replay the plot's effect on them
+// the same way the ledger applies it
+func verifyThreadRepresentations(plot *Plot, imbalances map[[ed25519.PublicKeySize]byte]int64,
+	plotroots map[int64]*Representation) error {
+	height := plot.Header.Height
+	for _, tx := range plot.Representations {
+		txID, err := tx.ID()
+		if err != nil {
+			return err
+		}
+
+		txToApply := tx
+		if tx.IsPlotroot() {
+			// plotroots are applied once they're mature
+			plotroots[height] = tx
+			txToApply = plotroots[height-PLOTROOT_MATURITY]
+			delete(plotroots, height-PLOTROOT_MATURITY)
+		} else {
+			ok, err := tx.Verify()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("Signature verification failed, representation: %s", txID)
+			}
+		}
+
+		if imbalances == nil || txToApply == nil {
+			continue
+		}
+		if !txToApply.IsPlotroot() {
+			var fpk [ed25519.PublicKeySize]byte
+			copy(fpk[:], txToApply.From)
+			if imbalances[fpk] < 1 {
+				return fmt.Errorf("Sender has insufficient imbalance in representation %s", txID)
+			}
+			imbalances[fpk] -= 1
+			if imbalances[fpk] == 0 {
+				delete(imbalances, fpk)
+			}
+		}
+		var tpk [ed25519.PublicKeySize]byte
+		copy(tpk[:], txToApply.To)
+		imbalances[tpk] += 1
+	}
+	return nil
+}
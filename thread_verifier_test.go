@@ -0,0 +1,126 @@
+package plotthread
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// makeTestThread stores a short valid thread and returns the ledger and storage for it
+func makeTestThread(t *testing.T) (*testLedger, *testPlotStore, ed25519.PublicKey, ed25519.PublicKey) {
+	// create a scriber and a recipient
+	scriberPubKey, scriberPrivKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every ID satisfies this target
+	var target PlotID
+	for i := range target {
+		target[i] = 0xff
+	}
+
+	ledger := newTestLedger()
+	plotStore := newTestPlotStore()
+
+	var prevID, threadWork PlotID
+	for height := int64(0); height < 4; height++ {
+		plotroot := NewRepresentation(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)),
+			scriberPubKey, 0, 0, height, "")
+		txs := []*Representation{plotroot}
+		if height == 2 {
+			// spend the matured reward from genesis
+			tx := NewRepresentation(scriberPubKey, pubKey, 0, 0, height, "")
+			if err := tx.Sign(scriberPrivKey); err != nil {
+				t.Fatal(err)
+			}
+			txs = append(txs, tx)
+		}
+		plot, err := NewPlot(prevID, height, target, threadWork, txs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := plot.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		plotStore.Store(id, plot, 0)
+		ledger.heights[height] = id
+		prevID, threadWork = id, plot.Header.ThreadWork
+	}
+
+	// 3 plotroots have matured and 1 was spent
+	ledger.setImbalance(scriberPubKey, 2)
+	ledger.setImbalance(pubKey, 1)
+	return ledger, plotStore, scriberPubKey, pubKey
+}
+
+func TestVerifyThread(t *testing.T) {
+	ledger, plotStore, _, _ := makeTestThread(t)
+	for _, full := range []bool{false, true} {
+		if err := VerifyThread(plotStore, ledger, 0, 3, VerifyThreadOptions{Full: full}); err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyThread(plotStore, ledger, 1, 2, VerifyThreadOptions{Full: full}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyThreadCorruptPlot(t *testing.T) {
+	ledger, plotStore, _, _ := makeTestThread(t)
+
+	// corrupt the plot at height 2
+	plot := plotStore.plots[ledger.heights[2]]
+	plot.Representations[1].Memo = "corrupt"
+
+	err := VerifyThread(plotStore, ledger, 0, 3, VerifyThreadOptions{})
+	if err == nil {
+		t.Fatal("Expected corrupt plot to be detected")
+	}
+	if !strings.HasPrefix(err.Error(), "Height 2:") {
+		t.Fatalf("Expected failure at height 2, found: %s", err)
+	}
+
+	// nothing is wrong before it
+	if err := VerifyThread(plotStore, ledger, 0, 1, VerifyThreadOptions{Full: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyThreadBadSignature(t *testing.T) {
+	ledger, plotStore, _, _ := makeTestThread(t)
+
+	// replace the signature. it isn't part of the ID so the hash list root still matches
+	plot := plotStore.plots[ledger.heights[2]]
+	plot.Representations[1].Signature = make(Signature, ed25519.SignatureSize)
+	plot.Representations[1].Signature[0] = 1
+
+	// structure is still intact
+	if err := VerifyThread(plotStore, ledger, 0, 3, VerifyThreadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err := VerifyThread(plotStore, ledger, 0, 3, VerifyThreadOptions{Full: true})
+	if err == nil || !strings.HasPrefix(err.Error(), "Height 2:") {
+		t.Fatalf("Expected signature failure at height 2, found: %v", err)
+	}
+}
+
+func TestVerifyThreadImbalanceMismatch(t *testing.T) {
+	ledger, plotStore, _, pubKey := makeTestThread(t)
+	ledger.setImbalance(pubKey, 2)
+
+	// fast mode doesn't look at imbalances
+	if err := VerifyThread(plotStore, ledger, 0, 3, VerifyThreadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err := VerifyThread(plotStore, ledger, 0, 3, VerifyThreadOptions{Full: true})
+	if err == nil || !strings.Contains(err.Error(), "imbalance") {
+		t.Fatalf("Expected imbalance mismatch, found: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package plotthread
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// TipWatchdog warns when no plot has been connected to the main thread for a configurable multiple
+// of the target spacing, e.g. because the node is isolated or the network has stalled. It calls a
+// handler when the tip goes stale and again each time the same period passes while it stays stale.
+type TipWatchdog struct {
+	processor    *Processor
+	ledger       Ledger
+	timeout      time.Duration
+	onStale      func(tipID *PlotID, height int64, since time.Duration)
+	now          func() time.Time
+	lastTip      time.Time // when the tip last advanced
+	lastAlert    time.Time
+	lock         sync.Mutex
+	shutdownChan chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewTipWatchdog returns a new TipWatchdog which calls onStale with the current tip and how long
+// ago it advanced when it hasn't for "multiple" times the target spacing. The multiple must be
+// positive. onStale may be nil in which case the watchdog only logs.
+func NewTipWatchdog(processor *Processor, ledger Ledger, multiple float64,
+	onStale func(tipID *PlotID, height int64, since time.Duration)) *TipWatchdog {
+	return &TipWatchdog{
+		processor:    processor,
+		ledger:       ledger,
+		timeout:      time.Duration(multiple * float64(DefaultThreadParams.TargetSpacing) * float64(time.Second)),
+		onStale:      onStale,
+		now:          time.Now,
+		lastTip:      time.Now(),
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+// Run executes the watchdog's main loop in its own goroutine.
+func (w *TipWatchdog) Run() {
+	w.wg.Add(1)
+	go w.run()
+}
+
+func (w *TipWatchdog) run() {
+	defer w.wg.Done()
+
+	// register for tip changes
+	tipChangeChan := make(chan TipChange, 1)
+	w.processor.RegisterForTipChange(tipChangeChan)
+	defer w.processor.UnregisterForTipChange(tipChangeChan)
+
+	interval := w.timeout / 4
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case tip := <-tipChangeChan:
+			if tip.Connect {
+				w.onTipAdvanced()
+			}
+		case <-ticker.C:
+			w.check()
+		case _, ok := <-w.shutdownChan:
+			if !ok {
+				log.Println("Tip watchdog shutting down...")
+				return
+			}
+		}
+	}
+}
+
+// Note that the tip advanced
+func (w *TipWatchdog) onTipAdvanced() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.lastTip = w.now()
+}
+
+// Check if the tip is stale and call the handler if so. Returns true if it was called
+func (w *TipWatchdog) check() bool {
+	w.lock.Lock()
+	now := w.now()
+	since := now.Sub(w.lastTip)
+	if since < w.timeout || now.Sub(w.lastAlert) < w.timeout {
+		w.lock.Unlock()
+		return false
+	}
+	w.lastAlert = now
+	w.lock.Unlock()
+
+	tipID, height, err := w.ledger.GetThreadTip()
+	if err != nil {
+		log.Printf("Error: %s\n", err)
+		return false
+	}
+	log.Printf("Warning: tip %s at height %d hasn't advanced in %s\n", tipID, height, since.Round(time.Second))
+	if w.onStale != nil {
+		w.onStale(tipID, height, since)
+	}
+	return true
+}
+
+// Shutdown stops the watchdog synchronously.
+func (w *TipWatchdog) Shutdown() {
+	close(w.shutdownChan)
+	w.wg.Wait()
+	log.Println("Tip watchdog shutdown")
+}
@@ -0,0 +1,68 @@
+package plotthread
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTipWatchdog(t *testing.T) {
+	ledger := newTestLedger()
+	ledger.heights[0] = PlotID{0x01}
+
+	var alerts []time.Duration
+	watchdog := NewTipWatchdog(nil, ledger, 2, func(tipID *PlotID, height int64, since time.Duration) {
+		if tipID == nil || *tipID != ledger.heights[0] || height != 0 {
+			t.Fatalf("Expected the current tip, found %v at height %d", tipID, height)
+		}
+		alerts = append(alerts, since)
+	})
+
+	// control the clock
+	now := time.Unix(1000000, 0)
+	watchdog.now = func() time.Time { return now }
+	watchdog.onTipAdvanced()
+	timeout := 2 * TARGET_SPACING * time.Second
+
+	// not stale yet
+	now = now.Add(timeout - time.Second)
+	if watchdog.check() {
+		t.Fatal("Expected the tip not to be stale yet")
+	}
+
+	// stale
+	now = now.Add(time.Second)
+	if !watchdog.check() || len(alerts) != 1 || alerts[0] != timeout {
+		t.Fatalf("Expected an alert after %s, found: %v", timeout, alerts)
+	}
+
+	// not again until another period passes
+	now = now.Add(timeout / 2)
+	if watchdog.check() {
+		t.Fatal("Expected no repeated alert yet")
+	}
+	now = now.Add(timeout / 2)
+	if !watchdog.check() || len(alerts) != 2 || alerts[1] != 2*timeout {
+		t.Fatalf("Expected a repeated alert after %s, found: %v", 2*timeout, alerts)
+	}
+
+	// a new plot resets it
+	watchdog.onTipAdvanced()
+	now = now.Add(timeout - time.Second)
+	if watchdog.check() {
+		t.Fatal("Expected the tip not to be stale after advancing")
+	}
+	now = now.Add(time.Second)
+	if !watchdog.check() || len(alerts) != 3 {
+		t.Fatalf("Expected another alert, found: %v", alerts)
+	}
+}
+
+func TestTipWatchdogTargetSpacing(t *testing.T) {
+	defer func(params ThreadParams) { DefaultThreadParams = params }(DefaultThreadParams)
+	DefaultThreadParams.TargetSpacing = 30
+
+	watchdog := NewTipWatchdog(nil, newTestLedger(), 2, nil)
+	if watchdog.timeout != time.Minute {
+		t.Fatalf("Expected a timeout of %s, found %s", time.Minute, watchdog.timeout)
+	}
+}